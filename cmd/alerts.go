@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newAlertsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alerts",
+		Short: "Inspect and check the alert rules",
+		Long: `Alert rules are declared under alerts in the configuration file and evaluated
+against every snapshot that fetch --store, fetch-all and watch store:
+
+  stalled    a release got no downloads within window (default 72h)
+  drop       downloads per day over window (default 24h) fell more than
+             percent (default 50) below the baseline (default 168h) before it
+  threshold  a release reached threshold downloads, optionally only
+             releases created within max_age
+
+Each rule keeps its state per repository or release in the database, so a
+condition that holds across many snapshots is notified once when it starts
+firing and once when it resolves. Notifications are posted to the notifiers
+declared in the configuration file as generic JSON webhooks or in the Slack,
+Discord or Microsoft Teams payload formats.`,
+	}
+
+	cmd.AddCommand(newAlertsListCmd())
+	cmd.AddCommand(newAlertsCheckCmd())
+	cmd.AddCommand(newAlertsTestCmd())
+	return cmd
+}
+
+func newAlertsListCmd() *cobra.Command {
+	var dbPath string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List firing alerts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			state := internal.AlertFiring
+			if all {
+				state = ""
+			}
+			alerts, err := db.ListAlerts(state)
+			if err != nil {
+				return err
+			}
+			return renderReport(cmd, &internal.AlertsReport{Alerts: alerts})
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().BoolVar(&all, "all", false, "Also list resolved alerts")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
+
+func newAlertsCheckCmd() *cobra.Command {
+	var dbPath string
+	var group string
+	var notify bool
+
+	cmd := &cobra.Command{
+		Use:   "check [<owner/repo|alias>]...",
+		Short: "Evaluate the alert rules against the stored snapshots",
+		Long: `Evaluate the alert rules against the newest stored snapshot of each
+repository, as fetch --store does, and list the alerts that started firing or
+resolved, including earlier changes whose notification failed. Without
+arguments, every tracked repository is checked.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			engine, err := newAlertEngine(cmd, db)
+			if err != nil {
+				return err
+			}
+			if !engine.Enabled() {
+				return fmt.Errorf("no alert rules: declare them under alerts in the configuration file")
+			}
+
+			var repos []trackedRepo
+			if len(args) == 0 {
+				if repos, err = trackedRepos(cmd, db, group); err != nil {
+					return err
+				}
+			}
+			for _, arg := range args {
+				owner, repo, err := resolveRepoName(cmd, arg)
+				if err != nil {
+					return err
+				}
+				repos = append(repos, trackedRepo{owner: owner, repo: repo})
+			}
+
+			report := &internal.AlertsReport{Alerts: []internal.Alert{}}
+			for _, r := range repos {
+				changed, err := engine.Evaluate(r.owner, r.repo)
+				if err != nil {
+					return fmt.Errorf("%s/%s: %w", r.owner, r.repo, err)
+				}
+				report.Alerts = append(report.Alerts, changed...)
+			}
+			// Without --notify the changes count as notified; otherwise those
+			// that failed are posted again by the next check
+			notified, notifyErr := report.Alerts, error(nil)
+			if notify {
+				notified, notifyErr = engine.Notify(cmd.Context(), report.Alerts)
+			}
+			if err := engine.MarkNotified(notified); err != nil {
+				return err
+			}
+			if err := renderReport(cmd, report); err != nil {
+				return err
+			}
+			return notifyErr
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&group, "group", "", "Only check configured repositories in this group")
+	cmd.Flags().BoolVar(&notify, "notify", true, "Post state changes to the notifiers")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
+
+func newAlertsTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test <notifier>",
+		Short: "Post a test notification",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			notifiers, err := internal.NewNotifiers(configFrom(cmd).Notifiers, notifyClient())
+			if err != nil {
+				return err
+			}
+			n, ok := notifiers[args[0]]
+			if !ok {
+				return fmt.Errorf("unknown notifier %q", args[0])
+			}
+
+			err = n.Notify(cmd.Context(), internal.Notification{
+				Kind:   "test",
+				Status: internal.NotificationInfo,
+				Title:  "Test notification",
+				Text:   "git-download-stats can post to this notifier.",
+				Time:   time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+			notice(cmd, "✓ Posted a test notification to %s\n", n)
+			return nil
+		},
+	}
+	return cmd
+}
+
+// notifyClient is the HTTP client notifications are posted with.
+func notifyClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// newAlertEngine returns the engine for the alert rules in the
+// configuration file.
+func newAlertEngine(cmd *cobra.Command, db *internal.Database) (*internal.AlertEngine, error) {
+	return internal.NewAlertEngine(db, configFrom(cmd), notifyClient())
+}
+
+// logAlerts logs alert state changes.
+func logAlerts(alerts []internal.Alert) {
+	for _, a := range alerts {
+		log.Printf("%s/%s: alert %s %s: %s", a.Owner, a.Repo, a.Rule, a.State, a.Message)
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newAnomaliesCmd() *cobra.Command {
+	var dbPath string
+	var days int
+	var window int
+	var threshold float64
+	var minDownloads int
+	var tagGlob string
+	var assetGlob string
+	var mark bool
+	var unmark bool
+
+	cmd := &cobra.Command{
+		Use:   "anomalies <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Flag abnormal download spikes per asset",
+		Long: `Flag the intervals between stored snapshots in which an asset's downloads
+jumped abnormally, e.g. because a CI system downloads the same binary over
+and over.
+
+Each interval's downloads per day are compared with the median rate of the
+preceding --window intervals. The distance is a robust z-score: it is scaled
+by the median absolute deviation, so earlier spikes do not inflate the
+baseline. An interval is flagged when its score exceeds --threshold and it
+got at least --min-downloads more downloads than the baseline rate explains.
+
+trend and forecast leave the excess downloads of flagged spikes out unless
+they are run with --keep-anomalies. --mark stores the spikes in the
+database, so that they stay excluded when the history that revealed them
+falls outside the range analysed, or is detected with other settings.
+--unmark removes the marks whose interval ends within --days and whose tag
+and asset match --tag and --asset. Defaults come from the anomalies section
+of the configuration file.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			opts := configFrom(cmd).Anomalies
+			if flagConfigured(cmd, "window") {
+				opts.Window = window
+			}
+			if flagConfigured(cmd, "threshold") {
+				opts.Threshold = threshold
+			}
+			if flagConfigured(cmd, "min-downloads") {
+				opts.MinDownloads = minDownloads
+			}
+			if err := opts.Validate(); err != nil {
+				return err
+			}
+			if assetGlob != "" && !unmark {
+				return fmt.Errorf("--asset only applies to --unmark")
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			end := time.Now()
+			if unmark {
+				n, err := db.UnmarkAnomalies(owner, repo, tagGlob, assetGlob, end.AddDate(0, 0, -days), end)
+				if err != nil {
+					return err
+				}
+				notice(cmd, "✓ Unmarked %d download spikes of %s/%s\n", n, owner, repo)
+			}
+
+			snapshots, err := db.GetStatsBetween(owner, repo, end.AddDate(0, 0, -days), end)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve stats: %w", err)
+			}
+
+			filter := internal.ReleaseFilter{TagGlob: tagGlob}
+			for i := range snapshots {
+				filtered, err := filter.Apply(&snapshots[i])
+				if err != nil {
+					return err
+				}
+				snapshots[i] = *filtered
+			}
+
+			anomalies, err := db.FindAnomalies(owner, repo, snapshots, opts)
+			if err != nil {
+				return err
+			}
+			if mark {
+				if err := db.MarkAnomalies(owner, repo, anomalies); err != nil {
+					return err
+				}
+				for i := range anomalies {
+					anomalies[i].Marked = true
+				}
+				notice(cmd, "✓ Marked %d download spikes of %s/%s\n", len(anomalies), owner, repo)
+			}
+
+			return renderReport(cmd, internal.NewAnomaliesReport(owner, repo, opts, anomalies))
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().IntVar(&days, "days", 90, "Number of days of history to analyse")
+	cmd.Flags().IntVar(&window, "window", 14, "Number of preceding intervals in the baseline")
+	cmd.Flags().Float64Var(&threshold, "threshold", 3.5, "Robust z-score above which an interval is a spike")
+	cmd.Flags().IntVar(&minDownloads, "min-downloads", 100, "Smallest number of downloads above the baseline to flag")
+	cmd.Flags().StringVar(&tagGlob, "tag", "", "Only include releases whose tag matches this glob (e.g. 'v2.*')")
+	cmd.Flags().BoolVar(&mark, "mark", false, "Mark the spikes found in the database")
+	cmd.Flags().StringVar(&assetGlob, "asset", "", "Only unmark spikes of assets whose name matches this glob (with --unmark)")
+	cmd.Flags().BoolVar(&unmark, "unmark", false, "Remove the marked spikes within --days matching --tag and --asset first (with --mark, replaces them)")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
+
+// excludeAnomalies removes the download spikes that anomalies finds in
+// snapshots, or has marked, and tells the user how many there were.
+func excludeAnomalies(cmd *cobra.Command, db *internal.Database, owner, repo string, snapshots []internal.ReleaseStats) ([]internal.ReleaseStats, error) {
+	anomalies, err := db.FindAnomalies(owner, repo, snapshots, configFrom(cmd).Anomalies)
+	if err != nil {
+		return nil, err
+	}
+	if len(anomalies) == 0 {
+		return snapshots, nil
+	}
+	notice(cmd, "Excluded %d download spikes (see anomalies; --keep-anomalies includes them)\n", len(anomalies))
+	return internal.ExcludeAnomalies(snapshots, anomalies), nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newBadgeCmd() *cobra.Command {
+	var dbPath string
+	var opts internal.BadgeOptions
+	var metric string
+	var style string
+	var outPath string
+
+	cmd := &cobra.Command{
+		Use:   "badge <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Render a download-count badge as SVG",
+		Long: `Render a shields.io-style SVG badge from the newest stored snapshot.
+
+--metric selects the count: total downloads, downloads of the latest release
+(or --tag), downloads over the 30 days before the newest snapshot, or the
+downloads of the assets of the latest release (or --tag) matching --asset.
+
+Colours are shields.io names (brightgreen, blue, orange, ...) or hex values.
+The same badges are served over HTTP at /badge/{owner}/{repo}/{metric}.svg by
+serve and watch --health-addr.`,
+		Example: `  git-download-stats badge cli/cli --out downloads.svg
+  git-download-stats badge cli/cli --metric monthly --color blue
+  git-download-stats badge cli/cli --metric asset --asset '*_linux_amd64.tar.gz' --label linux`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+			if opts.Metric, err = internal.ParseBadgeMetric(metric); err != nil {
+				return err
+			}
+			if opts.Style, err = internal.ParseBadgeStyle(style); err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			badge, err := internal.BuildBadge(db, owner, repo, opts)
+			if err != nil {
+				return err
+			}
+
+			if outPath == "" || outPath == "-" {
+				return badge.WriteSVG(cmd.OutOrStdout())
+			}
+			f, err := os.Create(outPath)
+			if err != nil {
+				return fmt.Errorf("failed to create badge file: %w", err)
+			}
+			if err := badge.WriteSVG(f); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write badge file: %w", err)
+			}
+			notice(cmd, "✓ Badge written to %s (%s: %s)\n", outPath, badge.Label, badge.Message)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&metric, "metric", "total", "Count shown: total, latest, monthly or asset")
+	cmd.Flags().StringVar(&opts.Tag, "tag", "", "Release for the latest and asset metrics (default: latest release)")
+	cmd.Flags().StringVar(&opts.Asset, "asset", "", "Asset name or glob for the asset metric")
+	cmd.Flags().StringVar(&opts.Label, "label", "", "Left-hand text (default: downloads)")
+	cmd.Flags().StringVar(&opts.Color, "color", "", "Message colour: a shields.io name or hex (default: brightgreen)")
+	cmd.Flags().StringVar(&opts.LabelColor, "label-color", "", "Label colour: a shields.io name or hex (default: grey)")
+	cmd.Flags().StringVar(&style, "style", "flat", "Badge style: flat or flat-square")
+	cmd.Flags().StringVar(&outPath, "out", "", "Output file (default: stdout)")
+
+	return cmd
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newBaselineCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "baseline",
+		Short: "Name snapshots for use with compare",
+		Long: `Name stored snapshots, such as the state of a repository on a launch day, so
+compare --from and --to can refer to them by name.`,
+	}
+
+	var dbPath string
+	var at string
+
+	setCmd := &cobra.Command{
+		Use:   "set <owner/repo|alias> <name>",
+		Short: "Name a snapshot, the latest one by default",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepoName(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			name := args[1]
+			if err := internal.ValidateBaselineName(name); err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			stats, err := db.ResolveSnapshot(owner, repo, at)
+			if err != nil {
+				return err
+			}
+			if err := db.SetBaseline(owner, repo, name, stats.FetchedAt); err != nil {
+				return err
+			}
+
+			notice(cmd, "✓ Baseline %q set to snapshot %d of %s/%s (%s)\n",
+				name, stats.SnapshotID, owner, repo, stats.FetchedAt.Format("2006-01-02 15:04"))
+			return nil
+		},
+	}
+	setCmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	setCmd.Flags().StringVar(&at, "at", internal.LatestRef, "Snapshot to name: latest, a date, a snapshot ID or another baseline")
+
+	listCmd := &cobra.Command{
+		Use:   "list <owner/repo|alias>",
+		Short: "List the baselines of a repository",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepoName(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			baselines, err := db.ListBaselines(owner, repo)
+			if err != nil {
+				return err
+			}
+
+			return renderReport(cmd, &internal.BaselinesReport{Owner: owner, Repo: repo, Baselines: baselines})
+		},
+	}
+	listCmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <owner/repo|alias> <name>",
+		Short: "Delete a baseline; the snapshot is kept",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepoName(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			removed, err := db.DeleteBaseline(owner, repo, args[1])
+			if err != nil {
+				return err
+			}
+			if !removed {
+				return fmt.Errorf("no baseline %q for %s/%s", args[1], owner, repo)
+			}
+
+			notice(cmd, "✓ Deleted baseline %q of %s/%s\n", args[1], owner, repo)
+			return nil
+		},
+	}
+	deleteCmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+
+	cmd.AddCommand(setCmd, listCmd, deleteCmd)
+	return cmd
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newChartCmd() *cobra.Command {
+	var dbPath string
+	var data string
+	var kind string
+	var days int
+	var top int
+	var by string
+	var period string
+	var tagGlob string
+	var theme string
+	var size string
+	var title string
+	var annotations []string
+	var releaseMarkers bool
+	var outPath string
+
+	cmd := &cobra.Command{
+		Use:   "chart <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Render stored history as an SVG chart",
+		Long: `Render stored history as a standalone SVG chart.
+
+--data selects what is drawn: the repository total, cumulative downloads per
+release, or cumulative downloads per platform bucket (see the platforms
+command). Line charts draw each series on its own, area charts stack them,
+and bar charts stack the downloads of each --period.
+
+Charts are deterministic: the same data, flags and theme produce the same
+file, so generated charts can be committed alongside a README.`,
+		Example: `  git-download-stats chart cli/cli --out downloads.svg
+  git-download-stats chart cli/cli --data releases --kind area --top 8 --theme dark --size slide
+  git-download-stats chart cli/cli --data platforms --kind bar --period month --annotate 2025-03-01=v3.0`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			chartKind, err := internal.ParseChartKind(kind)
+			if err != nil {
+				return err
+			}
+			chartTheme, err := internal.ParseChartTheme(theme)
+			if err != nil {
+				return err
+			}
+			width, height, err := internal.ParseChartSize(size)
+			if err != nil {
+				return err
+			}
+			trendPeriod, err := internal.ParseTrendPeriod(period)
+			if err != nil {
+				return err
+			}
+			marks := make([]internal.Annotation, 0, len(annotations))
+			for _, a := range annotations {
+				mark, err := internal.ParseAnnotation(a)
+				if err != nil {
+					return err
+				}
+				marks = append(marks, mark)
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			end := time.Now()
+			snapshots, err := db.GetStatsBetween(owner, repo, end.AddDate(0, 0, -days), end)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve stats: %w", err)
+			}
+			if len(snapshots) < 2 {
+				notice(cmd, "Need at least 2 snapshots in the last %d days to draw a chart\n", days)
+				return nil
+			}
+
+			filter := internal.ReleaseFilter{TagGlob: tagGlob}
+			for i := range snapshots {
+				filtered, err := filter.Apply(&snapshots[i])
+				if err != nil {
+					return err
+				}
+				snapshots[i] = *filtered
+			}
+
+			stacked := chartKind != internal.ChartLine
+			var series []internal.Series
+			var subject string
+			switch data {
+			case "total":
+				series = internal.ExtractSeries(snapshots, internal.SeriesRepo)
+				subject = "Total downloads"
+			case "releases":
+				series = internal.TopSeries(internal.ExtractSeries(snapshots, internal.SeriesRelease), top, stacked)
+				subject = "Downloads by release"
+			case "platforms":
+				dimension, err := internal.ParsePlatformDimension(by)
+				if err != nil {
+					return err
+				}
+				classifier, err := internal.NewPlatformClassifier(configFrom(cmd).Platforms)
+				if err != nil {
+					return err
+				}
+				series = internal.TopSeries(internal.PlatformSeries(snapshots, classifier, dimension), top, stacked)
+				subject = fmt.Sprintf("Downloads by %s", dimension)
+			default:
+				return fmt.Errorf("unknown --data %q (want total, releases or platforms)", data)
+			}
+			if chartKind == internal.ChartBar {
+				subject += " per " + string(trendPeriod)
+			}
+
+			if releaseMarkers {
+				// The newest snapshot knows every release still published
+				for _, rel := range snapshots[0].Releases {
+					marks = append(marks, internal.Annotation{Time: rel.CreatedAt, Label: rel.Tag})
+				}
+			}
+
+			oldest, newest := snapshots[len(snapshots)-1].FetchedAt, snapshots[0].FetchedAt
+			chart := &internal.SVGChart{
+				Title:       title,
+				Subtitle:    fmt.Sprintf("%s, %s to %s", subject, oldest.Format("2006-01-02"), newest.Format("2006-01-02")),
+				Kind:        chartKind,
+				Theme:       chartTheme,
+				Width:       width,
+				Height:      height,
+				Series:      series,
+				Period:      trendPeriod,
+				Annotations: marks,
+			}
+			if chart.Title == "" {
+				chart.Title = owner + "/" + repo
+			}
+
+			if outPath == "" || outPath == "-" {
+				return chart.WriteSVG(cmd.OutOrStdout())
+			}
+			f, err := os.Create(outPath)
+			if err != nil {
+				return fmt.Errorf("failed to create chart file: %w", err)
+			}
+			if err := chart.WriteSVG(f); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write chart file: %w", err)
+			}
+			notice(cmd, "✓ Chart written to %s\n", outPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&data, "data", "total", "What to draw: total, releases or platforms")
+	cmd.Flags().StringVar(&kind, "kind", "line", "Chart kind: line, area or bar")
+	cmd.Flags().IntVar(&days, "days", 90, "Number of days of history to draw")
+	cmd.Flags().IntVar(&top, "top", 6, "Number of releases or platform buckets drawn; stacked charts sum the rest as \"other\" (0 for all)")
+	cmd.Flags().StringVar(&by, "by", "os", "Platform dimension for --data platforms: os, arch, package or platform")
+	cmd.Flags().StringVar(&period, "period", "week", "Bar chart period: day, week or month")
+	cmd.Flags().StringVar(&tagGlob, "tag", "", "Only include releases whose tag matches this glob (e.g. 'v2.*')")
+	cmd.Flags().StringVar(&theme, "theme", "light", "Colour theme: light, dark, mono or transparent")
+	cmd.Flags().StringVar(&size, "size", "readme", "Size: readme (800x400), slide (1600x900), square (800x800) or WIDTHxHEIGHT")
+	cmd.Flags().StringVar(&title, "title", "", "Chart title (default: owner/repo)")
+	cmd.Flags().StringArrayVar(&annotations, "annotate", nil, "Mark a date on the chart: YYYY-MM-DD=label (repeatable)")
+	cmd.Flags().BoolVar(&releaseMarkers, "release-markers", false, "Mark the creation date of each release")
+	cmd.Flags().StringVar(&outPath, "out", "", "Output file (default: stdout)")
+
+	return cmd
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/jibel/git-download-stats/internal"
@@ -15,90 +18,188 @@ func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "git-download-stats",
 		Short: "Fetch and store GitHub release download statistics",
-		Long:  "Fetch and store GitHub release download statistics with SQLite persistence",
+		Long: `Fetch and store GitHub release download statistics with SQLite persistence.
+
+Repositories can be given as "<owner> <repo>", "<owner/repo>" or an alias from
+the configuration file (default ~/.config/git-download-stats/config.yaml).`,
+		PersistentPreRunE: loadConfig,
 	}
 
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "Output format: table, json, yaml, csv or markdown")
+	rootCmd.PersistentFlags().String("charts", "auto", "Charts in table output: auto, unicode, ascii or none")
+	rootCmd.PersistentFlags().String("config", "", "Configuration file (default: ~/.config/git-download-stats/config.yaml)")
+
 	rootCmd.AddCommand(newFetchCmd())
 	rootCmd.AddCommand(newShowCmd())
 	rootCmd.AddCommand(newHistoryCmd())
 	rootCmd.AddCommand(newCompareCmd())
+	rootCmd.AddCommand(newBaselineCmd())
+	rootCmd.AddCommand(newCompareReposCmd())
+	rootCmd.AddCommand(newLeaderboardCmd())
+	rootCmd.AddCommand(newTrendCmd())
+	rootCmd.AddCommand(newForecastCmd())
+	rootCmd.AddCommand(newAnomaliesCmd())
+	rootCmd.AddCommand(newPlatformsCmd())
+	rootCmd.AddCommand(newChartCmd())
+	rootCmd.AddCommand(newReportCmd())
+	rootCmd.AddCommand(newBadgeCmd())
+	rootCmd.AddCommand(newServeCmd())
+	rootCmd.AddCommand(newMetricsCmd())
+	rootCmd.AddCommand(newPushCmd())
+	rootCmd.AddCommand(newAlertsCmd())
+	rootCmd.AddCommand(newMilestonesCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newWatchCmd())
+	rootCmd.AddCommand(newTrackCmd())
+	rootCmd.AddCommand(newUntrackCmd())
+	rootCmd.AddCommand(newTrackedCmd())
+	rootCmd.AddCommand(newFetchAllCmd())
 
 	return rootCmd
 }
 
 func newFetchCmd() *cobra.Command {
-	var ghToken string
 	var store bool
 	var dbPath string
+	var detailed bool
+	var diffLast bool
 
 	cmd := &cobra.Command{
-		Use:   "fetch <owner> <repo>",
+		Use:   "fetch <owner> <repo> | <owner/repo> | <alias>",
 		Short: "Fetch GitHub release download statistics",
-		Args:  cobra.ExactArgs(2),
+		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ghOwner := args[0]
-			ghRepo := args[1]
+			ghOwner, ghRepo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			if !store && cmd.Flags().Changed("push") {
+				return fmt.Errorf("--push requires --store")
+			}
+
+			var db *internal.Database
+			var hooks *storeHooks
+			if store || diffLast {
+				db, err = openDatabase(cmd, dbPath)
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+			}
+			if store {
+				if hooks, err = newStoreHooks(cmd, db); err != nil {
+					return err
+				}
+			}
+
+			fetcher, err := newRepoFetcher(cmd, nil, ghOwner, ghRepo)
+			if err != nil {
+				return err
+			}
 
-			stats, err := internal.FetchReleaseStats(cmd.Context(), ghOwner, ghRepo, ghToken)
+			started := time.Now()
+			stats, err := fetcher.FetchReleaseStats(cmd.Context(), ghOwner, ghRepo)
 			if err != nil {
+				// Record the failure on the watchlist so tracked list shows it
+				if store {
+					_ = recordFetch(db, fetcher, ghOwner, ghRepo, started, err)
+				}
 				return err
 			}
 
 			if len(stats.Releases) == 0 {
 				log.Printf("No releases found for %s/%s\n", ghOwner, ghRepo)
+				// There is no snapshot to store, but the fetch succeeded
+				if store {
+					return recordFetch(db, fetcher, ghOwner, ghRepo, started, nil)
+				}
 				return nil
 			}
 
-			// Store in database if requested
-			if store {
-				db, err := internal.NewDatabase(dbPath)
+			// Load the previous snapshot before storing the new one
+			var report internal.Report = internal.NewSnapshotReport(stats, detailed)
+			if diffLast {
+				previous, err := db.GetStatsHistory(ghOwner, ghRepo, 1)
 				if err != nil {
-					return fmt.Errorf("failed to connect to database: %w", err)
+					return fmt.Errorf("failed to retrieve last snapshot: %w", err)
 				}
-				defer db.Close()
+				if len(previous) == 0 {
+					notice(cmd, "No stored snapshot for %s/%s to diff against\n", ghOwner, ghRepo)
+				} else {
+					report = internal.DiffSnapshots(&previous[0], stats)
+				}
+			}
 
+			if store {
 				if err := db.StoreStats(stats); err != nil {
 					return fmt.Errorf("failed to store stats: %w", err)
 				}
+				if err := recordFetch(db, fetcher, ghOwner, ghRepo, started, nil); err != nil {
+					return err
+				}
 				dbFile := dbPath
 				if dbFile == "" {
 					dbFile = "github-stats.db"
 				}
 				log.Printf("\n✓ Statistics stored in %s\n", dbFile)
-				return nil
-			}
+				if err := hooks.afterStore(cmd.Context(), stats, nil); err != nil {
+					return fmt.Errorf("statistics stored, but %w", err)
+				}
 
-			showCmd := newShowCmd()
-			showCmd.SetArgs([]string{ghOwner, ghRepo})
-			if err := showCmd.RunE(cmd, []string{ghOwner, ghRepo}); err != nil {
-				return err
+				// Stored runs stay quiet unless a diff was asked for
+				if !diffLast {
+					return nil
+				}
 			}
 
-			return nil
+			return renderReport(cmd, report)
 		},
 	}
 
-	cmd.Flags().StringVarP(&ghToken, "token", "t", os.Getenv("GITHUB_TOKEN"), "GitHub API token")
+	cmd.Flags().StringP("token", "t", "", "GitHub API token (default: $GITHUB_TOKEN for github.com repositories, then the configured token)")
 	cmd.Flags().BoolVarP(&store, "store", "s", false, "Store statistics in database")
 	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().BoolVarP(&detailed, "detailed", "d", false, "Show per-asset downloads")
+	cmd.Flags().BoolVar(&diffLast, "diff-last", false, "Show what changed since the last stored snapshot")
+	addPushFlag(cmd)
+	addTemplateFlag(cmd)
 
 	return cmd
 }
 
 func newShowCmd() *cobra.Command {
 	var dbPath string
+	var sortOrder string
+	var tagGlob string
+	var since string
+	var top int
+	var detailed bool
 
 	cmd := &cobra.Command{
-		Use:   "show <owner> <repo>",
+		Use:   "show <owner> <repo> | <owner/repo> | <alias>",
 		Short: "Show latest stored statistics",
-		Args:  cobra.ExactArgs(2),
+		Long:  "Show every release in the most recently stored snapshot, optionally filtered and sorted",
+		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			owner := args[0]
-			repo := args[1]
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			order, err := internal.ParseReleaseSort(sortOrder)
+			if err != nil {
+				return err
+			}
+			sinceTime, err := internal.ParseDate(since, false)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			filter := internal.ReleaseFilter{TagGlob: tagGlob, Since: sinceTime, Sort: order, Top: top}
 
-			db, err := internal.NewDatabase(dbPath)
+			db, err := openDatabase(cmd, dbPath)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
 			defer db.Close()
 
@@ -108,19 +209,26 @@ func newShowCmd() *cobra.Command {
 			}
 
 			if len(stats.Releases) == 0 {
-				fmt.Printf("No statistics found for %s/%s\n", owner, repo)
+				notice(cmd, "No statistics found for %s/%s\n", owner, repo)
 				return nil
 			}
 
-			fmt.Printf("\nLatest Statistics for %s/%s\n", owner, repo)
-			fmt.Printf("Fetched at: %s\n", stats.FetchedAt.Format("2006-01-02 15:04:05 MST"))
-			internal.DisplayStats(stats, false)
+			stats, err = filter.Apply(stats)
+			if err != nil {
+				return err
+			}
 
-			return nil
+			return renderReport(cmd, internal.NewSnapshotReport(stats, detailed))
 		},
 	}
 
 	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&sortOrder, "sort", "downloads", "Sort releases by downloads, created, tag or semver")
+	cmd.Flags().StringVar(&tagGlob, "tag", "", "Only show releases whose tag matches this glob (e.g. 'v2.*')")
+	cmd.Flags().StringVar(&since, "since", "", "Only show releases published on or after this date (YYYY-MM-DD or RFC3339)")
+	cmd.Flags().IntVar(&top, "top", 0, "Only show the first N releases after sorting")
+	cmd.Flags().BoolVarP(&detailed, "detailed", "d", false, "Show per-asset downloads")
+	addTemplateFlag(cmd)
 
 	return cmd
 }
@@ -130,16 +238,18 @@ func newHistoryCmd() *cobra.Command {
 	var limit int
 
 	cmd := &cobra.Command{
-		Use:   "history <owner> <repo>",
+		Use:   "history <owner> <repo> | <owner/repo> | <alias>",
 		Short: "Show statistics history",
-		Args:  cobra.ExactArgs(2),
+		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			owner := args[0]
-			repo := args[1]
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
 
-			db, err := internal.NewDatabase(dbPath)
+			db, err := openDatabase(cmd, dbPath)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
 			defer db.Close()
 
@@ -149,40 +259,17 @@ func newHistoryCmd() *cobra.Command {
 			}
 
 			if len(allStats) == 0 {
-				fmt.Printf("No history found for %s/%s\n", owner, repo)
+				notice(cmd, "No history found for %s/%s\n", owner, repo)
 				return nil
 			}
 
-			fmt.Printf("\nStatistics History for %s/%s (last %d fetches)\n\n", owner, repo, len(allStats))
-
-			for i, stats := range allStats {
-				fmt.Printf("[%d] Fetched at: %s | Total Releases: %d | Total Downloads: %d\n",
-					i+1,
-					stats.FetchedAt.Format("2006-01-02 15:04:05 MST"),
-					len(stats.Releases),
-					stats.TotalDownloads,
-				)
-
-				if len(stats.Releases) > 0 {
-					fmt.Printf("    Top 3 releases:\n")
-					count := 3
-					if len(stats.Releases) < 3 {
-						count = len(stats.Releases)
-					}
-					for j := 0; j < count; j++ {
-						rel := stats.Releases[j]
-						fmt.Printf("      - %s (%s): %d downloads\n", rel.Name, rel.Tag, rel.TotalDownloads)
-					}
-				}
-				fmt.Println()
-			}
-
-			return nil
+			return renderReport(cmd, internal.NewHistoryReport(owner, repo, allStats, 3))
 		},
 	}
 
 	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
 	cmd.Flags().IntVar(&limit, "limit", 10, "Number of historical snapshots to show")
+	addTemplateFlag(cmd)
 
 	return cmd
 }
@@ -190,116 +277,88 @@ func newHistoryCmd() *cobra.Command {
 func newCompareCmd() *cobra.Command {
 	var dbPath string
 	var days int
+	var from string
+	var to string
+	var top int
+	var detailed bool
 
 	cmd := &cobra.Command{
-		Use:   "compare <owner> <repo>",
+		Use:   "compare <owner> <repo> | <owner/repo> | <alias>",
 		Short: "Compare statistics across time",
-		Long:  "Compare download statistics between the oldest and newest records",
-		Args:  cobra.ExactArgs(2),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			owner := args[0]
-			repo := args[1]
+		Long: `Compare download statistics between two stored snapshots, including releases
+that were published or deleted in between.
 
-			db, err := internal.NewDatabase(dbPath)
+--from and --to take "latest", a date (the last snapshot taken on or before
+that day), a snapshot ID or a baseline name. Without --from, the oldest
+snapshot within --days before --to is used.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
 			if err != nil {
-				return fmt.Errorf("failed to connect to database: %w", err)
+				return err
 			}
-			defer db.Close()
-
-			endTime := time.Now()
-			startTime := endTime.AddDate(0, 0, -days)
 
-			allStats, err := db.GetStatsBetween(owner, repo, startTime, endTime)
+			db, err := openDatabase(cmd, dbPath)
 			if err != nil {
-				return fmt.Errorf("failed to retrieve stats: %w", err)
-			}
-
-			if len(allStats) < 2 {
-				fmt.Printf("Need at least 2 data points to compare (found %d)\n", len(allStats))
-				return nil
-			}
-
-			oldest := allStats[len(allStats)-1]
-			newest := allStats[0]
-
-			fmt.Printf("\nDownload Statistics Comparison for %s/%s\n", owner, repo)
-			fmt.Printf("Period: Last %d days\n", days)
-			fmt.Printf("Oldest: %s | Newest: %s\n\n", oldest.FetchedAt.Format("2006-01-02"), newest.FetchedAt.Format("2006-01-02"))
-
-			totalGrowth := newest.TotalDownloads - oldest.TotalDownloads
-			var percentGrowth float64
-			if oldest.TotalDownloads > 0 {
-				percentGrowth = (float64(totalGrowth) / float64(oldest.TotalDownloads)) * 100
+				return err
 			}
+			defer db.Close()
 
-			fmt.Printf("Total Downloads:\n")
-			fmt.Printf("  Oldest: %d\n", oldest.TotalDownloads)
-			fmt.Printf("  Newest: %d\n", newest.TotalDownloads)
-			fmt.Printf("  Growth: %+d (%+.2f%%)\n\n", totalGrowth, percentGrowth)
-
-			// Compare top releases
-			fmt.Printf("Top 5 releases by growth:\n")
-			type relComparison struct {
-				name   string
-				tag    string
-				oldDL  int
-				newDL  int
-				growth int
+			newest, err := db.ResolveSnapshot(owner, repo, to)
+			if err != nil {
+				return fmt.Errorf("invalid --to: %w", err)
 			}
 
-			comparisons := make([]relComparison, 0)
-			for _, newRel := range newest.Releases {
-				for _, oldRel := range oldest.Releases {
-					if oldRel.Tag == newRel.Tag {
-						growth := newRel.TotalDownloads - oldRel.TotalDownloads
-						comparisons = append(comparisons, relComparison{
-							name:   newRel.Name,
-							tag:    newRel.Tag,
-							oldDL:  oldRel.TotalDownloads,
-							newDL:  newRel.TotalDownloads,
-							growth: growth,
-						})
-						break
-					}
+			var oldest *internal.ReleaseStats
+			if from != "" {
+				oldest, err = db.ResolveSnapshot(owner, repo, from)
+				if err != nil {
+					return fmt.Errorf("invalid --from: %w", err)
 				}
-			}
-
-			// Sort by growth (simple bubble sort for small list)
-			for i := 0; i < len(comparisons); i++ {
-				for j := i + 1; j < len(comparisons); j++ {
-					if comparisons[j].growth > comparisons[i].growth {
-						comparisons[i], comparisons[j] = comparisons[j], comparisons[i]
-					}
+			} else {
+				window, err := db.GetStatsBetween(owner, repo, newest.FetchedAt.AddDate(0, 0, -days), newest.FetchedAt)
+				if err != nil {
+					return fmt.Errorf("failed to retrieve stats: %w", err)
+				}
+				if len(window) > 0 {
+					oldest = &window[len(window)-1]
 				}
 			}
 
-			count := 5
-			if len(comparisons) < 5 {
-				count = len(comparisons)
+			if oldest == nil || oldest.FetchedAt.Equal(newest.FetchedAt) {
+				notice(cmd, "Need two different snapshots to compare\n")
+				return nil
 			}
-			for i := 0; i < count; i++ {
-				c := comparisons[i]
-				pct := 0.0
-				if c.oldDL > 0 {
-					pct = (float64(c.growth) / float64(c.oldDL)) * 100
-				}
-				fmt.Printf("  %d. %s (%s): %+d (%+.2f%%)\n", i+1, c.name, c.tag, c.growth, pct)
+			if oldest.FetchedAt.After(newest.FetchedAt) {
+				return fmt.Errorf("--from snapshot (%s) is newer than --to snapshot (%s)",
+					oldest.FetchedAt.Format("2006-01-02 15:04"), newest.FetchedAt.Format("2006-01-02 15:04"))
 			}
 
-			fmt.Println()
-			return nil
+			report := internal.NewCompareReport(oldest, newest)
+			report.Top = top
+			report.Detailed = detailed
+			return renderReport(cmd, report)
 		},
 	}
 
 	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
-	cmd.Flags().IntVar(&days, "days", 30, "Number of days to look back")
+	cmd.Flags().IntVar(&days, "days", 30, "Number of days to look back when --from is not set")
+	cmd.Flags().StringVar(&from, "from", "", "Snapshot to compare from: latest, a date, a snapshot ID or a baseline")
+	cmd.Flags().StringVar(&to, "to", internal.LatestRef, "Snapshot to compare to: latest, a date, a snapshot ID or a baseline")
+	cmd.Flags().IntVar(&top, "top", 5, "Number of releases to list by growth in text output (0 for all)")
+	cmd.Flags().BoolVarP(&detailed, "detailed", "d", false, "Show per-asset deltas")
+	addTemplateFlag(cmd)
 
 	return cmd
 }
 
-// Execute runs the command and handles errors.
+// Execute runs the command and handles errors. SIGINT and SIGTERM cancel
+// the command context so long-running commands can shut down cleanly.
 func Execute() {
-	if err := NewRootCmd().Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := NewRootCmd().ExecuteContext(ctx); err != nil {
 		log.Fatalf("Command failed: %v", err)
 	}
 }
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type configKey struct{}
+
+// configuredAnnotation marks flags whose value came from the environment or
+// the configuration file.
+const configuredAnnotation = "git-download-stats/configured"
+
+// flagEnv maps flags shared by several commands to the environment
+// variables that override the configuration file.
+var flagEnv = map[string]string{
+	"db":     "GIT_DOWNLOAD_STATS_DB",
+	"output": "GIT_DOWNLOAD_STATS_OUTPUT",
+}
+
+// loadConfig reads the configuration file and fills in every flag the user
+// did not set. Precedence is flag, then environment, then configuration
+// file, then the flag's built-in default. Values filled in become the flag's
+// default, so Changed still reports whether a flag was given on the command
+// line; flagConfigured also covers filled-in values.
+func loadConfig(cmd *cobra.Command, args []string) error {
+	path, _ := cmd.Flags().GetString("config")
+	required := cmd.Flags().Changed("config")
+	if !required {
+		if env := os.Getenv("GIT_DOWNLOAD_STATS_CONFIG"); env != "" {
+			path, required = env, true
+		} else {
+			path = internal.DefaultConfigPath()
+		}
+	}
+
+	cfg, err := internal.LoadConfig(path, required)
+	if err != nil {
+		return err
+	}
+
+	var applyErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || applyErr != nil {
+			return
+		}
+		value, ok := configuredFlag(cmd, cfg, f.Name)
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			applyErr = fmt.Errorf("invalid default for --%s: %w", f.Name, err)
+			return
+		}
+		f.DefValue = value
+		applyErr = cmd.Flags().SetAnnotation(f.Name, configuredAnnotation, []string{"true"})
+	})
+	if applyErr != nil {
+		return applyErr
+	}
+
+	cmd.SetContext(context.WithValue(cmd.Context(), configKey{}, cfg))
+	return nil
+}
+
+func configuredFlag(cmd *cobra.Command, cfg *internal.Config, name string) (string, bool) {
+	if env, ok := flagEnv[name]; ok {
+		if v := os.Getenv(env); v != "" {
+			return v, true
+		}
+	}
+	if v, ok := cfg.Defaults[cmd.Name()][name]; ok {
+		return fmt.Sprint(v), true
+	}
+	switch name {
+	case "db":
+		return cfg.DB, cfg.DB != ""
+	case "output":
+		return cfg.Output, cfg.Output != ""
+	}
+	return "", false
+}
+
+// flagConfigured reports whether the flag was given on the command line, in
+// the environment or in the configuration file, rather than keeping its
+// built-in default.
+func flagConfigured(cmd *cobra.Command, name string) bool {
+	f := cmd.Flags().Lookup(name)
+	return f != nil && (f.Changed || len(f.Annotations[configuredAnnotation]) > 0)
+}
+
+// configFrom returns the configuration loaded for cmd, or an empty one.
+func configFrom(cmd *cobra.Command) *internal.Config {
+	if cfg, ok := cmd.Context().Value(configKey{}).(*internal.Config); ok {
+		return cfg
+	}
+	return &internal.Config{}
+}
+
+// resolveRepo turns "<owner> <repo>", "<owner/repo>" or a configured alias
+// into owner and repo.
+func resolveRepo(cmd *cobra.Command, args []string) (string, string, error) {
+	if len(args) == 2 {
+		return args[0], args[1], nil
+	}
+	return resolveRepoName(cmd, args[0])
+}
+
+// resolveRepoName resolves a configured alias or an "owner/repo" string.
+func resolveRepoName(cmd *cobra.Command, name string) (string, string, error) {
+	if r, ok := configFrom(cmd).Repo(name); ok {
+		owner, repo := r.OwnerRepo()
+		return owner, repo, nil
+	}
+	return splitRepo(name)
+}
+
+// newRepoFetcher creates a fetcher for owner/repo. A --token given on the
+// command line comes first, then GITHUB_TOKEN for github.com repositories,
+// then the tokens of the configuration file and last a token from its
+// defaults section. GITHUB_TOKEN is never sent to an Enterprise host.
+func newRepoFetcher(cmd *cobra.Command, httpClient *http.Client, owner, repo string) (*internal.Fetcher, error) {
+	cfg := configFrom(cmd)
+	baseURL := cfg.BaseURLFor(owner, repo)
+
+	token, _ := cmd.Flags().GetString("token")
+	if !cmd.Flags().Changed("token") {
+		env := ""
+		if baseURL == "" {
+			env = os.Getenv("GITHUB_TOKEN")
+		}
+		token = cmp.Or(env, cfg.TokenFor(owner, repo), token)
+	}
+
+	classifier, err := internal.NewAssetClassifier(cfg.Assets)
+	if err != nil {
+		return nil, err
+	}
+
+	fetcher := internal.NewFetcher(httpClient, token).WithAssetClassifier(classifier)
+	if baseURL != "" {
+		return fetcher.WithBaseURL(baseURL)
+	}
+	return fetcher, nil
+}
+
+// openDatabase opens the database at path. Loaded snapshots compute their
+// totals with the asset rules from the configuration file.
+func openDatabase(cmd *cobra.Command, path string) (*internal.Database, error) {
+	classifier, err := internal.NewAssetClassifier(configFrom(cmd).Assets)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := internal.NewDatabase(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db.SetAssetClassifier(classifier)
+	return db, nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd() *cobra.Command {
+	var dbPath string
+	var format string
+	var level string
+	var since string
+	var until string
+	var outFile string
+
+	cmd := &cobra.Command{
+		Use:   "export <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Export stored statistics as a time series",
+		Long: `Export stored statistics as a tidy long-format table.
+
+Each row is one observation: a snapshot, a release within a snapshot, or an
+asset within a release, depending on --level. Rows are ordered oldest first so
+the output loads directly into pandas or DuckDB.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			exportFormat, err := internal.ParseExportFormat(format)
+			if err != nil {
+				return err
+			}
+			exportLevel, err := internal.ParseExportLevel(level)
+			if err != nil {
+				return err
+			}
+
+			start, err := internal.ParseDate(since, false)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			end := time.Now()
+			if until != "" {
+				if end, err = internal.ParseDate(until, true); err != nil {
+					return fmt.Errorf("invalid --until: %w", err)
+				}
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			snapshots, err := db.GetStatsBetween(owner, repo, start, end)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve stats: %w", err)
+			}
+
+			if outFile == "" || outFile == "-" {
+				if err := internal.WriteExport(cmd.OutOrStdout(), snapshots, exportLevel, exportFormat); err != nil {
+					return fmt.Errorf("failed to export stats: %w", err)
+				}
+				return nil
+			}
+
+			f, err := os.Create(outFile)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			if err := internal.WriteExport(f, snapshots, exportLevel, exportFormat); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to export stats: %w", err)
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write output file: %w", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&format, "format", "csv", "Output format: json, jsonl, csv or parquet")
+	cmd.Flags().StringVar(&level, "level", "release", "Row granularity: snapshot, release or asset")
+	cmd.Flags().StringVar(&since, "since", "", "Only export snapshots fetched on or after this date (YYYY-MM-DD or RFC3339)")
+	cmd.Flags().StringVar(&until, "until", "", "Only export snapshots fetched on or before this date (YYYY-MM-DD or RFC3339)")
+	cmd.Flags().StringVar(&outFile, "file", "", "Write to this file instead of stdout")
+
+	return cmd
+}
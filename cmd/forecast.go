@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newForecastCmd() *cobra.Command {
+	var dbPath string
+	var lookback int
+	var days int
+	var model string
+	var confidence float64
+	var target string
+	var keepAnomalies bool
+
+	cmd := &cobra.Command{
+		Use:   "forecast <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Project total downloads and when a target will be reached",
+		Long: `Fit models to the stored download totals and project them forward.
+
+  linear       a constant number of downloads per day
+  exponential  a constant growth rate
+  holt         Holt's linear trend method, which weights recent snapshots
+               more and follows changes in the rate
+
+Each projection carries a prediction band (--confidence). With --target, the
+date each model expects the total to cross the target is solved, with the
+earliest and latest dates given by the band.
+
+Download spikes that the anomalies command flags are left out of the fit
+unless --keep-anomalies is given.`,
+		Example: `  git-download-stats forecast cli/cli --target 10M`,
+		Args:    cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			models, err := internal.ParseForecastModels(model)
+			if err != nil {
+				return err
+			}
+			if confidence <= 0 || confidence >= 1 {
+				return fmt.Errorf("--confidence must be between 0 and 1")
+			}
+			if days < 1 {
+				return fmt.Errorf("--days must be at least 1")
+			}
+			targetCount := 0
+			if target != "" {
+				if targetCount, err = internal.ParseCount(target); err != nil {
+					return fmt.Errorf("invalid --target: %w", err)
+				}
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			end := time.Now()
+			snapshots, err := db.GetStatsBetween(owner, repo, end.AddDate(0, 0, -lookback), end)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve stats: %w", err)
+			}
+
+			if len(snapshots) == 0 {
+				notice(cmd, "No statistics found for %s/%s in the last %d days\n", owner, repo, lookback)
+				return nil
+			}
+
+			if !keepAnomalies {
+				if snapshots, err = excludeAnomalies(cmd, db, owner, repo, snapshots); err != nil {
+					return err
+				}
+			}
+
+			report := internal.NewForecastReport(owner, repo, snapshots, internal.ForecastOptions{
+				Models:     models,
+				Days:       days,
+				Confidence: confidence,
+				Target:     targetCount,
+			})
+			if len(report.Models) == 0 {
+				return fmt.Errorf("no model could be fitted: %s", report.Skipped[0].Reason)
+			}
+
+			return renderReport(cmd, report)
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().IntVar(&lookback, "lookback", 90, "Number of days of history to fit")
+	cmd.Flags().IntVar(&days, "days", 30, "Number of days to project")
+	cmd.Flags().StringVar(&model, "model", "all", "Model: linear, exponential, holt or all")
+	cmd.Flags().Float64Var(&confidence, "confidence", 0.95, "Coverage of the prediction bands")
+	cmd.Flags().StringVar(&target, "target", "", "Solve for the date total downloads cross this count (e.g. 10M)")
+	cmd.Flags().BoolVar(&keepAnomalies, "keep-anomalies", false, "Include the downloads of flagged spikes")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+// leaderboardOptions are the flags shared by leaderboard and compare-repos.
+type leaderboardOptions struct {
+	dbPath string
+	days   int
+	to     string
+	by     string
+}
+
+func (o *leaderboardOptions) addFlags(cmd *cobra.Command, defaultMetric string) {
+	cmd.Flags().StringVar(&o.dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().IntVar(&o.days, "days", 30, "Length of the period in days")
+	cmd.Flags().StringVar(&o.to, "to", "", "End of the period (YYYY-MM-DD or RFC3339, default: now)")
+	cmd.Flags().StringVar(&o.by, "by", defaultMetric, "Rank by downloads, growth, per-release or adoption")
+	addTemplateFlag(cmd)
+}
+
+// buildLeaderboard ranks repos over the period ending at --to and ranks them
+// again over the period before it to report rank changes. Repositories
+// without snapshots in the period are left out.
+func buildLeaderboard(cmd *cobra.Command, db *internal.Database, repos []trackedRepo, o *leaderboardOptions) (*internal.LeaderboardReport, error) {
+	metric, err := internal.ParseLeaderboardMetric(o.by)
+	if err != nil {
+		return nil, err
+	}
+	if o.days <= 0 {
+		return nil, fmt.Errorf("--days must be positive")
+	}
+	end, err := internal.ParseDate(o.to, true)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --to: %w", err)
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	start := end.AddDate(0, 0, -o.days)
+
+	current := make([]internal.RepoPeriod, 0, len(repos))
+	previous := make([]internal.RepoPeriod, 0, len(repos))
+	for _, r := range repos {
+		oldest, newest, err := db.GetPeriodSnapshots(r.owner, r.repo, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if newest == nil {
+			notice(cmd, "No snapshots for %s/%s in the period\n", r.owner, r.repo)
+			continue
+		}
+		current = append(current, internal.RepoPeriod{Owner: r.owner, Repo: r.repo, Oldest: oldest, Newest: newest})
+
+		oldest, newest, err = db.GetPeriodSnapshots(r.owner, r.repo, start.AddDate(0, 0, -o.days), start)
+		if err != nil {
+			return nil, err
+		}
+		if newest != nil {
+			previous = append(previous, internal.RepoPeriod{Owner: r.owner, Repo: r.repo, Oldest: oldest, Newest: newest})
+		}
+	}
+
+	return internal.NewLeaderboardReport(current, previous, metric, start, end), nil
+}
+
+func newLeaderboardCmd() *cobra.Command {
+	var opts leaderboardOptions
+	var group string
+
+	cmd := &cobra.Command{
+		Use:   "leaderboard",
+		Short: "Rank tracked repositories over the same period",
+		Long: `Rank every tracked repository by downloads, growth, downloads per release or
+latest-release adoption over the same period, with rank changes since the
+previous period of the same length. Only stored snapshots are used.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, opts.dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			repos, err := trackedRepos(cmd, db, group)
+			if err != nil {
+				return err
+			}
+			if len(repos) == 0 {
+				notice(cmd, "No tracked repositories\n")
+				return nil
+			}
+
+			report, err := buildLeaderboard(cmd, db, repos, &opts)
+			if err != nil {
+				return err
+			}
+			if len(report.Repos) == 0 {
+				notice(cmd, "No snapshots in the period\n")
+				return nil
+			}
+			return renderReport(cmd, report)
+		},
+	}
+
+	opts.addFlags(cmd, "growth")
+	cmd.Flags().StringVar(&group, "group", "", "Only rank repositories in this group")
+
+	return cmd
+}
+
+func newCompareReposCmd() *cobra.Command {
+	var opts leaderboardOptions
+
+	cmd := &cobra.Command{
+		Use:   "compare-repos <owner/repo|alias> <owner/repo|alias>...",
+		Short: "Compare several repositories side by side",
+		Long: `Line up several repositories over the same period: total downloads, growth,
+downloads per release and latest-release adoption, ranked, with rank changes
+since the previous period. Only stored snapshots are used.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repos := make([]trackedRepo, 0, len(args))
+			for _, arg := range args {
+				owner, repo, err := resolveRepoName(cmd, arg)
+				if err != nil {
+					return err
+				}
+				repos = append(repos, trackedRepo{owner: owner, repo: repo})
+			}
+
+			db, err := openDatabase(cmd, opts.dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			report, err := buildLeaderboard(cmd, db, repos, &opts)
+			if err != nil {
+				return err
+			}
+			if len(report.Repos) == 0 {
+				notice(cmd, "No snapshots in the period\n")
+				return nil
+			}
+			return renderReport(cmd, report)
+		},
+	}
+
+	opts.addFlags(cmd, "downloads")
+
+	return cmd
+}
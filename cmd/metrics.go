@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newMetricsCmd() *cobra.Command {
+	var dbPath string
+	var addr string
+	var outPath string
+
+	cmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Export stored statistics as Prometheus metrics",
+		Long: `Export stored statistics in the Prometheus text format, either once to
+stdout or a file, or continuously over HTTP at /metrics with --addr.
+
+Download counters come from the newest snapshot of every stored repository:
+  github_repo_downloads_total{owner,repo}
+  github_release_downloads_total{owner,repo,tag}
+  github_release_asset_downloads_total{owner,repo,tag,asset,os,arch}
+Fetch duration, success, error counts and the GitHub API rate limit come from
+the fetch log written by fetch --store, fetch-all and watch.
+
+Repositories with many assets can produce thousands of series. Limit them with
+--metrics-releases (newest N releases), --metrics-tag (a tag glob),
+--metrics-assets platform (one series per OS and architecture) or none, and
+--metrics-max-series (busiest N asset series per repository). The same flags
+apply to the /metrics endpoint of serve and watch --health-addr.
+
+--out replaces the file atomically, so it suits the node_exporter textfile
+collector.`,
+		Example: `  git-download-stats metrics --addr :9105
+  git-download-stats metrics --metrics-assets platform --metrics-releases 5 --out /var/lib/node_exporter/downloads.prom`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			metrics, err := newMetrics(cmd, db)
+			if err != nil {
+				return err
+			}
+
+			if addr != "" {
+				mux := http.NewServeMux()
+				mux.Handle(internal.MetricsPattern, metrics)
+				return serveHTTP(cmd.Context(), addr, mux, 10*time.Second, func(addr net.Addr) {
+					log.Printf("Serving metrics on http://%s/metrics", addr)
+				})
+			}
+
+			if outPath == "" || outPath == "-" {
+				return metrics.Write(cmd.OutOrStdout())
+			}
+			if err := writeFileAtomic(outPath, metrics.Write); err != nil {
+				return err
+			}
+			notice(cmd, "✓ Metrics written to %s\n", outPath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&addr, "addr", "", "Serve /metrics on this address (e.g. :9105) instead of writing once")
+	cmd.Flags().StringVar(&outPath, "out", "", "Output file, replaced atomically (default: stdout)")
+	addMetricsFlags(cmd)
+
+	return cmd
+}
+
+// addMetricsFlags adds the flags that limit the series exported by /metrics.
+func addMetricsFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("metrics-releases", 0, "Export release and asset series for the newest N releases only (0: all)")
+	cmd.Flags().String("metrics-tag", "", "Export release and asset series for tags matching this glob only")
+	cmd.Flags().String("metrics-assets", "asset", "Asset series: asset, platform (summed per OS and architecture) or none")
+	cmd.Flags().Int("metrics-max-series", 0, "Keep the N asset series with the most downloads per repository (0: all)")
+}
+
+// newMetrics builds the exporter configured by the flags from
+// addMetricsFlags, classifying platforms with the configured rules.
+func newMetrics(cmd *cobra.Command, db *internal.Database) (*internal.Metrics, error) {
+	var opts internal.MetricsOptions
+	opts.Releases, _ = cmd.Flags().GetInt("metrics-releases")
+	opts.TagGlob, _ = cmd.Flags().GetString("metrics-tag")
+	opts.MaxAssetSeries, _ = cmd.Flags().GetInt("metrics-max-series")
+	assets, _ := cmd.Flags().GetString("metrics-assets")
+	var err error
+	if opts.Assets, err = internal.ParseAssetLabels(assets); err != nil {
+		return nil, err
+	}
+	if opts.Releases < 0 || opts.MaxAssetSeries < 0 {
+		return nil, fmt.Errorf("--metrics-releases and --metrics-max-series must not be negative")
+	}
+
+	classifier, err := internal.NewPlatformClassifier(configFrom(cmd).Platforms)
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewMetrics(db, classifier, opts)
+}
+
+// writeFileAtomic writes a file through a temporary file in the same
+// directory, so readers never see it half written.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
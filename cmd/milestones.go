@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newMilestonesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "milestones",
+		Short: "List and check download milestones",
+		Long: `Milestone rules are declared under milestones in the configuration file and
+evaluated against every snapshot that fetch --store, fetch-all and watch
+store:
+
+  total    the repository's total downloads reach count
+  release  a release reaches count downloads, optionally only within a
+           period after it was published (e.g. 100k in its first week)
+  period   the repository gets count downloads within one day, week or
+           month
+
+With every instead of count, each multiple is a milestone. A milestone is
+recorded once, with the first snapshot in which it was passed, and posted to
+the notifiers declared in the configuration file.`,
+	}
+
+	cmd.AddCommand(newMilestonesListCmd())
+	cmd.AddCommand(newMilestonesCheckCmd())
+	return cmd
+}
+
+func newMilestonesListCmd() *cobra.Command {
+	var dbPath string
+	var since string
+
+	cmd := &cobra.Command{
+		Use:   "list [<owner/repo|alias>]",
+		Short: "List the milestones passed",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var owner, repo string
+			if len(args) == 1 {
+				var err error
+				if owner, repo, err = resolveRepoName(cmd, args[0]); err != nil {
+					return err
+				}
+			}
+			from, err := internal.ParseDate(since, false)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			milestones, err := db.ListMilestones(owner, repo, from)
+			if err != nil {
+				return err
+			}
+			return renderReport(cmd, &internal.MilestonesReport{Milestones: milestones})
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&since, "since", "", "Only list milestones passed since this date (YYYY-MM-DD or RFC3339)")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
+
+func newMilestonesCheckCmd() *cobra.Command {
+	var dbPath string
+	var group string
+	var notify bool
+
+	cmd := &cobra.Command{
+		Use:   "check [<owner/repo|alias>]...",
+		Short: "Find the milestones passed in the stored history",
+		Long: `Evaluate the milestone rules against the whole stored history of each
+repository and list the milestones that were not recorded before, and
+earlier ones whose notification failed. Without arguments, every tracked
+repository is checked. Run it with --notify=false
+after adding a rule to record the milestones passed in the past without
+announcing them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			tracker, err := newMilestoneTracker(cmd, db)
+			if err != nil {
+				return err
+			}
+			if !tracker.Enabled() {
+				return fmt.Errorf("no milestone rules: declare them under milestones in the configuration file")
+			}
+
+			var repos []trackedRepo
+			if len(args) == 0 {
+				if repos, err = trackedRepos(cmd, db, group); err != nil {
+					return err
+				}
+			}
+			for _, arg := range args {
+				owner, repo, err := resolveRepoName(cmd, arg)
+				if err != nil {
+					return err
+				}
+				repos = append(repos, trackedRepo{owner: owner, repo: repo})
+			}
+
+			report := &internal.MilestonesReport{Milestones: []internal.Milestone{}}
+			for _, r := range repos {
+				passed, err := tracker.Evaluate(r.owner, r.repo, time.Time{})
+				if err != nil {
+					return fmt.Errorf("%s/%s: %w", r.owner, r.repo, err)
+				}
+				report.Milestones = append(report.Milestones, passed...)
+			}
+			// Without --notify the milestones count as notified; otherwise
+			// those that failed are posted again by the next check
+			notified, notifyErr := report.Milestones, error(nil)
+			if notify {
+				notified, notifyErr = tracker.Notify(cmd.Context(), report.Milestones)
+			}
+			if err := tracker.MarkNotified(notified); err != nil {
+				return err
+			}
+			if err := renderReport(cmd, report); err != nil {
+				return err
+			}
+			return notifyErr
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&group, "group", "", "Only check configured repositories in this group")
+	cmd.Flags().BoolVar(&notify, "notify", true, "Post new milestones to the notifiers")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
+
+// newMilestoneTracker returns the tracker for the milestone rules in the
+// configuration file.
+func newMilestoneTracker(cmd *cobra.Command, db *internal.Database) (*internal.MilestoneTracker, error) {
+	return internal.NewMilestoneTracker(db, configFrom(cmd), notifyClient())
+}
+
+// logMilestones logs milestones passed.
+func logMilestones(milestones []internal.Milestone) {
+	for _, m := range milestones {
+		log.Printf("%s/%s: milestone %s: %s", m.Owner, m.Repo, m.Rule, m.Message)
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// defaultTerminalWidth is used when the width cannot be determined.
+const defaultTerminalWidth = 80
+
+// renderReport writes r to the command's output using the command's
+// --template flag when set, or the format selected by the global --output flag.
+func renderReport(cmd *cobra.Command, r internal.Report) error {
+	if spec, _ := cmd.Flags().GetString("template"); spec != "" {
+		return internal.RenderTemplate(cmd.OutOrStdout(), spec, r)
+	}
+
+	name, _ := cmd.Flags().GetString("output")
+	format, err := internal.ParseOutputFormat(name)
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(internal.ChartedReport); ok && format == internal.OutputTable {
+		style, err := chartStyle(cmd)
+		if err != nil {
+			return err
+		}
+		c.SetChartStyle(style)
+	}
+	return internal.Render(cmd.OutOrStdout(), format, r)
+}
+
+// chartStyle resolves the global --charts flag. In auto mode, charts use
+// Unicode blocks on a terminal and plain ASCII otherwise. The width comes
+// from COLUMNS, then the terminal size.
+func chartStyle(cmd *cobra.Command) (internal.ChartStyle, error) {
+	mode, _ := cmd.Flags().GetString("charts")
+	out, _ := cmd.OutOrStdout().(*os.File)
+	tty := out != nil && term.IsTerminal(int(out.Fd()))
+
+	style := internal.ChartStyle{Width: defaultTerminalWidth, ASCII: !tty}
+	switch mode {
+	case "auto":
+	case "unicode":
+		style.ASCII = false
+	case "ascii":
+		style.ASCII = true
+	case "none":
+		return internal.ChartStyle{}, nil
+	default:
+		return internal.ChartStyle{}, fmt.Errorf("invalid --charts %q (want auto, unicode, ascii or none)", mode)
+	}
+
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		style.Width = columns
+	} else if tty {
+		if width, _, err := term.GetSize(int(out.Fd())); err == nil && width > 0 {
+			style.Width = width
+		}
+	}
+	return style, nil
+}
+
+// addTemplateFlag registers --template on a command that renders reports.
+func addTemplateFlag(cmd *cobra.Command) {
+	cmd.Flags().String("template", "", "Go text/template to render: a built-in name (slack, readme-table, changelog), a file or an inline template")
+}
+
+// notice writes an informational message to stderr so that it never mixes
+// with machine-readable output on stdout.
+func notice(cmd *cobra.Command, format string, a ...any) {
+	fmt.Fprintf(cmd.ErrOrStderr(), format, a...)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newPlatformsCmd() *cobra.Command {
+	var dbPath string
+	var days int
+	var by string
+	var period string
+	var tagGlob string
+	var rules []string
+
+	cmd := &cobra.Command{
+		Use:   "platforms <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Break downloads down by operating system, architecture or package type",
+		Long: `Classify release assets by operating system, architecture and package type,
+and aggregate their downloads across releases.
+
+Asset names are classified with built-in rules for goreleaser-style names
+(tool_2.1.0_linux_arm64.tar.gz) and package formats (.deb, .rpm, .msi, .dmg
+and others). Rules from the "platforms" section of the configuration file and
+--rule flags are tried first. A --rule is a regular expression with named
+groups "os", "arch" and/or "package"; anything it does not capture falls back
+to the built-in rules.
+
+Growth is measured between the oldest and newest snapshot of the last --days
+days, and downloads per --period show how the mix changes over time.`,
+		Example: `  git-download-stats platforms cli/cli --by platform
+  git-download-stats platforms cli/cli --rule '^mytool-(?P<os>[a-z]+)-(?P<arch>[a-z0-9]+)$'`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			dimension, err := internal.ParsePlatformDimension(by)
+			if err != nil {
+				return err
+			}
+			trendPeriod, err := internal.ParseTrendPeriod(period)
+			if err != nil {
+				return err
+			}
+
+			platformRules := make([]internal.PlatformRule, 0, len(rules))
+			for _, r := range rules {
+				platformRules = append(platformRules, internal.PlatformRule{Match: r})
+			}
+			platformRules = append(platformRules, configFrom(cmd).Platforms...)
+			classifier, err := internal.NewPlatformClassifier(platformRules)
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			end := time.Now()
+			snapshots, err := db.GetStatsBetween(owner, repo, end.AddDate(0, 0, -days), end)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve stats: %w", err)
+			}
+
+			if len(snapshots) == 0 {
+				notice(cmd, "No statistics found for %s/%s in the last %d days\n", owner, repo, days)
+				return nil
+			}
+
+			filter := internal.ReleaseFilter{TagGlob: tagGlob}
+			for i := range snapshots {
+				filtered, err := filter.Apply(&snapshots[i])
+				if err != nil {
+					return err
+				}
+				snapshots[i] = *filtered
+			}
+
+			return renderReport(cmd, internal.NewPlatformReport(owner, repo, snapshots, classifier, dimension, trendPeriod))
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().IntVar(&days, "days", 30, "Number of days to measure growth over")
+	cmd.Flags().StringVar(&by, "by", "os", "Group by: os, arch, package or platform (os/arch)")
+	cmd.Flags().StringVar(&period, "period", "week", "Period for downloads over time: day, week or month")
+	cmd.Flags().StringVar(&tagGlob, "tag", "", "Only include releases whose tag matches this glob (e.g. 'v2.*')")
+	cmd.Flags().StringArrayVar(&rules, "rule", nil, "Classification regex with named groups os, arch and package (repeatable)")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
@@ -0,0 +1,375 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newTrackCmd() *cobra.Command {
+	var dbPath string
+	var group string
+	var interval string
+
+	cmd := &cobra.Command{
+		Use:   "track <owner/repo|alias>",
+		Short: "Add a repository to the watchlist",
+		Long:  "Add a repository to the watchlist stored in the database, which fetch-all and watch poll",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepoName(cmd, args[0])
+			if err != nil {
+				return err
+			}
+			if interval != "" {
+				if _, err := internal.ParseSchedule(interval); err != nil {
+					return err
+				}
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.TrackProject(owner, repo, group, interval); err != nil {
+				return err
+			}
+
+			notice(cmd, "✓ Tracking %s/%s\n", owner, repo)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&group, "group", "", "Group name")
+	cmd.Flags().StringVar(&interval, "interval", "", "Polling schedule for watch: a duration or cron expression")
+
+	return cmd
+}
+
+func newUntrackCmd() *cobra.Command {
+	var dbPath string
+
+	cmd := &cobra.Command{
+		Use:   "untrack <owner/repo|alias>",
+		Short: "Remove a repository from the watchlist",
+		Long:  "Remove a repository from the watchlist. Its stored statistics are kept.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepoName(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			removed, err := db.UntrackProject(owner, repo)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				return fmt.Errorf("%s/%s is not tracked", owner, repo)
+			}
+
+			notice(cmd, "✓ No longer tracking %s/%s\n", owner, repo)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+
+	return cmd
+}
+
+func newTrackedCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tracked",
+		Short: "Inspect the watchlist",
+	}
+
+	var dbPath string
+	var group string
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tracked repositories with their fetch status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			projects, err := db.ListProjects(group)
+			if err != nil {
+				return err
+			}
+
+			return renderReport(cmd, &internal.ProjectsReport{Projects: projects})
+		},
+	}
+
+	listCmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	listCmd.Flags().StringVar(&group, "group", "", "Only list repositories in this group")
+
+	cmd.AddCommand(listCmd)
+	return cmd
+}
+
+func newFetchAllCmd() *cobra.Command {
+	var dbPath string
+	var group string
+
+	cmd := &cobra.Command{
+		Use:   "fetch-all",
+		Short: "Fetch and store statistics for every tracked repository",
+		Long: `Fetch and store statistics for every repository on the watchlist and in the
+configuration file. A failure for one repository does not stop the others.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			repos, err := trackedRepos(cmd, db, group)
+			if err != nil {
+				return err
+			}
+			if len(repos) == 0 {
+				notice(cmd, "No tracked repositories\n")
+				return nil
+			}
+
+			hooks, err := newStoreHooks(cmd, db)
+			if err != nil {
+				return err
+			}
+
+			httpClient := &http.Client{Timeout: 2 * time.Minute}
+			failed := 0
+			for _, r := range repos {
+				if err := fetchAndStore(cmd, httpClient, db, hooks, r.owner, r.repo); err != nil {
+					log.Printf("%s/%s: %v", r.owner, r.repo, err)
+					failed++
+					continue
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d repositories failed", failed, len(repos))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("token", "t", "", "GitHub API token (default: $GITHUB_TOKEN for github.com repositories, then the configured token)")
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&group, "group", "", "Only fetch repositories in this group")
+	addPushFlag(cmd)
+
+	return cmd
+}
+
+// trackedRepo is a repository to poll, from the database watchlist or the
+// configuration file.
+type trackedRepo struct {
+	owner    string
+	repo     string
+	schedule string
+}
+
+// trackedRepos merges the database watchlist with the configuration file,
+// restricted to group when it is not empty. A watchlist interval takes
+// precedence over a configured schedule.
+func trackedRepos(cmd *cobra.Command, db *internal.Database, group string) ([]trackedRepo, error) {
+	projects, err := trackedProjects(cmd, db, group)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]trackedRepo, 0, len(projects))
+	for _, p := range projects {
+		repos = append(repos, trackedRepo{owner: p.Owner, repo: p.Repo, schedule: p.Interval})
+	}
+	return repos, nil
+}
+
+// trackedProjects is trackedRepos as watchlist entries. Repositories only in
+// the configuration file have no fetch history, their configured schedule
+// as interval and the requested group, or else their first one.
+func trackedProjects(cmd *cobra.Command, db *internal.Database, group string) ([]internal.Project, error) {
+	projects, err := db.ListProjects(group)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(projects))
+	for i, p := range projects {
+		index[p.Owner+"/"+p.Repo] = i
+	}
+
+	for _, r := range configFrom(cmd).Group(group) {
+		owner, repo := r.OwnerRepo()
+		if i, ok := index[owner+"/"+repo]; ok {
+			if projects[i].Interval == "" {
+				projects[i].Interval = r.Schedule
+			}
+			continue
+		}
+		p := internal.Project{Owner: owner, Repo: repo, Group: group, Interval: r.Schedule}
+		if p.Group == "" && len(r.Groups) > 0 {
+			p.Group = r.Groups[0]
+		}
+		index[owner+"/"+repo] = len(projects)
+		projects = append(projects, p)
+	}
+
+	return projects, nil
+}
+
+// fetchAndStore fetches owner/repo, stores the snapshot, records the
+// outcome on the watchlist and runs the store hooks.
+func fetchAndStore(cmd *cobra.Command, httpClient *http.Client, db *internal.Database, hooks *storeHooks, owner, repo string) error {
+	fetcher, err := newRepoFetcher(cmd, httpClient, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	stats, err := fetcher.FetchReleaseStats(cmd.Context(), owner, repo)
+	if err == nil {
+		err = db.StoreStats(stats)
+	}
+	if recordErr := recordFetch(db, fetcher, owner, repo, started, err); recordErr != nil {
+		err = errors.Join(err, recordErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s/%s: stored %d releases, %d downloads", owner, repo, len(stats.Releases), stats.TotalDownloads)
+	if err := hooks.afterStore(cmd.Context(), stats, nil); err != nil {
+		return fmt.Errorf("stored, but %w", err)
+	}
+	return nil
+}
+
+// recordFetch records the outcome of a fetch of owner/repo that began at
+// started, both on the watchlist and in the fetch log read by /metrics.
+func recordFetch(db *internal.Database, fetcher *internal.Fetcher, owner, repo string, started time.Time, fetchErr error) error {
+	now := time.Now()
+	entry := internal.FetchLog{
+		Owner:     owner,
+		Repo:      repo,
+		StartedAt: started,
+		Duration:  now.Sub(started),
+		Rate:      fetcher.RateLimit(),
+	}
+	if fetchErr != nil {
+		entry.Error = fetchErr.Error()
+	}
+	return errors.Join(db.RecordFetch(owner, repo, now, fetchErr), db.LogFetch(entry))
+}
+
+// storeHooks run after a snapshot is stored: pushes to time-series
+// databases, then alert and milestone evaluation.
+type storeHooks struct {
+	pushers    []*pusher
+	alerts     *internal.AlertEngine
+	milestones *internal.MilestoneTracker
+}
+
+// newStoreHooks returns the store hooks of the configuration file and the
+// command's --push flag.
+func newStoreHooks(cmd *cobra.Command, db *internal.Database) (*storeHooks, error) {
+	pushers, err := storePushers(cmd)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := newAlertEngine(cmd, db)
+	if err != nil {
+		return nil, err
+	}
+	milestones, err := newMilestoneTracker(cmd, db)
+	if err != nil {
+		return nil, err
+	}
+	return &storeHooks{pushers: pushers, alerts: alerts, milestones: milestones}, nil
+}
+
+// afterStore pushes a snapshot that was just stored and evaluates the alert
+// and milestone rules for its repository. When mu is not nil it is held
+// while alert state and milestones are written; pushes and notifications go
+// over the network without it.
+func (h *storeHooks) afterStore(ctx context.Context, stats *internal.ReleaseStats, mu sync.Locker) error {
+	var errs []error
+	if err := pushStored(ctx, h.pushers, stats); err != nil {
+		errs = append(errs, fmt.Errorf("push failed: %w", err))
+	}
+	if !h.alerts.Enabled() && !h.milestones.Enabled() {
+		return errors.Join(errs...)
+	}
+
+	if mu != nil {
+		mu.Lock()
+	}
+	changed, alertErr := h.alerts.Evaluate(stats.Owner, stats.Repo)
+	passed, milestoneErr := h.milestones.Evaluate(stats.Owner, stats.Repo, stats.FetchedAt)
+	if mu != nil {
+		mu.Unlock()
+	}
+
+	var notified []internal.Alert
+	if alertErr != nil {
+		errs = append(errs, fmt.Errorf("alert evaluation failed: %w", alertErr))
+	} else {
+		logAlerts(changed)
+		var err error
+		if notified, err = h.alerts.Notify(ctx, changed); err != nil {
+			errs = append(errs, fmt.Errorf("alert notification failed: %w", err))
+		}
+	}
+	var announced []internal.Milestone
+	if milestoneErr != nil {
+		errs = append(errs, fmt.Errorf("milestone evaluation failed: %w", milestoneErr))
+	} else {
+		logMilestones(passed)
+		var err error
+		if announced, err = h.milestones.Notify(ctx, passed); err != nil {
+			errs = append(errs, fmt.Errorf("milestone notification failed: %w", err))
+		}
+	}
+
+	// Notifications that failed are sent again after the next snapshot
+	if len(notified) > 0 || len(announced) > 0 {
+		if mu != nil {
+			mu.Lock()
+		}
+		if err := h.alerts.MarkNotified(notified); err != nil {
+			errs = append(errs, err)
+		}
+		if err := h.milestones.MarkNotified(announced); err != nil {
+			errs = append(errs, err)
+		}
+		if mu != nil {
+			mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newPushCmd() *cobra.Command {
+	var dbPath string
+	var targets []string
+	var since, until string
+	var latest bool
+	var group string
+
+	cmd := &cobra.Command{
+		Use:   "push [<owner/repo|alias>]...",
+		Short: "Push stored snapshots to InfluxDB, Graphite or OpenTSDB",
+		Long: `Push stored snapshots to a time-series database, each point timestamped
+with the snapshot's fetch time. Use it to backfill history; once the
+configuration file lists push targets, fetch --store, fetch-all and watch push
+every new snapshot themselves.
+
+A target is a URL whose scheme selects the protocol:
+  http(s)://host:8086/api/v2/write?org=o&bucket=b   InfluxDB 2.x line protocol
+  http(s)://host:8086/write?db=d                    InfluxDB 1.x line protocol
+  graphite://host:2003                              Graphite plaintext
+  opentsdb://host:4242                              OpenTSDB telnet put
+
+Without --target, the targets in the configuration file are used; targets
+given as flags read their InfluxDB token from INFLUX_TOKEN. Without
+arguments, every tracked repository is pushed. Pushing the same snapshot twice
+writes the same points again, which these databases treat as an overwrite.
+
+The --metrics-* flags select series as for /metrics and override the
+selection configured for each target.`,
+		Example: `  git-download-stats push cli/cli --target 'http://localhost:8086/api/v2/write?org=acme&bucket=downloads'
+  git-download-stats push --target graphite://localhost:2003 --since 2024-01-01 --metrics-assets platform
+  git-download-stats push --latest`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			start, err := internal.ParseDate(since, false)
+			if err != nil {
+				return fmt.Errorf("invalid --since: %w", err)
+			}
+			end := time.Now()
+			if until != "" {
+				if end, err = internal.ParseDate(until, true); err != nil {
+					return fmt.Errorf("invalid --until: %w", err)
+				}
+			}
+
+			configured := configFrom(cmd).Push
+			if len(targets) > 0 {
+				configured = nil
+				for _, t := range targets {
+					configured = append(configured, commandLineTarget(t))
+				}
+			}
+			if len(configured) == 0 {
+				return fmt.Errorf("no push targets: pass --target or list them under push in the configuration file")
+			}
+			pushers, err := newPushers(cmd, configured)
+			if err != nil {
+				return err
+			}
+			for _, p := range pushers {
+				if err := overrideMetricsOptions(cmd, &p.opts); err != nil {
+					return err
+				}
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var repos []trackedRepo
+			if len(args) == 0 {
+				if repos, err = trackedRepos(cmd, db, group); err != nil {
+					return err
+				}
+				if len(repos) == 0 {
+					return fmt.Errorf("no repositories to push: pass owner/repo arguments, track repositories or declare them in the configuration file")
+				}
+			}
+			for _, arg := range args {
+				owner, repo, err := resolveRepoName(cmd, arg)
+				if err != nil {
+					return err
+				}
+				repos = append(repos, trackedRepo{owner: owner, repo: repo})
+			}
+
+			failed := 0
+			for _, r := range repos {
+				var snapshots []internal.ReleaseStats
+				if latest {
+					snapshots, err = db.GetStatsHistory(r.owner, r.repo, 1)
+				} else {
+					snapshots, err = db.GetStatsBetween(r.owner, r.repo, start, end)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to retrieve stats: %w", err)
+				}
+				if len(snapshots) == 0 {
+					notice(cmd, "%s/%s: no stored snapshots\n", r.owner, r.repo)
+					continue
+				}
+				// Push oldest first so a partial backfill leaves no gaps
+				slices.Reverse(snapshots)
+
+				for _, p := range pushers {
+					n, err := p.push(cmd.Context(), snapshots)
+					if err != nil {
+						log.Printf("%s/%s: %v", r.owner, r.repo, err)
+						failed++
+						continue
+					}
+					notice(cmd, "%s/%s: pushed %d snapshots (%d points) to %s\n", r.owner, r.repo, len(snapshots), n, p.sink)
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d pushes failed", failed, len(repos)*len(pushers))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringSliceVar(&targets, "target", nil, "Push target URL (repeatable; default: the push targets in the configuration file)")
+	cmd.Flags().StringVar(&since, "since", "", "Only push snapshots fetched on or after this date (YYYY-MM-DD or RFC3339)")
+	cmd.Flags().StringVar(&until, "until", "", "Only push snapshots fetched on or before this date (YYYY-MM-DD or RFC3339)")
+	cmd.Flags().BoolVar(&latest, "latest", false, "Only push the newest snapshot of each repository")
+	cmd.Flags().StringVar(&group, "group", "", "Only push configured repositories in this group")
+	addMetricsFlags(cmd)
+
+	return cmd
+}
+
+// pusher pushes snapshots to one target with the target's series selection.
+type pusher struct {
+	sink       internal.PushSink
+	opts       internal.MetricsOptions
+	classifier *internal.PlatformClassifier
+}
+
+// push converts snapshots to points and sends them in one push, returning
+// the number of points sent.
+func (p *pusher) push(ctx context.Context, snapshots []internal.ReleaseStats) (int, error) {
+	var points []internal.PushPoint
+	for i := range snapshots {
+		pts, err := internal.SnapshotPoints(&snapshots[i], p.classifier, p.opts)
+		if err != nil {
+			return 0, err
+		}
+		points = append(points, pts...)
+	}
+	return len(points), p.sink.Push(ctx, points)
+}
+
+// newPushers creates a pusher per target, classifying platforms with the
+// configured rules.
+func newPushers(cmd *cobra.Command, targets []internal.PushTarget) ([]*pusher, error) {
+	classifier, err := internal.NewPlatformClassifier(configFrom(cmd).Platforms)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{Timeout: time.Minute}
+
+	pushers := make([]*pusher, 0, len(targets))
+	for _, t := range targets {
+		sink, err := internal.NewPushSink(t, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		opts, err := t.Options()
+		if err != nil {
+			return nil, fmt.Errorf("push %s: %w", sink, err)
+		}
+		pushers = append(pushers, &pusher{sink: sink, opts: opts, classifier: classifier})
+	}
+	return pushers, nil
+}
+
+// overrideMetricsOptions applies the --metrics-* flags the user set to opts.
+func overrideMetricsOptions(cmd *cobra.Command, opts *internal.MetricsOptions) error {
+	flags := cmd.Flags()
+	if flagConfigured(cmd, "metrics-releases") {
+		opts.Releases, _ = flags.GetInt("metrics-releases")
+	}
+	if flagConfigured(cmd, "metrics-tag") {
+		opts.TagGlob, _ = flags.GetString("metrics-tag")
+	}
+	if flagConfigured(cmd, "metrics-max-series") {
+		opts.MaxAssetSeries, _ = flags.GetInt("metrics-max-series")
+	}
+	if flagConfigured(cmd, "metrics-assets") {
+		assets, _ := flags.GetString("metrics-assets")
+		var err error
+		if opts.Assets, err = internal.ParseAssetLabels(assets); err != nil {
+			return err
+		}
+	}
+	if opts.Releases < 0 || opts.MaxAssetSeries < 0 {
+		return fmt.Errorf("--metrics-releases and --metrics-max-series must not be negative")
+	}
+	return nil
+}
+
+// commandLineTarget is a push target given as a flag. Its InfluxDB token
+// comes from INFLUX_TOKEN.
+func commandLineTarget(url string) internal.PushTarget {
+	return internal.PushTarget{URL: url, TokenEnv: "INFLUX_TOKEN"}
+}
+
+// addPushFlag adds --push to a command that stores snapshots.
+func addPushFlag(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("push", nil, "Also push stored snapshots to this target URL (repeatable; see push)")
+}
+
+// storePushers returns the pushers for snapshots a command stores: the
+// targets in the configuration file and those given with --push.
+func storePushers(cmd *cobra.Command) ([]*pusher, error) {
+	targets := slices.Clone(configFrom(cmd).Push)
+	extra, _ := cmd.Flags().GetStringSlice("push")
+	for _, t := range extra {
+		targets = append(targets, commandLineTarget(t))
+	}
+	return newPushers(cmd, targets)
+}
+
+// pushStored pushes a snapshot that was just stored to every pusher.
+func pushStored(ctx context.Context, pushers []*pusher, stats *internal.ReleaseStats) error {
+	var errs []error
+	for _, p := range pushers {
+		if _, err := p.push(ctx, []internal.ReleaseStats{*stats}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newReportCmd() *cobra.Command {
+	var dbPath string
+	var outDir string
+	var title string
+	var days int
+	var group string
+	var by string
+	var period string
+	var theme string
+
+	cmd := &cobra.Command{
+		Use:   "report [owner/repo|alias...]",
+		Short: "Generate a static HTML report site",
+		Long: `Generate a self-contained static site from stored snapshots: an index of
+repositories, a page per repository with its latest releases, history charts,
+the changes over the period and the platform breakdown, a page per release,
+and a data.json file with the same figures.
+
+Pages use relative links, inline styles and inline SVG charts, so the site can
+be served from any directory, including GitHub Pages. Each repository's period
+ends at its newest snapshot rather than the current time: building the site
+twice from the same database produces identical files.
+
+Without arguments, every tracked repository (optionally in --group) is
+included.`,
+		Example: `  git-download-stats report --out site
+  git-download-stats report cli/cli goreleaser/goreleaser --days 90 --theme dark`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if days <= 0 {
+				return fmt.Errorf("--days must be positive")
+			}
+			dimension, err := internal.ParsePlatformDimension(by)
+			if err != nil {
+				return err
+			}
+			trendPeriod, err := internal.ParseTrendPeriod(period)
+			if err != nil {
+				return err
+			}
+			chartTheme, err := internal.ParseChartTheme(theme)
+			if err != nil {
+				return err
+			}
+			classifier, err := internal.NewPlatformClassifier(configFrom(cmd).Platforms)
+			if err != nil {
+				return err
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var repos []trackedRepo
+			if len(args) > 0 {
+				for _, arg := range args {
+					owner, repo, err := resolveRepoName(cmd, arg)
+					if err != nil {
+						return err
+					}
+					repos = append(repos, trackedRepo{owner: owner, repo: repo})
+				}
+			} else if repos, err = trackedRepos(cmd, db, group); err != nil {
+				return err
+			}
+
+			siteRepos := make([]*internal.SiteRepo, 0, len(repos))
+			for _, r := range repos {
+				latest, err := db.GetLatestStats(r.owner, r.repo)
+				if err != nil {
+					return fmt.Errorf("failed to retrieve stats: %w", err)
+				}
+				if len(latest.Releases) == 0 {
+					notice(cmd, "No statistics found for %s/%s\n", r.owner, r.repo)
+					continue
+				}
+				snapshots, err := db.GetStatsBetween(r.owner, r.repo, latest.FetchedAt.AddDate(0, 0, -days), latest.FetchedAt)
+				if err != nil {
+					return fmt.Errorf("failed to retrieve stats: %w", err)
+				}
+				siteRepo, err := internal.NewSiteRepo(snapshots, classifier, dimension, trendPeriod)
+				if err != nil {
+					return fmt.Errorf("%s/%s: %w", r.owner, r.repo, err)
+				}
+				siteRepos = append(siteRepos, siteRepo)
+			}
+			if len(siteRepos) == 0 {
+				notice(cmd, "No statistics to report\n")
+				return nil
+			}
+
+			site := internal.NewSite(title, days, chartTheme, siteRepos)
+			files := 0
+			err = site.Build(func(path string, content []byte) error {
+				target := filepath.Join(outDir, filepath.FromSlash(path))
+				if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+					return fmt.Errorf("failed to create directory: %w", err)
+				}
+				if err := os.WriteFile(target, content, 0o644); err != nil {
+					return fmt.Errorf("failed to write %s: %w", target, err)
+				}
+				files++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			notice(cmd, "✓ Wrote %d files for %d repositories to %s\n", files, len(siteRepos), outDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&outDir, "out", "site", "Output directory")
+	cmd.Flags().StringVar(&title, "title", "Download statistics", "Site title")
+	cmd.Flags().IntVar(&days, "days", 30, "Length of the period before each repository's newest snapshot")
+	cmd.Flags().StringVar(&group, "group", "", "Only include tracked repositories in this group")
+	cmd.Flags().StringVar(&by, "by", "os", "Platform breakdown: os, arch, package or platform")
+	cmd.Flags().StringVar(&period, "period", "week", "Period of the platform chart: day, week or month")
+	cmd.Flags().StringVar(&theme, "theme", "light", "Colour theme: light, dark, mono or transparent")
+
+	return cmd
+}
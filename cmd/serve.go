@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newServeCmd() *cobra.Command {
+	var dbPath string
+	var addr string
+	var origins []string
+	var shutdownTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve stored statistics over a read-only JSON API",
+		Long: `Serve stored statistics over HTTP without fetching anything.
+
+Routes, all GET, under /api/v1:
+  /projects[?group=]                      tracked repositories
+  /repos/{owner}/{repo}/latest            newest snapshot with releases and assets
+  /repos/{owner}/{repo}/releases          releases of the newest snapshot (?tag=, ?sort=)
+  /repos/{owner}/{repo}/history           snapshots, newest first (?from=, ?to=, ?limit=, ?offset=, ?top=)
+  /repos/{owner}/{repo}/series            download series (?level=repo|release|asset, ?from=, ?to=, ?tag=, ?asset=)
+  /repos/{owner}/{repo}/compare           growth between snapshots (?from=, ?to=, ?days=)
+
+Responses carry an ETag and answer If-None-Match with 304 Not Modified.
+Badges are served at /badge/{owner}/{repo}/{metric}.svg and Prometheus
+metrics at /metrics (see the metrics command). The server stops
+gracefully on SIGINT or SIGTERM, letting in-flight requests finish.`,
+		Example: `  git-download-stats serve --addr :8080 --cors-origin https://dash.example.com
+  curl localhost:8080/api/v1/repos/cli/cli/history?limit=10`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			api := internal.NewAPIServer(db)
+			api.AllowedOrigins = origins
+			api.Projects = func(group string) ([]internal.Project, error) {
+				return trackedProjects(cmd, db, group)
+			}
+
+			mux := http.NewServeMux()
+			api.Register(mux)
+			mux.Handle(internal.BadgePattern, internal.BadgeHandler(db))
+
+			grafana := internal.NewGrafanaDatasource(db)
+			grafana.Projects = api.Projects
+			grafana.Register(mux)
+
+			metrics, err := newMetrics(cmd, db)
+			if err != nil {
+				return err
+			}
+			mux.Handle(internal.MetricsPattern, metrics)
+
+			return serveHTTP(cmd.Context(), addr, mux, shutdownTimeout, func(addr net.Addr) {
+				log.Printf("Serving %s on http://%s, metrics at /metrics", internal.APIPrefix, addr)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&addr, "addr", ":8080", "Address to listen on")
+	cmd.Flags().StringSliceVar(&origins, "cors-origin", nil, "Origin allowed to call the API from a browser, or * for any (repeatable)")
+	cmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "Time allowed for in-flight requests on shutdown")
+
+	addMetricsFlags(cmd)
+
+	return cmd
+}
+
+// serveHTTP serves handler on addr until ctx is cancelled, then shuts down
+// gracefully, giving in-flight requests up to shutdownTimeout to finish.
+// listening is called once the listener is open.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler, shutdownTimeout time.Duration, listening func(net.Addr)) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	// Requests outlive ctx, so that shutting down lets them finish; their
+	// context is cancelled once shutdown returns or gives up on them
+	requestCtx, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return requestCtx },
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(listener)
+	}()
+	listening(listener.Addr())
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return nil
+}
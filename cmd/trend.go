@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newTrendCmd() *cobra.Command {
+	var dbPath string
+	var days int
+	var level string
+	var period string
+	var window int
+	var top int
+	var tagGlob string
+	var keepAnomalies bool
+
+	cmd := &cobra.Command{
+		Use:   "trend <owner> <repo> | <owner/repo> | <alias>",
+		Short: "Show download rates per day, week or month",
+		Long: `Derive download rates from successive stored snapshots.
+
+Downloads between two snapshots are spread evenly over the time between them
+and attributed to day, week or month buckets, so irregular fetch intervals do
+not distort the rates. Each bucket shows downloads per day, a moving average
+over --window buckets and the change from the previous bucket. Buckets are
+aligned to UTC; weeks start on Monday.
+
+Download spikes that the anomalies command flags are left out unless
+--keep-anomalies is given.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, repo, err := resolveRepo(cmd, args)
+			if err != nil {
+				return err
+			}
+
+			seriesLevel, err := internal.ParseSeriesLevel(level)
+			if err != nil {
+				return err
+			}
+			trendPeriod, err := internal.ParseTrendPeriod(period)
+			if err != nil {
+				return err
+			}
+			if window < 1 {
+				return fmt.Errorf("--window must be at least 1")
+			}
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			end := time.Now()
+			snapshots, err := db.GetStatsBetween(owner, repo, end.AddDate(0, 0, -days), end)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve stats: %w", err)
+			}
+
+			if len(snapshots) < 2 {
+				notice(cmd, "Need at least 2 snapshots in the last %d days to compute a trend\n", days)
+				return nil
+			}
+
+			// Spikes are detected on the selected releases only, as anomalies
+			// --tag does
+			filter := internal.ReleaseFilter{TagGlob: tagGlob}
+			for i := range snapshots {
+				filtered, err := filter.Apply(&snapshots[i])
+				if err != nil {
+					return err
+				}
+				snapshots[i] = *filtered
+			}
+
+			if !keepAnomalies {
+				if snapshots, err = excludeAnomalies(cmd, db, owner, repo, snapshots); err != nil {
+					return err
+				}
+			}
+
+			return renderReport(cmd, internal.NewTrendReport(owner, repo, snapshots, internal.TrendOptions{
+				Level:  seriesLevel,
+				Period: trendPeriod,
+				Window: window,
+				Top:    top,
+			}))
+		},
+	}
+
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().IntVar(&days, "days", 90, "Number of days of history to analyse")
+	cmd.Flags().StringVar(&level, "level", "repo", "Series granularity: repo, release or asset")
+	cmd.Flags().StringVar(&period, "period", "day", "Bucket size: day, week or month")
+	cmd.Flags().IntVar(&window, "window", 7, "Number of buckets in the moving average")
+	cmd.Flags().IntVar(&top, "top", 0, "Only show the N series with the most downloads in range")
+	cmd.Flags().StringVar(&tagGlob, "tag", "", "Only include releases whose tag matches this glob (e.g. 'v2.*')")
+	cmd.Flags().BoolVar(&keepAnomalies, "keep-anomalies", false, "Include the downloads of flagged spikes")
+	addTemplateFlag(cmd)
+
+	return cmd
+}
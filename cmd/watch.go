@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jibel/git-download-stats/internal"
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd() *cobra.Command {
+	var dbPath string
+	var every string
+	var jitter time.Duration
+	var healthAddr string
+	var immediate bool
+	var group string
+
+	cmd := &cobra.Command{
+		Use:     "watch [<owner/repo|alias>[=schedule]]...",
+		Aliases: []string{"daemon"},
+		Short:   "Periodically fetch and store statistics for several repositories",
+		Long: `Run until interrupted, fetching and storing statistics for each repository on
+its own schedule.
+
+A schedule is a Go duration ("6h"), a five-field cron expression
+("0 */6 * * *") or a descriptor ("@daily"). Repositories without an explicit
+"=schedule" suffix use their configured schedule, or --every.
+
+Without arguments, every repository on the watchlist (see track) and in the
+configuration file is watched, optionally restricted to one --group.`,
+		Example: `  git-download-stats watch cli/cli hashicorp/terraform=@daily 'golang/go=0 3 * * *'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cfg := configFrom(cmd)
+
+			db, err := openDatabase(cmd, dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var repos []trackedRepo
+			if len(args) == 0 {
+				if repos, err = trackedRepos(cmd, db, group); err != nil {
+					return err
+				}
+				if len(repos) == 0 {
+					return fmt.Errorf("no repositories to watch: pass owner/repo arguments, track repositories or declare them in the configuration file")
+				}
+			}
+			for _, arg := range args {
+				repoArg, spec, _ := strings.Cut(arg, "=")
+				owner, repo, err := resolveRepoName(cmd, repoArg)
+				if err != nil {
+					return err
+				}
+				if r, ok := cfg.Repo(owner + "/" + repo); ok && spec == "" {
+					spec = r.Schedule
+				}
+				repos = append(repos, trackedRepo{owner: owner, repo: repo, schedule: spec})
+			}
+
+			hooks, err := newStoreHooks(cmd, db)
+			if err != nil {
+				return err
+			}
+
+			scheduler := internal.NewScheduler(jitter, immediate)
+			httpClient := &http.Client{Timeout: 2 * time.Minute}
+
+			// SQLite allows a single writer; serialise stores across jobs
+			var storeMu sync.Mutex
+
+			for _, r := range repos {
+				owner, repo, spec := r.owner, r.repo, r.schedule
+				if spec == "" {
+					spec = every
+				}
+				schedule, err := internal.ParseSchedule(spec)
+				if err != nil {
+					return fmt.Errorf("%s/%s: %w", owner, repo, err)
+				}
+				fetcher, err := newRepoFetcher(cmd, httpClient, owner, repo)
+				if err != nil {
+					return fmt.Errorf("%s/%s: %w", owner, repo, err)
+				}
+
+				scheduler.Add(owner+"/"+repo, spec, schedule, func(ctx context.Context) error {
+					started := time.Now()
+					stats, err := fetcher.FetchReleaseStats(ctx, owner, repo)
+
+					if err != nil && ctx.Err() != nil {
+						// Cancelled by shutdown, which is not a failure of the
+						// repository
+						return err
+					}
+
+					storeMu.Lock()
+					if err != nil {
+						log.Printf("%s/%s: fetch failed: %v", owner, repo, err)
+					} else if err = db.StoreStats(stats); err != nil {
+						log.Printf("%s/%s: store failed: %v", owner, repo, err)
+					}
+					if recordErr := recordFetch(db, fetcher, owner, repo, started, err); recordErr != nil {
+						log.Printf("%s/%s: %v", owner, repo, recordErr)
+					}
+					// Pushes and notifications go over the network; only database
+					// writes need the lock
+					storeMu.Unlock()
+					if err != nil {
+						return err
+					}
+
+					log.Printf("%s/%s: stored %d releases, %d downloads", owner, repo, len(stats.Releases), stats.TotalDownloads)
+					if err := hooks.afterStore(ctx, stats, &storeMu); err != nil {
+						log.Printf("%s/%s: %v", owner, repo, err)
+						return err
+					}
+					return nil
+				})
+			}
+
+			if healthAddr != "" {
+				metrics, err := newMetrics(cmd, db)
+				if err != nil {
+					return err
+				}
+				mux := http.NewServeMux()
+				mux.Handle("/healthz", internal.HealthHandler(scheduler))
+				mux.Handle(internal.BadgePattern, internal.BadgeHandler(db))
+				mux.Handle(internal.MetricsPattern, metrics)
+				srv := &http.Server{Addr: healthAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+				go func() {
+					if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Printf("health server failed: %v", err)
+					}
+				}()
+				defer func() {
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					_ = srv.Shutdown(shutdownCtx)
+				}()
+				log.Printf("Health status available at http://%s/healthz, badges at /badge/{owner}/{repo}/{metric}.svg, metrics at /metrics", healthAddr)
+			}
+
+			log.Printf("Watching %d repositories", len(repos))
+			scheduler.Run(ctx)
+			log.Printf("Shutting down")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("token", "t", "", "GitHub API token (default: $GITHUB_TOKEN for github.com repositories, then the configured token)")
+	cmd.Flags().StringVar(&dbPath, "db", "", "Database path (default: github-stats.db)")
+	cmd.Flags().StringVar(&every, "every", "6h", "Default schedule: a duration or cron expression")
+	cmd.Flags().DurationVar(&jitter, "jitter", time.Minute, "Maximum random delay added to each run")
+	cmd.Flags().StringVar(&healthAddr, "health-addr", "", "Serve health status, badges and metrics on this address (e.g. :8080)")
+	cmd.Flags().BoolVar(&immediate, "immediate", true, "Fetch every repository once at startup")
+	cmd.Flags().StringVar(&group, "group", "", "Only watch configured repositories in this group")
+	addPushFlag(cmd)
+	addMetricsFlags(cmd)
+
+	return cmd
+}
+
+// splitRepo parses an "owner/repo" argument.
+func splitRepo(s string) (string, string, error) {
+	owner, repo, ok := strings.Cut(s, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", fmt.Errorf("invalid repository %q: expected owner/repo", s)
+	}
+	return owner, repo, nil
+}
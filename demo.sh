@@ -13,9 +13,9 @@ echo ""
 
 # Test 1: Fetch and display
 echo "1️⃣  Fetch GitHub CLI stats (display only)"
-echo "Command: $PROG fetch -o cli -r cli"
+echo "Command: $PROG fetch cli cli"
 echo ""
-$PROG fetch -o cli -r cli 2>&1 | head -15
+$PROG fetch cli cli 2>&1 | head -15
 echo "... (truncated)"
 echo ""
 
@@ -49,7 +49,7 @@ echo "✅ Demo Complete!"
 echo "================================"
 echo ""
 echo "Try these commands:"
-echo "  $PROG fetch -o hashicorp -r terraform -s"
+echo "  $PROG fetch hashicorp terraform -s"
 echo "  $PROG show hashicorp terraform"
 echo "  $PROG history hashicorp terraform --limit 5"
 echo "  $PROG compare hashicorp terraform --days 30"
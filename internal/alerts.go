@@ -0,0 +1,664 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// AlertType selects the condition an alert rule checks.
+type AlertType string
+
+const (
+	// AlertStalled fires for a release that got no downloads within Window.
+	AlertStalled AlertType = "stalled"
+	// AlertDrop fires when the repository's downloads per day over Window
+	// fell by more than Percent against the Baseline before it.
+	AlertDrop AlertType = "drop"
+	// AlertThreshold fires for a release whose downloads reached Threshold.
+	AlertThreshold AlertType = "threshold"
+)
+
+// AlertRule is a declarative alert condition from the configuration file.
+type AlertRule struct {
+	Name string    `yaml:"name"`
+	Type AlertType `yaml:"type"`
+	// Repos restricts the rule to these repositories, given as owner/repo
+	// or alias, and Group to the configured repositories in a group.
+	Repos []string `yaml:"repos"`
+	Group string   `yaml:"group"`
+	// Tag restricts stalled and threshold rules to releases whose tag
+	// matches the glob.
+	Tag string `yaml:"tag"`
+	// Releases is the number of newest releases a stalled rule watches
+	// (default 1).
+	Releases int `yaml:"releases"`
+	// Window is the period checked: 72h for stalled rules and 24h for drop
+	// rules by default.
+	Window time.Duration `yaml:"window"`
+	// Baseline is the period before Window a drop rule compares with
+	// (default 168h).
+	Baseline time.Duration `yaml:"baseline"`
+	// Percent is the drop that fires a drop rule (default 50).
+	Percent float64 `yaml:"percent"`
+	// Threshold is the download count that fires a threshold rule.
+	Threshold int `yaml:"threshold"`
+	// MaxAge restricts threshold rules to releases published at most this
+	// long before the snapshot (default 720h), so that adding a rule does
+	// not fire for every old release already past the threshold.
+	MaxAge time.Duration `yaml:"max_age"`
+	// Notify names the notifiers to post to (default: all of them).
+	Notify []string `yaml:"notify"`
+}
+
+// withDefaults fills in the defaults of unset fields.
+func (r AlertRule) withDefaults() AlertRule {
+	switch r.Type {
+	case AlertStalled:
+		if r.Window == 0 {
+			r.Window = 72 * time.Hour
+		}
+		if r.Releases == 0 {
+			r.Releases = 1
+		}
+	case AlertDrop:
+		if r.Window == 0 {
+			r.Window = 24 * time.Hour
+		}
+		if r.Baseline == 0 {
+			r.Baseline = 7 * 24 * time.Hour
+		}
+		if r.Percent == 0 {
+			r.Percent = 50
+		}
+	case AlertThreshold:
+		if r.MaxAge == 0 {
+			r.MaxAge = 30 * 24 * time.Hour
+		}
+	}
+	return r
+}
+
+// validate checks the rule against the configured notifiers.
+func (r AlertRule) validate(notifiers []NotifierConfig) error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rule: missing name")
+	}
+	switch r.Type {
+	case AlertStalled, AlertDrop:
+	case AlertThreshold:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("alert %s: threshold must be positive", r.Name)
+		}
+	default:
+		return fmt.Errorf("alert %s: unknown type %q (want stalled, drop or threshold)", r.Name, r.Type)
+	}
+	if r.Window < 0 || r.Baseline < 0 || r.MaxAge < 0 || r.Releases < 0 {
+		return fmt.Errorf("alert %s: window, baseline, max_age and releases must not be negative", r.Name)
+	}
+	if r.Percent < 0 || r.Percent >= 100 {
+		return fmt.Errorf("alert %s: percent must be between 0 and 100", r.Name)
+	}
+	if r.Tag != "" {
+		if _, err := path.Match(r.Tag, ""); err != nil {
+			return fmt.Errorf("alert %s: invalid tag pattern %q: %w", r.Name, r.Tag, err)
+		}
+	}
+	for _, name := range r.Notify {
+		if !hasNotifier(notifiers, name) {
+			return fmt.Errorf("alert %s: unknown notifier %q", r.Name, name)
+		}
+	}
+	return nil
+}
+
+func hasNotifier(notifiers []NotifierConfig, name string) bool {
+	for _, n := range notifiers {
+		if n.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether the rule covers owner/repo.
+func (r AlertRule) appliesTo(cfg *Config, owner, repo string) bool {
+	return coversRepo(cfg, r.Repos, r.Group, owner, repo)
+}
+
+// coversRepo reports whether owner/repo is one of repos, given as owner/repo
+// or alias, and a configured repository in group. Empty repos and group
+// cover every repository.
+func coversRepo(cfg *Config, repos []string, group, owner, repo string) bool {
+	name := owner + "/" + repo
+	if group != "" {
+		rc, ok := cfg.Repo(name)
+		if !ok || !rc.InGroup(group) {
+			return false
+		}
+	}
+	if len(repos) == 0 {
+		return true
+	}
+	for _, want := range repos {
+		if rc, ok := cfg.Repo(want); ok {
+			want = rc.Name
+		}
+		if strings.EqualFold(want, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookback returns how far before the newest snapshot the rule reads.
+func (r AlertRule) lookback() time.Duration {
+	switch r.Type {
+	case AlertStalled:
+		return r.Window
+	case AlertDrop:
+		return r.Window + r.Baseline
+	}
+	return 0
+}
+
+// alertCheck is the outcome of a rule for one subject: the repository, or
+// a release named by its tag.
+type alertCheck struct {
+	subject string
+	// undecided marks a subject the rule still checks but lacks the
+	// history to decide on, so its alert state is kept.
+	undecided bool
+	firing    bool
+	value     float64
+	message   string
+}
+
+// evaluate checks the rule against snapshots, oldest first, ending with
+// latest. It returns a check for every subject the rule covers.
+func (r AlertRule) evaluate(latest *ReleaseStats, snapshots []ReleaseStats) ([]alertCheck, error) {
+	repo := latest.Owner + "/" + latest.Repo
+	at := latest.FetchedAt
+
+	switch r.Type {
+	case AlertStalled:
+		selected, err := ReleaseFilter{TagGlob: r.Tag, Sort: SortCreated, Top: r.Releases}.Apply(latest)
+		if err != nil {
+			return nil, err
+		}
+		series := make(map[string][]Point)
+		for _, s := range ExtractSeries(snapshots, SeriesRelease) {
+			series[s.Tag] = s.Points
+		}
+		var checks []alertCheck
+		for _, rel := range selected.Releases {
+			start, ok := pointAt(series[rel.Tag], at.Add(-r.Window))
+			if !ok {
+				checks = append(checks, alertCheck{subject: rel.Tag, undecided: true})
+				continue
+			}
+			got := math.Max(0, float64(rel.TotalDownloads)-start.Value)
+			checks = append(checks, alertCheck{
+				subject: rel.Tag,
+				firing:  got == 0,
+				value:   got,
+				message: fmt.Sprintf("%s %s got %s downloads in the last %s", repo, rel.Tag, humanizeFloat(got), formatWindow(r.Window)),
+			})
+		}
+		return checks, nil
+
+	case AlertDrop:
+		undecided := []alertCheck{{undecided: true}}
+		points := ExtractSeries(snapshots, SeriesRepo)
+		if len(points) == 0 {
+			return undecided, nil
+		}
+		end := points[0].Points[len(points[0].Points)-1]
+		mid, ok := pointAt(points[0].Points, at.Add(-r.Window))
+		if !ok || !mid.Time.Before(end.Time) {
+			return undecided, nil
+		}
+		start, ok := pointAt(points[0].Points, mid.Time.Add(-r.Baseline))
+		if !ok || !start.Time.Before(mid.Time) {
+			return undecided, nil
+		}
+		before := perDay(start, mid)
+		recent := perDay(mid, end)
+		drop := 0.0
+		if before > 0 {
+			drop = math.Max(0, (1-recent/before)*100)
+		}
+		return []alertCheck{{
+			firing: drop > r.Percent,
+			value:  drop,
+			message: fmt.Sprintf("%s got %s downloads/day over the last %s against %s/day over the %s before (%.0f%% drop)",
+				repo, humanizeFloat(math.Round(recent)), formatWindow(end.Time.Sub(mid.Time)),
+				humanizeFloat(math.Round(before)), formatWindow(mid.Time.Sub(start.Time)), drop),
+		}}, nil
+
+	case AlertThreshold:
+		selected, err := ReleaseFilter{TagGlob: r.Tag}.Apply(latest)
+		if err != nil {
+			return nil, err
+		}
+		var checks []alertCheck
+		for _, rel := range selected.Releases {
+			if at.Sub(rel.ReleaseDate()) > r.MaxAge {
+				continue
+			}
+			checks = append(checks, alertCheck{
+				subject: rel.Tag,
+				firing:  rel.TotalDownloads >= r.Threshold,
+				value:   float64(rel.TotalDownloads),
+				message: fmt.Sprintf("%s %s has %s downloads (threshold %s)", repo, rel.Tag, humanizeFloat(float64(rel.TotalDownloads)), humanizeFloat(float64(r.Threshold))),
+			})
+		}
+		return checks, nil
+	}
+	return nil, fmt.Errorf("alert %s: unknown type %q", r.Name, r.Type)
+}
+
+// pointAt returns the last point at or before t.
+func pointAt(points []Point, t time.Time) (Point, bool) {
+	var found Point
+	ok := false
+	for _, p := range points {
+		if p.Time.After(t) {
+			break
+		}
+		found, ok = p, true
+	}
+	return found, ok
+}
+
+// perDay returns the downloads per day between two points, counting
+// decreases as zero.
+func perDay(from, to Point) float64 {
+	days := to.Time.Sub(from.Time).Hours() / 24
+	if days <= 0 {
+		return 0
+	}
+	return math.Max(0, to.Value-from.Value) / days
+}
+
+// formatWindow formats a duration in days when it is a whole number of
+// them, e.g. 3d or 36h.
+func formatWindow(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	s := d.Round(time.Minute).String()
+	s = strings.TrimSuffix(s, "0s")
+	return strings.TrimSuffix(s, "0m")
+}
+
+// AlertState is whether an alert is firing or resolved.
+type AlertState string
+
+const (
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert is the state of a rule for one repository or release. Only
+// transitions between firing and resolved are notified, so a condition
+// that holds across many snapshots is reported once.
+type Alert struct {
+	Rule  string `json:"rule" yaml:"rule"`
+	Owner string `json:"owner" yaml:"owner"`
+	Repo  string `json:"repo" yaml:"repo"`
+	// Subject is the release tag, or empty for repository-wide rules.
+	Subject string     `json:"subject,omitempty" yaml:"subject,omitempty"`
+	State   AlertState `json:"state" yaml:"state"`
+	Message string     `json:"message" yaml:"message"`
+	Value   float64    `json:"value" yaml:"value"`
+	// FiredAt, ResolvedAt and UpdatedAt are fetch times of the snapshots
+	// the alert fired, resolved and was last evaluated in.
+	FiredAt    time.Time `json:"fired_at" yaml:"fired_at"`
+	ResolvedAt time.Time `json:"resolved_at,omitzero" yaml:"resolved_at,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at" yaml:"updated_at"`
+}
+
+// GetAlert returns the state of a rule for a subject, or nil if it never
+// fired.
+func (d *Database) GetAlert(rule, owner, repo, subject string) (*Alert, error) {
+	a := &Alert{Rule: rule, Owner: owner, Repo: repo, Subject: subject}
+	var resolved sql.NullTime
+	err := d.db.QueryRow(
+		`SELECT state, message, value, fired_at, resolved_at, updated_at FROM alerts
+		 WHERE rule = ? AND owner = ? AND repo = ? AND subject = ?`,
+		rule, owner, repo, subject,
+	).Scan(&a.State, &a.Message, &a.Value, &a.FiredAt, &resolved, &a.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert: %w", err)
+	}
+	a.ResolvedAt = resolved.Time
+	return a, nil
+}
+
+// SaveAlert stores the state of an alert, replacing the previous one. The
+// state last notified is kept.
+func (d *Database) SaveAlert(a *Alert) error {
+	var resolved sql.NullTime
+	if !a.ResolvedAt.IsZero() {
+		resolved = sql.NullTime{Time: a.ResolvedAt, Valid: true}
+	}
+	_, err := d.db.Exec(
+		`INSERT INTO alerts (rule, owner, repo, subject, state, message, value, fired_at, resolved_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (rule, owner, repo, subject) DO UPDATE SET
+			state = excluded.state,
+			message = excluded.message,
+			value = excluded.value,
+			fired_at = excluded.fired_at,
+			resolved_at = excluded.resolved_at,
+			updated_at = excluded.updated_at`,
+		a.Rule, a.Owner, a.Repo, a.Subject, a.State, a.Message, a.Value, a.FiredAt, resolved, a.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
+	return nil
+}
+
+// ListAlerts returns the alerts in state, or all of them when state is
+// empty, most recently fired first.
+func (d *Database) ListAlerts(state AlertState) ([]Alert, error) {
+	return d.listAlerts(`? = '' OR state = ?`, state, state)
+}
+
+// MarkAlertNotified records that the alert's state was notified, unless the
+// state changed since.
+func (d *Database) MarkAlertNotified(a *Alert) error {
+	_, err := d.db.Exec(
+		`UPDATE alerts SET notified = state
+		 WHERE rule = ? AND owner = ? AND repo = ? AND subject = ? AND state = ?`,
+		a.Rule, a.Owner, a.Repo, a.Subject, a.State,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark alert as notified: %w", err)
+	}
+	return nil
+}
+
+// listAlerts returns the alerts matching the where clause, most recently
+// fired first.
+func (d *Database) listAlerts(where string, args ...any) ([]Alert, error) {
+	rows, err := d.db.Query(
+		`SELECT rule, owner, repo, subject, state, message, value, fired_at, resolved_at, updated_at
+		 FROM alerts
+		 WHERE `+where+`
+		 ORDER BY fired_at DESC, rule, owner, repo, subject`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := make([]Alert, 0)
+	for rows.Next() {
+		var a Alert
+		var resolved sql.NullTime
+		if err := rows.Scan(&a.Rule, &a.Owner, &a.Repo, &a.Subject, &a.State, &a.Message, &a.Value, &a.FiredAt, &resolved, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		a.ResolvedAt = resolved.Time
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// AlertEngine evaluates the configured alert rules against stored
+// snapshots and notifies state changes.
+type AlertEngine struct {
+	db        *Database
+	cfg       *Config
+	rules     []AlertRule
+	notifiers map[string]*Notifier
+}
+
+// NewAlertEngine returns an engine for the rules in cfg. A nil client uses
+// http.DefaultClient for notifications.
+func NewAlertEngine(db *Database, cfg *Config, client *http.Client) (*AlertEngine, error) {
+	notifiers, err := NewNotifiers(cfg.Notifiers, client)
+	if err != nil {
+		return nil, err
+	}
+	e := &AlertEngine{db: db, cfg: cfg, notifiers: notifiers}
+	for _, r := range cfg.Alerts {
+		if err := r.validate(cfg.Notifiers); err != nil {
+			return nil, err
+		}
+		e.rules = append(e.rules, r.withDefaults())
+	}
+	return e, nil
+}
+
+// Enabled reports whether any rule is configured.
+func (e *AlertEngine) Enabled() bool {
+	return len(e.rules) > 0
+}
+
+// Evaluate checks every rule that covers owner/repo against its newest
+// snapshot and the history before it, stores the resulting states and
+// returns the alerts whose state change is not notified yet: those that
+// started firing or resolved, and earlier ones whose notification failed.
+// Alerts for releases a rule no longer checks, such as deleted releases or
+// those past max_age, resolve.
+func (e *AlertEngine) Evaluate(owner, repo string) ([]Alert, error) {
+	var rules []AlertRule
+	var lookback time.Duration
+	for _, r := range e.rules {
+		if r.appliesTo(e.cfg, owner, repo) {
+			rules = append(rules, r)
+			lookback = max(lookback, r.lookback())
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	latest, err := e.db.GetLatestStats(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if latest.FetchedAt.IsZero() {
+		return nil, nil
+	}
+	// The snapshot just before the lookback anchors the oldest interval
+	start, err := e.db.GetSnapshotAt(owner, repo, latest.FetchedAt.Add(-lookback))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := e.db.GetStatsBetween(owner, repo, start.FetchedAt, latest.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(snapshots)
+
+	for _, r := range rules {
+		checks, err := r.evaluate(latest, snapshots)
+		if err != nil {
+			return nil, err
+		}
+		checked := make(map[string]bool, len(checks))
+		for _, c := range checks {
+			checked[c.subject] = true
+			if c.undecided {
+				continue
+			}
+			prev, err := e.db.GetAlert(r.Name, owner, repo, c.subject)
+			if err != nil {
+				return nil, err
+			}
+			wasFiring := prev != nil && prev.State == AlertFiring
+			if !c.firing && !wasFiring {
+				continue
+			}
+
+			a := Alert{Rule: r.Name, Owner: owner, Repo: repo, Subject: c.subject, Message: c.message, Value: c.value, UpdatedAt: latest.FetchedAt}
+			switch {
+			case c.firing && !wasFiring:
+				a.State, a.FiredAt = AlertFiring, latest.FetchedAt
+			case c.firing:
+				a.State, a.FiredAt = AlertFiring, prev.FiredAt
+			default:
+				a.State, a.FiredAt, a.ResolvedAt = AlertResolved, prev.FiredAt, latest.FetchedAt
+			}
+			if err := e.db.SaveAlert(&a); err != nil {
+				return nil, err
+			}
+		}
+
+		firing, err := e.db.listAlerts(`rule = ? AND owner = ? AND repo = ? AND state = ?`, r.Name, owner, repo, AlertFiring)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range firing {
+			if checked[a.Subject] {
+				continue
+			}
+			a.State, a.ResolvedAt, a.UpdatedAt = AlertResolved, latest.FetchedAt, latest.FetchedAt
+			a.Message = fmt.Sprintf("%s/%s %s is no longer checked", owner, repo, a.Subject)
+			if err := e.db.SaveAlert(&a); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return e.db.listAlerts(`owner = ? AND repo = ? AND state != notified`, owner, repo)
+}
+
+// Notify posts each alert to the notifiers of its rule and returns the
+// alerts that every notifier accepted. Record those with MarkNotified;
+// the others are returned by Evaluate again and retried, which may repeat
+// them on notifiers that accepted them.
+func (e *AlertEngine) Notify(ctx context.Context, alerts []Alert) ([]Alert, error) {
+	var delivered []Alert
+	var errs []error
+	for _, a := range alerts {
+		ok := true
+		for _, n := range e.notifiersFor(a.Rule) {
+			if err := n.Notify(ctx, a.Notification()); err != nil {
+				errs = append(errs, err)
+				ok = false
+			}
+		}
+		if ok {
+			delivered = append(delivered, a)
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// MarkNotified records that alerts were notified, so that Evaluate no
+// longer returns them.
+func (e *AlertEngine) MarkNotified(alerts []Alert) error {
+	for i := range alerts {
+		if err := e.db.MarkAlertNotified(&alerts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifiersFor returns the notifiers of the named rule.
+func (e *AlertEngine) notifiersFor(rule string) []*Notifier {
+	var out []*Notifier
+	for _, r := range e.rules {
+		if r.Name == rule {
+			out = append(out, selectNotifiers(e.cfg.Notifiers, e.notifiers, r.Notify)...)
+		}
+	}
+	return out
+}
+
+// selectNotifiers returns the named notifiers, or every configured notifier
+// in order when names is empty.
+func selectNotifiers(configs []NotifierConfig, notifiers map[string]*Notifier, names []string) []*Notifier {
+	var out []*Notifier
+	if len(names) == 0 {
+		for _, cfg := range configs {
+			out = append(out, notifiers[cfg.Name])
+		}
+	}
+	for _, name := range names {
+		out = append(out, notifiers[name])
+	}
+	return out
+}
+
+// Notification describes the alert's state change.
+func (a Alert) Notification() Notification {
+	title := "[" + strings.ToUpper(string(a.State)) + "] " + a.Rule + ": " + a.Owner + "/" + a.Repo
+	if a.Subject != "" {
+		title += " " + a.Subject
+	}
+	labels := map[string]string{"rule": a.Rule}
+	if a.Subject != "" {
+		labels["tag"] = a.Subject
+	}
+	at := a.FiredAt
+	if a.State == AlertResolved {
+		at = a.ResolvedAt
+	}
+	return Notification{
+		Kind:   "alert",
+		Status: string(a.State),
+		Title:  title,
+		Text:   a.Message,
+		Owner:  a.Owner,
+		Repo:   a.Repo,
+		Time:   at,
+		Labels: labels,
+	}
+}
+
+// AlertsReport lists alerts.
+type AlertsReport struct {
+	Alerts []Alert `json:"alerts" yaml:"alerts"`
+}
+
+// WriteText writes the alerts as an aligned table.
+func (r *AlertsReport) WriteText(out io.Writer) error {
+	if len(r.Alerts) == 0 {
+		_, err := fmt.Fprintln(out, "No alerts")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATE\tRULE\tREPOSITORY\tRELEASE\tFIRED\tRESOLVED\tMESSAGE")
+	fmt.Fprintln(w, "---\t---\t---\t---\t---\t---\t---")
+	for _, a := range r.Alerts {
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\t%s\t%s\t%s\n",
+			a.State, a.Rule, a.Owner, a.Repo, orDash(a.Subject),
+			formatOptionalTime(a.FiredAt), formatOptionalTime(a.ResolvedAt), a.Message)
+	}
+	return w.Flush()
+}
+
+// Table returns one row per alert.
+func (r *AlertsReport) Table() ([]string, [][]string) {
+	header := []string{"state", "rule", "owner", "repo", "subject", "message", "value", "fired_at", "resolved_at", "updated_at"}
+	rows := make([][]string, 0, len(r.Alerts))
+	for _, a := range r.Alerts {
+		rows = append(rows, []string{
+			string(a.State), a.Rule, a.Owner, a.Repo, a.Subject, a.Message,
+			strconv.FormatFloat(a.Value, 'f', -1, 64),
+			formatRFC3339(a.FiredAt), formatRFC3339(a.ResolvedAt), formatRFC3339(a.UpdatedAt),
+		})
+	}
+	return header, rows
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var alertStart = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+// alertSnapshot returns sampleStats fetched day days after alertStart with
+// v1.1.0 at downloads.
+func alertSnapshot(day, downloads int) *ReleaseStats {
+	s := sampleStats()
+	s.FetchedAt = alertStart.AddDate(0, 0, day)
+	s.Releases[1].Assets[0].DownloadCount = downloads
+	s.Releases[1].TotalDownloads = downloads
+	s.TotalDownloads = 5 + downloads
+	return s
+}
+
+func evaluateRule(t *testing.T, r AlertRule, downloads ...int) []alertCheck {
+	t.Helper()
+	var snapshots []ReleaseStats
+	for day, n := range downloads {
+		snapshots = append(snapshots, *alertSnapshot(day, n))
+	}
+	checks, err := r.withDefaults().evaluate(&snapshots[len(snapshots)-1], snapshots)
+	if err != nil {
+		t.Fatalf("evaluate failed: %v", err)
+	}
+	return checks
+}
+
+func TestAlertRules(t *testing.T) {
+	stalled := AlertRule{Name: "stalled", Type: AlertStalled, Window: 48 * time.Hour}
+	if checks := evaluateRule(t, stalled, 10, 20, 30, 30, 30); len(checks) != 1 || !checks[0].firing || checks[0].subject != "v1.1.0" {
+		t.Errorf("expected v1.1.0 to stall, got %+v", checks)
+	}
+	if checks := evaluateRule(t, stalled, 10, 20, 30, 30, 31); len(checks) != 1 || checks[0].firing || checks[0].value != 1 {
+		t.Errorf("expected v1.1.0 to be getting downloads, got %+v", checks)
+	}
+	if checks := evaluateRule(t, stalled, 10); len(checks) != 1 || !checks[0].undecided {
+		t.Errorf("expected no decision without history, got %+v", checks)
+	}
+
+	drop := AlertRule{Name: "drop", Type: AlertDrop}
+	steady := []int{0, 100, 200, 300, 400, 500, 600, 700}
+	checks := evaluateRule(t, drop, append(steady, 720)...)
+	if len(checks) != 1 || !checks[0].firing || checks[0].value != 80 {
+		t.Fatalf("expected an 80%% drop to fire, got %+v", checks)
+	}
+	if want := "owner/repo got 20 downloads/day over the last 1d against 100/day over the 7d before (80% drop)"; checks[0].message != want {
+		t.Errorf("unexpected message %q", checks[0].message)
+	}
+	if checks := evaluateRule(t, drop, append(steady, 760)...); len(checks) != 1 || checks[0].firing {
+		t.Errorf("expected a 40%% drop not to fire, got %+v", checks)
+	}
+
+	// v1.1.0 was created on 2024-06-01, a month before the snapshots
+	threshold := AlertRule{Name: "10k", Type: AlertThreshold, Threshold: 10000, Tag: "v1.1.*", MaxAge: 60 * 24 * time.Hour}
+	if checks := evaluateRule(t, threshold, 9000, 10500); len(checks) != 1 || !checks[0].firing || checks[0].subject != "v1.1.0" {
+		t.Errorf("expected v1.1.0 to pass the threshold, got %+v", checks)
+	}
+	threshold.MaxAge = 0
+	if checks := evaluateRule(t, threshold, 9000, 10500); len(checks) != 0 {
+		t.Errorf("expected releases older than the default max_age to be skipped, got %+v", checks)
+	}
+	published := alertSnapshot(1, 10500)
+	published.Releases[1].PublishedAt = alertStart.AddDate(0, 0, -3)
+	if checks, _ := threshold.withDefaults().evaluate(published, []ReleaseStats{*published}); len(checks) != 1 || !checks[0].firing {
+		t.Errorf("expected max_age to count from the publish date, got %+v", checks)
+	}
+}
+
+func TestAlertRuleAppliesTo(t *testing.T) {
+	cfg := &Config{Repos: []RepoConfig{{Name: "cli/cli", Alias: "gh", Groups: []string{"clis"}}}}
+	for _, tt := range []struct {
+		rule AlertRule
+		repo string
+		want bool
+	}{
+		{AlertRule{}, "acme/tool", true},
+		{AlertRule{Repos: []string{"gh"}}, "cli/cli", true},
+		{AlertRule{Repos: []string{"Acme/Tool"}}, "acme/tool", true},
+		{AlertRule{Repos: []string{"gh"}}, "acme/tool", false},
+		{AlertRule{Group: "clis"}, "cli/cli", true},
+		{AlertRule{Group: "clis"}, "acme/tool", false},
+	} {
+		owner, repo, _ := strings.Cut(tt.repo, "/")
+		if got := tt.rule.appliesTo(cfg, owner, repo); got != tt.want {
+			t.Errorf("%+v applies to %s = %v, want %v", tt.rule, tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestAlertEngine(t *testing.T) {
+	var received []Notification
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	db := newTestDatabase(t)
+	engine, err := NewAlertEngine(db, &Config{
+		Notifiers: []NotifierConfig{{Name: "hook", Type: NotifierWebhook, URL: srv.URL}},
+		Alerts:    []AlertRule{{Name: "stalled", Type: AlertStalled, Window: 48 * time.Hour}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewAlertEngine failed: %v", err)
+	}
+
+	var notifyErr error
+	evaluate := func(day, downloads int) []Alert {
+		t.Helper()
+		if err := db.StoreStats(alertSnapshot(day, downloads)); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+		changed, err := engine.Evaluate("owner", "repo")
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		notified, err := engine.Notify(context.Background(), changed)
+		notifyErr = err
+		if err := engine.MarkNotified(notified); err != nil {
+			t.Fatalf("MarkNotified failed: %v", err)
+		}
+		return changed
+	}
+
+	for day, n := range []int{10, 20, 30, 30} {
+		if changed := evaluate(day, n); len(changed) != 0 {
+			t.Fatalf("day %d: unexpected alerts %+v", day, changed)
+		}
+	}
+	failing = true
+	changed := evaluate(4, 30)
+	if len(changed) != 1 || changed[0].State != AlertFiring || changed[0].Subject != "v1.1.0" || !changed[0].FiredAt.Equal(alertStart.AddDate(0, 0, 4)) {
+		t.Fatalf("expected v1.1.0 to start firing, got %+v", changed)
+	}
+	if notifyErr == nil || !strings.Contains(notifyErr.Error(), "503 Service Unavailable: try later") {
+		t.Fatalf("expected the notification to fail, got %v", notifyErr)
+	}
+	failing = false
+	if changed := evaluate(5, 30); len(changed) != 1 || changed[0].State != AlertFiring || notifyErr != nil {
+		t.Fatalf("expected the failed notification to be retried, got %+v, %v", changed, notifyErr)
+	}
+	if changed := evaluate(6, 30); len(changed) != 0 {
+		t.Fatalf("expected a firing alert to be notified once, got %+v", changed)
+	}
+	firing, err := db.ListAlerts(AlertFiring)
+	if err != nil || len(firing) != 1 || !firing[0].UpdatedAt.Equal(alertStart.AddDate(0, 0, 6)) {
+		t.Fatalf("unexpected firing alerts %+v, %v", firing, err)
+	}
+
+	changed = evaluate(7, 45)
+	if len(changed) != 1 || changed[0].State != AlertResolved || !changed[0].ResolvedAt.Equal(alertStart.AddDate(0, 0, 7)) {
+		t.Fatalf("expected v1.1.0 to resolve, got %+v", changed)
+	}
+	if firing, _ := db.ListAlerts(AlertFiring); len(firing) != 0 {
+		t.Errorf("expected no firing alerts, got %+v", firing)
+	}
+
+	if len(received) != 2 || received[0].Status != NotificationFiring || received[1].Status != NotificationResolved {
+		t.Fatalf("unexpected notifications %+v", received)
+	}
+	if n := received[0]; n.Kind != "alert" || n.Title != "[FIRING] stalled: owner/repo v1.1.0" || n.Labels["tag"] != "v1.1.0" ||
+		n.Text != "owner/repo v1.1.0 got 0 downloads in the last 2d" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
+
+func TestAlertEngineResolvesUncheckedReleases(t *testing.T) {
+	db := newTestDatabase(t)
+	engine, err := NewAlertEngine(db, &Config{
+		Alerts: []AlertRule{{Name: "10k", Type: AlertThreshold, Threshold: 10000, MaxAge: 60 * 24 * time.Hour}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewAlertEngine failed: %v", err)
+	}
+
+	if err := db.StoreStats(alertSnapshot(0, 10500)); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+	if changed, err := engine.Evaluate("owner", "repo"); err != nil || len(changed) != 1 || changed[0].State != AlertFiring {
+		t.Fatalf("expected v1.1.0 to start firing, got %+v, %v", changed, err)
+	}
+
+	// v1.1.0 was deleted
+	deleted := alertSnapshot(1, 0)
+	deleted.Releases = deleted.Releases[:1]
+	if err := db.StoreStats(deleted); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+	changed, err := engine.Evaluate("owner", "repo")
+	if err != nil || len(changed) != 1 || changed[0].State != AlertResolved || changed[0].Subject != "v1.1.0" ||
+		changed[0].Message != "owner/repo v1.1.0 is no longer checked" || !changed[0].ResolvedAt.Equal(alertStart.AddDate(0, 0, 1)) {
+		t.Fatalf("expected v1.1.0 to resolve, got %+v, %v", changed, err)
+	}
+}
+
+func TestNotifierPayloads(t *testing.T) {
+	bodies := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies[r.URL.Path] = string(data)
+		if r.URL.Path == "/gone" {
+			http.Error(w, "no_service", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	msg := Alert{Rule: "drop", Owner: "acme", Repo: "cli", State: AlertFiring, Message: "downloads fell", FiredAt: alertStart}.Notification()
+	for kind, want := range map[NotifierType]string{
+		NotifierSlack:   `"attachments":[{"color":"#d73a49","footer":"acme/cli","text":"downloads fell","title":"[FIRING] drop: acme/cli","ts":1719835200}]`,
+		NotifierDiscord: `"embeds":[{"color":14105161,"description":"downloads fell","footer":{"text":"acme/cli"},"timestamp":"2024-07-01T12:00:00Z","title":"[FIRING] drop: acme/cli"}]`,
+		NotifierTeams:   `"contentType":"application/vnd.microsoft.card.adaptive"`,
+		NotifierWebhook: `"kind":"alert","status":"firing"`,
+	} {
+		n, err := NewNotifier(NotifierConfig{Name: string(kind), Type: kind, URL: srv.URL + "/" + string(kind)}, nil)
+		if err != nil {
+			t.Fatalf("NewNotifier failed: %v", err)
+		}
+		if err := n.Notify(context.Background(), msg); err != nil {
+			t.Fatalf("%s: Notify failed: %v", kind, err)
+		}
+		if body := bodies["/"+string(kind)]; !strings.Contains(body, want) {
+			t.Errorf("%s: missing %s in %s", kind, want, body)
+		}
+	}
+
+	n, _ := NewNotifier(NotifierConfig{Name: "gone", Type: NotifierSlack, URL: srv.URL + "/gone"}, nil)
+	if err := n.Notify(context.Background(), msg); err == nil || !strings.Contains(err.Error(), "no_service") {
+		t.Errorf("expected the webhook's error, got %v", err)
+	}
+
+	for _, cfg := range []NotifierConfig{
+		{Type: NotifierSlack, URL: "https://hooks.slack.com/x"},
+		{Name: "n", Type: "email", URL: "https://example.com"},
+		{Name: "n", Type: NotifierSlack, URL: "ftp://example.com"},
+		{Name: "n", Type: NotifierSlack},
+	} {
+		if _, err := NewNotifier(cfg, nil); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// anomalyMinBaseline is the number of preceding intervals an interval needs
+// before it can be judged.
+const anomalyMinBaseline = 5
+
+// AnomalyOptions controls DetectAnomalies. Zero values select the defaults.
+type AnomalyOptions struct {
+	// Window is the number of preceding intervals in the rolling baseline
+	// (default 14).
+	Window int `yaml:"window" json:"window"`
+	// Threshold is the robust z-score above which an interval is a spike
+	// (default 3.5).
+	Threshold float64 `yaml:"threshold" json:"threshold"`
+	// MinDownloads is the smallest excess over the baseline that is flagged
+	// (default 100), so that quiet assets are not flagged for a handful of
+	// downloads.
+	MinDownloads int `yaml:"min_downloads" json:"min_downloads"`
+}
+
+func (o AnomalyOptions) withDefaults() AnomalyOptions {
+	if o.Window == 0 {
+		o.Window = 14
+	}
+	if o.Threshold == 0 {
+		o.Threshold = 3.5
+	}
+	if o.MinDownloads == 0 {
+		o.MinDownloads = 100
+	}
+	return o
+}
+
+// Validate checks the options.
+func (o AnomalyOptions) Validate() error {
+	if o.Window != 0 && o.Window < anomalyMinBaseline {
+		return fmt.Errorf("anomalies: window must be at least %d intervals", anomalyMinBaseline)
+	}
+	if o.Threshold < 0 {
+		return fmt.Errorf("anomalies: threshold must not be negative")
+	}
+	if o.MinDownloads < 0 {
+		return fmt.Errorf("anomalies: min_downloads must not be negative")
+	}
+	return nil
+}
+
+// Anomaly is an abnormal jump in the downloads of one asset between two
+// successive snapshots, such as a CI system downloading the same binary
+// over and over.
+type Anomaly struct {
+	Tag   string    `json:"tag" yaml:"tag"`
+	Asset string    `json:"asset" yaml:"asset"`
+	Start time.Time `json:"start" yaml:"start"`
+	End   time.Time `json:"end" yaml:"end"`
+	// Downloads is the increase over the interval and PerDay its rate.
+	Downloads float64 `json:"downloads" yaml:"downloads"`
+	PerDay    float64 `json:"per_day" yaml:"per_day"`
+	// Baseline is the median rate of the preceding intervals, per day.
+	Baseline float64 `json:"baseline_per_day" yaml:"baseline_per_day"`
+	// Score is the robust z-score of PerDay against the baseline.
+	Score float64 `json:"score" yaml:"score"`
+	// Excess is the number of downloads above the baseline rate, which
+	// ExcludeAnomalies removes.
+	Excess float64 `json:"excess" yaml:"excess"`
+	// Marked reports whether the spike is marked in the database.
+	Marked bool `json:"marked" yaml:"marked"`
+}
+
+func (a Anomaly) key() string {
+	return a.Tag + "/" + a.Asset + "@" + a.End.UTC().Format(time.RFC3339Nano)
+}
+
+// DetectAnomalies flags the intervals in which an asset's downloads per day
+// rose abnormally far above its rolling baseline: the median rate of the
+// preceding opts.Window intervals. The distance is a robust z-score, scaled
+// by the median absolute deviation so that earlier spikes do not inflate
+// the baseline. Snapshots may be in any order; anomalies are ordered by the
+// end of their interval.
+func DetectAnomalies(snapshots []ReleaseStats, opts AnomalyOptions) []Anomaly {
+	opts = opts.withDefaults()
+	out := make([]Anomaly, 0)
+	for _, s := range ExtractSeries(snapshots, SeriesAsset) {
+		intervals := Intervals(s.Points)
+		for i := anomalyMinBaseline; i < len(intervals); i++ {
+			baseline := intervals[max(0, i-opts.Window):i]
+			rates := make([]float64, len(baseline))
+			for j, iv := range baseline {
+				rates[j] = iv.PerDay
+			}
+			center, scale := robustScale(rates)
+
+			iv := intervals[i]
+			days := iv.End.Sub(iv.Start).Hours() / 24
+			excess := iv.Downloads - center*days
+			score := (iv.PerDay - center) / scale
+			if score <= opts.Threshold || excess < float64(opts.MinDownloads) {
+				continue
+			}
+			out = append(out, Anomaly{
+				Tag:       s.Tag,
+				Asset:     s.Asset,
+				Start:     iv.Start,
+				End:       iv.End,
+				Downloads: iv.Downloads,
+				PerDay:    iv.PerDay,
+				Baseline:  center,
+				Score:     score,
+				Excess:    excess,
+			})
+		}
+	}
+	sortAnomalies(out)
+	return out
+}
+
+// robustScale returns the median of values and the median absolute
+// deviation scaled to match a standard deviation. When more than half of
+// the values are equal the MAD is zero, and the mean absolute deviation is
+// used instead. The scale is at least one download per day, so that a
+// perfectly steady asset is not flagged for a single extra download.
+func robustScale(values []float64) (center, scale float64) {
+	center = median(values)
+	deviations := make([]float64, len(values))
+	var sum float64
+	for i, v := range values {
+		deviations[i] = math.Abs(v - center)
+		sum += deviations[i]
+	}
+	scale = 1.4826 * median(deviations)
+	if scale == 0 && len(values) > 0 {
+		scale = 1.2533 * sum / float64(len(values))
+	}
+	return center, max(scale, 1)
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func sortAnomalies(anomalies []Anomaly) {
+	slices.SortFunc(anomalies, func(a, b Anomaly) int {
+		return cmp.Or(a.End.Compare(b.End), cmp.Compare(a.Tag, b.Tag), cmp.Compare(a.Asset, b.Asset))
+	})
+}
+
+// MergeAnomalies combines anomalies marked in the database with freshly
+// detected ones. A detected anomaly that is also marked is listed once, as
+// it was marked.
+func MergeAnomalies(marked, detected []Anomaly) []Anomaly {
+	out := make([]Anomaly, 0, len(marked)+len(detected))
+	seen := make(map[string]bool)
+	for _, a := range marked {
+		a.Marked = true
+		seen[a.key()] = true
+		out = append(out, a)
+	}
+	for _, a := range detected {
+		if !seen[a.key()] {
+			out = append(out, a)
+		}
+	}
+	sortAnomalies(out)
+	return out
+}
+
+// ExcludeAnomalies returns copies of snapshots with the excess downloads of
+// each anomaly removed from its asset in every snapshot from the end of its
+// interval on, so that the cumulative counts continue as if the spike had
+// not happened. Counts never drop below zero. Release and snapshot totals
+// are recomputed.
+func ExcludeAnomalies(snapshots []ReleaseStats, anomalies []Anomaly) []ReleaseStats {
+	excess := make(map[string][]Anomaly)
+	for _, a := range anomalies {
+		excess[a.Tag+"/"+a.Asset] = append(excess[a.Tag+"/"+a.Asset], a)
+	}
+
+	out := make([]ReleaseStats, len(snapshots))
+	for i, snap := range snapshots {
+		snap.Releases = slices.Clone(snap.Releases)
+		for j := range snap.Releases {
+			rel := &snap.Releases[j]
+			rel.Assets = slices.Clone(rel.Assets)
+			for k := range rel.Assets {
+				asset := &rel.Assets[k]
+				for _, a := range excess[rel.Tag+"/"+asset.Name] {
+					if !snap.FetchedAt.Before(a.End) {
+						asset.DownloadCount -= int(math.Round(a.Excess))
+					}
+				}
+				// A mark made before the asset was reset, e.g. re-uploaded,
+				// can exceed its count
+				asset.DownloadCount = max(asset.DownloadCount, 0)
+			}
+		}
+		updateTotals(&snap)
+		out[i] = snap
+	}
+	return out
+}
+
+// FindAnomalies detects the anomalies in snapshots of owner/repo and merges
+// them with those marked in the database within the snapshots' range.
+func (d *Database) FindAnomalies(owner, repo string, snapshots []ReleaseStats, opts AnomalyOptions) ([]Anomaly, error) {
+	if len(snapshots) == 0 {
+		return []Anomaly{}, nil
+	}
+	first, last := snapshots[0].FetchedAt, snapshots[0].FetchedAt
+	for _, s := range snapshots[1:] {
+		first, last = minTime(first, s.FetchedAt), maxTime(last, s.FetchedAt)
+	}
+	marked, err := d.ListAnomalies(owner, repo, first, last)
+	if err != nil {
+		return nil, err
+	}
+	return MergeAnomalies(marked, DetectAnomalies(snapshots, opts)), nil
+}
+
+// MarkAnomalies stores anomalies of owner/repo in the database, replacing
+// earlier marks of the same intervals.
+func (d *Database) MarkAnomalies(owner, repo string, anomalies []Anomaly) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, a := range anomalies {
+		_, err := tx.Exec(
+			`INSERT INTO anomalies (owner, repo, tag, asset, start_at, end_at, downloads, per_day, baseline, score, excess, marked_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT (owner, repo, tag, asset, end_at) DO UPDATE SET
+				start_at = excluded.start_at,
+				downloads = excluded.downloads,
+				per_day = excluded.per_day,
+				baseline = excluded.baseline,
+				score = excluded.score,
+				excess = excluded.excess,
+				marked_at = excluded.marked_at`,
+			owner, repo, a.Tag, a.Asset, a.Start, a.End, a.Downloads, a.PerDay, a.Baseline, a.Score, a.Excess, now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to mark anomaly: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListAnomalies returns the anomalies of owner/repo marked in the database
+// whose interval ends between start and end, oldest first.
+func (d *Database) ListAnomalies(owner, repo string, start, end time.Time) ([]Anomaly, error) {
+	rows, err := d.db.Query(
+		`SELECT tag, asset, start_at, end_at, downloads, per_day, baseline, score, excess
+		 FROM anomalies
+		 WHERE owner = ? AND repo = ? AND end_at BETWEEN ? AND ?
+		 ORDER BY end_at, tag, asset`,
+		owner, repo, start, end,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	anomalies := make([]Anomaly, 0)
+	for rows.Next() {
+		a := Anomaly{Marked: true}
+		if err := rows.Scan(&a.Tag, &a.Asset, &a.Start, &a.End, &a.Downloads, &a.PerDay, &a.Baseline, &a.Score, &a.Excess); err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
+
+// UnmarkAnomalies removes the marked anomalies of owner/repo whose interval
+// ends between start and end and whose tag and asset match the globs, which
+// match everything when empty, and returns how many there were.
+func (d *Database) UnmarkAnomalies(owner, repo, tagGlob, assetGlob string, start, end time.Time) (int64, error) {
+	for _, glob := range []string{tagGlob, assetGlob} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return 0, fmt.Errorf("invalid pattern %q: %w", glob, err)
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT id, tag, asset FROM anomalies WHERE owner = ? AND repo = ? AND end_at BETWEEN ? AND ?`,
+		owner, repo, start, end,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query anomalies: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var tag, asset string
+		if err := rows.Scan(&id, &tag, &asset); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan anomaly: %w", err)
+		}
+		if globMatch(tagGlob, tag) && globMatch(assetGlob, asset) {
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("failed to read anomalies: %w", err)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`DELETE FROM anomalies WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to unmark anomalies: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to unmark anomalies: %w", err)
+	}
+	return int64(len(ids)), nil
+}
+
+// globMatch reports whether name matches glob, an empty glob matching
+// every name.
+func globMatch(glob, name string) bool {
+	if glob == "" {
+		return true
+	}
+	ok, _ := path.Match(glob, name)
+	return ok
+}
+
+// AnomaliesReport renders the anomalies command.
+type AnomaliesReport struct {
+	Owner     string         `json:"owner" yaml:"owner"`
+	Repo      string         `json:"repo" yaml:"repo"`
+	Options   AnomalyOptions `json:"options" yaml:"options"`
+	Anomalies []Anomaly      `json:"anomalies" yaml:"anomalies"`
+}
+
+// NewAnomaliesReport returns a report of anomalies found with opts.
+func NewAnomaliesReport(owner, repo string, opts AnomalyOptions, anomalies []Anomaly) *AnomaliesReport {
+	return &AnomaliesReport{Owner: owner, Repo: repo, Options: opts.withDefaults(), Anomalies: anomalies}
+}
+
+// WriteText writes the anomalies as an aligned table.
+func (r *AnomaliesReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nDownload spikes for %s/%s (robust z-score above %g against the preceding %d intervals)\n\n",
+		r.Owner, r.Repo, r.Options.Threshold, r.Options.Window)
+	if len(r.Anomalies) == 0 {
+		_, err := fmt.Fprintln(out, "No download spikes found")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RELEASE\tASSET\tFROM\tTO\tDOWNLOADS\tPER DAY\tBASELINE/DAY\tSCORE\tEXCESS\tMARKED")
+	fmt.Fprintln(w, "---\t---\t---\t---\t---\t---\t---\t---\t---\t---")
+	for _, a := range r.Anomalies {
+		marked := ""
+		if a.Marked {
+			marked = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%.0f\t%.1f\t%.1f\t%.1f\t%.0f\t%s\n",
+			a.Tag, a.Asset, a.Start.Format("2006-01-02 15:04"), a.End.Format("2006-01-02 15:04"),
+			a.Downloads, a.PerDay, a.Baseline, a.Score, a.Excess, marked)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// Table returns one row per anomaly.
+func (r *AnomaliesReport) Table() ([]string, [][]string) {
+	header := []string{"tag", "asset", "start", "end", "downloads", "per_day", "baseline_per_day", "score", "excess", "marked"}
+	rows := make([][]string, 0, len(r.Anomalies))
+	for _, a := range r.Anomalies {
+		rows = append(rows, []string{
+			a.Tag, a.Asset,
+			a.Start.Format(time.RFC3339), a.End.Format(time.RFC3339),
+			strconv.FormatFloat(a.Downloads, 'f', -1, 64),
+			strconv.FormatFloat(a.PerDay, 'f', 2, 64),
+			strconv.FormatFloat(a.Baseline, 'f', 2, 64),
+			strconv.FormatFloat(a.Score, 'f', 2, 64),
+			strconv.FormatFloat(a.Excess, 'f', 0, 64),
+			strconv.FormatBool(a.Marked),
+		})
+	}
+	return header, rows
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// spikeSnapshots returns daily snapshots of sampleStats in which v1.1.0's
+// asset gains the given downloads per day.
+func spikeSnapshots(daily ...int) []ReleaseStats {
+	snapshots := make([]ReleaseStats, 0, len(daily)+1)
+	total := 1000
+	for day := 0; day <= len(daily); day++ {
+		if day > 0 {
+			total += daily[day-1]
+		}
+		s := sampleStats()
+		s.FetchedAt = alertStart.AddDate(0, 0, day)
+		s.Releases[1].Assets[0].DownloadCount = total
+		updateTotals(s)
+		snapshots = append(snapshots, *s)
+	}
+	return snapshots
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	daily := []int{100, 120, 90, 110, 105, 95, 2600, 100, 115}
+	anomalies := DetectAnomalies(spikeSnapshots(daily...), AnomalyOptions{})
+	if len(anomalies) != 1 {
+		t.Fatalf("expected one spike, got %+v", anomalies)
+	}
+	a := anomalies[0]
+	if a.Tag != "v1.1.0" || a.Asset != "asset2.tar.gz" || !a.End.Equal(alertStart.AddDate(0, 0, 7)) {
+		t.Errorf("unexpected spike %+v", a)
+	}
+	if a.Downloads != 2600 || a.Baseline != 102.5 || a.Excess != 2497.5 || a.Score < 100 {
+		t.Errorf("unexpected spike values %+v", a)
+	}
+
+	// Ordinary noise, a spike below min_downloads and a spike without
+	// enough history are not flagged
+	for _, daily := range [][]int{
+		{100, 120, 90, 110, 105, 95, 180, 100},
+		{1, 0, 2, 1, 0, 1, 60, 1},
+		{100, 120, 90, 2600, 110},
+	} {
+		if anomalies := DetectAnomalies(spikeSnapshots(daily...), AnomalyOptions{}); len(anomalies) != 0 {
+			t.Errorf("%v: expected no spikes, got %+v", daily, anomalies)
+		}
+	}
+	if anomalies := DetectAnomalies(spikeSnapshots(1, 0, 2, 1, 0, 1, 60, 1), AnomalyOptions{MinDownloads: 50}); len(anomalies) != 1 {
+		t.Errorf("expected a spike with a lower min_downloads, got %+v", anomalies)
+	}
+}
+
+func TestExcludeAnomalies(t *testing.T) {
+	snapshots := spikeSnapshots(100, 120, 90, 110, 105, 95, 2600, 100, 115)
+	excluded := ExcludeAnomalies(snapshots, DetectAnomalies(snapshots, AnomalyOptions{}))
+
+	// 2497.5 excess downloads round to 2498
+	for day, want := range map[int]int{6: 1620, 7: 1722, 9: 1937} {
+		if got := excluded[day].Releases[1].Assets[0].DownloadCount; got != want {
+			t.Errorf("day %d: expected %d downloads, got %d", day, want, got)
+		}
+		if got := excluded[day].TotalDownloads; got != want+5 {
+			t.Errorf("day %d: expected total %d, got %d", day, want+5, got)
+		}
+	}
+	if snapshots[9].Releases[1].Assets[0].DownloadCount != 4435 {
+		t.Errorf("expected the input snapshots to be left unchanged")
+	}
+
+	// The asset was re-uploaded after the spike, so its count restarted
+	reset := slices.Clone(snapshots)
+	reset[9].Releases = slices.Clone(reset[9].Releases)
+	reset[9].Releases[1].Assets = []Asset{{Name: reset[9].Releases[1].Assets[0].Name, DownloadCount: 40}}
+	excluded = ExcludeAnomalies(reset, DetectAnomalies(snapshots, AnomalyOptions{}))
+	if got := excluded[9].Releases[1].Assets[0].DownloadCount; got != 0 || excluded[9].TotalDownloads != 5 {
+		t.Errorf("expected the count to stop at 0, got %d (total %d)", got, excluded[9].TotalDownloads)
+	}
+}
+
+func TestMarkAnomalies(t *testing.T) {
+	db := newTestDatabase(t)
+	snapshots := spikeSnapshots(100, 120, 90, 110, 105, 95, 2600, 100, 115)
+	detected := DetectAnomalies(snapshots, AnomalyOptions{})
+	if err := db.MarkAnomalies("owner", "repo", detected); err != nil {
+		t.Fatalf("MarkAnomalies failed: %v", err)
+	}
+	// Marking again replaces the earlier mark
+	if err := db.MarkAnomalies("owner", "repo", detected); err != nil {
+		t.Fatalf("MarkAnomalies failed: %v", err)
+	}
+
+	// A marked spike stays excluded when stricter settings no longer flag it
+	found, err := db.FindAnomalies("owner", "repo", snapshots, AnomalyOptions{MinDownloads: 5000})
+	if err != nil || len(found) != 1 || !found[0].Marked || found[0].Excess != detected[0].Excess {
+		t.Fatalf("expected the marked spike, got %+v, %v", found, err)
+	}
+	if found, _ := db.FindAnomalies("owner", "repo", snapshots[:7], AnomalyOptions{MinDownloads: 5000}); len(found) != 0 {
+		t.Errorf("expected no marked spikes before %s, got %+v", snapshots[6].FetchedAt, found)
+	}
+	if found, _ := db.FindAnomalies("other", "repo", snapshots, AnomalyOptions{}); len(found) != 1 || found[0].Marked {
+		t.Errorf("expected an unmarked spike for another repository, got %+v", found)
+	}
+
+	for _, sel := range []struct{ tag, asset string }{{"v2.*", ""}, {"", "*.zip"}} {
+		if n, err := db.UnmarkAnomalies("owner", "repo", sel.tag, sel.asset, time.Time{}, alertStart.AddDate(1, 0, 0)); err != nil || n != 0 {
+			t.Fatalf("UnmarkAnomalies(%q, %q) = %d, %v, want no match", sel.tag, sel.asset, n, err)
+		}
+	}
+	if n, err := db.UnmarkAnomalies("owner", "repo", "", "", time.Time{}, snapshots[5].FetchedAt); err != nil || n != 0 {
+		t.Fatalf("UnmarkAnomalies before the spike = %d, %v", n, err)
+	}
+	if n, err := db.UnmarkAnomalies("owner", "repo", "v1.*", "*.tar.gz", time.Time{}, alertStart.AddDate(1, 0, 0)); err != nil || n != 1 {
+		t.Fatalf("UnmarkAnomalies = %d, %v", n, err)
+	}
+	if marked, _ := db.ListAnomalies("owner", "repo", time.Time{}, alertStart.AddDate(1, 0, 0)); len(marked) != 0 {
+		t.Errorf("expected no marked spikes, got %+v", marked)
+	}
+}
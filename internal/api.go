@@ -0,0 +1,384 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the path under which APIServer serves its routes.
+const APIPrefix = "/api/v1"
+
+// Limits for paginated API responses.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// APIServer serves stored statistics as a read-only JSON API.
+type APIServer struct {
+	db *Database
+
+	// Projects lists the repositories for /projects. It defaults to the
+	// watchlist stored in the database.
+	Projects func(group string) ([]Project, error)
+	// AllowedOrigins are the origins browsers may call the API from; "*"
+	// allows any origin. Without origins no CORS headers are sent.
+	AllowedOrigins []string
+}
+
+// NewAPIServer returns an API over db.
+func NewAPIServer(db *Database) *APIServer {
+	return &APIServer{db: db, Projects: db.ListProjects}
+}
+
+// Register adds the API routes to mux.
+func (s *APIServer) Register(mux *http.ServeMux) {
+	routes := map[string]func(*http.Request) (any, error){
+		"/projects":                      s.projects,
+		"/repos/{owner}/{repo}/latest":   s.latest,
+		"/repos/{owner}/{repo}/history":  s.history,
+		"/repos/{owner}/{repo}/series":   s.series,
+		"/repos/{owner}/{repo}/compare":  s.compare,
+		"/repos/{owner}/{repo}/releases": s.releases,
+	}
+	for path, h := range routes {
+		mux.Handle("GET "+APIPrefix+path, s.cors(jsonHandler(h)))
+	}
+	mux.Handle("OPTIONS "+APIPrefix+"/", s.cors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+}
+
+// apiError is an error with the HTTP status to report it with.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+
+func badRequest(format string, args ...any) error {
+	return &apiError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+func notFound(format string, args ...any) error {
+	return &apiError{http.StatusNotFound, fmt.Errorf(format, args...)}
+}
+
+// errorStatus returns the HTTP status to report err with: its own for an
+// apiError, 400 for an invalid snapshot reference, 404 for a missing
+// snapshot and 500 otherwise.
+func errorStatus(err error) int {
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+		return e.status
+	case errors.Is(err, ErrInvalidRef):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNoSnapshot):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// jsonHandler encodes what h returns as JSON with an ETag, answering
+// conditional requests whose If-None-Match matches with 304 Not Modified.
+func jsonHandler(h func(*http.Request) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		v, err := h(r)
+		if err != nil {
+			status = errorStatus(err)
+			message := err.Error()
+			// Server errors may carry database details
+			if status == http.StatusInternalServerError {
+				log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+				message = http.StatusText(status)
+			}
+			v = map[string]string{"error": message}
+		}
+
+		body, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+			return
+		}
+		body = append(body, '\n')
+
+		w.Header().Set("Content-Type", "application/json")
+		if status == http.StatusOK {
+			sum := sha256.Sum256(body)
+			etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "no-cache")
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	})
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison that RFC 9110 prescribes for it.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cors adds CORS headers for allowed origins and answers preflight requests.
+func (s *APIServer) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.AllowedOrigins) > 0 {
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && len(s.AllowedOrigins) > 0 {
+			if slices.Contains(s.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else if slices.Contains(s.AllowedOrigins, origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "If-None-Match")
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeRange reads the from and to query parameters. to defaults to now and
+// from to defaultDays before to; a zero defaultDays leaves from open.
+func timeRange(r *http.Request, defaultDays int) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	to, err := ParseDate(q.Get("to"), true)
+	if err != nil {
+		return time.Time{}, time.Time{}, badRequest("invalid to: %v", err)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from, err := ParseDate(q.Get("from"), false)
+	if err != nil {
+		return time.Time{}, time.Time{}, badRequest("invalid from: %v", err)
+	}
+	if from.IsZero() && defaultDays > 0 {
+		from = to.AddDate(0, 0, -defaultDays)
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, badRequest("from is after to")
+	}
+	return from, to, nil
+}
+
+// intParam reads a non-negative integer query parameter.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, badRequest("invalid %s %q", name, s)
+	}
+	return n, nil
+}
+
+func (s *APIServer) projects(r *http.Request) (any, error) {
+	projects, err := s.Projects(r.URL.Query().Get("group"))
+	if err != nil {
+		return nil, err
+	}
+	if projects == nil {
+		projects = []Project{}
+	}
+	return projects, nil
+}
+
+// latestSnapshot loads the newest snapshot of the repository in the path.
+func (s *APIServer) latestSnapshot(r *http.Request) (*ReleaseStats, error) {
+	owner, repo := r.PathValue("owner"), r.PathValue("repo")
+	stats, err := s.db.GetLatestStats(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if stats.FetchedAt.IsZero() {
+		return nil, notFound("no snapshot stored for %s/%s", owner, repo)
+	}
+	return stats, nil
+}
+
+func (s *APIServer) latest(r *http.Request) (any, error) {
+	return s.latestSnapshot(r)
+}
+
+// releases lists the releases of the newest snapshot without their assets.
+func (s *APIServer) releases(r *http.Request) (any, error) {
+	stats, err := s.latestSnapshot(r)
+	if err != nil {
+		return nil, err
+	}
+	order, err := ParseReleaseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	filtered, err := ReleaseFilter{TagGlob: r.URL.Query().Get("tag"), Sort: order}.Apply(stats)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	type release struct {
+		Release
+		Assets int `json:"assets"`
+	}
+	out := make([]release, 0, len(filtered.Releases))
+	for _, rel := range filtered.Releases {
+		out = append(out, release{Release: rel, Assets: len(rel.Assets)})
+	}
+	return out, nil
+}
+
+// HistoryPage is one page of a repository's snapshots, newest first.
+type HistoryPage struct {
+	Owner     string         `json:"owner"`
+	Repo      string         `json:"repo"`
+	Total     int            `json:"total"`
+	Limit     int            `json:"limit"`
+	Offset    int            `json:"offset"`
+	Snapshots []HistoryEntry `json:"snapshots"`
+}
+
+func (s *APIServer) history(r *http.Request) (any, error) {
+	from, to, err := timeRange(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := intParam(r, "limit", defaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 || limit > maxPageSize {
+		return nil, badRequest("limit must be between 1 and %d", maxPageSize)
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	top, err := intParam(r, "top", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repo := r.PathValue("owner"), r.PathValue("repo")
+	snapshots, total, err := s.db.GetStatsPage(owner, repo, from, to, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryPage{
+		Owner:     owner,
+		Repo:      repo,
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+		Snapshots: NewHistoryReport(owner, repo, snapshots, top).Snapshots,
+	}, nil
+}
+
+// APISeries is a download series with its points.
+type APISeries struct {
+	Series
+	Points []Point `json:"points"`
+}
+
+func (s *APIServer) series(r *http.Request) (any, error) {
+	q := r.URL.Query()
+	level := SeriesRepo
+	if l := q.Get("level"); l != "" {
+		var err error
+		if level, err = ParseSeriesLevel(l); err != nil {
+			return nil, badRequest("%v", err)
+		}
+	}
+	from, to, err := timeRange(r, 90)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repo := r.PathValue("owner"), r.PathValue("repo")
+	snapshots, err := s.db.GetStatsBetween(owner, repo, from, to)
+	if err != nil {
+		return nil, err
+	}
+	filter := ReleaseFilter{TagGlob: q.Get("tag")}
+	for i := range snapshots {
+		filtered, err := filter.Apply(&snapshots[i])
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		snapshots[i] = *filtered
+	}
+
+	asset := q.Get("asset")
+	out := make([]APISeries, 0)
+	for _, ser := range ExtractSeries(snapshots, level) {
+		if asset != "" && ser.Asset != asset {
+			continue
+		}
+		out = append(out, APISeries{Series: ser, Points: ser.Points})
+	}
+	return out, nil
+}
+
+// compare compares two snapshots given as references understood by
+// Database.ResolveSnapshot. to defaults to the latest snapshot and from to
+// days (default 30) before it.
+func (s *APIServer) compare(r *http.Request) (any, error) {
+	q := r.URL.Query()
+	owner, repo := r.PathValue("owner"), r.PathValue("repo")
+	days, err := intParam(r, "days", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	toRef := q.Get("to")
+	if toRef == "" {
+		toRef = LatestRef
+	}
+	newest, err := s.db.ResolveSnapshot(owner, repo, toRef)
+	if err != nil {
+		return nil, err
+	}
+	var oldest *ReleaseStats
+	if fromRef := q.Get("from"); fromRef != "" {
+		oldest, err = s.db.ResolveSnapshot(owner, repo, fromRef)
+	} else {
+		oldest, err = s.db.GetSnapshotAt(owner, repo, newest.FetchedAt.AddDate(0, 0, -days))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if oldest.FetchedAt.After(newest.FetchedAt) {
+		return nil, badRequest("from (%s) is after to (%s)", oldest.FetchedAt.Format(time.RFC3339), newest.FetchedAt.Format(time.RFC3339))
+	}
+	return NewCompareReport(oldest, newest), nil
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	db := newTestDatabase(t)
+	if err := db.TrackProject("owner", "repo", "tools", "6h"); err != nil {
+		t.Fatalf("TrackProject failed: %v", err)
+	}
+
+	storeDailySnapshots(t, db, 5, nil)
+
+	api := NewAPIServer(db)
+	api.AllowedOrigins = []string{"https://dash.example.com"}
+	mux := http.NewServeMux()
+	api.Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func apiGet(t *testing.T, srv *httptest.Server, path string, header http.Header, v any) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	for k, vals := range header {
+		req.Header[k] = vals
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: invalid JSON: %v", path, err)
+		}
+	}
+	return resp
+}
+
+func TestAPIRoutes(t *testing.T) {
+	srv := newTestAPI(t)
+
+	var projects []Project
+	apiGet(t, srv, "/api/v1/projects?group=tools", nil, &projects)
+	if len(projects) != 1 || projects[0].Interval != "6h" {
+		t.Errorf("unexpected projects %+v", projects)
+	}
+
+	var latest ReleaseStats
+	apiGet(t, srv, "/api/v1/repos/owner/repo/latest", nil, &latest)
+	if latest.TotalDownloads != 35 || !latest.FetchedAt.Equal(time.Date(2024, 7, 5, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected latest snapshot: %d at %s", latest.TotalDownloads, latest.FetchedAt)
+	}
+	if resp := apiGet(t, srv, "/api/v1/repos/owner/missing/latest", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a repository without snapshots, got %d", resp.StatusCode)
+	}
+
+	var page HistoryPage
+	apiGet(t, srv, "/api/v1/repos/owner/repo/history?limit=2&offset=1&from=2024-07-02T00:00:00Z", nil, &page)
+	if page.Total != 4 || len(page.Snapshots) != 2 || page.Snapshots[0].TotalDownloads != 30 {
+		t.Errorf("unexpected history page %+v", page)
+	}
+	if resp := apiGet(t, srv, "/api/v1/repos/owner/repo/history?limit=0", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit=0, got %d", resp.StatusCode)
+	}
+
+	var series []APISeries
+	apiGet(t, srv, "/api/v1/repos/owner/repo/series?level=asset&asset=asset2.tar.gz&from=2024-06-01&to=2024-07-31", nil, &series)
+	if len(series) != 1 || len(series[0].Points) != 5 || series[0].Points[4].Value != 30 {
+		t.Errorf("unexpected series %+v", series)
+	}
+
+	var compare CompareReport
+	apiGet(t, srv, "/api/v1/repos/owner/repo/compare?from=2024-07-02T12:00:00Z&to=latest", nil, &compare)
+	if compare.Growth != 15 || compare.Days != 3 {
+		t.Errorf("unexpected comparison: growth %d over %d days", compare.Growth, compare.Days)
+	}
+	if resp := apiGet(t, srv, "/api/v1/repos/owner/repo/compare?from=latest&to=2024-07-02T12:00:00Z", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for reversed snapshots, got %d", resp.StatusCode)
+	}
+	if resp := apiGet(t, srv, "/api/v1/repos/owner/repo/compare?from=no-such-baseline", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown reference, got %d", resp.StatusCode)
+	}
+	if resp := apiGet(t, srv, "/api/v1/repos/owner/repo/compare?from=999999", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing snapshot, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIETagAndCORS(t *testing.T) {
+	srv := newTestAPI(t)
+
+	resp := apiGet(t, srv, "/api/v1/repos/owner/repo/latest", http.Header{"Origin": {"https://dash.example.com"}}, nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Access-Control-Allow-Origin") != "https://dash.example.com" {
+		t.Fatalf("missing ETag or CORS headers: %v", resp.Header)
+	}
+
+	resp = apiGet(t, srv, "/api/v1/repos/owner/repo/latest", http.Header{"If-None-Match": {`"other", ` + etag}}, nil)
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", resp.StatusCode)
+	}
+
+	resp = apiGet(t, srv, "/api/v1/projects", http.Header{"Origin": {"https://evil.example.com"}}, nil)
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("unexpected Access-Control-Allow-Origin %q for another origin", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/api/v1/repos/owner/repo/history", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	preflight, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("preflight failed: %v", err)
+	}
+	preflight.Body.Close()
+	if preflight.StatusCode != http.StatusNoContent || preflight.Header.Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("unexpected preflight response %d %v", preflight.StatusCode, preflight.Header)
+	}
+
+	post, err := http.Post(srv.URL+"/api/v1/projects", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected the API to be read-only, got %d for POST", post.StatusCode)
+	}
+}
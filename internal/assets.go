@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AssetKind says whether an asset is a real artifact or an auxiliary file
+// that installers and verifiers download alongside it.
+type AssetKind string
+
+const (
+	AssetArtifact    AssetKind = "artifact"
+	AssetChecksum    AssetKind = "checksum"
+	AssetSignature   AssetKind = "signature"
+	AssetCertificate AssetKind = "certificate"
+	AssetSBOM        AssetKind = "sbom"
+	AssetAttestation AssetKind = "attestation"
+	// AssetExcluded is an asset matched by a user exclude pattern.
+	AssetExcluded AssetKind = "excluded"
+)
+
+// Auxiliary reports whether assets of this kind are left out of totals.
+func (k AssetKind) Auxiliary() bool {
+	return k != "" && k != AssetArtifact
+}
+
+// auxiliaryPatterns are the built-in globs for auxiliary assets, matched
+// against the lower-cased asset name. Extensions come first so that
+// checksums.txt.sig is a signature rather than a checksum file.
+var auxiliaryPatterns = []struct {
+	glob string
+	kind AssetKind
+}{
+	{"*.sha1", AssetChecksum},
+	{"*.sha256", AssetChecksum},
+	{"*.sha256sum", AssetChecksum},
+	{"*.sha512", AssetChecksum},
+	{"*.md5", AssetChecksum},
+	{"*.sig", AssetSignature},
+	{"*.asc", AssetSignature},
+	{"*.gpg", AssetSignature},
+	{"*.minisig", AssetSignature},
+	{"*.pem", AssetCertificate},
+	{"*.crt", AssetCertificate},
+	{"*.cert", AssetCertificate},
+	{"*.sbom", AssetSBOM},
+	{"*.sbom.*", AssetSBOM},
+	{"*.spdx", AssetSBOM},
+	{"*.spdx.*", AssetSBOM},
+	{"*.cdx.json", AssetSBOM},
+	{"*.cdx.xml", AssetSBOM},
+	{"*.intoto.jsonl", AssetAttestation},
+	{"*.sigstore", AssetAttestation},
+	{"*.sigstore.json", AssetAttestation},
+	{"*.att", AssetAttestation},
+	{"*checksums*", AssetChecksum},
+	{"*sha256sums*", AssetChecksum},
+	{"*sha512sums*", AssetChecksum},
+}
+
+// AssetRules adjusts which assets count towards download totals. Patterns
+// are shell globs matched case-insensitively against the asset name.
+type AssetRules struct {
+	// Include counts matching assets as artifacts, overriding Exclude and
+	// the built-in auxiliary patterns.
+	Include []string `yaml:"include"`
+	// Exclude leaves matching assets out of totals.
+	Exclude []string `yaml:"exclude"`
+}
+
+// AssetClassifier decides which assets count towards download totals. A nil
+// *AssetClassifier applies the built-in patterns only.
+type AssetClassifier struct {
+	rules AssetRules
+}
+
+// NewAssetClassifier validates rules and returns a classifier applying them
+// on top of the built-in patterns.
+func NewAssetClassifier(rules AssetRules) (*AssetClassifier, error) {
+	c := &AssetClassifier{}
+	for _, patterns := range []*[]string{&rules.Include, &rules.Exclude} {
+		for _, p := range *patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid asset pattern %q: %w", p, err)
+			}
+		}
+	}
+	for _, p := range rules.Include {
+		c.rules.Include = append(c.rules.Include, strings.ToLower(p))
+	}
+	for _, p := range rules.Exclude {
+		c.rules.Exclude = append(c.rules.Exclude, strings.ToLower(p))
+	}
+	return c, nil
+}
+
+// Classify returns the kind of an asset name.
+func (c *AssetClassifier) Classify(name string) AssetKind {
+	lower := strings.ToLower(name)
+	if c != nil {
+		if matchAny(c.rules.Include, lower) {
+			return AssetArtifact
+		}
+		if matchAny(c.rules.Exclude, lower) {
+			return AssetExcluded
+		}
+	}
+	for _, p := range auxiliaryPatterns {
+		if ok, _ := path.Match(p.glob, lower); ok {
+			return p.kind
+		}
+	}
+	return AssetArtifact
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply sets the kind of every asset in stats and recomputes the release and
+// snapshot totals: TotalDownloads counts artifacts only and
+// AuxiliaryDownloads counts the rest.
+func (c *AssetClassifier) Apply(stats *ReleaseStats) {
+	for i := range stats.Releases {
+		for j := range stats.Releases[i].Assets {
+			asset := &stats.Releases[i].Assets[j]
+			asset.Kind = c.Classify(asset.Name)
+		}
+	}
+	updateTotals(stats)
+}
+
+// updateTotals recomputes the release and snapshot totals from the asset
+// counts and their kinds.
+func updateTotals(stats *ReleaseStats) {
+	stats.TotalDownloads = 0
+	stats.AuxiliaryDownloads = 0
+	for i := range stats.Releases {
+		rel := &stats.Releases[i]
+		rel.TotalDownloads = 0
+		rel.AuxiliaryDownloads = 0
+		for _, asset := range rel.Assets {
+			if asset.Kind.Auxiliary() {
+				rel.AuxiliaryDownloads += asset.DownloadCount
+			} else {
+				rel.TotalDownloads += asset.DownloadCount
+			}
+		}
+		stats.TotalDownloads += rel.TotalDownloads
+		stats.AuxiliaryDownloads += rel.AuxiliaryDownloads
+	}
+}
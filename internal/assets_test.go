@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifyAsset(t *testing.T) {
+	tests := map[string]AssetKind{
+		"tool_2.1.0_linux_amd64.tar.gz":               AssetArtifact,
+		"checksums.txt":                               AssetChecksum,
+		"tool_2.1.0_checksums.txt":                    AssetChecksum,
+		"SHA256SUMS":                                  AssetChecksum,
+		"tool.tar.gz.sha256":                          AssetChecksum,
+		"checksums.txt.sig":                           AssetSignature,
+		"tool_2.1.0_linux_amd64.tar.gz.asc":           AssetSignature,
+		"checksums.txt.pem":                           AssetCertificate,
+		"tool_2.1.0_linux_amd64.tar.gz.sbom.json":     AssetSBOM,
+		"tool.spdx.json":                              AssetSBOM,
+		"multiple.intoto.jsonl":                       AssetAttestation,
+		"tool_2.1.0_linux_amd64.tar.gz.sigstore.json": AssetAttestation,
+	}
+
+	var classifier *AssetClassifier
+	for name, want := range tests {
+		if got := classifier.Classify(name); got != want {
+			t.Errorf("Classify(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestAssetRules(t *testing.T) {
+	classifier, err := NewAssetClassifier(AssetRules{
+		Include: []string{"*.sig"},
+		Exclude: []string{"*.sig", "*-debug.zip"},
+	})
+	if err != nil {
+		t.Fatalf("NewAssetClassifier failed: %v", err)
+	}
+
+	if got := classifier.Classify("tool.sig"); got != AssetArtifact {
+		t.Errorf("expected include to win over exclude and built-ins, got %q", got)
+	}
+	if got := classifier.Classify("Tool-DEBUG.zip"); got != AssetExcluded {
+		t.Errorf("expected case-insensitive exclude, got %q", got)
+	}
+
+	if _, err := NewAssetClassifier(AssetRules{Exclude: []string{"["}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestAssetClassifierApply(t *testing.T) {
+	stats := &ReleaseStats{
+		Releases: []Release{{
+			Tag: "v1.0.0",
+			Assets: []Asset{
+				{Name: "tool_linux_amd64.tar.gz", DownloadCount: 100},
+				{Name: "checksums.txt", DownloadCount: 40},
+				{Name: "checksums.txt.sig", DownloadCount: 10},
+			},
+			TotalDownloads: 150,
+		}},
+		TotalDownloads: 150,
+	}
+
+	var classifier *AssetClassifier
+	classifier.Apply(stats)
+
+	rel := stats.Releases[0]
+	if rel.TotalDownloads != 100 || rel.AuxiliaryDownloads != 50 {
+		t.Fatalf("expected 100 artifact and 50 auxiliary downloads, got %d and %d", rel.TotalDownloads, rel.AuxiliaryDownloads)
+	}
+	if stats.TotalDownloads != 100 || stats.AuxiliaryDownloads != 50 {
+		t.Fatalf("unexpected snapshot totals: %d and %d", stats.TotalDownloads, stats.AuxiliaryDownloads)
+	}
+	if rel.Assets[1].Kind != AssetChecksum {
+		t.Fatalf("expected checksums.txt to be marked as a checksum, got %q", rel.Assets[1].Kind)
+	}
+}
+
+func TestDatabaseRecomputesTotalsOnLoad(t *testing.T) {
+	db := newTestDatabase(t)
+
+	// Stored as fetched before auxiliary assets were excluded
+	stats := &ReleaseStats{
+		Owner:     "owner",
+		Repo:      "repo",
+		FetchedAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Releases: []Release{{
+			Name: "v1.0.0",
+			Tag:  "v1.0.0",
+			Assets: []Asset{
+				{Name: "tool.zip", DownloadCount: 30},
+				{Name: "tool.zip.sig", DownloadCount: 20},
+			},
+			TotalDownloads: 50,
+		}},
+		TotalDownloads: 50,
+	}
+	if err := db.StoreStats(stats); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+
+	latest, err := db.GetLatestStats("owner", "repo")
+	if err != nil {
+		t.Fatalf("GetLatestStats failed: %v", err)
+	}
+	if latest.TotalDownloads != 30 || latest.AuxiliaryDownloads != 20 {
+		t.Fatalf("expected totals recomputed to 30 + 20 auxiliary, got %d + %d", latest.TotalDownloads, latest.AuxiliaryDownloads)
+	}
+
+	classifier, err := NewAssetClassifier(AssetRules{Include: []string{"*.sig"}})
+	if err != nil {
+		t.Fatalf("NewAssetClassifier failed: %v", err)
+	}
+	db.SetAssetClassifier(classifier)
+
+	latest, err = db.GetLatestStats("owner", "repo")
+	if err != nil {
+		t.Fatalf("GetLatestStats failed: %v", err)
+	}
+	if latest.TotalDownloads != 50 || latest.AuxiliaryDownloads != 0 {
+		t.Fatalf("expected include rule to count signatures, got %d + %d", latest.TotalDownloads, latest.AuxiliaryDownloads)
+	}
+}
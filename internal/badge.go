@@ -0,0 +1,393 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BadgeMetric is the download count a badge shows.
+type BadgeMetric string
+
+const (
+	BadgeTotal   BadgeMetric = "total"
+	BadgeLatest  BadgeMetric = "latest"
+	BadgeMonthly BadgeMetric = "monthly"
+	BadgeAsset   BadgeMetric = "asset"
+)
+
+// ParseBadgeMetric validates a badge metric name.
+func ParseBadgeMetric(s string) (BadgeMetric, error) {
+	switch m := BadgeMetric(s); m {
+	case BadgeTotal, BadgeLatest, BadgeMonthly, BadgeAsset:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown badge metric %q (want total, latest, monthly or asset)", s)
+}
+
+// BadgeStyle is the look of a badge, following shields.io.
+type BadgeStyle string
+
+const (
+	BadgeFlat       BadgeStyle = "flat"
+	BadgeFlatSquare BadgeStyle = "flat-square"
+)
+
+// ParseBadgeStyle validates a badge style name.
+func ParseBadgeStyle(s string) (BadgeStyle, error) {
+	switch st := BadgeStyle(s); st {
+	case BadgeFlat, BadgeFlatSquare:
+		return st, nil
+	case "":
+		return BadgeFlat, nil
+	}
+	return "", fmt.Errorf("unknown badge style %q (want flat or flat-square)", s)
+}
+
+// badgeColors are the shields.io colour names.
+var badgeColors = map[string]string{
+	"brightgreen":   "#4c1",
+	"green":         "#97ca00",
+	"yellowgreen":   "#a4a61d",
+	"yellow":        "#dfb317",
+	"orange":        "#fe7d37",
+	"red":           "#e05d44",
+	"blue":          "#007ec6",
+	"grey":          "#555",
+	"gray":          "#555",
+	"lightgrey":     "#9f9f9f",
+	"lightgray":     "#9f9f9f",
+	"success":       "#4c1",
+	"important":     "#fe7d37",
+	"critical":      "#e05d44",
+	"informational": "#007ec6",
+	"inactive":      "#9f9f9f",
+}
+
+var hexColor = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ParseBadgeColor accepts a shields.io colour name or a hex colour with or
+// without the leading "#", and returns the hex colour.
+func ParseBadgeColor(s string) (string, error) {
+	if c, ok := badgeColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	if hexColor.MatchString(s) {
+		return "#" + strings.TrimPrefix(s, "#"), nil
+	}
+	return "", fmt.Errorf("invalid colour %q (want a name such as brightgreen or a hex colour)", s)
+}
+
+// BadgeOptions select what a badge shows and how it looks. Empty fields
+// take defaults.
+type BadgeOptions struct {
+	Metric BadgeMetric
+	// Tag selects the release for the latest and asset metrics instead of
+	// the latest release.
+	Tag string
+	// Asset is a shell pattern matched against asset names for the asset
+	// metric; the downloads of all matches are added up.
+	Asset      string
+	Label      string
+	Color      string
+	LabelColor string
+	Style      BadgeStyle
+}
+
+// Badge is a two-part label and message badge in the style of shields.io.
+type Badge struct {
+	Label      string
+	Message    string
+	Color      string
+	LabelColor string
+	Style      BadgeStyle
+}
+
+// monthDays is the period of the monthly metric.
+const monthDays = 30
+
+// BuildBadge computes a download badge for owner/repo from the newest stored
+// snapshot. The monthly metric counts the downloads of the 30 days before
+// that snapshot, scaled to 30 days when less history is stored.
+func BuildBadge(db *Database, owner, repo string, opts BadgeOptions) (*Badge, error) {
+	b := &Badge{Label: "downloads", Color: "#4c1", LabelColor: "#555", Style: opts.Style}
+	if b.Style == "" {
+		b.Style = BadgeFlat
+	}
+	for _, c := range []struct {
+		spec string
+		dst  *string
+	}{{opts.Color, &b.Color}, {opts.LabelColor, &b.LabelColor}} {
+		if c.spec == "" {
+			continue
+		}
+		color, err := ParseBadgeColor(c.spec)
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		*c.dst = color
+	}
+
+	latest, err := db.GetLatestStats(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if latest.FetchedAt.IsZero() {
+		return nil, fmt.Errorf("%w for %s/%s", ErrNoSnapshot, owner, repo)
+	}
+
+	var count int
+	switch opts.Metric {
+	case BadgeTotal, "":
+		count = latest.TotalDownloads
+	case BadgeMonthly:
+		before, err := db.GetSnapshotAt(owner, repo, latest.FetchedAt.AddDate(0, 0, -monthDays))
+		if err != nil {
+			return nil, err
+		}
+		count = latest.TotalDownloads - before.TotalDownloads
+		// The closest snapshot is newer than a month ago with less history,
+		// and older after a gap in collection; scale what it covers to a
+		// month as trend does
+		covered := latest.FetchedAt.Sub(before.FetchedAt)
+		if covered <= 0 {
+			return nil, notFound("the monthly metric needs two snapshots of %s/%s", owner, repo)
+		}
+		if month := time.Duration(monthDays) * 24 * time.Hour; covered != month {
+			count = int(math.Round(float64(count) * float64(month) / float64(covered)))
+		}
+	case BadgeLatest, BadgeAsset:
+		rel := badgeRelease(latest, opts.Tag)
+		if rel == nil {
+			if opts.Tag != "" {
+				return nil, notFound("release %s not found for %s/%s", opts.Tag, owner, repo)
+			}
+			return nil, notFound("no releases stored for %s/%s", owner, repo)
+		}
+		b.Label = "downloads@" + rel.Tag
+		if opts.Metric == BadgeLatest {
+			count = rel.TotalDownloads
+			break
+		}
+
+		if opts.Asset == "" {
+			return nil, badRequest("the asset metric needs an asset name or pattern")
+		}
+		matched := 0
+		for _, a := range rel.Assets {
+			if ok, err := path.Match(opts.Asset, a.Name); err != nil {
+				return nil, badRequest("invalid asset pattern %q: %v", opts.Asset, err)
+			} else if ok {
+				count += a.DownloadCount
+				matched++
+			}
+		}
+		if matched == 0 {
+			return nil, notFound("no asset of %s matches %q", rel.Tag, opts.Asset)
+		}
+	default:
+		return nil, badRequest("unknown badge metric %q", opts.Metric)
+	}
+
+	b.Message = humanizeFloat(float64(count))
+	if opts.Metric == BadgeMonthly {
+		b.Message += "/month"
+	}
+	if opts.Label != "" {
+		b.Label = opts.Label
+	}
+	return b, nil
+}
+
+// badgeRelease returns the release tagged tag, or without a tag the most
+// recently created release that is not a pre-release, falling back to
+// pre-releases for repositories that only publish those.
+func badgeRelease(stats *ReleaseStats, tag string) *Release {
+	var latest, latestPre *Release
+	for i := range stats.Releases {
+		rel := &stats.Releases[i]
+		if tag != "" {
+			if rel.Tag == tag {
+				return rel
+			}
+			continue
+		}
+		if rel.IsPrerelease {
+			if latestPre == nil || rel.CreatedAt.After(latestPre.CreatedAt) {
+				latestPre = rel
+			}
+		} else if latest == nil || rel.CreatedAt.After(latest.CreatedAt) {
+			latest = rel
+		}
+	}
+	if latest == nil {
+		return latestPre
+	}
+	return latest
+}
+
+// ErrorBadge is shown instead of a count, so that a README still renders a
+// badge when the repository is unknown.
+func ErrorBadge(label, message string) *Badge {
+	return &Badge{Label: label, Message: message, Color: "#9f9f9f", LabelColor: "#555", Style: BadgeFlat}
+}
+
+// verdanaWidths approximates the advance of printable ASCII characters in
+// 11px Verdana, the font shields.io measures badges with, from space to "~".
+var verdanaWidths = [95]float64{
+	3.9, 4.3, 5.1, 9.0, 7.0, 12.3, 8.0, 3.0, 5.0, 5.0, 7.0, 9.0, 4.0, 5.0, 4.0, 5.0,
+	7.0, 7.0, 7.0, 7.0, 7.0, 7.0, 7.0, 7.0, 7.0, 7.0, 5.0, 5.0, 9.0, 9.0, 9.0, 6.0,
+	11.0, 7.5, 7.6, 7.7, 8.5, 7.0, 6.3, 8.5, 8.3, 4.6, 5.0, 7.6, 6.1, 9.4, 8.2, 8.7,
+	6.6, 8.7, 7.7, 7.5, 6.8, 8.0, 7.5, 10.9, 7.5, 6.8, 7.5, 5.0, 5.0, 5.0, 9.0, 7.0,
+	7.0, 6.6, 6.8, 5.8, 6.8, 6.6, 3.9, 6.8, 7.0, 3.0, 3.8, 6.5, 3.0, 10.7, 7.0, 6.7,
+	6.8, 6.8, 4.7, 5.7, 4.3, 7.0, 6.5, 9.0, 6.5, 6.5, 5.8, 7.0, 5.0, 7.0, 9.0,
+}
+
+// textWidth estimates the rendered width of s in pixels.
+func textWidth(s string) float64 {
+	w := 0.0
+	for _, r := range s {
+		if r >= ' ' && r <= '~' {
+			w += verdanaWidths[r-' ']
+		} else {
+			w += 7.5
+		}
+	}
+	return w
+}
+
+// lightColor reports whether a hex colour is light enough to need dark text.
+func lightColor(hex string) bool {
+	h := strings.TrimPrefix(hex, "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return false
+	}
+	r, g, b := float64(v>>16&0xff), float64(v>>8&0xff), float64(v&0xff)
+	return (0.299*r+0.587*g+0.114*b)/255 > 0.69
+}
+
+// WriteSVG renders the badge.
+func (b *Badge) WriteSVG(w io.Writer) error {
+	const pad = 5
+	labelW := int(textWidth(b.Label)+0.5) + 2*pad
+	messageW := int(textWidth(b.Message)+0.5) + 2*pad
+	width := labelW + messageW
+	title := escapeXML(b.Label + ": " + b.Message)
+
+	radius, gradient, fill := "3", `<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+"\n", `<rect width="`+strconv.Itoa(width)+`" height="20" fill="url(#s)"/>`
+	if b.Style == BadgeFlatSquare {
+		radius, gradient, fill = "0", "", ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s">`+"\n", width, title)
+	fmt.Fprintf(&sb, "<title>%s</title>\n", title)
+	sb.WriteString(gradient)
+	fmt.Fprintf(&sb, `<clipPath id="r"><rect width="%d" height="20" rx="%s" fill="#fff"/></clipPath>`+"\n", width, radius)
+	fmt.Fprintf(&sb, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="%s"/><rect x="%d" width="%d" height="20" fill="%s"/>%s</g>`+"\n",
+		labelW, b.LabelColor, labelW, messageW, b.Color, fill)
+	sb.WriteString(`<g text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` + "\n")
+	for _, part := range []struct {
+		text  string
+		x     float64
+		color string
+	}{
+		{b.Label, float64(labelW) / 2, b.LabelColor},
+		{b.Message, float64(labelW) + float64(messageW)/2, b.Color},
+	} {
+		text, shadow := "#fff", "#010101"
+		if lightColor(part.color) {
+			text, shadow = "#333", "#ccc"
+		}
+		if b.Style != BadgeFlatSquare {
+			fmt.Fprintf(&sb, `<text x="%s" y="15" fill="%s" fill-opacity=".3">%s</text>`, num(part.x), shadow, escapeXML(part.text))
+		}
+		fmt.Fprintf(&sb, `<text x="%s" y="14" fill="%s">%s</text>`+"\n", num(part.x), text, escapeXML(part.text))
+	}
+	sb.WriteString("</g>\n</svg>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// BadgeHandler serves badges from db at
+// /badge/{owner}/{repo}/{metric}.svg. Query parameters label, color,
+// labelColor, style, tag and asset map to BadgeOptions. Unknown repositories,
+// releases and assets get a grey "not found" badge with status 404 so pages
+// still render; other failures get an "error" badge with status 500.
+func BadgeHandler(db *Database) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		metric, err := ParseBadgeMetric(strings.TrimSuffix(r.PathValue("metric"), ".svg"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		style, err := ParseBadgeStyle(q.Get("style"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for _, c := range []string{q.Get("color"), q.Get("labelColor")} {
+			if _, err := ParseBadgeColor(c); c != "" && err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		status := http.StatusOK
+		badge, err := BuildBadge(db, r.PathValue("owner"), r.PathValue("repo"), BadgeOptions{
+			Metric:     metric,
+			Tag:        q.Get("tag"),
+			Asset:      q.Get("asset"),
+			Label:      q.Get("label"),
+			Color:      q.Get("color"),
+			LabelColor: q.Get("labelColor"),
+			Style:      style,
+		})
+		if err != nil {
+			label := q.Get("label")
+			if label == "" {
+				label = "downloads"
+			}
+			message := "error"
+			switch status = errorStatus(err); status {
+			case http.StatusNotFound:
+				message = "not found"
+			case http.StatusBadRequest:
+				message = "invalid"
+			}
+			badge = ErrorBadge(label, message)
+			// Only client errors are safe to describe
+			if status < http.StatusInternalServerError {
+				w.Header().Set("X-Badge-Error", err.Error())
+			} else {
+				log.Printf("badge %s: %v", r.URL.Path, err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+		if status < http.StatusInternalServerError {
+			w.Header().Set("Cache-Control", "public, max-age=300")
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.WriteHeader(status)
+		_ = badge.WriteSVG(w)
+	})
+}
+
+// BadgePattern is the ServeMux pattern BadgeHandler expects.
+const BadgePattern = "GET /badge/{owner}/{repo}/{metric}"
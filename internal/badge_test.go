@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func badgeDatabase(t *testing.T) *Database {
+	t.Helper()
+	db := newTestDatabase(t)
+
+	older := sampleStats()
+	older.FetchedAt = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	newer := sampleStats()
+	newer.FetchedAt = time.Date(2024, 7, 5, 12, 0, 0, 0, time.UTC)
+	newer.Releases[1].Assets = []Asset{
+		{Name: "tool_linux_amd64.tar.gz", DownloadCount: 1500},
+		{Name: "tool_linux_arm64.tar.gz", DownloadCount: 300},
+		{Name: "tool_windows_amd64.zip", DownloadCount: 700},
+	}
+	for _, s := range []*ReleaseStats{older, newer} {
+		if err := db.StoreStats(s); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+	return db
+}
+
+func TestBuildBadge(t *testing.T) {
+	db := badgeDatabase(t)
+
+	tests := []struct {
+		opts    BadgeOptions
+		label   string
+		message string
+	}{
+		{BadgeOptions{}, "downloads", "2.5k"},
+		{BadgeOptions{Metric: BadgeLatest}, "downloads@v1.1.0", "2.5k"},
+		{BadgeOptions{Metric: BadgeLatest, Tag: "v1.0.0", Label: "v1"}, "v1", "5"},
+		{BadgeOptions{Metric: BadgeMonthly}, "downloads", "2.2k/month"},
+		{BadgeOptions{Metric: BadgeAsset, Asset: "*_linux_*"}, "downloads@v1.1.0", "1.8k"},
+	}
+	for _, tt := range tests {
+		b, err := BuildBadge(db, "owner", "repo", tt.opts)
+		if err != nil {
+			t.Fatalf("BuildBadge(%+v) failed: %v", tt.opts, err)
+		}
+		if b.Label != tt.label || b.Message != tt.message {
+			t.Errorf("BuildBadge(%+v) = %q: %q, want %q: %q", tt.opts, b.Label, b.Message, tt.label, tt.message)
+		}
+	}
+
+	for _, opts := range []BadgeOptions{
+		{Metric: BadgeAsset},
+		{Metric: BadgeAsset, Asset: "*.dmg"},
+		{Metric: BadgeLatest, Tag: "v9"},
+		{Color: "not-a-colour"},
+	} {
+		if _, err := BuildBadge(db, "owner", "repo", opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+	if _, err := BuildBadge(db, "owner", "missing", BadgeOptions{}); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected ErrNoSnapshot for a repository without snapshots, got %v", err)
+	}
+
+	// Ten days of history, and sixty days without snapshots, are scaled to
+	// a month
+	for owner, days := range map[string]int{"recent": 10, "gap": 60} {
+		older, newer := sampleStats(), sampleStats()
+		older.Owner, older.FetchedAt = owner, time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+		newer.Owner, newer.FetchedAt = owner, older.FetchedAt.AddDate(0, 0, days)
+		newer.Releases[1].Assets[0].DownloadCount = 10 + 10*days
+		for _, s := range []*ReleaseStats{older, newer} {
+			if err := db.StoreStats(s); err != nil {
+				t.Fatalf("StoreStats failed: %v", err)
+			}
+		}
+		if b, err := BuildBadge(db, owner, "repo", BadgeOptions{Metric: BadgeMonthly}); err != nil || b.Message != "300/month" {
+			t.Errorf("expected 300/month over %d days, got %+v, %v", days, b, err)
+		}
+	}
+
+	// Pre-releases are stored, so the latest badge skips them
+	pre := sampleStats()
+	pre.Owner, pre.FetchedAt = "pre", time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	pre.Releases[1].IsPrerelease = true
+	if err := db.StoreStats(pre); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+	if b, err := BuildBadge(db, "pre", "repo", BadgeOptions{Metric: BadgeLatest}); err != nil || b.Label != "downloads@v1.0.0" {
+		t.Errorf("expected the latest badge to skip pre-release v1.1.0, got %+v, %v", b, err)
+	}
+}
+
+func TestBadgeSVG(t *testing.T) {
+	b := &Badge{Label: "a&b", Message: "1.2k", Color: "#dfb317", LabelColor: "#555", Style: BadgeFlatSquare}
+	var sb strings.Builder
+	if err := b.WriteSVG(&sb); err != nil {
+		t.Fatalf("WriteSVG failed: %v", err)
+	}
+	svg := sb.String()
+	if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+		t.Fatalf("invalid SVG: %v\n%s", err, svg)
+	}
+	if !strings.Contains(svg, "a&amp;b") || strings.Contains(svg, "url(#s)") {
+		t.Errorf("unexpected flat-square badge:\n%s", svg)
+	}
+
+	if c, err := ParseBadgeColor("Blue"); err != nil || c != "#007ec6" {
+		t.Errorf("ParseBadgeColor(Blue) = %q, %v", c, err)
+	}
+	if c, err := ParseBadgeColor("ff8800"); err != nil || c != "#ff8800" {
+		t.Errorf("ParseBadgeColor(ff8800) = %q, %v", c, err)
+	}
+	if _, err := ParseBadgeColor(`#fff"/>`); err == nil {
+		t.Error("expected an error for an invalid colour")
+	}
+}
+
+func TestBadgeHandler(t *testing.T) {
+	db := badgeDatabase(t)
+	mux := http.NewServeMux()
+	mux.Handle(BadgePattern, BadgeHandler(db))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("/badge/owner/repo/monthly.svg?label=monthly&color=blue")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/svg+xml; charset=utf-8" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(body, "monthly: 2.2k/month") || !strings.Contains(body, "#007ec6") {
+		t.Errorf("unexpected badge:\n%s", body)
+	}
+
+	if resp, body = get("/badge/owner/missing/total.svg"); resp.StatusCode != http.StatusNotFound || !strings.Contains(body, "not found") {
+		t.Errorf("expected a not found badge, got %d:\n%s", resp.StatusCode, body)
+	}
+	if resp, _ = get("/badge/owner/repo/weekly.svg"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown metric, got %d", resp.StatusCode)
+	}
+	if resp, _ = get("/badge/owner/repo/total.svg?color=nope"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid colour, got %d", resp.StatusCode)
+	}
+	if resp, body = get("/badge/owner/repo/asset.svg?asset=%5B"); resp.StatusCode != http.StatusBadRequest || !strings.Contains(body, "invalid") {
+		t.Errorf("expected an invalid badge for a malformed asset pattern, got %d:\n%s", resp.StatusCode, body)
+	}
+
+	// Database failures are not reported as missing repositories
+	db.Close()
+	if resp, body = get("/badge/owner/repo/total.svg"); resp.StatusCode != http.StatusInternalServerError ||
+		!strings.Contains(body, "error") || resp.Header.Get("X-Badge-Error") != "" {
+		t.Errorf("expected an error badge without details, got %d %v:\n%s", resp.StatusCode, resp.Header, body)
+	}
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Baseline is a named reference to a stored snapshot, such as the state of
+// a repository on a launch day, that compare can use as either end.
+type Baseline struct {
+	Owner     string    `json:"owner" yaml:"owner"`
+	Repo      string    `json:"repo" yaml:"repo"`
+	Name      string    `json:"name" yaml:"name"`
+	FetchedAt time.Time `json:"fetched_at" yaml:"fetched_at"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+}
+
+// SetBaseline names the snapshot fetched at fetchedAt. Setting an existing
+// name moves it to the new snapshot.
+func (d *Database) SetBaseline(owner, repo, name string, fetchedAt time.Time) error {
+	_, err := d.db.Exec(
+		`INSERT INTO baselines (owner, repo, name, fetched_at, created_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (owner, repo, name) DO UPDATE SET
+			fetched_at = excluded.fetched_at,
+			created_at = excluded.created_at`,
+		owner, repo, name, fetchedAt, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set baseline: %w", err)
+	}
+	return nil
+}
+
+// GetBaseline returns the named baseline, or nil if there is none.
+func (d *Database) GetBaseline(owner, repo, name string) (*Baseline, error) {
+	b := &Baseline{Owner: owner, Repo: repo, Name: name}
+	err := d.db.QueryRow(
+		`SELECT fetched_at, created_at FROM baselines
+		 WHERE owner = ? AND repo = ? AND name = ?`,
+		owner, repo, name,
+	).Scan(&b.FetchedAt, &b.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query baseline: %w", err)
+	}
+	return b, nil
+}
+
+// ListBaselines returns the baselines of owner/repo, oldest snapshot first.
+func (d *Database) ListBaselines(owner, repo string) ([]Baseline, error) {
+	rows, err := d.db.Query(
+		`SELECT name, fetched_at, created_at FROM baselines
+		 WHERE owner = ? AND repo = ?
+		 ORDER BY fetched_at, name`,
+		owner, repo,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query baselines: %w", err)
+	}
+	defer rows.Close()
+
+	baselines := make([]Baseline, 0)
+	for rows.Next() {
+		b := Baseline{Owner: owner, Repo: repo}
+		if err := rows.Scan(&b.Name, &b.FetchedAt, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan baseline: %w", err)
+		}
+		baselines = append(baselines, b)
+	}
+
+	return baselines, rows.Err()
+}
+
+// DeleteBaseline removes the named baseline. The snapshot itself is kept. It
+// reports whether the baseline existed.
+func (d *Database) DeleteBaseline(owner, repo, name string) (bool, error) {
+	res, err := d.db.Exec(
+		`DELETE FROM baselines WHERE owner = ? AND repo = ? AND name = ?`,
+		owner, repo, name,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete baseline: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete baseline: %w", err)
+	}
+	return n > 0, nil
+}
+
+// BaselinesReport renders the baselines of a repository.
+type BaselinesReport struct {
+	Owner     string     `json:"owner" yaml:"owner"`
+	Repo      string     `json:"repo" yaml:"repo"`
+	Baselines []Baseline `json:"baselines" yaml:"baselines"`
+}
+
+// WriteText writes the baselines as an aligned table.
+func (r *BaselinesReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nBaselines for %s/%s\n\n", r.Owner, r.Repo)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSNAPSHOT\tSET AT")
+	fmt.Fprintln(w, "---\t---\t---")
+	for _, b := range r.Baselines {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", b.Name, b.FetchedAt.Format("2006-01-02 15:04"), b.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// Table returns one row per baseline.
+func (r *BaselinesReport) Table() ([]string, [][]string) {
+	header := []string{"name", "fetched_at", "created_at"}
+	rows := make([][]string, 0, len(r.Baselines))
+	for _, b := range r.Baselines {
+		rows = append(rows, []string{b.Name, b.FetchedAt.Format(time.RFC3339), b.CreatedAt.Format(time.RFC3339)})
+	}
+	return header, rows
+}
+
+// LatestRef refers to the most recent snapshot of a repository.
+const LatestRef = "latest"
+
+// ErrInvalidRef is wrapped by the error ResolveSnapshot returns for a
+// reference that is neither "latest", a date, a snapshot ID nor a baseline.
+var ErrInvalidRef = errors.New("invalid snapshot reference")
+
+// ResolveSnapshot loads the snapshot that ref refers to: "latest", a date
+// (the last snapshot taken on or before the end of that day), a snapshot ID
+// or a baseline name.
+func (d *Database) ResolveSnapshot(owner, repo, ref string) (*ReleaseStats, error) {
+	if ref == LatestRef {
+		stats, err := d.GetLatestStats(owner, repo)
+		if err != nil {
+			return nil, err
+		}
+		if len(stats.Releases) == 0 {
+			return nil, fmt.Errorf("%w for %s/%s", ErrNoSnapshot, owner, repo)
+		}
+		return stats, nil
+	}
+	if t, err := ParseDate(ref, true); err == nil {
+		return d.GetSnapshotAt(owner, repo, t)
+	}
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return d.GetSnapshotByID(owner, repo, id)
+	}
+
+	baseline, err := d.GetBaseline(owner, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	if baseline == nil {
+		return nil, fmt.Errorf("%w: %q is not a date, snapshot ID or baseline of %s/%s", ErrInvalidRef, ref, owner, repo)
+	}
+	return d.GetSnapshotAt(owner, repo, baseline.FetchedAt)
+}
+
+// ValidateBaselineName rejects names that ResolveSnapshot would read as
+// something other than a baseline.
+func ValidateBaselineName(name string) error {
+	if name == "" || name == LatestRef {
+		return fmt.Errorf("invalid baseline name %q", name)
+	}
+	if _, err := ParseDate(name, false); err == nil {
+		return fmt.Errorf("baseline name %q looks like a date", name)
+	}
+	if _, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return fmt.Errorf("baseline name %q looks like a snapshot ID", name)
+	}
+	return nil
+}
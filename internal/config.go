@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the project configuration file. Every field is optional.
+type Config struct {
+	// DB is the database path used when --db is not given.
+	DB string `yaml:"db"`
+	// Token is the GitHub token used when no more specific token applies.
+	Token string `yaml:"token"`
+	// TokenEnv names an environment variable holding Token.
+	TokenEnv string `yaml:"token_env"`
+	// Output is the default --output format.
+	Output string `yaml:"output"`
+	// Sources declares GitHub Enterprise instances by name.
+	Sources map[string]SourceConfig `yaml:"sources"`
+	// Repos declares the tracked repositories.
+	Repos []RepoConfig `yaml:"repos"`
+	// Defaults sets flag defaults per command, e.g. {history: {limit: 20}}.
+	Defaults map[string]map[string]any `yaml:"defaults"`
+	// Platforms classifies asset names ahead of the built-in rules.
+	Platforms []PlatformRule `yaml:"platforms"`
+	// Assets decides which assets count towards download totals.
+	Assets AssetRules `yaml:"assets"`
+	// Push lists the time-series databases that fetch --store, fetch-all
+	// and watch push every stored snapshot to.
+	Push []PushTarget `yaml:"push"`
+	// Notifiers declares the webhooks that alerts are posted to.
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+	// Alerts lists the rules evaluated after every stored snapshot.
+	Alerts []AlertRule `yaml:"alerts"`
+	// Milestones lists the download counts announced as they are passed.
+	Milestones []MilestoneRule `yaml:"milestones"`
+	// Anomalies tunes the download spike detection of anomalies, trend
+	// and forecast.
+	Anomalies AnomalyOptions `yaml:"anomalies"`
+}
+
+// SourceConfig describes a GitHub API endpoint.
+type SourceConfig struct {
+	// URL is the API base URL, e.g. https://ghe.example.com/api/v3/.
+	URL      string `yaml:"url"`
+	Token    string `yaml:"token"`
+	TokenEnv string `yaml:"token_env"`
+}
+
+// RepoConfig declares one tracked repository.
+type RepoConfig struct {
+	// Name is "owner/repo".
+	Name     string   `yaml:"name"`
+	Alias    string   `yaml:"alias"`
+	Groups   []string `yaml:"groups"`
+	Source   string   `yaml:"source"`
+	Token    string   `yaml:"token"`
+	TokenEnv string   `yaml:"token_env"`
+	// Schedule is used by watch: a duration or cron expression.
+	Schedule string `yaml:"schedule"`
+}
+
+// OwnerRepo splits Name into owner and repo.
+func (r RepoConfig) OwnerRepo() (string, string) {
+	owner, repo, _ := strings.Cut(r.Name, "/")
+	return owner, repo
+}
+
+// InGroup reports whether the repository belongs to group.
+func (r RepoConfig) InGroup(group string) bool {
+	for _, g := range r.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/git-download-stats/config.yaml,
+// falling back to ~/.config when XDG_CONFIG_HOME is unset.
+func DefaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "git-download-stats", "config.yaml")
+}
+
+// LoadConfig reads a configuration file. A missing file yields an empty
+// configuration unless required is set.
+func LoadConfig(path string, required bool) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// An empty file decodes to io.EOF and leaves the defaults in place
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	seen := make(map[string]bool)
+	for _, r := range c.Repos {
+		owner, repo := r.OwnerRepo()
+		if owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("repo %q: name must be owner/repo", r.Name)
+		}
+		for _, key := range []string{r.Name, r.Alias} {
+			if key == "" {
+				continue
+			}
+			if seen[key] {
+				return fmt.Errorf("repo %q: duplicate name or alias %q", r.Name, key)
+			}
+			seen[key] = true
+		}
+		if r.Source != "" {
+			if _, ok := c.Sources[r.Source]; !ok {
+				return fmt.Errorf("repo %q: unknown source %q", r.Name, r.Source)
+			}
+		}
+	}
+	if _, err := NewPlatformClassifier(c.Platforms); err != nil {
+		return err
+	}
+	if _, err := NewAssetClassifier(c.Assets); err != nil {
+		return err
+	}
+	for _, t := range c.Push {
+		if _, err := NewPushSink(t, nil); err != nil {
+			return err
+		}
+		if _, err := t.Options(); err != nil {
+			return fmt.Errorf("push %s: %w", t.URL, err)
+		}
+	}
+	if _, err := NewNotifiers(c.Notifiers, nil); err != nil {
+		return err
+	}
+	rules := make(map[string]bool)
+	for _, r := range c.Alerts {
+		if err := r.validate(c.Notifiers); err != nil {
+			return err
+		}
+		if rules[r.Name] {
+			return fmt.Errorf("alert %s: duplicate name", r.Name)
+		}
+		rules[r.Name] = true
+	}
+	milestones := make(map[string]bool)
+	for _, r := range c.Milestones {
+		if err := r.validate(c.Notifiers); err != nil {
+			return err
+		}
+		if milestones[r.Name] {
+			return fmt.Errorf("milestone %s: duplicate name", r.Name)
+		}
+		milestones[r.Name] = true
+	}
+	return c.Anomalies.Validate()
+}
+
+// Repo looks up a tracked repository by alias or "owner/repo".
+func (c *Config) Repo(nameOrAlias string) (RepoConfig, bool) {
+	for _, r := range c.Repos {
+		if r.Alias == nameOrAlias || strings.EqualFold(r.Name, nameOrAlias) {
+			return r, true
+		}
+	}
+	return RepoConfig{}, false
+}
+
+// Group returns the tracked repositories in group, or all of them when
+// group is empty.
+func (c *Config) Group(group string) []RepoConfig {
+	out := make([]RepoConfig, 0, len(c.Repos))
+	for _, r := range c.Repos {
+		if group == "" || r.InGroup(group) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// TokenFor returns the configured token for owner/repo, preferring the
+// repository's own token, then its source's, then the global one.
+func (c *Config) TokenFor(owner, repo string) string {
+	r, ok := c.Repo(owner + "/" + repo)
+	if ok {
+		if t := tokenValue(r.Token, r.TokenEnv); t != "" {
+			return t
+		}
+		if src, ok := c.Sources[r.Source]; ok {
+			if t := tokenValue(src.Token, src.TokenEnv); t != "" {
+				return t
+			}
+		}
+	}
+	return tokenValue(c.Token, c.TokenEnv)
+}
+
+// BaseURLFor returns the API base URL for owner/repo, or "" for github.com.
+func (c *Config) BaseURLFor(owner, repo string) string {
+	r, ok := c.Repo(owner + "/" + repo)
+	if !ok {
+		return ""
+	}
+	return c.Sources[r.Source].URL
+}
+
+func tokenValue(token, env string) string {
+	if token != "" {
+		return token
+	}
+	if env != "" {
+		return os.Getenv(env)
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("GHE_TOKEN", "from-env")
+	path := writeConfig(t, `
+db: /var/lib/stats.db
+token: global
+sources:
+  ghe:
+    url: https://ghe.example.com/api/v3/
+    token_env: GHE_TOKEN
+repos:
+  - name: cli/cli
+    alias: gh
+    groups: [clis]
+    token: repo-token
+  - name: acme/tool
+    source: ghe
+  - name: golang/go
+defaults:
+  history:
+    limit: 20
+`)
+
+	cfg, err := LoadConfig(path, true)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if r, ok := cfg.Repo("gh"); !ok || r.Name != "cli/cli" {
+		t.Fatalf("expected alias gh to resolve to cli/cli, got %+v", r)
+	}
+	if got := cfg.TokenFor("cli", "cli"); got != "repo-token" {
+		t.Fatalf("expected repo token, got %q", got)
+	}
+	if got := cfg.TokenFor("acme", "tool"); got != "from-env" {
+		t.Fatalf("expected source token, got %q", got)
+	}
+	if got := cfg.TokenFor("golang", "go"); got != "global" {
+		t.Fatalf("expected global token, got %q", got)
+	}
+	if got := cfg.BaseURLFor("acme", "tool"); got != "https://ghe.example.com/api/v3/" {
+		t.Fatalf("unexpected base URL %q", got)
+	}
+	if got := len(cfg.Group("clis")); got != 1 {
+		t.Fatalf("expected 1 repo in group, got %d", got)
+	}
+	if cfg.Defaults["history"]["limit"] != 20 {
+		t.Fatalf("unexpected defaults: %+v", cfg.Defaults)
+	}
+}
+
+func TestLoadConfigMissingAndInvalid(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := LoadConfig(missing, false); err != nil {
+		t.Fatalf("expected optional missing config to load, got %v", err)
+	}
+	if _, err := LoadConfig(missing, true); err == nil {
+		t.Fatal("expected required missing config to fail")
+	}
+
+	cases := map[string]string{
+		"repos:\n  - name: nope\n":                               "owner/repo",
+		"repos:\n  - name: a/b\n    source: ghe\n":               "unknown source",
+		"repos:\n  - name: a/b\n  - name: c/d\n    alias: a/b\n": "duplicate",
+		"unknown_key: 1\n":                                       "unknown_key",
+		"platforms:\n  - match: '('\n":                           "invalid platform rule",
+		"assets:\n  exclude: ['[']\n":                            "invalid asset pattern",
+		"push:\n  - url: udp://h:1\n":                            "invalid push URL",
+		"push:\n  - url: http://h\n    assets: x\n":              "unknown asset labels",
+		"alerts:\n  - name: a\n    type: spike\n":                "unknown type",
+		"alerts:\n  - name: a\n    type: threshold\n":            "threshold must be positive",
+		"alerts: [{name: a, type: drop, notify: [x]}]\n":         "unknown notifier",
+		"notifiers:\n  - name: n\n    type: email\n":             "unknown type",
+		"milestones: [{name: m, type: total, count: 1X}]\n":      "invalid count",
+		"milestones: [{name: m, type: total}]\n":                 "either count or every",
+	}
+	for content, want := range cases {
+		_, err := LoadConfig(writeConfig(t, content), true)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error containing %q for %q, got %v", want, content, err)
+		}
+	}
+}
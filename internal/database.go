@@ -2,9 +2,11 @@ package internal
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -21,7 +23,9 @@ const (
 		release_name TEXT NOT NULL,
 		total_downloads INTEGER NOT NULL,
 		fetched_at TIMESTAMP NOT NULL,
-		created_at TIMESTAMP NOT NULL
+		created_at TIMESTAMP NOT NULL,
+		published_at TIMESTAMP,
+		prerelease BOOLEAN NOT NULL DEFAULT 0
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_owner_repo_fetched 
@@ -40,11 +44,109 @@ const (
 
 	CREATE INDEX IF NOT EXISTS idx_stat_id ON assets(stat_id);
 	`
+	projectsTable = `
+	CREATE TABLE IF NOT EXISTS projects (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		group_name TEXT NOT NULL DEFAULT '',
+		interval TEXT NOT NULL DEFAULT '',
+		added_at TIMESTAMP NOT NULL,
+		first_fetch_at TIMESTAMP,
+		last_fetch_at TIMESTAMP,
+		last_error TEXT NOT NULL DEFAULT '',
+		last_error_at TIMESTAMP,
+		UNIQUE (owner, repo)
+	);
+	`
+	baselinesTable = `
+	CREATE TABLE IF NOT EXISTS baselines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		name TEXT NOT NULL,
+		fetched_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		UNIQUE (owner, repo, name)
+	);
+	`
+	fetchesTable = `
+	CREATE TABLE IF NOT EXISTS fetches (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		rate_limit INTEGER NOT NULL DEFAULT 0,
+		rate_remaining INTEGER NOT NULL DEFAULT 0,
+		rate_reset TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_fetches_owner_repo
+		ON fetches(owner, repo, started_at DESC);
+	`
+	alertsTable = `
+	CREATE TABLE IF NOT EXISTS alerts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rule TEXT NOT NULL,
+		owner TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		subject TEXT NOT NULL DEFAULT '',
+		state TEXT NOT NULL,
+		message TEXT NOT NULL,
+		value REAL NOT NULL,
+		fired_at TIMESTAMP NOT NULL,
+		resolved_at TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL,
+		notified TEXT NOT NULL DEFAULT '',
+		UNIQUE (rule, owner, repo, subject)
+	);
+	`
+	anomaliesTable = `
+	CREATE TABLE IF NOT EXISTS anomalies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		asset TEXT NOT NULL,
+		start_at TIMESTAMP NOT NULL,
+		end_at TIMESTAMP NOT NULL,
+		downloads REAL NOT NULL,
+		per_day REAL NOT NULL,
+		baseline REAL NOT NULL,
+		score REAL NOT NULL,
+		excess REAL NOT NULL,
+		marked_at TIMESTAMP NOT NULL,
+		UNIQUE (owner, repo, tag, asset, end_at)
+	);
+	`
+	milestonesTable = `
+	CREATE TABLE IF NOT EXISTS milestones (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		rule TEXT NOT NULL,
+		owner TEXT NOT NULL,
+		repo TEXT NOT NULL,
+		subject TEXT NOT NULL DEFAULT '',
+		count INTEGER NOT NULL,
+		value INTEGER NOT NULL,
+		message TEXT NOT NULL,
+		snapshot_id INTEGER NOT NULL,
+		fetched_at TIMESTAMP NOT NULL,
+		notified_at TIMESTAMP,
+		UNIQUE (rule, owner, repo, subject, count)
+	);
+	`
 )
 
+// ErrNoSnapshot is wrapped by the errors of lookups that match no stored
+// snapshot.
+var ErrNoSnapshot = errors.New("no snapshot stored")
+
 type Database struct {
-	db   *sql.DB
-	path string
+	db     *sql.DB
+	path   string
+	assets *AssetClassifier
 }
 
 // NewDatabase creates or opens an SQLite database.
@@ -81,6 +183,14 @@ func NewDatabase(dbPath string) (*Database, error) {
 	return d, nil
 }
 
+// SetAssetClassifier sets how loaded snapshots compute their totals. Totals
+// are always recomputed from the stored assets, so snapshots stored before
+// a rule changed follow the new rule. A nil classifier applies the built-in
+// asset patterns.
+func (d *Database) SetAssetClassifier(c *AssetClassifier) {
+	d.assets = c
+}
+
 func (d *Database) createTables() error {
 	if _, err := d.db.Exec(statsTable); err != nil {
 		return fmt.Errorf("failed to create stats table: %w", err)
@@ -90,6 +200,49 @@ func (d *Database) createTables() error {
 		return fmt.Errorf("failed to create assets table: %w", err)
 	}
 
+	if _, err := d.db.Exec(projectsTable); err != nil {
+		return fmt.Errorf("failed to create projects table: %w", err)
+	}
+
+	if _, err := d.db.Exec(baselinesTable); err != nil {
+		return fmt.Errorf("failed to create baselines table: %w", err)
+	}
+
+	if _, err := d.db.Exec(fetchesTable); err != nil {
+		return fmt.Errorf("failed to create fetches table: %w", err)
+	}
+
+	if _, err := d.db.Exec(alertsTable); err != nil {
+		return fmt.Errorf("failed to create alerts table: %w", err)
+	}
+
+	if _, err := d.db.Exec(anomaliesTable); err != nil {
+		return fmt.Errorf("failed to create anomalies table: %w", err)
+	}
+
+	if _, err := d.db.Exec(milestonesTable); err != nil {
+		return fmt.Errorf("failed to create milestones table: %w", err)
+	}
+
+	if err := d.addColumn("stats", "published_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	return d.addColumn("stats", "prerelease", "BOOLEAN NOT NULL DEFAULT 0")
+}
+
+// addColumn adds a column to a table created before the column existed.
+func (d *Database) addColumn(table, column, decl string) error {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s table: %w", table, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := d.db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl); err != nil {
+		return fmt.Errorf("failed to add %s to %s table: %w", column, table, err)
+	}
 	return nil
 }
 
@@ -104,10 +257,11 @@ func (d *Database) StoreStats(stats *ReleaseStats) error {
 	for _, rel := range stats.Releases {
 		var statID int64
 		err := tx.QueryRow(
-			`INSERT INTO stats (owner, repo, tag, release_name, total_downloads, fetched_at, created_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?)
+			`INSERT INTO stats (owner, repo, tag, release_name, total_downloads, fetched_at, created_at, published_at, prerelease)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 			 RETURNING id`,
 			stats.Owner, stats.Repo, rel.Tag, rel.Name, rel.TotalDownloads, stats.FetchedAt, rel.CreatedAt,
+			sql.NullTime{Time: rel.PublishedAt, Valid: !rel.PublishedAt.IsZero()}, rel.IsPrerelease,
 		).Scan(&statID)
 		if err != nil {
 			return fmt.Errorf("failed to insert stat: %w", err)
@@ -129,47 +283,108 @@ func (d *Database) StoreStats(stats *ReleaseStats) error {
 	return tx.Commit()
 }
 
-// GetLatestStats retrieves the most recent statistics for a given owner/repo.
+// GetLatestStats retrieves the most recent snapshot for a given owner/repo,
+// including every release fetched at that time.
 func (d *Database) GetLatestStats(owner, repo string) (*ReleaseStats, error) {
-	stats := &ReleaseStats{
-		Owner:    owner,
-		Repo:     repo,
-		Releases: make([]Release, 0),
-	}
-
-	rows, err := d.db.Query(
-		`SELECT id, tag, release_name, total_downloads, fetched_at, created_at
-		 FROM stats
+	var fetchedAt time.Time
+	err := d.db.QueryRow(
+		`SELECT fetched_at FROM stats
 		 WHERE owner = ? AND repo = ?
 		 ORDER BY fetched_at DESC
 		 LIMIT 1`,
 		owner, repo,
-	)
+	).Scan(&fetchedAt)
+	if err == sql.ErrNoRows {
+		return &ReleaseStats{
+			Owner:    owner,
+			Repo:     repo,
+			Releases: make([]Release, 0),
+		}, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query latest stats: %w", err)
 	}
-	defer rows.Close()
 
-	// Get the first result to determine FetchedAt
-	var statID int64
-	if rows.Next() {
-		var rel Release
-		err := rows.Scan(&statID, &rel.Tag, &rel.Name, &rel.TotalDownloads, &stats.FetchedAt, &rel.CreatedAt)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan stats row: %w", err)
-		}
+	return d.getSnapshot(owner, repo, fetchedAt)
+}
 
-		// Get assets for this release
-		assets, err := d.getAssets(statID)
-		if err != nil {
-			return nil, err
-		}
-		rel.Assets = assets
-		stats.Releases = append(stats.Releases, rel)
-		stats.TotalDownloads += rel.TotalDownloads
+// GetSnapshotByID retrieves the snapshot that the stats row id belongs to.
+// Any row of a snapshot resolves to it, though SnapshotID reports the lowest.
+func (d *Database) GetSnapshotByID(owner, repo string, id int64) (*ReleaseStats, error) {
+	var fetchedAt time.Time
+	err := d.db.QueryRow(
+		`SELECT fetched_at FROM stats WHERE id = ? AND owner = ? AND repo = ?`,
+		id, owner, repo,
+	).Scan(&fetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w with ID %d for %s/%s", ErrNoSnapshot, id, owner, repo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot: %w", err)
 	}
 
-	return stats, nil
+	return d.getSnapshot(owner, repo, fetchedAt)
+}
+
+// GetSnapshotAt retrieves the last snapshot taken at or before t, falling
+// back to the first one after t when none is older.
+func (d *Database) GetSnapshotAt(owner, repo string, t time.Time) (*ReleaseStats, error) {
+	var fetchedAt time.Time
+	err := d.db.QueryRow(
+		`SELECT fetched_at FROM stats
+		 WHERE owner = ? AND repo = ? AND fetched_at <= ?
+		 ORDER BY fetched_at DESC
+		 LIMIT 1`,
+		owner, repo, t,
+	).Scan(&fetchedAt)
+	if err == sql.ErrNoRows {
+		err = d.db.QueryRow(
+			`SELECT fetched_at FROM stats
+			 WHERE owner = ? AND repo = ? AND fetched_at > ?
+			 ORDER BY fetched_at ASC
+			 LIMIT 1`,
+			owner, repo, t,
+		).Scan(&fetchedAt)
+	}
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w for %s/%s", ErrNoSnapshot, owner, repo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot: %w", err)
+	}
+
+	return d.getSnapshot(owner, repo, fetchedAt)
+}
+
+// GetPeriodSnapshots retrieves the snapshots bounding the period from start
+// to end: the last one taken at or before end, and the last one at or before
+// start, or the first one in the period when none is older. Both are nil
+// when no snapshot was taken in the period.
+func (d *Database) GetPeriodSnapshots(owner, repo string, start, end time.Time) (*ReleaseStats, *ReleaseStats, error) {
+	var newestAt time.Time
+	err := d.db.QueryRow(
+		`SELECT fetched_at FROM stats
+		 WHERE owner = ? AND repo = ? AND fetched_at <= ?
+		 ORDER BY fetched_at DESC
+		 LIMIT 1`,
+		owner, repo, end,
+	).Scan(&newestAt)
+	if err == sql.ErrNoRows || (err == nil && !newestAt.After(start)) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query period snapshots: %w", err)
+	}
+
+	oldest, err := d.GetSnapshotAt(owner, repo, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	newest, err := d.getSnapshot(owner, repo, newestAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return oldest, newest, nil
 }
 
 // GetStatsHistory retrieves all statistics for a given owner/repo, ordered by fetch date.
@@ -188,60 +403,8 @@ func (d *Database) GetStatsHistory(owner, repo string, limit int) ([]ReleaseStat
 	if err != nil {
 		return nil, fmt.Errorf("failed to query history: %w", err)
 	}
-	defer rows.Close()
-
-	var fetchDates []time.Time
-	for rows.Next() {
-		var fetchedAt time.Time
-		if err := rows.Scan(&fetchedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan fetch date: %w", err)
-		}
-		fetchDates = append(fetchDates, fetchedAt)
-	}
 
-	result := make([]ReleaseStats, 0, len(fetchDates))
-	for _, fetchedAt := range fetchDates {
-		stats := &ReleaseStats{
-			Owner:     owner,
-			Repo:      repo,
-			Releases:  make([]Release, 0),
-			FetchedAt: fetchedAt,
-		}
-
-		statRows, err := d.db.Query(
-			`SELECT id, tag, release_name, total_downloads, created_at
-			 FROM stats
-			 WHERE owner = ? AND repo = ? AND fetched_at = ?
-			 ORDER BY total_downloads DESC`,
-			owner, repo, fetchedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to query stats for date: %w", err)
-		}
-
-		for statRows.Next() {
-			var statID int64
-			var rel Release
-			if err := statRows.Scan(&statID, &rel.Tag, &rel.Name, &rel.TotalDownloads, &rel.CreatedAt); err != nil {
-				statRows.Close()
-				return nil, fmt.Errorf("failed to scan stat row: %w", err)
-			}
-
-			assets, err := d.getAssets(statID)
-			if err != nil {
-				statRows.Close()
-				return nil, err
-			}
-			rel.Assets = assets
-			stats.Releases = append(stats.Releases, rel)
-			stats.TotalDownloads += rel.TotalDownloads
-		}
-		statRows.Close()
-
-		result = append(result, *stats)
-	}
-
-	return result, nil
+	return d.getSnapshots(owner, repo, rows)
 }
 
 // GetStatsBetween retrieves statistics collected between two dates.
@@ -255,60 +418,131 @@ func (d *Database) GetStatsBetween(owner, repo string, start, end time.Time) ([]
 	if err != nil {
 		return nil, fmt.Errorf("failed to query stats between dates: %w", err)
 	}
-	defer rows.Close()
 
+	return d.getSnapshots(owner, repo, rows)
+}
+
+// GetStatsPage retrieves one page of the snapshots collected between two
+// dates, newest first, and the number of snapshots in the whole range.
+func (d *Database) GetStatsPage(owner, repo string, start, end time.Time, limit, offset int) ([]ReleaseStats, int, error) {
+	var total int
+	err := d.db.QueryRow(
+		`SELECT COUNT(DISTINCT fetched_at) FROM stats
+		 WHERE owner = ? AND repo = ? AND fetched_at BETWEEN ? AND ?`,
+		owner, repo, start, end,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count snapshots: %w", err)
+	}
+
+	rows, err := d.db.Query(
+		`SELECT DISTINCT fetched_at FROM stats
+		 WHERE owner = ? AND repo = ? AND fetched_at BETWEEN ? AND ?
+		 ORDER BY fetched_at DESC
+		 LIMIT ? OFFSET ?`,
+		owner, repo, start, end, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query snapshots: %w", err)
+	}
+
+	snapshots, err := d.getSnapshots(owner, repo, rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return snapshots, total, nil
+}
+
+// getSnapshots loads one snapshot per fetched_at value in rows, preserving
+// their order. It closes rows.
+func (d *Database) getSnapshots(owner, repo string, rows *sql.Rows) ([]ReleaseStats, error) {
 	var fetchDates []time.Time
 	for rows.Next() {
 		var fetchedAt time.Time
 		if err := rows.Scan(&fetchedAt); err != nil {
+			rows.Close()
 			return nil, fmt.Errorf("failed to scan fetch date: %w", err)
 		}
 		fetchDates = append(fetchDates, fetchedAt)
 	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to read fetch dates: %w", err)
+	}
+	rows.Close()
 
 	result := make([]ReleaseStats, 0, len(fetchDates))
 	for _, fetchedAt := range fetchDates {
-		stats := &ReleaseStats{
-			Owner:     owner,
-			Repo:      repo,
-			Releases:  make([]Release, 0),
-			FetchedAt: fetchedAt,
-		}
-
-		statRows, err := d.db.Query(
-			`SELECT id, tag, release_name, total_downloads, created_at
-			 FROM stats
-			 WHERE owner = ? AND repo = ? AND fetched_at = ?
-			 ORDER BY total_downloads DESC`,
-			owner, repo, fetchedAt,
-		)
+		stats, err := d.getSnapshot(owner, repo, fetchedAt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to query stats for date: %w", err)
+			return nil, err
 		}
+		result = append(result, *stats)
+	}
 
-		for statRows.Next() {
-			var statID int64
-			var rel Release
-			if err := statRows.Scan(&statID, &rel.Tag, &rel.Name, &rel.TotalDownloads, &rel.CreatedAt); err != nil {
-				statRows.Close()
-				return nil, fmt.Errorf("failed to scan stat row: %w", err)
-			}
+	return result, nil
+}
 
-			assets, err := d.getAssets(statID)
-			if err != nil {
-				statRows.Close()
-				return nil, err
-			}
-			rel.Assets = assets
-			stats.Releases = append(stats.Releases, rel)
-			stats.TotalDownloads += rel.TotalDownloads
+// getSnapshot loads every release and asset stored for owner/repo at fetchedAt.
+func (d *Database) getSnapshot(owner, repo string, fetchedAt time.Time) (*ReleaseStats, error) {
+	stats := &ReleaseStats{
+		Owner:     owner,
+		Repo:      repo,
+		Releases:  make([]Release, 0),
+		FetchedAt: fetchedAt,
+	}
+
+	statRows, err := d.db.Query(
+		`SELECT id, tag, release_name, total_downloads, created_at, published_at, prerelease
+		 FROM stats
+		 WHERE owner = ? AND repo = ? AND fetched_at = ?
+		 ORDER BY total_downloads DESC`,
+		owner, repo, fetchedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stats for date: %w", err)
+	}
+	defer statRows.Close()
+
+	type storedRelease struct {
+		id  int64
+		rel Release
+	}
+	var stored []storedRelease
+	for statRows.Next() {
+		var sr storedRelease
+		var publishedAt sql.NullTime
+		if err := statRows.Scan(&sr.id, &sr.rel.Tag, &sr.rel.Name, &sr.rel.TotalDownloads, &sr.rel.CreatedAt, &publishedAt, &sr.rel.IsPrerelease); err != nil {
+			return nil, fmt.Errorf("failed to scan stat row: %w", err)
 		}
-		statRows.Close()
+		// Snapshots stored before publish dates and pre-release flags were
+		// recorded have no publish date and count as releases
+		sr.rel.PublishedAt = publishedAt.Time
+		stored = append(stored, sr)
+	}
+	if err := statRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stats for date: %w", err)
+	}
 
-		result = append(result, *stats)
+	for i, sr := range stored {
+		// The lowest row id of a snapshot doubles as its snapshot ID
+		if i == 0 || sr.id < stats.SnapshotID {
+			stats.SnapshotID = sr.id
+		}
+		assets, err := d.getAssets(sr.id)
+		if err != nil {
+			return nil, err
+		}
+		sr.rel.Assets = assets
+		stats.Releases = append(stats.Releases, sr.rel)
 	}
 
-	return result, nil
+	d.assets.Apply(stats)
+	sort.SliceStable(stats.Releases, func(i, j int) bool {
+		return stats.Releases[i].TotalDownloads > stats.Releases[j].TotalDownloads
+	})
+
+	return stats, nil
 }
 
 func (d *Database) getAssets(statID int64) ([]Asset, error) {
@@ -329,6 +563,9 @@ func (d *Database) getAssets(statID int64) ([]Asset, error) {
 		}
 		assets = append(assets, asset)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read assets: %w", err)
+	}
 
 	return assets, nil
 }
@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// storeDailySnapshots stores days daily snapshots of sampleStats from
+// 2024-07-01 12:00 UTC in which v1.1.0 gains 5 downloads a day. edit, when
+// not nil, adjusts each snapshot before it is stored.
+func storeDailySnapshots(t *testing.T, db *Database, days int, edit func(*ReleaseStats)) {
+	t.Helper()
+	first := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for day := 0; day < days; day++ {
+		s := sampleStats()
+		s.FetchedAt = first.AddDate(0, 0, day)
+		s.Releases[1].Assets[0].DownloadCount = 10 + day*5
+		if edit != nil {
+			edit(s)
+		}
+		if err := db.StoreStats(s); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+}
+
+func TestGetLatestStatsLoadsWholeSnapshot(t *testing.T) {
+	db := newTestDatabase(t)
+
+	older := sampleStats()
+	older.FetchedAt = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	newer := sampleStats()
+	newer.FetchedAt = time.Date(2024, 7, 2, 12, 0, 0, 0, time.UTC)
+	newer.Releases[1].PublishedAt = time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	newer.Releases[1].IsPrerelease = true
+	for _, s := range []*ReleaseStats{older, newer} {
+		if err := db.StoreStats(s); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+
+	latest, err := db.GetLatestStats("owner", "repo")
+	if err != nil {
+		t.Fatalf("GetLatestStats failed: %v", err)
+	}
+	if !latest.FetchedAt.Equal(newer.FetchedAt) {
+		t.Fatalf("expected snapshot from %s, got %s", newer.FetchedAt, latest.FetchedAt)
+	}
+	if len(latest.Releases) != 2 || latest.TotalDownloads != 15 {
+		t.Fatalf("expected 2 releases totalling 15, got %d totalling %d", len(latest.Releases), latest.TotalDownloads)
+	}
+	if len(latest.Releases[0].Assets) != 1 {
+		t.Fatalf("expected assets to be loaded, got %+v", latest.Releases[0])
+	}
+	if !latest.Releases[0].PublishedAt.Equal(newer.Releases[1].PublishedAt) || !latest.Releases[1].PublishedAt.IsZero() {
+		t.Errorf("expected only v1.1.0 to have a publish date, got %+v", latest.Releases)
+	}
+	if !latest.Releases[0].IsPrerelease || latest.Releases[1].IsPrerelease {
+		t.Errorf("expected only v1.1.0 to be a pre-release, got %+v", latest.Releases)
+	}
+
+	empty, err := db.GetLatestStats("owner", "missing")
+	if err != nil {
+		t.Fatalf("GetLatestStats failed for missing repo: %v", err)
+	}
+	if len(empty.Releases) != 0 {
+		t.Fatalf("expected no releases, got %d", len(empty.Releases))
+	}
+}
+
+func TestNewDatabaseAddsReleaseColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = old.Exec(`CREATE TABLE stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, owner TEXT NOT NULL, repo TEXT NOT NULL, tag TEXT NOT NULL,
+		release_name TEXT NOT NULL, total_downloads INTEGER NOT NULL, fetched_at TIMESTAMP NOT NULL, created_at TIMESTAMP NOT NULL
+	)`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("failed to create old stats table: %v", err)
+	}
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase failed: %v", err)
+	}
+	defer db.Close()
+	stats := sampleStats()
+	stats.FetchedAt = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	stats.Releases[1].IsPrerelease = true
+	if err := db.StoreStats(stats); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+	latest, err := db.GetLatestStats("owner", "repo")
+	if err != nil || len(latest.Releases) != 2 || !latest.Releases[0].IsPrerelease {
+		t.Fatalf("expected pre-release v1.1.0 to be loaded, got %+v, %v", latest, err)
+	}
+}
+
+func TestProjectsWatchlist(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if err := db.TrackProject("cli", "cli", "clis", "6h"); err != nil {
+		t.Fatalf("TrackProject failed: %v", err)
+	}
+	if err := db.TrackProject("golang", "go", "", ""); err != nil {
+		t.Fatalf("TrackProject failed: %v", err)
+	}
+	// Tracking again updates the group without duplicating the entry
+	if err := db.TrackProject("golang", "go", "langs", ""); err != nil {
+		t.Fatalf("TrackProject failed: %v", err)
+	}
+
+	first := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	if err := db.RecordFetch("cli", "cli", first, nil); err != nil {
+		t.Fatalf("RecordFetch failed: %v", err)
+	}
+	if err := db.RecordFetch("cli", "cli", second, nil); err != nil {
+		t.Fatalf("RecordFetch failed: %v", err)
+	}
+	if err := db.RecordFetch("golang", "go", second, errors.New("rate limited")); err != nil {
+		t.Fatalf("RecordFetch failed: %v", err)
+	}
+
+	projects, err := db.ListProjects("")
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(projects) != 2 {
+		t.Fatalf("expected 2 projects, got %d", len(projects))
+	}
+	cli, golang := projects[0], projects[1]
+	if !cli.FirstFetchAt.Equal(first) || !cli.LastFetchAt.Equal(second) || cli.LastError != "" {
+		t.Fatalf("unexpected cli project: %+v", cli)
+	}
+	if golang.Group != "langs" || golang.LastError != "rate limited" || !golang.LastFetchAt.IsZero() {
+		t.Fatalf("unexpected golang project: %+v", golang)
+	}
+
+	if grouped, _ := db.ListProjects("clis"); len(grouped) != 1 {
+		t.Fatalf("expected 1 project in group, got %d", len(grouped))
+	}
+
+	removed, err := db.UntrackProject("cli", "cli")
+	if err != nil || !removed {
+		t.Fatalf("UntrackProject = %v, %v", removed, err)
+	}
+	if removed, _ := db.UntrackProject("cli", "cli"); removed {
+		t.Fatal("expected second untrack to report nothing removed")
+	}
+}
+
+func TestResolveSnapshotsAndBaselines(t *testing.T) {
+	db := newTestDatabase(t)
+
+	first := sampleStats()
+	first.FetchedAt = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	second := sampleStats()
+	second.FetchedAt = time.Date(2024, 7, 3, 12, 0, 0, 0, time.UTC)
+	for _, s := range []*ReleaseStats{first, second} {
+		if err := db.StoreStats(s); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+
+	latest, err := db.GetLatestStats("owner", "repo")
+	if err != nil {
+		t.Fatalf("GetLatestStats failed: %v", err)
+	}
+	if latest.SnapshotID != 3 {
+		t.Fatalf("expected snapshot ID 3, got %d", latest.SnapshotID)
+	}
+
+	// Any row of a snapshot resolves to the whole snapshot
+	byID, err := db.GetSnapshotByID("owner", "repo", 2)
+	if err != nil {
+		t.Fatalf("GetSnapshotByID failed: %v", err)
+	}
+	if !byID.FetchedAt.Equal(first.FetchedAt) || byID.SnapshotID != 1 || len(byID.Releases) != 2 {
+		t.Fatalf("unexpected snapshot: %+v", byID)
+	}
+	if _, err := db.GetSnapshotByID("owner", "other", 1); err == nil {
+		t.Fatal("expected snapshot IDs to be scoped to the repository")
+	}
+
+	at, err := db.GetSnapshotAt("owner", "repo", time.Date(2024, 7, 2, 23, 59, 0, 0, time.UTC))
+	if err != nil || !at.FetchedAt.Equal(first.FetchedAt) {
+		t.Fatalf("expected the snapshot on or before July 2, got %+v (%v)", at, err)
+	}
+	at, err = db.GetSnapshotAt("owner", "repo", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || !at.FetchedAt.Equal(first.FetchedAt) {
+		t.Fatalf("expected the first snapshot for an earlier date, got %+v (%v)", at, err)
+	}
+
+	if err := db.SetBaseline("owner", "repo", "launch", first.FetchedAt); err != nil {
+		t.Fatalf("SetBaseline failed: %v", err)
+	}
+	if err := db.SetBaseline("owner", "repo", "launch", second.FetchedAt); err != nil {
+		t.Fatalf("SetBaseline failed to move the baseline: %v", err)
+	}
+	b, err := db.GetBaseline("owner", "repo", "launch")
+	if err != nil || b == nil || !b.FetchedAt.Equal(second.FetchedAt) {
+		t.Fatalf("expected launch to point at the second snapshot, got %+v (%v)", b, err)
+	}
+	if missing, err := db.GetBaseline("owner", "repo", "nope"); err != nil || missing != nil {
+		t.Fatalf("expected no baseline, got %+v (%v)", missing, err)
+	}
+
+	removed, err := db.DeleteBaseline("owner", "repo", "launch")
+	if err != nil || !removed {
+		t.Fatalf("DeleteBaseline = %v, %v", removed, err)
+	}
+	if list, err := db.ListBaselines("owner", "repo"); err != nil || len(list) != 0 {
+		t.Fatalf("expected no baselines left, got %+v (%v)", list, err)
+	}
+}
+
+func TestGetPeriodSnapshots(t *testing.T) {
+	db := newTestDatabase(t)
+
+	first := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	for day := 0; day < 3; day++ {
+		s := sampleStats()
+		s.FetchedAt = first.AddDate(0, 0, day*10)
+		if err := db.StoreStats(s); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+
+	// The period starts between the first and second snapshots
+	oldest, newest, err := db.GetPeriodSnapshots("owner", "repo", first.AddDate(0, 0, 5), first.AddDate(0, 0, 15))
+	if err != nil {
+		t.Fatalf("GetPeriodSnapshots failed: %v", err)
+	}
+	if !oldest.FetchedAt.Equal(first) || !newest.FetchedAt.Equal(first.AddDate(0, 0, 10)) {
+		t.Fatalf("unexpected bounds: %s to %s", oldest.FetchedAt, newest.FetchedAt)
+	}
+
+	oldest, newest, err = db.GetPeriodSnapshots("owner", "repo", first.AddDate(0, 0, 25), first.AddDate(0, 0, 30))
+	if err != nil || oldest != nil || newest != nil {
+		t.Fatalf("expected no snapshots after the last fetch, got %v, %v, %v", oldest, newest, err)
+	}
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// DiffReport describes what changed between two snapshots of the same repo.
+// Changed releases are ordered by growth, largest first.
+type DiffReport struct {
+	Owner           string              `json:"owner" yaml:"owner"`
+	Repo            string              `json:"repo" yaml:"repo"`
+	Previous        SnapshotTotal       `json:"previous" yaml:"previous"`
+	Current         SnapshotTotal       `json:"current" yaml:"current"`
+	Growth          int                 `json:"growth" yaml:"growth"`
+	GrowthPercent   float64             `json:"growth_percent" yaml:"growth_percent"`
+	Releases        []ReleaseComparison `json:"releases" yaml:"releases"`
+	NewReleases     []ReleaseSummary    `json:"new_releases" yaml:"new_releases"`
+	RemovedReleases []ReleaseSummary    `json:"removed_releases" yaml:"removed_releases"`
+}
+
+// DiffSnapshots matches releases by tag and reports download deltas as well
+// as releases that appeared or disappeared between previous and current.
+func DiffSnapshots(previous, current *ReleaseStats) *DiffReport {
+	growth := current.TotalDownloads - previous.TotalDownloads
+	report := &DiffReport{
+		Owner:           current.Owner,
+		Repo:            current.Repo,
+		Previous:        snapshotTotal(previous),
+		Current:         snapshotTotal(current),
+		Growth:          growth,
+		GrowthPercent:   percentOf(growth, previous.TotalDownloads),
+		Releases:        make([]ReleaseComparison, 0),
+		NewReleases:     make([]ReleaseSummary, 0),
+		RemovedReleases: make([]ReleaseSummary, 0),
+	}
+
+	before := make(map[string]Release, len(previous.Releases))
+	for _, rel := range previous.Releases {
+		before[rel.Tag] = rel
+	}
+
+	seen := make(map[string]bool, len(current.Releases))
+	for _, rel := range current.Releases {
+		seen[rel.Tag] = true
+		old, ok := before[rel.Tag]
+		if !ok {
+			report.NewReleases = append(report.NewReleases, summarizeRelease(rel))
+			continue
+		}
+		c := NewReleaseComparison(rel.Name, rel.Tag, old.TotalDownloads, rel.TotalDownloads)
+		c.Assets = compareAssets(old.Assets, rel.Assets)
+		report.Releases = append(report.Releases, c)
+	}
+
+	for _, rel := range previous.Releases {
+		if !seen[rel.Tag] {
+			report.RemovedReleases = append(report.RemovedReleases, summarizeRelease(rel))
+		}
+	}
+
+	// Equal growth falls back to the newest version first
+	sort.SliceStable(report.Releases, func(i, j int) bool {
+		a, b := report.Releases[i], report.Releases[j]
+		if a.Growth != b.Growth {
+			return a.Growth > b.Growth
+		}
+		return ParseVersion(a.Tag).Compare(ParseVersion(b.Tag)) > 0
+	})
+
+	return report
+}
+
+func summarizeRelease(rel Release) ReleaseSummary {
+	return ReleaseSummary{Name: rel.Name, Tag: rel.Tag, TotalDownloads: rel.TotalDownloads}
+}
+
+// WriteText writes the total change followed by new, removed and changed releases.
+func (r *DiffReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nChanges for %s/%s since %s\n", r.Owner, r.Repo, r.Previous.FetchedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(out, "Total Downloads: %d -> %d (%+d, %+.2f%%)\n", r.Previous.TotalDownloads, r.Current.TotalDownloads, r.Growth, r.GrowthPercent)
+
+	if len(r.NewReleases) > 0 {
+		fmt.Fprintf(out, "\nNew releases:\n")
+		for _, rel := range r.NewReleases {
+			fmt.Fprintf(out, "  + %s (%s): %d downloads\n", rel.Name, rel.Tag, rel.TotalDownloads)
+		}
+	}
+	if len(r.RemovedReleases) > 0 {
+		fmt.Fprintf(out, "\nRemoved releases:\n")
+		for _, rel := range r.RemovedReleases {
+			fmt.Fprintf(out, "  - %s (%s): %d downloads\n", rel.Name, rel.Tag, rel.TotalDownloads)
+		}
+	}
+
+	changed := 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range r.Releases {
+		if c.Growth == 0 {
+			continue
+		}
+		if changed == 0 {
+			fmt.Fprintf(out, "\nChanged releases:\n")
+			fmt.Fprintln(w, "  RELEASE\tTAG\tBEFORE\tAFTER\tGROWTH")
+		}
+		changed++
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%+d (%+.2f%%)\n", c.Name, c.Tag, c.OldDownloads, c.NewDownloads, c.Growth, c.GrowthPercent)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if changed == 0 && len(r.NewReleases) == 0 && len(r.RemovedReleases) == 0 {
+		fmt.Fprintf(out, "\nNo changes.\n")
+	}
+
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// Table returns one row per release with its status: new, removed or changed.
+func (r *DiffReport) Table() ([]string, [][]string) {
+	header := []string{"status", "release", "tag", "old_downloads", "new_downloads", "growth"}
+	rows := make([][]string, 0, len(r.Releases)+len(r.NewReleases)+len(r.RemovedReleases))
+	for _, rel := range r.NewReleases {
+		rows = append(rows, []string{StatusNew, rel.Name, rel.Tag, "0", strconv.Itoa(rel.TotalDownloads), strconv.Itoa(rel.TotalDownloads)})
+	}
+	for _, rel := range r.RemovedReleases {
+		rows = append(rows, []string{StatusRemoved, rel.Name, rel.Tag, strconv.Itoa(rel.TotalDownloads), "0", strconv.Itoa(-rel.TotalDownloads)})
+	}
+	for _, c := range r.Releases {
+		rows = append(rows, []string{releaseStatus(c), c.Name, c.Tag, strconv.Itoa(c.OldDownloads), strconv.Itoa(c.NewDownloads), strconv.Itoa(c.Growth)})
+	}
+	return header, rows
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	previous := sampleStats()
+	current := sampleStats()
+	current.Releases = []Release{
+		{Name: "Release Two", Tag: "v1.1.0", TotalDownloads: 14},
+		{Name: "Release Three", Tag: "v1.2.0", TotalDownloads: 3},
+	}
+	current.TotalDownloads = 17
+
+	report := DiffSnapshots(previous, current)
+
+	if report.Growth != 2 {
+		t.Fatalf("expected growth 2, got %d", report.Growth)
+	}
+	if len(report.NewReleases) != 1 || report.NewReleases[0].Tag != "v1.2.0" {
+		t.Fatalf("expected v1.2.0 to be new, got %+v", report.NewReleases)
+	}
+	if len(report.RemovedReleases) != 1 || report.RemovedReleases[0].Tag != "v1.0.0" {
+		t.Fatalf("expected v1.0.0 to be removed, got %+v", report.RemovedReleases)
+	}
+	if len(report.Releases) != 1 || report.Releases[0].Growth != 4 {
+		t.Fatalf("expected v1.1.0 to grow by 4, got %+v", report.Releases)
+	}
+}
+
+func TestCompareReportChurnAndAssets(t *testing.T) {
+	oldest := sampleStats()
+	oldest.FetchedAt = time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	newest := &ReleaseStats{
+		Owner:     "owner",
+		Repo:      "repo",
+		FetchedAt: oldest.FetchedAt.AddDate(0, 0, 14),
+		Releases: []Release{
+			{Name: "Release Two", Tag: "v1.1.0", TotalDownloads: 18, Assets: []Asset{
+				{Name: "asset2.tar.gz", DownloadCount: 12},
+				{Name: "asset2.zip", DownloadCount: 6},
+			}},
+			{Name: "Release Three", Tag: "v1.2.0", TotalDownloads: 7, Assets: []Asset{
+				{Name: "asset3.tar.gz", DownloadCount: 7},
+			}},
+		},
+		TotalDownloads: 25,
+	}
+
+	report := NewCompareReport(oldest, newest)
+
+	if report.Days != 14 || report.Growth != 10 {
+		t.Fatalf("expected +10 over 14 days, got %+d over %d", report.Growth, report.Days)
+	}
+	if len(report.NewReleases) != 1 || report.NewReleases[0].Tag != "v1.2.0" {
+		t.Fatalf("expected v1.2.0 to be new, got %+v", report.NewReleases)
+	}
+	if len(report.RemovedReleases) != 1 || report.RemovedReleases[0].Tag != "v1.0.0" {
+		t.Fatalf("expected v1.0.0 to be removed, got %+v", report.RemovedReleases)
+	}
+
+	assets := report.Releases[0].Assets
+	if len(assets) != 2 {
+		t.Fatalf("expected 2 asset deltas, got %+v", assets)
+	}
+	if assets[0].Name != "asset2.zip" || assets[0].Status != StatusNew || assets[0].Growth != 6 {
+		t.Errorf("expected the new zip first, got %+v", assets[0])
+	}
+	if assets[1].Status != StatusChanged || assets[1].Growth != 2 {
+		t.Errorf("expected the tarball to grow by 2, got %+v", assets[1])
+	}
+
+	header, rows := report.Table()
+	if len(rows) != 3 || header[len(header)-1] != "status" || rows[1][6] != StatusNew || rows[2][6] != StatusRemoved {
+		t.Fatalf("unexpected table: %v %v", header, rows)
+	}
+}
+
+func TestDiffSnapshotsOrdersEqualGrowthBySemver(t *testing.T) {
+	previous := &ReleaseStats{Releases: []Release{
+		{Tag: "v1.9.0", TotalDownloads: 1},
+		{Tag: "v1.10.0", TotalDownloads: 1},
+	}}
+	current := &ReleaseStats{Releases: []Release{
+		{Tag: "v1.9.0", TotalDownloads: 2},
+		{Tag: "v1.10.0", TotalDownloads: 2},
+	}}
+
+	report := DiffSnapshots(previous, current)
+	if report.Releases[0].Tag != "v1.10.0" {
+		t.Fatalf("expected v1.10.0 first, got %+v", report.Releases)
+	}
+}
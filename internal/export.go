@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ExportLevel selects the granularity of exported rows.
+type ExportLevel string
+
+const (
+	ExportLevelSnapshot ExportLevel = "snapshot"
+	ExportLevelRelease  ExportLevel = "release"
+	ExportLevelAsset    ExportLevel = "asset"
+)
+
+// ExportFormat selects the encoding of exported rows.
+type ExportFormat string
+
+const (
+	ExportFormatJSON    ExportFormat = "json"
+	ExportFormatJSONL   ExportFormat = "jsonl"
+	ExportFormatCSV     ExportFormat = "csv"
+	ExportFormatParquet ExportFormat = "parquet"
+)
+
+// ParseExportLevel validates an export level name.
+func ParseExportLevel(s string) (ExportLevel, error) {
+	switch l := ExportLevel(s); l {
+	case ExportLevelSnapshot, ExportLevelRelease, ExportLevelAsset:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown export level %q (want snapshot, release or asset)", s)
+}
+
+// ParseExportFormat validates an export format name.
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(s); f {
+	case ExportFormatJSON, ExportFormatJSONL, ExportFormatCSV, ExportFormatParquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want json, jsonl, csv or parquet)", s)
+}
+
+// SnapshotRow is one exported row per stored snapshot.
+type SnapshotRow struct {
+	FetchedAt time.Time `json:"fetched_at" parquet:"fetched_at,timestamp"`
+	Owner     string    `json:"owner" parquet:"owner,dict"`
+	Repo      string    `json:"repo" parquet:"repo,dict"`
+	Releases  int64     `json:"releases" parquet:"releases"`
+	Assets    int64     `json:"assets" parquet:"assets"`
+	Downloads int64     `json:"downloads" parquet:"downloads"`
+}
+
+// ReleaseRow is one exported row per release per stored snapshot.
+type ReleaseRow struct {
+	FetchedAt   time.Time `json:"fetched_at" parquet:"fetched_at,timestamp"`
+	Owner       string    `json:"owner" parquet:"owner,dict"`
+	Repo        string    `json:"repo" parquet:"repo,dict"`
+	Tag         string    `json:"tag" parquet:"tag,dict"`
+	ReleaseName string    `json:"release_name" parquet:"release_name,dict"`
+	CreatedAt   time.Time `json:"created_at" parquet:"created_at,timestamp"`
+	Assets      int64     `json:"assets" parquet:"assets"`
+	Downloads   int64     `json:"downloads" parquet:"downloads"`
+}
+
+// AssetRow is one exported row per asset per release per stored snapshot.
+type AssetRow struct {
+	FetchedAt   time.Time `json:"fetched_at" parquet:"fetched_at,timestamp"`
+	Owner       string    `json:"owner" parquet:"owner,dict"`
+	Repo        string    `json:"repo" parquet:"repo,dict"`
+	Tag         string    `json:"tag" parquet:"tag,dict"`
+	Asset       string    `json:"asset" parquet:"asset,dict"`
+	ContentType string    `json:"content_type" parquet:"content_type,dict"`
+	Size        int64     `json:"size" parquet:"size"`
+	Downloads   int64     `json:"downloads" parquet:"downloads"`
+}
+
+func (r SnapshotRow) csvHeader() []string {
+	return []string{"fetched_at", "owner", "repo", "releases", "assets", "downloads"}
+}
+
+func (r SnapshotRow) csvRecord() []string {
+	return []string{
+		formatExportTime(r.FetchedAt), r.Owner, r.Repo,
+		strconv.FormatInt(r.Releases, 10),
+		strconv.FormatInt(r.Assets, 10),
+		strconv.FormatInt(r.Downloads, 10),
+	}
+}
+
+func (r ReleaseRow) csvHeader() []string {
+	return []string{"fetched_at", "owner", "repo", "tag", "release_name", "created_at", "assets", "downloads"}
+}
+
+func (r ReleaseRow) csvRecord() []string {
+	return []string{
+		formatExportTime(r.FetchedAt), r.Owner, r.Repo, r.Tag, r.ReleaseName,
+		formatExportTime(r.CreatedAt),
+		strconv.FormatInt(r.Assets, 10),
+		strconv.FormatInt(r.Downloads, 10),
+	}
+}
+
+func (r AssetRow) csvHeader() []string {
+	return []string{"fetched_at", "owner", "repo", "tag", "asset", "content_type", "size", "downloads"}
+}
+
+func (r AssetRow) csvRecord() []string {
+	return []string{
+		formatExportTime(r.FetchedAt), r.Owner, r.Repo, r.Tag, r.Asset, r.ContentType,
+		strconv.FormatInt(r.Size, 10),
+		strconv.FormatInt(r.Downloads, 10),
+	}
+}
+
+type exportRow interface {
+	SnapshotRow | ReleaseRow | AssetRow
+	csvHeader() []string
+	csvRecord() []string
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// SnapshotRows flattens snapshots into one row per snapshot, oldest first.
+func SnapshotRows(snapshots []ReleaseStats) []SnapshotRow {
+	rows := make([]SnapshotRow, 0, len(snapshots))
+	for _, s := range chronological(snapshots) {
+		row := SnapshotRow{
+			FetchedAt: s.FetchedAt.UTC(),
+			Owner:     s.Owner,
+			Repo:      s.Repo,
+			Releases:  int64(len(s.Releases)),
+			Downloads: int64(s.TotalDownloads),
+		}
+		for _, rel := range s.Releases {
+			row.Assets += int64(len(rel.Assets))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// ReleaseRows flattens snapshots into one row per release, oldest snapshot first.
+func ReleaseRows(snapshots []ReleaseStats) []ReleaseRow {
+	rows := make([]ReleaseRow, 0)
+	for _, s := range chronological(snapshots) {
+		for _, rel := range s.Releases {
+			rows = append(rows, ReleaseRow{
+				FetchedAt:   s.FetchedAt.UTC(),
+				Owner:       s.Owner,
+				Repo:        s.Repo,
+				Tag:         rel.Tag,
+				ReleaseName: rel.Name,
+				CreatedAt:   rel.CreatedAt.UTC(),
+				Assets:      int64(len(rel.Assets)),
+				Downloads:   int64(rel.TotalDownloads),
+			})
+		}
+	}
+	return rows
+}
+
+// AssetRows flattens snapshots into one row per asset, oldest snapshot first.
+func AssetRows(snapshots []ReleaseStats) []AssetRow {
+	rows := make([]AssetRow, 0)
+	for _, s := range chronological(snapshots) {
+		for _, rel := range s.Releases {
+			for _, asset := range rel.Assets {
+				rows = append(rows, AssetRow{
+					FetchedAt:   s.FetchedAt.UTC(),
+					Owner:       s.Owner,
+					Repo:        s.Repo,
+					Tag:         rel.Tag,
+					Asset:       asset.Name,
+					ContentType: asset.ContentType,
+					Size:        asset.Size,
+					Downloads:   int64(asset.DownloadCount),
+				})
+			}
+		}
+	}
+	return rows
+}
+
+// chronological returns snapshots ordered oldest first. The database returns
+// them newest first, which is the wrong way round for a time series.
+func chronological(snapshots []ReleaseStats) []ReleaseStats {
+	out := make([]ReleaseStats, len(snapshots))
+	copy(out, snapshots)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// WriteExport writes snapshots to w as a long-format table at the given level.
+func WriteExport(w io.Writer, snapshots []ReleaseStats, level ExportLevel, format ExportFormat) error {
+	switch level {
+	case ExportLevelSnapshot:
+		return writeExportRows(w, SnapshotRows(snapshots), format)
+	case ExportLevelRelease:
+		return writeExportRows(w, ReleaseRows(snapshots), format)
+	case ExportLevelAsset:
+		return writeExportRows(w, AssetRows(snapshots), format)
+	}
+	return fmt.Errorf("unknown export level %q", level)
+}
+
+func writeExportRows[T exportRow](w io.Writer, rows []T, format ExportFormat) error {
+	switch format {
+	case ExportFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case ExportFormatJSONL:
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return fmt.Errorf("failed to encode row: %w", err)
+			}
+		}
+		return nil
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		var zero T
+		if err := cw.Write(zero.csvHeader()); err != nil {
+			return fmt.Errorf("failed to write csv header: %w", err)
+		}
+		for _, row := range rows {
+			if err := cw.Write(row.csvRecord()); err != nil {
+				return fmt.Errorf("failed to write csv row: %w", err)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case ExportFormatParquet:
+		pw := parquet.NewGenericWriter[T](w, parquet.Compression(&parquet.Snappy))
+		if _, err := pw.Write(rows); err != nil {
+			return fmt.Errorf("failed to write parquet rows: %w", err)
+		}
+		return pw.Close()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
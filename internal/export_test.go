@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func sampleSnapshots() []ReleaseStats {
+	older := *sampleStats()
+	older.FetchedAt = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	newer := *sampleStats()
+	newer.FetchedAt = time.Date(2024, 7, 2, 12, 0, 0, 0, time.UTC)
+	newer.TotalDownloads = 20
+	newer.Releases = append([]Release(nil), newer.Releases...)
+	newer.Releases[1].TotalDownloads = 15
+	newer.Releases[1].Assets = []Asset{{Name: "asset2.tar.gz", DownloadCount: 15}}
+	// Newest first, as returned by the database.
+	return []ReleaseStats{newer, older}
+}
+
+func TestWriteExportCSVRelease(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, sampleSnapshots(), ExportLevelRelease, ExportFormatCSV); err != nil {
+		t.Fatalf("WriteExport failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"fetched_at,owner,repo,tag,release_name,created_at,assets,downloads",
+		"2024-07-01T12:00:00Z,owner,repo,v1.0.0,Release One,2024-05-01T00:00:00Z,1,5",
+		"2024-07-01T12:00:00Z,owner,repo,v1.1.0,Release Two,2024-06-01T00:00:00Z,1,10",
+		"2024-07-02T12:00:00Z,owner,repo,v1.0.0,Release One,2024-05-01T00:00:00Z,1,5",
+		"2024-07-02T12:00:00Z,owner,repo,v1.1.0,Release Two,2024-06-01T00:00:00Z,1,15",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %d:\n%s", len(want), len(lines), buf.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("line %d: expected %q, got %q", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestWriteExportJSONLSnapshot(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, sampleSnapshots(), ExportLevelSnapshot, ExportFormatJSONL); err != nil {
+		t.Fatalf("WriteExport failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	var row SnapshotRow
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil {
+		t.Fatalf("failed to decode row: %v", err)
+	}
+	if row.Downloads != 20 || row.Releases != 2 || row.Assets != 2 {
+		t.Fatalf("unexpected snapshot row: %+v", row)
+	}
+}
+
+func TestWriteExportParquetAsset(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, sampleSnapshots(), ExportLevelAsset, ExportFormatParquet); err != nil {
+		t.Fatalf("WriteExport failed: %v", err)
+	}
+
+	rows, err := parquet.Read[AssetRow](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read parquet: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+	last := rows[3]
+	if last.Asset != "asset2.tar.gz" || last.Downloads != 15 || !last.FetchedAt.Equal(time.Date(2024, 7, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected last row: %+v", last)
+	}
+}
+
+func TestParseExportOptions(t *testing.T) {
+	if _, err := ParseExportLevel("asset"); err != nil {
+		t.Fatalf("expected asset level to parse: %v", err)
+	}
+	if _, err := ParseExportLevel("tag"); err == nil {
+		t.Fatal("expected unknown level to fail")
+	}
+	if _, err := ParseExportFormat("xlsx"); err == nil {
+		t.Fatal("expected unknown format to fail")
+	}
+}
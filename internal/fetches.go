@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// FetchLog records one attempt to fetch a repository, successful or not,
+// with the rate limit GitHub reported during it.
+type FetchLog struct {
+	Owner     string        `json:"owner" yaml:"owner"`
+	Repo      string        `json:"repo" yaml:"repo"`
+	StartedAt time.Time     `json:"started_at" yaml:"started_at"`
+	Duration  time.Duration `json:"duration" yaml:"duration"`
+	Error     string        `json:"error,omitempty" yaml:"error,omitempty"`
+	Rate      RateLimit     `json:"rate" yaml:"rate"`
+}
+
+// LogFetch appends a fetch attempt to the fetch log.
+func (d *Database) LogFetch(f FetchLog) error {
+	var reset sql.NullTime
+	if !f.Rate.Reset.IsZero() {
+		reset = sql.NullTime{Time: f.Rate.Reset, Valid: true}
+	}
+	_, err := d.db.Exec(
+		`INSERT INTO fetches (owner, repo, started_at, duration_ms, error, rate_limit, rate_remaining, rate_reset)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.Owner, f.Repo, f.StartedAt, f.Duration.Milliseconds(), f.Error, f.Rate.Limit, f.Rate.Remaining, reset,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log fetch: %w", err)
+	}
+	return nil
+}
+
+// FetchSummary describes the fetch history of a repository.
+type FetchSummary struct {
+	Owner string
+	Repo  string
+	// Fetches and Errors count the logged attempts and the failed ones.
+	Fetches int
+	Errors  int
+	// Last is the latest logged attempt, or nil when none was logged, as
+	// for snapshots stored before fetches were logged.
+	Last *FetchLog
+}
+
+// FetchSummaries returns a summary for every repository with a stored
+// snapshot or a logged fetch, ordered by owner and repo.
+func (d *Database) FetchSummaries() ([]FetchSummary, error) {
+	rows, err := d.db.Query(
+		`SELECT r.owner, r.repo, COALESCE(c.total, 0), COALESCE(c.errors, 0),
+			f.started_at, f.duration_ms, f.error, f.rate_limit, f.rate_remaining, f.rate_reset
+		 FROM (SELECT owner, repo FROM stats UNION SELECT owner, repo FROM fetches) r
+		 LEFT JOIN (
+			SELECT owner, repo, MAX(id) AS last_id, COUNT(*) AS total, SUM(error != '') AS errors
+			FROM fetches GROUP BY owner, repo
+		 ) c ON c.owner = r.owner AND c.repo = r.repo
+		 LEFT JOIN fetches f ON f.id = c.last_id
+		 ORDER BY r.owner, r.repo`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fetches: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make([]FetchSummary, 0)
+	for rows.Next() {
+		var s FetchSummary
+		var started, reset sql.NullTime
+		var durationMS, limit, remaining sql.NullInt64
+		var fetchErr sql.NullString
+		if err := rows.Scan(&s.Owner, &s.Repo, &s.Fetches, &s.Errors,
+			&started, &durationMS, &fetchErr, &limit, &remaining, &reset); err != nil {
+			return nil, fmt.Errorf("failed to scan fetch: %w", err)
+		}
+		if started.Valid {
+			s.Last = &FetchLog{
+				Owner:     s.Owner,
+				Repo:      s.Repo,
+				StartedAt: started.Time,
+				Duration:  time.Duration(durationMS.Int64) * time.Millisecond,
+				Error:     fetchErr.String,
+				Rate:      RateLimit{Limit: int(limit.Int64), Remaining: int(remaining.Int64), Reset: reset.Time},
+			}
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, rows.Err()
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReleaseSort names an ordering for the releases of a snapshot.
+type ReleaseSort string
+
+const (
+	SortDownloads ReleaseSort = "downloads"
+	SortCreated   ReleaseSort = "created"
+	SortTag       ReleaseSort = "tag"
+	SortSemver    ReleaseSort = "semver"
+)
+
+// ParseReleaseSort validates a sort order name.
+func ParseReleaseSort(s string) (ReleaseSort, error) {
+	switch o := ReleaseSort(s); o {
+	case SortDownloads, SortCreated, SortTag, SortSemver:
+		return o, nil
+	case "":
+		return SortDownloads, nil
+	}
+	return "", fmt.Errorf("unknown sort order %q (want downloads, created, tag or semver)", s)
+}
+
+// ReleaseFilter selects and orders the releases of a snapshot.
+type ReleaseFilter struct {
+	// TagGlob keeps releases whose tag matches a shell pattern such as "v2.*".
+	TagGlob string
+	// Since keeps releases published at or after this time (see
+	// Release.ReleaseDate).
+	Since time.Time
+	// Sort orders the remaining releases; downloads and created are
+	// descending, tag is ascending and semver puts the highest version first.
+	Sort ReleaseSort
+	// Top keeps only the first N releases after sorting when positive.
+	Top int
+}
+
+// Apply returns a copy of stats containing only the selected releases, with
+// TotalDownloads and AuxiliaryDownloads recomputed for that selection.
+func (f ReleaseFilter) Apply(stats *ReleaseStats) (*ReleaseStats, error) {
+	if f.TagGlob != "" {
+		if _, err := path.Match(f.TagGlob, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %q: %w", f.TagGlob, err)
+		}
+	}
+
+	out := *stats
+	out.Releases = make([]Release, 0, len(stats.Releases))
+	out.TotalDownloads = 0
+	out.AuxiliaryDownloads = 0
+
+	for _, rel := range stats.Releases {
+		if f.TagGlob != "" {
+			if ok, _ := path.Match(f.TagGlob, rel.Tag); !ok {
+				continue
+			}
+		}
+		if !f.Since.IsZero() && rel.ReleaseDate().Before(f.Since) {
+			continue
+		}
+		out.Releases = append(out.Releases, rel)
+	}
+
+	SortReleases(out.Releases, f.Sort)
+
+	if f.Top > 0 && len(out.Releases) > f.Top {
+		out.Releases = out.Releases[:f.Top]
+	}
+	for _, rel := range out.Releases {
+		out.TotalDownloads += rel.TotalDownloads
+		out.AuxiliaryDownloads += rel.AuxiliaryDownloads
+	}
+
+	return &out, nil
+}
+
+// SortReleases orders releases in place. Ties keep their existing order.
+func SortReleases(releases []Release, order ReleaseSort) {
+	var less func(a, b Release) bool
+	switch order {
+	case SortCreated:
+		less = func(a, b Release) bool { return a.CreatedAt.After(b.CreatedAt) }
+	case SortTag:
+		less = func(a, b Release) bool { return strings.Compare(a.Tag, b.Tag) < 0 }
+	case SortSemver:
+		less = func(a, b Release) bool { return ParseVersion(a.Tag).Compare(ParseVersion(b.Tag)) > 0 }
+	default:
+		less = func(a, b Release) bool { return a.TotalDownloads > b.TotalDownloads }
+	}
+	sort.SliceStable(releases, func(i, j int) bool { return less(releases[i], releases[j]) })
+}
+
+// ParseDate accepts a calendar date or an RFC3339 timestamp. An empty string
+// yields the zero time. When endOfDay is set, a bare date is extended to the
+// last instant of that day so it can be used as an inclusive upper bound.
+func ParseDate(s string, endOfDay bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or RFC3339, got %q", s)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReleaseFilterApply(t *testing.T) {
+	stats := sampleStats()
+	stats.Releases = append(stats.Releases, Release{
+		Name:           "Release Ten",
+		Tag:            "v1.10.0",
+		TotalDownloads: 1,
+		CreatedAt:      time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	filtered, err := ReleaseFilter{TagGlob: "v1.1*", Sort: SortSemver}.Apply(stats)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(filtered.Releases) != 2 || filtered.Releases[0].Tag != "v1.10.0" || filtered.Releases[1].Tag != "v1.1.0" {
+		t.Fatalf("unexpected releases: %+v", filtered.Releases)
+	}
+	if filtered.TotalDownloads != 11 {
+		t.Fatalf("expected total 11, got %d", filtered.TotalDownloads)
+	}
+	if len(stats.Releases) != 3 {
+		t.Fatal("Apply must not modify its input")
+	}
+
+	filtered, err = ReleaseFilter{Since: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), Top: 1}.Apply(stats)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(filtered.Releases) != 1 || filtered.Releases[0].Tag != "v1.1.0" {
+		t.Fatalf("unexpected releases: %+v", filtered.Releases)
+	}
+
+	// v1.0.0 was created before Since but published after it
+	stats.Releases[0].PublishedAt = time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)
+	filtered, err = ReleaseFilter{Since: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)}.Apply(stats)
+	if err != nil || len(filtered.Releases) != 3 {
+		t.Fatalf("expected v1.0.0 to count from its publish date, got %+v, %v", filtered, err)
+	}
+
+	if _, err := (ReleaseFilter{TagGlob: "["}).Apply(stats); err == nil {
+		t.Fatal("expected invalid glob to fail")
+	}
+}
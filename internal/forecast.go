@@ -0,0 +1,546 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ForecastModel names a model fitted to cumulative download totals.
+type ForecastModel string
+
+const (
+	// ModelLinear fits a straight line: a constant number of downloads per day.
+	ModelLinear ForecastModel = "linear"
+	// ModelExponential fits a straight line to the logarithm of the total: a
+	// constant growth rate.
+	ModelExponential ForecastModel = "exponential"
+	// ModelHolt is Holt's linear trend method (double exponential smoothing)
+	// on daily totals, which follows recent changes in the rate.
+	ModelHolt ForecastModel = "holt"
+)
+
+// ForecastModels lists every model in the order they are reported.
+var ForecastModels = []ForecastModel{ModelLinear, ModelExponential, ModelHolt}
+
+// ParseForecastModels parses a model name, or "all" for every model.
+func ParseForecastModels(s string) ([]ForecastModel, error) {
+	if s == "all" {
+		return ForecastModels, nil
+	}
+	for _, m := range ForecastModels {
+		if string(m) == s {
+			return []ForecastModel{m}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown model %q (want linear, exponential, holt or all)", s)
+}
+
+// maxTargetDays bounds the search for the date a target is crossed.
+const maxTargetDays = 10 * 365
+
+// ForecastOptions controls NewForecastReport.
+type ForecastOptions struct {
+	Models []ForecastModel
+	// Days is the number of days projected past the latest snapshot.
+	Days int
+	// Confidence is the coverage of the prediction bands, e.g. 0.95.
+	Confidence float64
+	// Target, when positive, is a download total to solve the date for.
+	Target int
+}
+
+// ForecastPoint is a projected total with its prediction band.
+type ForecastPoint struct {
+	Date  time.Time `json:"date" yaml:"date"`
+	Value float64   `json:"value" yaml:"value"`
+	Lower float64   `json:"lower" yaml:"lower"`
+	Upper float64   `json:"upper" yaml:"upper"`
+}
+
+// TargetEstimate is when a model expects a download total to be crossed.
+// Earliest follows the upper band and Latest the lower band; each is nil
+// when the crossing lies beyond the search horizon of ten years.
+type TargetEstimate struct {
+	Target   int        `json:"target" yaml:"target"`
+	Reached  bool       `json:"reached" yaml:"reached"`
+	Date     *time.Time `json:"date" yaml:"date"`
+	Earliest *time.Time `json:"earliest" yaml:"earliest"`
+	Latest   *time.Time `json:"latest" yaml:"latest"`
+}
+
+// ModelForecast is the projection of one model.
+type ModelForecast struct {
+	Model ForecastModel `json:"model" yaml:"model"`
+	// RMSE is the root mean squared error of the fit, in downloads.
+	RMSE float64 `json:"rmse" yaml:"rmse"`
+	// PerDay is the projected number of downloads per day over the horizon.
+	PerDay float64         `json:"per_day" yaml:"per_day"`
+	Points []ForecastPoint `json:"points" yaml:"points"`
+	Target *TargetEstimate `json:"target,omitempty" yaml:"target,omitempty"`
+}
+
+// Final returns the projection at the end of the horizon.
+func (m ModelForecast) Final() ForecastPoint {
+	if len(m.Points) == 0 {
+		return ForecastPoint{}
+	}
+	return m.Points[len(m.Points)-1]
+}
+
+// SkippedModel records a model that could not be fitted to the data.
+type SkippedModel struct {
+	Model  ForecastModel `json:"model" yaml:"model"`
+	Reason string        `json:"reason" yaml:"reason"`
+}
+
+// ForecastReport renders the forecast command.
+type ForecastReport struct {
+	Owner      string          `json:"owner" yaml:"owner"`
+	Repo       string          `json:"repo" yaml:"repo"`
+	Current    SnapshotTotal   `json:"current" yaml:"current"`
+	Snapshots  int             `json:"snapshots" yaml:"snapshots"`
+	Days       int             `json:"days" yaml:"days"`
+	Confidence float64         `json:"confidence" yaml:"confidence"`
+	Models     []ModelForecast `json:"models" yaml:"models"`
+	Skipped    []SkippedModel  `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+}
+
+// NewForecastReport fits the requested models to the repository totals of
+// snapshots and projects them opts.Days past the latest snapshot. Models that
+// cannot be fitted are listed in Skipped.
+func NewForecastReport(owner, repo string, snapshots []ReleaseStats, opts ForecastOptions) *ForecastReport {
+	report := &ForecastReport{
+		Owner:      owner,
+		Repo:       repo,
+		Days:       opts.Days,
+		Confidence: opts.Confidence,
+		Models:     make([]ModelForecast, 0, len(opts.Models)),
+	}
+
+	var points []Point
+	if series := ExtractSeries(snapshots, SeriesRepo); len(series) > 0 {
+		points = series[0].Points
+	}
+	report.Snapshots = len(points)
+	if len(points) == 0 {
+		for _, m := range opts.Models {
+			report.Skipped = append(report.Skipped, SkippedModel{Model: m, Reason: "no snapshots"})
+		}
+		return report
+	}
+	last := points[len(points)-1]
+	for i := range snapshots {
+		if snapshots[i].FetchedAt.Equal(last.Time) {
+			report.Current = snapshotTotal(&snapshots[i])
+		}
+	}
+
+	z := math.Sqrt2 * math.Erfinv(opts.Confidence)
+	for _, m := range opts.Models {
+		fitted, err := fitForecastModel(m, points, z)
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedModel{Model: m, Reason: err.Error()})
+			continue
+		}
+		report.Models = append(report.Models, project(m, fitted, last, opts))
+	}
+
+	return report
+}
+
+// fittedModel projects a cumulative total h days past the latest snapshot.
+type fittedModel interface {
+	predict(h float64) (value, lower, upper float64)
+	rmse() float64
+}
+
+func fitForecastModel(m ForecastModel, points []Point, z float64) (fittedModel, error) {
+	switch m {
+	case ModelLinear:
+		return fitLinear(points, z)
+	case ModelExponential:
+		return fitExponential(points, z)
+	case ModelHolt:
+		return fitHolt(points, z)
+	}
+	return nil, fmt.Errorf("unknown model %q", m)
+}
+
+func project(m ForecastModel, fitted fittedModel, last Point, opts ForecastOptions) ModelForecast {
+	forecast := ModelForecast{
+		Model:  m,
+		RMSE:   fitted.rmse(),
+		Points: make([]ForecastPoint, 0, opts.Days),
+	}
+	next := projector(fitted, last)
+	for day := 1; day <= opts.Days; day++ {
+		forecast.Points = append(forecast.Points, next())
+	}
+	if opts.Days > 0 {
+		forecast.PerDay = (forecast.Final().Value - last.Value) / float64(opts.Days)
+	}
+
+	if opts.Target > 0 {
+		target := float64(opts.Target)
+		estimate := &TargetEstimate{Target: opts.Target, Reached: last.Value >= target}
+		if !estimate.Reached {
+			next := projector(fitted, last)
+			for day := 1; day <= maxTargetDays && estimate.Latest == nil; day++ {
+				p := next()
+				if estimate.Earliest == nil && p.Upper >= target {
+					estimate.Earliest = &p.Date
+				}
+				if estimate.Date == nil && p.Value >= target {
+					estimate.Date = &p.Date
+				}
+				if p.Lower >= target {
+					estimate.Latest = &p.Date
+				}
+			}
+		}
+		forecast.Target = estimate
+	}
+
+	return forecast
+}
+
+// projector returns a function yielding the projection one day further on
+// each call. Totals never decrease, so neither may the projection or its
+// band: each value is at least the one before it.
+func projector(fitted fittedModel, last Point) func() ForecastPoint {
+	prev := ForecastPoint{Value: last.Value, Lower: last.Value, Upper: last.Value}
+	day := 0
+	return func() ForecastPoint {
+		day++
+		value, lower, upper := fitted.predict(float64(day))
+		prev = ForecastPoint{
+			Date:  last.Time.AddDate(0, 0, day),
+			Value: math.Max(value, prev.Value),
+			Lower: math.Max(lower, prev.Lower),
+			Upper: math.Max(upper, prev.Upper),
+		}
+		return prev
+	}
+}
+
+// line is an ordinary least squares fit of y = a + b*x, with the quantities
+// needed for prediction intervals.
+type line struct {
+	a, b  float64
+	sigma float64 // residual standard error
+	meanX float64
+	sxx   float64
+	n     int
+	lastX float64
+	lastY float64
+}
+
+func fitLine(xs, ys []float64) (line, error) {
+	n := len(xs)
+	if n < 3 {
+		return line{}, fmt.Errorf("need at least 3 snapshots, have %d", n)
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return line{}, fmt.Errorf("snapshots span no time")
+	}
+
+	l := line{b: sxy / sxx, meanX: meanX, sxx: sxx, n: n, lastX: xs[n-1], lastY: ys[n-1]}
+	l.a = meanY - l.b*meanX
+
+	var sse float64
+	for i := range xs {
+		r := ys[i] - (l.a + l.b*xs[i])
+		sse += r * r
+	}
+	l.sigma = math.Sqrt(sse / float64(n-2))
+	return l, nil
+}
+
+// interval returns the value h days past the last observation and the
+// half-width of its prediction interval for z standard errors. The line is
+// anchored at the last observation rather than at its fitted value, so a
+// projection continues from the current total.
+func (l line) interval(h, z float64) (float64, float64) {
+	x := l.lastX + h
+	se := l.sigma * math.Sqrt(1+1/float64(l.n)+(x-l.meanX)*(x-l.meanX)/l.sxx)
+	return l.lastY + l.b*h, z * se
+}
+
+// daysSince converts point times to fractional days since the first point.
+func daysSince(points []Point) []float64 {
+	xs := make([]float64, len(points))
+	for i, p := range points {
+		xs[i] = p.Time.Sub(points[0].Time).Hours() / 24
+	}
+	return xs
+}
+
+type linearModel struct {
+	line
+	z    float64
+	rmsd float64
+}
+
+func fitLinear(points []Point, z float64) (fittedModel, error) {
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		ys[i] = p.Value
+	}
+	l, err := fitLine(daysSince(points), ys)
+	if err != nil {
+		return nil, err
+	}
+	rmsd := l.sigma * math.Sqrt(float64(l.n-2)/float64(l.n))
+	return &linearModel{line: l, z: z, rmsd: rmsd}, nil
+}
+
+func (m *linearModel) predict(h float64) (float64, float64, float64) {
+	v, hw := m.interval(h, m.z)
+	return v, v - hw, v + hw
+}
+
+func (m *linearModel) rmse() float64 { return m.rmsd }
+
+type exponentialModel struct {
+	line
+	z    float64
+	rmsd float64
+}
+
+func fitExponential(points []Point, z float64) (fittedModel, error) {
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		if p.Value <= 0 {
+			return nil, fmt.Errorf("needs positive download totals")
+		}
+		ys[i] = math.Log(p.Value)
+	}
+	xs := daysSince(points)
+	l, err := fitLine(xs, ys)
+	if err != nil {
+		return nil, err
+	}
+
+	var sse float64
+	for i, p := range points {
+		r := p.Value - math.Exp(l.a+l.b*xs[i])
+		sse += r * r
+	}
+	return &exponentialModel{line: l, z: z, rmsd: math.Sqrt(sse / float64(len(points)))}, nil
+}
+
+func (m *exponentialModel) predict(h float64) (float64, float64, float64) {
+	v, hw := m.interval(h, m.z)
+	return math.Exp(v), math.Exp(v - hw), math.Exp(v + hw)
+}
+
+func (m *exponentialModel) rmse() float64 { return m.rmsd }
+
+type holtModel struct {
+	level, trend float64
+	alpha, beta  float64
+	sigma        float64
+	z            float64
+	// offset is the time between the last daily step and the last snapshot
+	offset float64
+	rmsd   float64
+}
+
+// dailyTotals resamples points onto a one-day grid starting at the first
+// point, interpolating linearly between snapshots.
+func dailyTotals(points []Point) ([]float64, float64) {
+	xs := daysSince(points)
+	span := xs[len(xs)-1]
+	totals := make([]float64, 0, int(span)+1)
+	j := 0
+	for day := 0.0; day <= span; day++ {
+		for j < len(xs)-2 && xs[j+1] < day {
+			j++
+		}
+		v := points[j].Value
+		if dx := xs[j+1] - xs[j]; dx > 0 {
+			v += (points[j+1].Value - points[j].Value) * (day - xs[j]) / dx
+		}
+		totals = append(totals, v)
+	}
+	return totals, span - math.Floor(span)
+}
+
+func fitHolt(points []Point, z float64) (fittedModel, error) {
+	if len(points) < 2 {
+		return nil, fmt.Errorf("need at least 2 snapshots, have %d", len(points))
+	}
+	ys, offset := dailyTotals(points)
+	if len(ys) < 4 {
+		return nil, fmt.Errorf("need at least 3 days of snapshots")
+	}
+
+	// Pick the smoothing parameters that minimise one-step-ahead errors
+	best := holtModel{sigma: math.Inf(1)}
+	for a := 1; a <= 20; a++ {
+		for b := 1; b <= 20; b++ {
+			m := runHolt(ys, float64(a)/20, float64(b)/20)
+			if m.sigma < best.sigma {
+				best = m
+			}
+		}
+	}
+	best.z = z
+	best.offset = offset
+	return &best, nil
+}
+
+func runHolt(ys []float64, alpha, beta float64) holtModel {
+	level, trend := ys[0], ys[1]-ys[0]
+	var sse float64
+	for _, y := range ys[1:] {
+		forecast := level + trend
+		sse += (y - forecast) * (y - forecast)
+		prev := level
+		level = alpha*y + (1-alpha)*(level+trend)
+		trend = beta*(level-prev) + (1-beta)*trend
+	}
+	steps := float64(len(ys) - 1)
+	return holtModel{
+		level: level,
+		trend: trend,
+		alpha: alpha,
+		beta:  beta,
+		sigma: math.Sqrt(sse / (steps - 1)),
+		rmsd:  math.Sqrt(sse / steps),
+	}
+}
+
+func (m *holtModel) predict(h float64) (float64, float64, float64) {
+	steps := h + m.offset
+	v := m.level + steps*m.trend
+
+	// Variance of the h-step forecast error for Holt's method
+	variance := 1.0
+	for j := 1; float64(j) < steps; j++ {
+		k := m.alpha * (1 + float64(j)*m.beta)
+		variance += k * k
+	}
+	hw := m.z * m.sigma * math.Sqrt(variance)
+	return v, v - hw, v + hw
+}
+
+func (m *holtModel) rmse() float64 { return m.rmsd }
+
+// ParseCount parses a download count such as "10000000", "2.5k" or "10M".
+func ParseCount(count string) (int, error) {
+	s := strings.TrimSpace(count)
+	multiplier := 1.0
+	if s != "" {
+		switch strings.ToUpper(s[len(s)-1:]) {
+		case "K":
+			multiplier = 1e3
+		case "M":
+			multiplier = 1e6
+		case "B":
+			multiplier = 1e9
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(s, "_", ""), 64)
+	if err != nil || !(v >= 0) {
+		return 0, fmt.Errorf("invalid count %q", count)
+	}
+	n := math.Round(v * multiplier)
+	if n >= math.MaxInt {
+		return 0, fmt.Errorf("count %q is too large", count)
+	}
+	return int(n), nil
+}
+
+// WriteText writes a summary per model followed by a sampled projection.
+func (r *ForecastReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nDownload Forecast for %s/%s\n", r.Owner, r.Repo)
+	fmt.Fprintf(out, "Current: %d downloads (%s, %d snapshots)\n", r.Current.TotalDownloads, r.Current.FetchedAt.Format("2006-01-02"), r.Snapshots)
+	fmt.Fprintf(out, "Horizon: %d days, %.0f%% prediction bands\n", r.Days, r.Confidence*100)
+
+	for _, m := range r.Models {
+		final := m.Final()
+		fmt.Fprintf(out, "\n%s (RMSE %s)\n", m.Model, humanizeFloat(roundTo(m.RMSE, 1)))
+		fmt.Fprintf(out, "  In %d days: %s [%s - %s], %s/day\n",
+			r.Days, humanizeFloat(math.Round(final.Value)), humanizeFloat(math.Round(final.Lower)), humanizeFloat(math.Round(final.Upper)), humanizeFloat(roundTo(m.PerDay, 1)))
+		if m.Target != nil {
+			fmt.Fprintf(out, "  %s downloads: %s\n", humanizeFloat(float64(m.Target.Target)), describeTarget(m.Target))
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "  DATE\tFORECAST\tLOWER\tUPPER\t")
+		step := max(1, len(m.Points)/10)
+		for i, p := range m.Points {
+			if (i+1)%step != 0 && i != len(m.Points)-1 {
+				continue
+			}
+			fmt.Fprintf(w, "  %s\t%.0f\t%.0f\t%.0f\t\n", p.Date.Format("2006-01-02"), p.Value, p.Lower, p.Upper)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range r.Skipped {
+		fmt.Fprintf(out, "\n%s: skipped, %s\n", s.Model, s.Reason)
+	}
+
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+func describeTarget(t *TargetEstimate) string {
+	date := func(d *time.Time) string {
+		if d == nil {
+			return "beyond 10 years"
+		}
+		return d.Format("2006-01-02")
+	}
+	switch {
+	case t.Reached:
+		return "already reached"
+	case t.Earliest == nil:
+		return "not reached within 10 years"
+	}
+	return fmt.Sprintf("expected %s (earliest %s, latest %s)", date(t.Date), date(t.Earliest), date(t.Latest))
+}
+
+// Table returns one row per model and projected day.
+func (r *ForecastReport) Table() ([]string, [][]string) {
+	header := []string{"model", "date", "forecast", "lower", "upper"}
+	rows := make([][]string, 0)
+	for _, m := range r.Models {
+		for _, p := range m.Points {
+			rows = append(rows, []string{
+				string(m.Model),
+				p.Date.Format("2006-01-02"),
+				strconv.FormatFloat(p.Value, 'f', 0, 64),
+				strconv.FormatFloat(p.Lower, 'f', 0, 64),
+				strconv.FormatFloat(p.Upper, 'f', 0, 64),
+			})
+		}
+	}
+	return header, rows
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func linearSnapshots(days, start, perDay int) []ReleaseStats {
+	first := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := make([]ReleaseStats, 0, days)
+	for day := 0; day < days; day++ {
+		snapshots = append(snapshots, ReleaseStats{
+			Owner:          "owner",
+			Repo:           "repo",
+			TotalDownloads: start + day*perDay,
+			FetchedAt:      first.AddDate(0, 0, day),
+		})
+	}
+	return snapshots
+}
+
+func TestForecastLinearGrowth(t *testing.T) {
+	snapshots := linearSnapshots(10, 1000, 100)
+
+	report := NewForecastReport("owner", "repo", snapshots, ForecastOptions{
+		Models:     ForecastModels,
+		Days:       30,
+		Confidence: 0.95,
+		Target:     5000,
+	})
+
+	if len(report.Models) != len(ForecastModels) {
+		t.Fatalf("expected every model to fit, skipped %+v", report.Skipped)
+	}
+	if report.Current.TotalDownloads != 1900 {
+		t.Fatalf("expected current total 1900, got %d", report.Current.TotalDownloads)
+	}
+
+	for _, m := range report.Models {
+		if len(m.Points) != 30 {
+			t.Fatalf("%s: expected 30 points, got %d", m.Model, len(m.Points))
+		}
+		for i, p := range m.Points {
+			if p.Lower > p.Value || p.Value > p.Upper {
+				t.Fatalf("%s: point %d outside its band: %+v", m.Model, i, p)
+			}
+			if i > 0 && p.Value < m.Points[i-1].Value {
+				t.Fatalf("%s: projection decreases at point %d", m.Model, i)
+			}
+		}
+	}
+
+	for _, model := range []ForecastModel{ModelLinear, ModelHolt} {
+		m := findModel(t, report, model)
+		if math.Abs(m.PerDay-100) > 1e-6 {
+			t.Fatalf("%s: expected 100/day, got %v", model, m.PerDay)
+		}
+		// 1900 + 31*100 crosses 5000 on day 31 after the last snapshot
+		want := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 31)
+		if m.Target == nil || m.Target.Date == nil || !m.Target.Date.Equal(want) {
+			t.Fatalf("%s: expected target date %v, got %+v", model, want, m.Target)
+		}
+	}
+}
+
+func TestForecastSkipsModelsWithoutEnoughData(t *testing.T) {
+	report := NewForecastReport("owner", "repo", linearSnapshots(2, 0, 10), ForecastOptions{
+		Models:     ForecastModels,
+		Days:       7,
+		Confidence: 0.9,
+	})
+
+	if len(report.Models) != 0 {
+		t.Fatalf("expected no model to fit two snapshots, got %d", len(report.Models))
+	}
+	if len(report.Skipped) != len(ForecastModels) {
+		t.Fatalf("expected every model to be skipped, got %+v", report.Skipped)
+	}
+}
+
+func TestForecastTargetAlreadyReached(t *testing.T) {
+	report := NewForecastReport("owner", "repo", linearSnapshots(5, 1000, 10), ForecastOptions{
+		Models:     []ForecastModel{ModelLinear},
+		Days:       7,
+		Confidence: 0.95,
+		Target:     500,
+	})
+
+	m := findModel(t, report, ModelLinear)
+	if m.Target == nil || !m.Target.Reached || m.Target.Date != nil {
+		t.Fatalf("expected target to be reached already, got %+v", m.Target)
+	}
+}
+
+func TestParseCount(t *testing.T) {
+	tests := map[string]int{
+		"10000000": 10_000_000,
+		"10M":      10_000_000,
+		"2.5k":     2500,
+		"1B":       1_000_000_000,
+		"1_000":    1000,
+	}
+	for in, want := range tests {
+		got, err := ParseCount(in)
+		if err != nil || got != want {
+			t.Errorf("ParseCount(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"lots", "-5", "NaN", "Inf", "1e30", "99999999999B"} {
+		if _, err := ParseCount(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func findModel(t *testing.T, r *ForecastReport, model ForecastModel) ModelForecast {
+	t.Helper()
+	for _, m := range r.Models {
+		if m.Model == model {
+			return m
+		}
+	}
+	t.Fatalf("model %s missing from report", model)
+	return ModelForecast{}
+}
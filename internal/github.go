@@ -3,46 +3,113 @@ package internal
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v56/github"
 )
 
 type Asset struct {
-	Name          string
-	DownloadCount int
-	Size          int64
-	ContentType   string
+	Name          string `json:"name" yaml:"name"`
+	DownloadCount int    `json:"download_count" yaml:"download_count"`
+	Size          int64  `json:"size" yaml:"size"`
+	ContentType   string `json:"content_type" yaml:"content_type"`
+	// Kind is set by an AssetClassifier; auxiliary assets are not counted
+	// in TotalDownloads.
+	Kind AssetKind `json:"kind" yaml:"kind"`
 }
 
 type Release struct {
-	Name           string
-	Tag            string
-	Assets         []Asset
-	TotalDownloads int
-	CreatedAt      time.Time
-	PublishedAt    time.Time
-	IsPrerelease   bool
-	IsDraft        bool
+	Name           string  `json:"name" yaml:"name"`
+	Tag            string  `json:"tag" yaml:"tag"`
+	Assets         []Asset `json:"assets" yaml:"assets"`
+	TotalDownloads int     `json:"total_downloads" yaml:"total_downloads"`
+	// AuxiliaryDownloads counts checksum, signature, SBOM and other
+	// auxiliary assets, which TotalDownloads leaves out.
+	AuxiliaryDownloads int       `json:"auxiliary_downloads" yaml:"auxiliary_downloads"`
+	CreatedAt          time.Time `json:"created_at" yaml:"created_at"`
+	PublishedAt        time.Time `json:"published_at" yaml:"published_at"`
+	IsPrerelease       bool      `json:"prerelease" yaml:"prerelease"`
+	IsDraft            bool      `json:"draft" yaml:"draft"`
+}
+
+// ReleaseDate returns when the release was published, or when it was
+// created for releases without a publish date, such as drafts.
+func (r Release) ReleaseDate() time.Time {
+	if r.PublishedAt.IsZero() {
+		return r.CreatedAt
+	}
+	return r.PublishedAt
 }
 
 type ReleaseStats struct {
-	Owner          string
-	Repo           string
-	TotalDownloads int
-	Releases       []Release
-	FetchedAt      time.Time
+	Owner          string `json:"owner" yaml:"owner"`
+	Repo           string `json:"repo" yaml:"repo"`
+	TotalDownloads int    `json:"total_downloads" yaml:"total_downloads"`
+	// AuxiliaryDownloads is the sum of Release.AuxiliaryDownloads.
+	AuxiliaryDownloads int       `json:"auxiliary_downloads" yaml:"auxiliary_downloads"`
+	Releases           []Release `json:"releases" yaml:"releases"`
+	FetchedAt          time.Time `json:"fetched_at" yaml:"fetched_at"`
+	// SnapshotID identifies a stored snapshot. It is zero for snapshots that
+	// were not loaded from the database.
+	SnapshotID int64 `json:"snapshot_id,omitempty" yaml:"snapshot_id,omitempty"`
 }
 
-// FetchReleaseStats fetches all releases and their asset download statistics from GitHub
-func FetchReleaseStats(ctx context.Context, owner, repo, token string) (*ReleaseStats, error) {
-	client := github.NewClient(nil)
+// RateLimit is the GitHub API rate limit reported with a response.
+type RateLimit struct {
+	Limit     int       `json:"limit" yaml:"limit"`
+	Remaining int       `json:"remaining" yaml:"remaining"`
+	Reset     time.Time `json:"reset" yaml:"reset"`
+}
+
+// Fetcher fetches release statistics through a single GitHub client, so
+// long-running callers reuse one HTTP connection pool.
+type Fetcher struct {
+	client *github.Client
+	assets *AssetClassifier
+
+	mu   sync.Mutex
+	rate RateLimit
+}
+
+// NewFetcher creates a Fetcher. A nil httpClient uses http.DefaultClient.
+func NewFetcher(httpClient *http.Client, token string) *Fetcher {
+	client := github.NewClient(httpClient)
 
 	// If token is provided, create an authenticated client for higher rate limits
 	if token != "" {
-		client = github.NewClient(nil).WithAuthToken(token)
+		client = client.WithAuthToken(token)
 	}
 
+	return &Fetcher{client: client}
+}
+
+// WithBaseURL returns a copy of f that talks to a GitHub Enterprise API at
+// baseURL, e.g. https://ghe.example.com/api/v3/.
+func (f *Fetcher) WithBaseURL(baseURL string) (*Fetcher, error) {
+	client, err := f.client.WithEnterpriseURLs(baseURL, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API URL %q: %w", baseURL, err)
+	}
+	return &Fetcher{client: client, assets: f.assets}, nil
+}
+
+// WithAssetClassifier returns a copy of f that computes totals with c
+// instead of the built-in asset patterns.
+func (f *Fetcher) WithAssetClassifier(c *AssetClassifier) *Fetcher {
+	return &Fetcher{client: f.client, assets: c}
+}
+
+// FetchReleaseStats fetches all releases and their asset download statistics from GitHub
+func FetchReleaseStats(ctx context.Context, owner, repo, token string) (*ReleaseStats, error) {
+	return NewFetcher(nil, token).FetchReleaseStats(ctx, owner, repo)
+}
+
+// FetchReleaseStats fetches all releases and their asset download statistics from GitHub
+func (f *Fetcher) FetchReleaseStats(ctx context.Context, owner, repo string) (*ReleaseStats, error) {
+	client := f.client
+
 	stats := &ReleaseStats{
 		Owner:     owner,
 		Repo:      repo,
@@ -54,6 +121,7 @@ func FetchReleaseStats(ctx context.Context, owner, repo, token string) (*Release
 	opt := &github.ListOptions{PerPage: 100}
 	for {
 		releases, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opt)
+		f.recordRate(resp)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list releases: %w", err)
 		}
@@ -84,11 +152,9 @@ func FetchReleaseStats(ctx context.Context, owner, repo, token string) (*Release
 					ContentType:   ghAsset.GetContentType(),
 				}
 				rel.Assets = append(rel.Assets, asset)
-				rel.TotalDownloads += asset.DownloadCount
 			}
 
 			stats.Releases = append(stats.Releases, rel)
-			stats.TotalDownloads += rel.TotalDownloads
 		}
 
 		// Check if there are more pages
@@ -98,5 +164,24 @@ func FetchReleaseStats(ctx context.Context, owner, repo, token string) (*Release
 		opt.Page = resp.NextPage
 	}
 
+	f.assets.Apply(stats)
+
 	return stats, nil
 }
+
+// RateLimit returns the rate limit reported with the last response f
+// received, or a zero RateLimit before the first response.
+func (f *Fetcher) RateLimit() RateLimit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rate
+}
+
+func (f *Fetcher) recordRate(resp *github.Response) {
+	if resp == nil || resp.Rate.Limit == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rate = RateLimit{Limit: resp.Rate.Limit, Remaining: resp.Rate.Remaining, Reset: resp.Rate.Reset.Time}
+}
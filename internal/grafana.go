@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GrafanaPrefix is the path under which GrafanaDatasource serves its routes.
+const GrafanaPrefix = "/grafana"
+
+// maxGrafanaRequest bounds the size of a Grafana request body.
+const maxGrafanaRequest = 1 << 20
+
+// GrafanaDatasource answers the JSON datasource protocol spoken by the
+// Grafana SimpleJSON, JSON and Infinity plugins, so dashboards can chart the
+// database without Prometheus.
+//
+// A query target names a repository, release or asset:
+//
+//	owner/repo                 repository total
+//	owner/repo:v1.*            every release whose tag matches the pattern
+//	owner/repo:v1.2.0:*linux*  every matching asset of matching releases
+//
+// Git forbids ":" in tags, so the first two colons always separate the parts.
+type GrafanaDatasource struct {
+	db *Database
+
+	// Projects lists the repositories /search offers. It defaults to the
+	// watchlist stored in the database.
+	Projects func(group string) ([]Project, error)
+}
+
+// NewGrafanaDatasource returns a datasource over db.
+func NewGrafanaDatasource(db *Database) *GrafanaDatasource {
+	return &GrafanaDatasource{db: db, Projects: db.ListProjects}
+}
+
+// Register adds the datasource routes to mux.
+func (g *GrafanaDatasource) Register(mux *http.ServeMux) {
+	// Grafana tests the connection with a GET of the datasource URL
+	mux.HandleFunc("GET "+GrafanaPrefix+"/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("POST "+GrafanaPrefix+"/search", jsonHandler(g.search))
+	mux.Handle("POST "+GrafanaPrefix+"/query", jsonHandler(g.query))
+	mux.Handle("POST "+GrafanaPrefix+"/annotations", jsonHandler(g.annotations))
+}
+
+// decodeGrafanaRequest decodes the JSON body of a request into v.
+func decodeGrafanaRequest(r *http.Request, v any) error {
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxGrafanaRequest)).Decode(v); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// GrafanaTarget is a parsed query target.
+type GrafanaTarget struct {
+	Owner string
+	Repo  string
+	// Tag and Asset are glob patterns; an empty Tag selects the repository
+	// total and an empty Asset the release totals.
+	Tag   string
+	Asset string
+}
+
+// ParseGrafanaTarget parses owner/repo[:tag[:asset]].
+func ParseGrafanaTarget(s string) (GrafanaTarget, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 3)
+	owner, repo, ok := strings.Cut(parts[0], "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return GrafanaTarget{}, fmt.Errorf("invalid target %q (want owner/repo[:tag[:asset]])", s)
+	}
+	t := GrafanaTarget{Owner: owner, Repo: repo}
+	if len(parts) > 1 {
+		t.Tag = parts[1]
+	}
+	if len(parts) > 2 {
+		t.Asset = parts[2]
+	}
+	for _, pattern := range []string{t.Tag, t.Asset} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return GrafanaTarget{}, fmt.Errorf("invalid pattern %q in target %q: %w", pattern, s, err)
+		}
+	}
+	if len(parts) > 1 && t.Tag == "" {
+		return GrafanaTarget{}, fmt.Errorf("invalid target %q: empty tag", s)
+	}
+	return t, nil
+}
+
+// level returns the series level the target selects.
+func (t GrafanaTarget) level() SeriesLevel {
+	switch {
+	case t.Tag == "":
+		return SeriesRepo
+	case t.Asset == "":
+		return SeriesRelease
+	}
+	return SeriesAsset
+}
+
+// name returns the target naming a single series of t.
+func (t GrafanaTarget) name(s Series) string {
+	name := t.Owner + "/" + t.Repo
+	if s.Tag != "" {
+		name += ":" + s.Tag
+	}
+	if s.Asset != "" {
+		name += ":" + s.Asset
+	}
+	return name
+}
+
+// series returns the series the target selects from snapshots.
+func (t GrafanaTarget) series(snapshots []ReleaseStats) []Series {
+	var out []Series
+	for _, s := range ExtractSeries(snapshots, t.level()) {
+		if t.Tag != "" {
+			if ok, _ := path.Match(t.Tag, s.Tag); !ok {
+				continue
+			}
+		}
+		if t.Asset != "" {
+			if ok, _ := path.Match(t.Asset, s.Asset); !ok {
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// grafanaRange is the time range of a query or annotation request.
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// bounds returns the range, defaulting an open end to now.
+func (r grafanaRange) bounds() (time.Time, time.Time, error) {
+	to := r.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if r.From.After(to) {
+		return time.Time{}, time.Time{}, badRequest("range from is after to")
+	}
+	return r.From, to, nil
+}
+
+type grafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+// search completes targets level by level: repositories first, then the
+// releases of the repository typed so far, then the assets of a release,
+// each taken from the newest snapshot.
+func (g *GrafanaDatasource) search(r *http.Request) (any, error) {
+	var req grafanaSearchRequest
+	if err := decodeGrafanaRequest(r, &req); err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSpace(req.Target)
+
+	out := []string{}
+	repo, rest, hasTag := strings.Cut(prefix, ":")
+	if !hasTag {
+		projects, err := g.Projects("")
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range projects {
+			if name := p.Owner + "/" + p.Repo; strings.HasPrefix(name, prefix) {
+				out = append(out, name)
+			}
+		}
+		return out, nil
+	}
+
+	target, err := ParseGrafanaTarget(repo)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	stats, err := g.db.GetLatestStats(target.Owner, target.Repo)
+	if err != nil {
+		return nil, err
+	}
+	tag, _, hasAsset := strings.Cut(rest, ":")
+	for _, rel := range stats.Releases {
+		if !hasAsset {
+			if name := repo + ":" + rel.Tag; strings.HasPrefix(name, prefix) {
+				out = append(out, name)
+			}
+			continue
+		}
+		if rel.Tag != tag {
+			continue
+		}
+		for _, a := range rel.Assets {
+			if name := repo + ":" + rel.Tag + ":" + a.Name; strings.HasPrefix(name, prefix) {
+				out = append(out, name)
+			}
+		}
+	}
+	return out, nil
+}
+
+type grafanaQueryRequest struct {
+	Range   grafanaRange `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"`
+		Hide   bool   `json:"hide"`
+		// Data carries per-target options; per_day charts downloads per day
+		// between snapshots instead of the cumulative count.
+		Data struct {
+			PerDay bool `json:"per_day"`
+		} `json:"data"`
+	} `json:"targets"`
+}
+
+// grafanaTimeSeries is a time series response: [value, unix ms] pairs,
+// oldest first.
+type grafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// grafanaTable is a table response with one row per observation.
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	RefID   string          `json:"refId,omitempty"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+// query answers each target with one time series per matching repository,
+// release or asset, or with a single table when the target type is table.
+func (g *GrafanaDatasource) query(r *http.Request) (any, error) {
+	var req grafanaQueryRequest
+	if err := decodeGrafanaRequest(r, &req); err != nil {
+		return nil, err
+	}
+	from, to, err := req.Range.bounds()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []any{}
+	for _, qt := range req.Targets {
+		if qt.Hide || strings.TrimSpace(qt.Target) == "" {
+			continue
+		}
+		target, err := ParseGrafanaTarget(qt.Target)
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		snapshots, err := g.db.GetStatsBetween(target.Owner, target.Repo, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		var table *grafanaTable
+		switch qt.Type {
+		case "", "timeserie", "timeseries":
+		case "table":
+			value := "Downloads"
+			if qt.Data.PerDay {
+				value = "Downloads per day"
+			}
+			table = &grafanaTable{
+				Type:    "table",
+				RefID:   qt.RefID,
+				Columns: []grafanaColumn{{"Time", "time"}, {"Target", "string"}, {value, "number"}},
+				Rows:    [][]any{},
+			}
+			out = append(out, table)
+		default:
+			return nil, badRequest("unknown target type %q (want timeserie or table)", qt.Type)
+		}
+
+		for _, s := range target.series(snapshots) {
+			points := s.Points
+			if qt.Data.PerDay {
+				points = perDayPoints(points)
+			}
+			name := target.name(s)
+			if table != nil {
+				for _, p := range points {
+					table.Rows = append(table.Rows, []any{p.Time.UnixMilli(), name, p.Value})
+				}
+				continue
+			}
+			ts := grafanaTimeSeries{Target: name, RefID: qt.RefID, Datapoints: make([][2]float64, 0, len(points))}
+			for _, p := range points {
+				ts.Datapoints = append(ts.Datapoints, [2]float64{p.Value, float64(p.Time.UnixMilli())})
+			}
+			out = append(out, ts)
+		}
+	}
+	return out, nil
+}
+
+// perDayPoints converts cumulative points into downloads per day, each
+// placed at the end of its interval.
+func perDayPoints(points []Point) []Point {
+	intervals := Intervals(points)
+	out := make([]Point, 0, len(intervals))
+	for _, iv := range intervals {
+		out = append(out, Point{Time: iv.End, Value: iv.PerDay})
+	}
+	return out
+}
+
+// grafanaAnnotation describes the annotation a request is for. Its query
+// holds a target, optionally followed by "snapshots" or "releases" to show
+// only one kind of event.
+type grafanaAnnotation struct {
+	Name       string `json:"name"`
+	Datasource string `json:"datasource,omitempty"`
+	Enable     bool   `json:"enable"`
+	IconColor  string `json:"iconColor,omitempty"`
+	Query      string `json:"query"`
+}
+
+type grafanaAnnotationsRequest struct {
+	Range      grafanaRange      `json:"range"`
+	Annotation grafanaAnnotation `json:"annotation"`
+}
+
+// grafanaEvent is one annotation in a response.
+type grafanaEvent struct {
+	Annotation grafanaAnnotation `json:"annotation"`
+	Time       int64             `json:"time"`
+	Title      string            `json:"title"`
+	Text       string            `json:"text"`
+	Tags       []string          `json:"tags"`
+}
+
+// annotations marks the snapshots stored in the range and the releases
+// created in it. A tag pattern in the target limits the releases; asset
+// patterns are ignored.
+func (g *GrafanaDatasource) annotations(r *http.Request) (any, error) {
+	var req grafanaAnnotationsRequest
+	if err := decodeGrafanaRequest(r, &req); err != nil {
+		return nil, err
+	}
+	from, to, err := req.Range.bounds()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(req.Annotation.Query)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, badRequest("invalid annotation query %q (want owner/repo[:tag] [snapshots|releases])", req.Annotation.Query)
+	}
+	target, err := ParseGrafanaTarget(fields[0])
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	snapshots, releases := true, true
+	if len(fields) == 2 {
+		switch fields[1] {
+		case "snapshots":
+			releases = false
+		case "releases":
+			snapshots = false
+		default:
+			return nil, badRequest("unknown annotation kind %q (want snapshots or releases)", fields[1])
+		}
+	}
+
+	repo := target.Owner + "/" + target.Repo
+	out := []grafanaEvent{}
+	if snapshots {
+		stored, err := g.db.GetStatsBetween(target.Owner, target.Repo, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stored {
+			out = append(out, grafanaEvent{
+				Annotation: req.Annotation,
+				Time:       s.FetchedAt.UnixMilli(),
+				Title:      "Snapshot of " + repo,
+				Text:       fmt.Sprintf("%d downloads across %d releases", s.TotalDownloads, len(s.Releases)),
+				Tags:       []string{"snapshot", repo},
+			})
+		}
+	}
+	if releases {
+		// Releases deleted since are missing from the newest snapshot
+		latest, err := g.db.GetLatestStats(target.Owner, target.Repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range latest.Releases {
+			published := rel.ReleaseDate()
+			if published.Before(from) || published.After(to) {
+				continue
+			}
+			if target.Tag != "" {
+				if ok, _ := path.Match(target.Tag, rel.Tag); !ok {
+					continue
+				}
+			}
+			title := rel.Tag
+			if rel.Name != "" && rel.Name != rel.Tag {
+				title += " (" + rel.Name + ")"
+			}
+			tags := []string{"release", repo}
+			if rel.IsPrerelease {
+				tags = append(tags, "prerelease")
+			}
+			out = append(out, grafanaEvent{
+				Annotation: req.Annotation,
+				Time:       published.UnixMilli(),
+				Title:      "Released " + title,
+				Text:       fmt.Sprintf("%d downloads as of the newest snapshot", rel.TotalDownloads),
+				Tags:       tags,
+			})
+		}
+	}
+	slices.SortStableFunc(out, func(a, b grafanaEvent) int { return cmp.Compare(a.Time, b.Time) })
+	return out, nil
+}
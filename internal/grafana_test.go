@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestGrafana(t *testing.T) *httptest.Server {
+	t.Helper()
+	db := newTestDatabase(t)
+	if err := db.TrackProject("owner", "repo", "", ""); err != nil {
+		t.Fatalf("TrackProject failed: %v", err)
+	}
+
+	// v1.1.0 was drafted before the range and published as a pre-release
+	// within it
+	storeDailySnapshots(t, db, 5, func(s *ReleaseStats) {
+		s.Releases[1].CreatedAt = time.Date(2024, 6, 28, 9, 0, 0, 0, time.UTC)
+		s.Releases[1].PublishedAt = time.Date(2024, 7, 2, 9, 0, 0, 0, time.UTC)
+		s.Releases[1].IsPrerelease = true
+	})
+
+	mux := http.NewServeMux()
+	NewGrafanaDatasource(db).Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func grafanaPost(t *testing.T, srv *httptest.Server, route, body string, v any) int {
+	t.Helper()
+	resp, err := http.Post(srv.URL+GrafanaPrefix+route, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", route, err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("POST %s: invalid JSON: %v", route, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestParseGrafanaTarget(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  GrafanaTarget
+		level SeriesLevel
+	}{
+		{"cli/cli", GrafanaTarget{Owner: "cli", Repo: "cli"}, SeriesRepo},
+		{"cli/cli:v2.*", GrafanaTarget{Owner: "cli", Repo: "cli", Tag: "v2.*"}, SeriesRelease},
+		{"cli/cli:v2.0.0:gh_*:x.zip", GrafanaTarget{Owner: "cli", Repo: "cli", Tag: "v2.0.0", Asset: "gh_*:x.zip"}, SeriesAsset},
+	}
+	for _, tt := range tests {
+		got, err := ParseGrafanaTarget(tt.in)
+		if err != nil || got != tt.want || got.level() != tt.level {
+			t.Errorf("ParseGrafanaTarget(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+	for _, in := range []string{"", "cli", "cli/cli/x", "cli/cli:", "cli/cli:["} {
+		if _, err := ParseGrafanaTarget(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestGrafanaSearch(t *testing.T) {
+	srv := newTestGrafana(t)
+
+	resp, err := http.Get(srv.URL + GrafanaPrefix + "/")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("connection test failed: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	for _, tt := range []struct{ target, want string }{
+		{"", `["owner/repo"]`},
+		{"owner/repo:", `["owner/repo:v1.1.0","owner/repo:v1.0.0"]`},
+		{"owner/repo:v1.1", `["owner/repo:v1.1.0"]`},
+		{"owner/repo:v1.1.0:", `["owner/repo:v1.1.0:asset2.tar.gz"]`},
+		{"other/", `[]`},
+	} {
+		var got []string
+		grafanaPost(t, srv, "/search", `{"target":"`+tt.target+`"}`, &got)
+		if b, _ := json.Marshal(got); string(b) != tt.want {
+			t.Errorf("search %q = %s, want %s", tt.target, b, tt.want)
+		}
+	}
+}
+
+func TestGrafanaQuery(t *testing.T) {
+	srv := newTestGrafana(t)
+	rng := `"range":{"from":"2024-07-02T00:00:00.000Z","to":"2024-07-04T23:59:59.000Z"}`
+
+	var series []grafanaTimeSeries
+	grafanaPost(t, srv, "/query", `{`+rng+`,"targets":[{"target":"owner/repo","refId":"A"},{"target":"owner/repo:v1.*:asset2*","refId":"B"}]}`, &series)
+	if len(series) != 2 {
+		t.Fatalf("expected 2 series, got %+v", series)
+	}
+	if s := series[0]; s.Target != "owner/repo" || s.RefID != "A" || len(s.Datapoints) != 3 || s.Datapoints[0] != [2]float64{20, 1719921600000} {
+		t.Errorf("unexpected repo series %+v", s)
+	}
+	if s := series[1]; s.Target != "owner/repo:v1.1.0:asset2.tar.gz" || s.Datapoints[2][0] != 25 {
+		t.Errorf("unexpected asset series %+v", s)
+	}
+
+	series = nil
+	grafanaPost(t, srv, "/query", `{`+rng+`,"targets":[{"target":"owner/repo:v1.1.0","data":{"per_day":true}}]}`, &series)
+	if len(series) != 1 || len(series[0].Datapoints) != 2 || series[0].Datapoints[0][0] != 5 {
+		t.Errorf("unexpected per-day series %+v", series)
+	}
+
+	var tables []grafanaTable
+	grafanaPost(t, srv, "/query", `{`+rng+`,"targets":[{"target":"owner/repo:*","type":"table"}]}`, &tables)
+	if len(tables) != 1 || tables[0].Type != "table" || len(tables[0].Columns) != 3 || len(tables[0].Rows) != 6 {
+		t.Errorf("unexpected table %+v", tables)
+	}
+
+	for _, body := range []string{
+		`{"targets":[{"target":"owner"}]}`,
+		`{"targets":[{"target":"owner/repo","type":"heatmap"}]}`,
+		`{"range":{"from":"2024-07-05T00:00:00Z","to":"2024-07-01T00:00:00Z"},"targets":[]}`,
+		`not json`,
+	} {
+		if code := grafanaPost(t, srv, "/query", body, nil); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, code)
+		}
+	}
+}
+
+func TestGrafanaAnnotations(t *testing.T) {
+	srv := newTestGrafana(t)
+	rng := `"range":{"from":"2024-07-02T00:00:00Z","to":"2024-07-03T23:59:59Z"}`
+
+	var events []grafanaEvent
+	grafanaPost(t, srv, "/annotations", `{`+rng+`,"annotation":{"name":"Releases","enable":true,"query":"owner/repo"}}`, &events)
+	if len(events) != 3 {
+		t.Fatalf("expected 2 snapshots and 1 release, got %+v", events)
+	}
+	release := events[0]
+	if release.Title != "Released v1.1.0 (Release Two)" || !slices.Equal(release.Tags, []string{"release", "owner/repo", "prerelease"}) || release.Annotation.Name != "Releases" ||
+		release.Time != time.Date(2024, 7, 2, 9, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Errorf("unexpected release annotation %+v", release)
+	}
+	if events[1].Tags[0] != "snapshot" || events[1].Time > events[2].Time {
+		t.Errorf("unexpected snapshot annotations %+v", events[1:])
+	}
+
+	events = nil
+	grafanaPost(t, srv, "/annotations", `{`+rng+`,"annotation":{"query":"owner/repo:v1.0.* releases"}}`, &events)
+	if len(events) != 0 {
+		t.Errorf("expected no annotations, got %+v", events)
+	}
+	if code := grafanaPost(t, srv, "/annotations", `{`+rng+`,"annotation":{"query":"owner/repo deploys"}}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown annotation kind, got %d", code)
+	}
+}
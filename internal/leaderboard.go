@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// LeaderboardMetric is what repositories are ranked by.
+type LeaderboardMetric string
+
+const (
+	RankByDownloads  LeaderboardMetric = "downloads"
+	RankByGrowth     LeaderboardMetric = "growth"
+	RankByPerRelease LeaderboardMetric = "per-release"
+	RankByAdoption   LeaderboardMetric = "adoption"
+)
+
+// ParseLeaderboardMetric validates a ranking metric name.
+func ParseLeaderboardMetric(s string) (LeaderboardMetric, error) {
+	switch m := LeaderboardMetric(s); m {
+	case RankByDownloads, RankByGrowth, RankByPerRelease, RankByAdoption:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown metric %q (want downloads, growth, per-release or adoption)", s)
+}
+
+// RepoPeriod is a repository with the snapshots bounding a period, as
+// returned by Database.GetPeriodSnapshots.
+type RepoPeriod struct {
+	Owner  string
+	Repo   string
+	Oldest *ReleaseStats
+	Newest *ReleaseStats
+}
+
+// RepoStanding is one repository's figures for a period and its rank.
+type RepoStanding struct {
+	Rank int `json:"rank" yaml:"rank"`
+	// PreviousRank is the rank in the previous period of the same length,
+	// or zero when the repository had no snapshots then.
+	PreviousRank   int     `json:"previous_rank,omitempty" yaml:"previous_rank,omitempty"`
+	RankChange     int     `json:"rank_change" yaml:"rank_change"`
+	Owner          string  `json:"owner" yaml:"owner"`
+	Repo           string  `json:"repo" yaml:"repo"`
+	TotalDownloads int     `json:"total_downloads" yaml:"total_downloads"`
+	Growth         int     `json:"growth" yaml:"growth"`
+	GrowthPercent  float64 `json:"growth_percent" yaml:"growth_percent"`
+	Releases       int     `json:"releases" yaml:"releases"`
+	PerRelease     float64 `json:"downloads_per_release" yaml:"downloads_per_release"`
+	// LatestRelease is the most recently created release, and Adoption the
+	// share of the period's growth that went to it.
+	LatestRelease string    `json:"latest_release" yaml:"latest_release"`
+	LatestGrowth  int       `json:"latest_release_growth" yaml:"latest_release_growth"`
+	Adoption      float64   `json:"latest_release_adoption_percent" yaml:"latest_release_adoption_percent"`
+	FetchedAt     time.Time `json:"fetched_at" yaml:"fetched_at"`
+}
+
+// NewRepoStanding computes the figures of a repository over a period. The
+// rank fields are left for NewLeaderboardReport.
+func NewRepoStanding(p RepoPeriod) RepoStanding {
+	s := RepoStanding{
+		Owner:          p.Owner,
+		Repo:           p.Repo,
+		TotalDownloads: p.Newest.TotalDownloads,
+		Growth:         p.Newest.TotalDownloads - p.Oldest.TotalDownloads,
+		Releases:       len(p.Newest.Releases),
+		FetchedAt:      p.Newest.FetchedAt,
+	}
+	s.GrowthPercent = percentOf(s.Growth, p.Oldest.TotalDownloads)
+	if s.Releases > 0 {
+		s.PerRelease = float64(s.TotalDownloads) / float64(s.Releases)
+	}
+
+	var latest *Release
+	for i := range p.Newest.Releases {
+		rel := &p.Newest.Releases[i]
+		if latest == nil || rel.CreatedAt.After(latest.CreatedAt) {
+			latest = rel
+		}
+	}
+	if latest != nil {
+		s.LatestRelease = latest.Tag
+		s.LatestGrowth = latest.TotalDownloads
+		for _, old := range p.Oldest.Releases {
+			if old.Tag == latest.Tag {
+				s.LatestGrowth -= old.TotalDownloads
+				break
+			}
+		}
+		if s.Growth > 0 {
+			s.Adoption = float64(s.LatestGrowth) / float64(s.Growth) * 100
+		}
+	}
+
+	return s
+}
+
+func (s RepoStanding) metric(m LeaderboardMetric) float64 {
+	switch m {
+	case RankByGrowth:
+		return float64(s.Growth)
+	case RankByPerRelease:
+		return s.PerRelease
+	case RankByAdoption:
+		return s.Adoption
+	}
+	return float64(s.TotalDownloads)
+}
+
+// rankStandings orders standings by metric, largest first, with total
+// downloads and then the repository name breaking ties, and numbers them.
+func rankStandings(standings []RepoStanding, m LeaderboardMetric) {
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if x, y := a.metric(m), b.metric(m); x != y {
+			return x > y
+		}
+		if a.TotalDownloads != b.TotalDownloads {
+			return a.TotalDownloads > b.TotalDownloads
+		}
+		return a.Owner+"/"+a.Repo < b.Owner+"/"+b.Repo
+	})
+	for i := range standings {
+		standings[i].Rank = i + 1
+	}
+}
+
+// LeaderboardReport ranks repositories over the same period and compares
+// each rank with the previous period of the same length.
+type LeaderboardReport struct {
+	Metric LeaderboardMetric `json:"metric" yaml:"metric"`
+	Start  time.Time         `json:"start" yaml:"start"`
+	End    time.Time         `json:"end" yaml:"end"`
+	Days   int               `json:"days" yaml:"days"`
+	Repos  []RepoStanding    `json:"repos" yaml:"repos"`
+}
+
+// NewLeaderboardReport ranks current by metric. previous holds the
+// preceding period; repositories missing from it have no previous rank.
+func NewLeaderboardReport(current, previous []RepoPeriod, m LeaderboardMetric, start, end time.Time) *LeaderboardReport {
+	before := make([]RepoStanding, 0, len(previous))
+	for _, p := range previous {
+		before = append(before, NewRepoStanding(p))
+	}
+	rankStandings(before, m)
+	previousRank := make(map[string]int, len(before))
+	for _, s := range before {
+		previousRank[s.Owner+"/"+s.Repo] = s.Rank
+	}
+
+	report := &LeaderboardReport{
+		Metric: m,
+		Start:  start,
+		End:    end,
+		Days:   int(math.Round(end.Sub(start).Hours() / 24)),
+		Repos:  make([]RepoStanding, 0, len(current)),
+	}
+	for _, p := range current {
+		report.Repos = append(report.Repos, NewRepoStanding(p))
+	}
+	rankStandings(report.Repos, m)
+	for i := range report.Repos {
+		s := &report.Repos[i]
+		if rank, ok := previousRank[s.Owner+"/"+s.Repo]; ok {
+			s.PreviousRank = rank
+			s.RankChange = rank - s.Rank
+		}
+	}
+
+	return report
+}
+
+// rankChange formats a rank change: "↑2", "↓1", "=" or "new".
+func rankChange(s RepoStanding) string {
+	switch {
+	case s.PreviousRank == 0:
+		return "new"
+	case s.RankChange > 0:
+		return fmt.Sprintf("↑%d", s.RankChange)
+	case s.RankChange < 0:
+		return fmt.Sprintf("↓%d", -s.RankChange)
+	}
+	return "="
+}
+
+// WriteText writes the ranking as an aligned table.
+func (r *LeaderboardReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nLeaderboard by %s, %s to %s (%d days)\n\n",
+		r.Metric, r.Start.Format("2006-01-02"), r.End.Format("2006-01-02"), r.Days)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tCHANGE\tREPOSITORY\tDOWNLOADS\tGROWTH\tRELEASES\tPER RELEASE\tLATEST\tADOPTION")
+	fmt.Fprintln(w, "---\t---\t---\t---\t---\t---\t---\t---\t---")
+	for _, s := range r.Repos {
+		fmt.Fprintf(w, "%d\t%s\t%s/%s\t%d\t%+d (%+.2f%%)\t%d\t%.0f\t%s\t%.1f%%\n",
+			s.Rank, rankChange(s), s.Owner, s.Repo,
+			s.TotalDownloads, s.Growth, s.GrowthPercent,
+			s.Releases, s.PerRelease,
+			orDash(s.LatestRelease), s.Adoption,
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// Table returns one row per repository in rank order.
+func (r *LeaderboardReport) Table() ([]string, [][]string) {
+	header := []string{
+		"rank", "previous_rank", "owner", "repo", "total_downloads", "growth", "growth_percent",
+		"releases", "downloads_per_release", "latest_release", "latest_release_growth", "latest_release_adoption_percent",
+	}
+	rows := make([][]string, 0, len(r.Repos))
+	for _, s := range r.Repos {
+		previous := ""
+		if s.PreviousRank > 0 {
+			previous = strconv.Itoa(s.PreviousRank)
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(s.Rank),
+			previous,
+			s.Owner,
+			s.Repo,
+			strconv.Itoa(s.TotalDownloads),
+			strconv.Itoa(s.Growth),
+			strconv.FormatFloat(s.GrowthPercent, 'f', 2, 64),
+			strconv.Itoa(s.Releases),
+			strconv.FormatFloat(s.PerRelease, 'f', 2, 64),
+			s.LatestRelease,
+			strconv.Itoa(s.LatestGrowth),
+			strconv.FormatFloat(s.Adoption, 'f', 2, 64),
+		})
+	}
+	return header, rows
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaderboardRanksAndRankChanges(t *testing.T) {
+	snapshot := func(old, latest int) *ReleaseStats {
+		return &ReleaseStats{
+			Releases: []Release{
+				{Tag: "v1.0.0", TotalDownloads: old, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{Tag: "v2.0.0", TotalDownloads: latest, CreatedAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+			},
+			TotalDownloads: old + latest,
+		}
+	}
+	period := func(repo string, from, to *ReleaseStats) RepoPeriod {
+		return RepoPeriod{Owner: "acme", Repo: repo, Oldest: from, Newest: to}
+	}
+
+	previous := []RepoPeriod{
+		period("big", snapshot(900, 0), snapshot(1000, 0)),
+		period("small", snapshot(10, 0), snapshot(20, 0)),
+	}
+	current := []RepoPeriod{
+		period("big", snapshot(1000, 0), snapshot(1050, 0)),
+		period("small", snapshot(20, 0), snapshot(40, 180)),
+		period("fresh", snapshot(0, 0), snapshot(0, 5)),
+	}
+
+	end := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	report := NewLeaderboardReport(current, previous, RankByGrowth, end.AddDate(0, 0, -30), end)
+
+	if report.Days != 30 || len(report.Repos) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	small, big, fresh := report.Repos[0], report.Repos[1], report.Repos[2]
+	if small.Repo != "small" || small.Growth != 200 || small.PreviousRank != 2 || small.RankChange != 1 {
+		t.Errorf("expected small to move up to first, got %+v", small)
+	}
+	if big.Repo != "big" || big.RankChange != -1 {
+		t.Errorf("expected big to drop to second, got %+v", big)
+	}
+	if fresh.Repo != "fresh" || fresh.PreviousRank != 0 || rankChange(fresh) != "new" {
+		t.Errorf("expected fresh to be new, got %+v", fresh)
+	}
+
+	if small.LatestRelease != "v2.0.0" || small.LatestGrowth != 180 || small.Adoption != 90 {
+		t.Errorf("expected v2.0.0 to take 90%% of growth, got %+v", small)
+	}
+	if small.PerRelease != 110 {
+		t.Errorf("expected 110 downloads per release, got %v", small.PerRelease)
+	}
+}
+
+func TestParseLeaderboardMetric(t *testing.T) {
+	if m, err := ParseLeaderboardMetric("per-release"); err != nil || m != RankByPerRelease {
+		t.Fatalf("ParseLeaderboardMetric = %q, %v", m, err)
+	}
+	if _, err := ParseLeaderboardMetric("stars"); err == nil {
+		t.Fatal("expected an error for an unknown metric")
+	}
+}
@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MetricsPattern is the route Metrics is served at.
+const MetricsPattern = "GET /metrics"
+
+// AssetLabels selects how per-asset download series are labelled.
+type AssetLabels string
+
+const (
+	// AssetLabelsAsset exports one series per asset.
+	AssetLabelsAsset AssetLabels = "asset"
+	// AssetLabelsPlatform sums the assets of a release per OS and
+	// architecture and leaves the asset label empty.
+	AssetLabelsPlatform AssetLabels = "platform"
+	// AssetLabelsNone exports no per-asset series.
+	AssetLabelsNone AssetLabels = "none"
+)
+
+// ParseAssetLabels validates an asset labelling mode. An empty string
+// selects AssetLabelsAsset.
+func ParseAssetLabels(s string) (AssetLabels, error) {
+	switch l := AssetLabels(s); l {
+	case AssetLabelsAsset, AssetLabelsPlatform, AssetLabelsNone:
+		return l, nil
+	case "":
+		return AssetLabelsAsset, nil
+	}
+	return "", fmt.Errorf("unknown asset labels %q (want asset, platform or none)", s)
+}
+
+// MetricsOptions bound the number of series exported per repository.
+// Repositories with thousands of assets otherwise produce a series per
+// asset of every release they ever published.
+type MetricsOptions struct {
+	// TagGlob restricts release and asset series to matching tags.
+	TagGlob string
+	// Releases restricts release and asset series to the newest N releases
+	// when positive.
+	Releases int
+	// Assets selects how asset series are labelled.
+	Assets AssetLabels
+	// MaxAssetSeries keeps only the N asset series with the most downloads
+	// per repository when positive; the number dropped is exported too.
+	MaxAssetSeries int
+}
+
+// Metrics exports stored statistics in the Prometheus text format. Every
+// value comes from the database, so a scrape never calls GitHub.
+type Metrics struct {
+	db         *Database
+	classifier *PlatformClassifier
+	opts       MetricsOptions
+}
+
+// NewMetrics returns an exporter over db that labels assets with the OS and
+// architecture classifier finds in their names.
+func NewMetrics(db *Database, classifier *PlatformClassifier, opts MetricsOptions) (*Metrics, error) {
+	if opts.TagGlob != "" {
+		if _, err := path.Match(opts.TagGlob, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern %q: %w", opts.TagGlob, err)
+		}
+	}
+	var err error
+	if opts.Assets, err = ParseAssetLabels(string(opts.Assets)); err != nil {
+		return nil, err
+	}
+	return &Metrics{db: db, classifier: classifier, opts: opts}, nil
+}
+
+// metricFamily is a metric name with its help text and samples.
+type metricFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample holds label names and values alternately.
+type metricSample struct {
+	labels []string
+	value  float64
+}
+
+func (f *metricFamily) add(value float64, labels ...string) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+// assetSample is the download count of one asset series before the
+// cardinality limits apply.
+type assetSample struct {
+	release   int
+	tag       string
+	asset     string
+	os        string
+	arch      string
+	downloads int
+}
+
+// downloadSelection holds the release and asset series of a snapshot that
+// MetricsOptions select.
+type downloadSelection struct {
+	releases []Release
+	assets   []assetSample
+	// dropped counts the asset series beyond MaxAssetSeries.
+	dropped int
+}
+
+// selectDownloads applies the options to a snapshot. Releases are newest
+// first and assets follow their release; auxiliary assets are left out.
+func (o MetricsOptions) selectDownloads(stats *ReleaseStats, classifier *PlatformClassifier) (*downloadSelection, error) {
+	selected, err := ReleaseFilter{TagGlob: o.TagGlob, Sort: SortCreated, Top: o.Releases}.Apply(stats)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := &downloadSelection{releases: selected.Releases}
+	if o.Assets == AssetLabelsNone {
+		return sel, nil
+	}
+	byPlatform := make(map[string]int)
+	for i, rel := range selected.Releases {
+		for _, a := range rel.Assets {
+			if a.Kind.Auxiliary() {
+				continue
+			}
+			p := classifier.Classify(a.Name)
+			sample := assetSample{release: i, tag: rel.Tag, asset: a.Name, os: p.OS, arch: p.Arch, downloads: a.DownloadCount}
+			if o.Assets == AssetLabelsPlatform {
+				key := rel.Tag + "\x00" + p.OS + "\x00" + p.Arch
+				if j, ok := byPlatform[key]; ok {
+					sel.assets[j].downloads += a.DownloadCount
+					continue
+				}
+				sample.asset = ""
+				byPlatform[key] = len(sel.assets)
+			}
+			sel.assets = append(sel.assets, sample)
+		}
+	}
+
+	if limit := o.MaxAssetSeries; limit > 0 && len(sel.assets) > limit {
+		sel.dropped = len(sel.assets) - limit
+		slices.SortStableFunc(sel.assets, func(a, b assetSample) int {
+			return cmp.Compare(b.downloads, a.downloads)
+		})
+		sel.assets = sel.assets[:limit]
+		slices.SortStableFunc(sel.assets, func(a, b assetSample) int {
+			return cmp.Or(cmp.Compare(a.release, b.release), cmp.Compare(a.asset, b.asset), cmp.Compare(a.os, b.os), cmp.Compare(a.arch, b.arch))
+		})
+	}
+	return sel, nil
+}
+
+// Write writes every metric in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	summaries, err := m.db.FetchSummaries()
+	if err != nil {
+		return err
+	}
+
+	var (
+		repoDownloads = &metricFamily{name: "github_repo_downloads_total", kind: "counter", help: "Downloads of all releases in the newest snapshot, excluding auxiliary assets."}
+		repoReleases  = &metricFamily{name: "github_repo_releases", kind: "gauge", help: "Releases in the newest snapshot."}
+		snapshotTime  = &metricFamily{name: "github_release_snapshot_timestamp_seconds", kind: "gauge", help: "Time the newest snapshot was fetched."}
+		releaseTotals = &metricFamily{name: "github_release_downloads_total", kind: "counter", help: "Downloads of a release, excluding auxiliary assets."}
+		assetTotals   = &metricFamily{name: "github_release_asset_downloads_total", kind: "counter", help: "Downloads of a release asset."}
+		assetsDropped = &metricFamily{name: "github_release_asset_series_dropped", kind: "gauge", help: "Asset series left out by the series limit."}
+		fetchTime     = &metricFamily{name: "github_release_fetch_timestamp_seconds", kind: "gauge", help: "Time the last fetch started."}
+		fetchDuration = &metricFamily{name: "github_release_fetch_duration_seconds", kind: "gauge", help: "Duration of the last fetch."}
+		fetchSuccess  = &metricFamily{name: "github_release_fetch_success", kind: "gauge", help: "Whether the last fetch succeeded."}
+		fetches       = &metricFamily{name: "github_release_fetches_total", kind: "counter", help: "Logged fetches."}
+		fetchErrors   = &metricFamily{name: "github_release_fetch_errors_total", kind: "counter", help: "Logged fetches that failed."}
+		rateLimit     = &metricFamily{name: "github_api_rate_limit", kind: "gauge", help: "GitHub API requests allowed per hour, as of the last fetch."}
+		rateRemaining = &metricFamily{name: "github_api_rate_limit_remaining", kind: "gauge", help: "GitHub API requests left in the current window, as of the last fetch."}
+		rateReset     = &metricFamily{name: "github_api_rate_limit_reset_timestamp_seconds", kind: "gauge", help: "Time the GitHub API rate limit window resets, as of the last fetch."}
+		families      = []*metricFamily{repoDownloads, repoReleases, snapshotTime, releaseTotals, assetTotals, assetsDropped, fetchTime, fetchDuration, fetchSuccess, fetches, fetchErrors, rateLimit, rateRemaining, rateReset}
+	)
+
+	for _, s := range summaries {
+		owner, repo := s.Owner, s.Repo
+
+		fetches.add(float64(s.Fetches), "owner", owner, "repo", repo)
+		fetchErrors.add(float64(s.Errors), "owner", owner, "repo", repo)
+		if last := s.Last; last != nil {
+			fetchTime.add(unixSeconds(last.StartedAt.UnixMilli()), "owner", owner, "repo", repo)
+			fetchDuration.add(last.Duration.Seconds(), "owner", owner, "repo", repo)
+			fetchSuccess.add(boolValue(last.Error == ""), "owner", owner, "repo", repo)
+			if last.Rate.Limit > 0 {
+				rateLimit.add(float64(last.Rate.Limit), "owner", owner, "repo", repo)
+				rateRemaining.add(float64(last.Rate.Remaining), "owner", owner, "repo", repo)
+				rateReset.add(float64(last.Rate.Reset.Unix()), "owner", owner, "repo", repo)
+			}
+		}
+
+		stats, err := m.db.GetLatestStats(owner, repo)
+		if err != nil {
+			return err
+		}
+		if stats.FetchedAt.IsZero() {
+			continue
+		}
+		repoDownloads.add(float64(stats.TotalDownloads), "owner", owner, "repo", repo)
+		repoReleases.add(float64(len(stats.Releases)), "owner", owner, "repo", repo)
+		snapshotTime.add(unixSeconds(stats.FetchedAt.UnixMilli()), "owner", owner, "repo", repo)
+
+		sel, err := m.opts.selectDownloads(stats, m.classifier)
+		if err != nil {
+			return err
+		}
+		for _, rel := range sel.releases {
+			releaseTotals.add(float64(rel.TotalDownloads), "owner", owner, "repo", repo, "tag", rel.Tag)
+		}
+		if m.opts.MaxAssetSeries > 0 {
+			assetsDropped.add(float64(sel.dropped), "owner", owner, "repo", repo)
+		}
+		for _, a := range sel.assets {
+			assetTotals.add(float64(a.downloads), "owner", owner, "repo", repo, "tag", a.tag, "asset", a.asset, "os", a.os, "arch", a.arch)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// write writes the family in the text exposition format, skipping families
+// without samples.
+func (f *metricFamily) write(w *bufio.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, helpEscaper.Replace(f.help), f.name, f.kind)
+	for _, s := range f.samples {
+		w.WriteString(f.name)
+		if len(s.labels) > 0 {
+			w.WriteByte('{')
+			for i := 0; i < len(s.labels); i += 2 {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				fmt.Fprintf(w, `%s="%s"`, s.labels[i], labelEscaper.Replace(s.labels[i+1]))
+			}
+			w.WriteByte('}')
+		}
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatFloat(s.value, 'f', -1, 64))
+		w.WriteByte('\n')
+	}
+}
+
+// unixSeconds converts Unix milliseconds to fractional seconds.
+func unixSeconds(ms int64) float64 {
+	return float64(ms) / 1000
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var sb strings.Builder
+	if err := m.Write(&sb); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = io.WriteString(w, sb.String())
+}
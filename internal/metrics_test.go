@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func metricsDatabase(t *testing.T) *Database {
+	t.Helper()
+	db := badgeDatabase(t)
+	started := time.Date(2024, 7, 5, 12, 0, 0, 0, time.UTC)
+	for _, f := range []FetchLog{
+		{Owner: "owner", Repo: "repo", StartedAt: started.Add(-time.Hour), Duration: time.Second, Error: "rate limited"},
+		{Owner: "owner", Repo: "repo", StartedAt: started, Duration: 1500 * time.Millisecond,
+			Rate: RateLimit{Limit: 5000, Remaining: 4990, Reset: started.Add(time.Hour)}},
+		{Owner: "other", Repo: "broken", StartedAt: started, Duration: 200 * time.Millisecond, Error: `not "found"`},
+	} {
+		if err := db.LogFetch(f); err != nil {
+			t.Fatalf("LogFetch failed: %v", err)
+		}
+	}
+	return db
+}
+
+func writeMetrics(t *testing.T, db *Database, opts MetricsOptions) string {
+	t.Helper()
+	m, err := NewMetrics(db, nil, opts)
+	if err != nil {
+		t.Fatalf("NewMetrics failed: %v", err)
+	}
+	var sb strings.Builder
+	if err := m.Write(&sb); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	return sb.String()
+}
+
+func TestFetchSummaries(t *testing.T) {
+	summaries, err := metricsDatabase(t).FetchSummaries()
+	if err != nil {
+		t.Fatalf("FetchSummaries failed: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Repo != "broken" || summaries[1].Repo != "repo" {
+		t.Fatalf("unexpected summaries %+v", summaries)
+	}
+	s := summaries[1]
+	if s.Fetches != 2 || s.Errors != 1 || s.Last == nil || s.Last.Error != "" || s.Last.Rate.Remaining != 4990 || s.Last.Duration != 1500*time.Millisecond {
+		t.Errorf("unexpected summary %+v (last %+v)", s, s.Last)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	out := writeMetrics(t, metricsDatabase(t), MetricsOptions{})
+	for _, want := range []string{
+		"# TYPE github_release_asset_downloads_total counter\n",
+		`github_repo_downloads_total{owner="owner",repo="repo"} 2505` + "\n",
+		`github_release_downloads_total{owner="owner",repo="repo",tag="v1.0.0"} 5` + "\n",
+		`github_release_asset_downloads_total{owner="owner",repo="repo",tag="v1.1.0",asset="tool_linux_arm64.tar.gz",os="linux",arch="arm64"} 300` + "\n",
+		`github_release_fetch_duration_seconds{owner="owner",repo="repo"} 1.5` + "\n",
+		`github_release_fetch_errors_total{owner="owner",repo="repo"} 1` + "\n",
+		`github_release_fetch_success{owner="other",repo="broken"} 0` + "\n",
+		`github_api_rate_limit_remaining{owner="owner",repo="repo"} 4990` + "\n",
+		`github_api_rate_limit_reset_timestamp_seconds{owner="owner",repo="repo"} 1720184400` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `github_repo_downloads_total{owner="other"`) {
+		t.Errorf("unexpected download counters for a repository without snapshots:\n%s", out)
+	}
+	if strings.Contains(out, `github_api_rate_limit{owner="other"`) {
+		t.Errorf("unexpected rate limit for a fetch without one:\n%s", out)
+	}
+}
+
+func TestMetricsCardinality(t *testing.T) {
+	db := metricsDatabase(t)
+
+	out := writeMetrics(t, db, MetricsOptions{Releases: 1, Assets: AssetLabelsPlatform})
+	if strings.Contains(out, `tag="v1.0.0"`) {
+		t.Errorf("expected only the newest release:\n%s", out)
+	}
+	want := `github_release_asset_downloads_total{owner="owner",repo="repo",tag="v1.1.0",asset="",os="linux",arch="amd64"} 1500`
+	if !strings.Contains(out, want) || strings.Count(out, "github_release_asset_downloads_total{") != 3 {
+		t.Errorf("expected one series per platform:\n%s", out)
+	}
+
+	out = writeMetrics(t, db, MetricsOptions{MaxAssetSeries: 2})
+	if n := strings.Count(out, "github_release_asset_downloads_total{"); n != 2 {
+		t.Errorf("expected 2 asset series, got %d:\n%s", n, out)
+	}
+	if !strings.Contains(out, `github_release_asset_series_dropped{owner="owner",repo="repo"} 2`) || strings.Contains(out, `arch="arm64"`) {
+		t.Errorf("expected the least downloaded series to be dropped:\n%s", out)
+	}
+
+	out = writeMetrics(t, db, MetricsOptions{TagGlob: "v1.0.*", Assets: AssetLabelsNone})
+	if strings.Contains(out, "github_release_asset_downloads_total") || strings.Contains(out, `tag="v1.1.0"`) {
+		t.Errorf("unexpected series:\n%s", out)
+	}
+
+	if _, err := NewMetrics(db, nil, MetricsOptions{Assets: "files"}); err == nil {
+		t.Error("expected an error for unknown asset labels")
+	}
+	if _, err := NewMetrics(db, nil, MetricsOptions{TagGlob: "["}); err == nil {
+		t.Error("expected an error for an invalid tag pattern")
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m, err := NewMetrics(metricsDatabase(t), nil, MetricsOptions{})
+	if err != nil {
+		t.Fatalf("NewMetrics failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPattern, m)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, _, ok := strings.Cut(line, "{")
+		if !ok || !strings.HasPrefix(name, "github_") || strings.Count(line, `"`)%2 != 0 {
+			t.Errorf("malformed sample %q", line)
+		}
+	}
+}
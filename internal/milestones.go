@@ -0,0 +1,508 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Count is a download count that the configuration file may give with a
+// k, M or B suffix, e.g. 1M.
+type Count int
+
+// UnmarshalYAML parses a count with ParseCount.
+func (c *Count) UnmarshalYAML(value *yaml.Node) error {
+	n, err := ParseCount(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*c = Count(n)
+	return nil
+}
+
+// MilestoneType selects what a milestone rule counts.
+type MilestoneType string
+
+const (
+	// MilestoneTotal counts the repository's total downloads.
+	MilestoneTotal MilestoneType = "total"
+	// MilestoneRelease counts the downloads of each release, optionally only
+	// within a period after it was published.
+	MilestoneRelease MilestoneType = "release"
+	// MilestonePeriod counts the repository's downloads within each day,
+	// week or month.
+	MilestonePeriod MilestoneType = "period"
+)
+
+// MilestoneRule declares download counts worth announcing.
+type MilestoneRule struct {
+	Name string        `yaml:"name"`
+	Type MilestoneType `yaml:"type"`
+	// Repos restricts the rule to these repositories, given as owner/repo
+	// or alias, and Group to the configured repositories in a group.
+	Repos []string `yaml:"repos"`
+	Group string   `yaml:"group"`
+	// Tag restricts the rule to releases whose tag matches the glob.
+	Tag string `yaml:"tag"`
+	// Count is the milestone; Every makes each multiple of it one instead.
+	Count Count `yaml:"count"`
+	Every Count `yaml:"every"`
+	// Within restricts release rules to snapshots taken at most this long
+	// after the release was published, e.g. 168h for its first week.
+	Within time.Duration `yaml:"within"`
+	// Period is the bucket of period rules: day, week (default) or month.
+	Period TrendPeriod `yaml:"period"`
+	// Notify names the notifiers to post to (default: all of them).
+	Notify []string `yaml:"notify"`
+}
+
+func (r MilestoneRule) withDefaults() MilestoneRule {
+	if r.Type == MilestonePeriod && r.Period == "" {
+		r.Period = PeriodWeek
+	}
+	return r
+}
+
+// validate checks the rule against the configured notifiers.
+func (r MilestoneRule) validate(notifiers []NotifierConfig) error {
+	if r.Name == "" {
+		return fmt.Errorf("milestone rule: missing name")
+	}
+	switch r.Type {
+	case MilestoneTotal, MilestoneRelease:
+	case MilestonePeriod:
+		if r.Period != "" {
+			if _, err := ParseTrendPeriod(string(r.Period)); err != nil {
+				return fmt.Errorf("milestone %s: %w", r.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("milestone %s: unknown type %q (want total, release or period)", r.Name, r.Type)
+	}
+	if (r.Count > 0) == (r.Every > 0) {
+		return fmt.Errorf("milestone %s: set either count or every to a positive count", r.Name)
+	}
+	if r.Within < 0 {
+		return fmt.Errorf("milestone %s: within must not be negative", r.Name)
+	}
+	if r.Within > 0 && r.Type != MilestoneRelease {
+		return fmt.Errorf("milestone %s: within only applies to release milestones", r.Name)
+	}
+	if r.Period != "" && r.Type != MilestonePeriod {
+		return fmt.Errorf("milestone %s: period only applies to period milestones", r.Name)
+	}
+	if r.Tag != "" {
+		if _, err := path.Match(r.Tag, ""); err != nil {
+			return fmt.Errorf("milestone %s: invalid tag pattern %q: %w", r.Name, r.Tag, err)
+		}
+	}
+	for _, name := range r.Notify {
+		if !hasNotifier(notifiers, name) {
+			return fmt.Errorf("milestone %s: unknown notifier %q", r.Name, name)
+		}
+	}
+	return nil
+}
+
+// crossed returns the milestone passed by a value growing from prev to
+// cur. With Every, it is the highest multiple passed.
+func (r MilestoneRule) crossed(prev, cur int) (int, bool) {
+	if r.Count > 0 {
+		return int(r.Count), prev < int(r.Count) && cur >= int(r.Count)
+	}
+	every := int(r.Every)
+	reached := cur / every * every
+	return reached, reached > 0 && prev < reached
+}
+
+// milestoneCrossing is a milestone passed between two snapshots.
+type milestoneCrossing struct {
+	// subject is the release tag or period start, empty for totals.
+	subject string
+	count   int
+	value   int
+	message string
+}
+
+// evaluate returns the milestones passed between prev and cur. intervals
+// are the repository's downloads between successive snapshots up to cur,
+// which period rules spread over their buckets. Period rules check every
+// bucket from the one prev was taken in to the one cur was taken in, as a
+// snapshot after a gap completes the buckets before it.
+func (r MilestoneRule) evaluate(prev, cur *ReleaseStats, intervals []Interval) []milestoneCrossing {
+	name := cur.Owner + "/" + cur.Repo
+	var out []milestoneCrossing
+	switch r.Type {
+	case MilestoneTotal:
+		if count, ok := r.crossed(prev.TotalDownloads, cur.TotalDownloads); ok {
+			out = append(out, milestoneCrossing{
+				count:   count,
+				value:   cur.TotalDownloads,
+				message: fmt.Sprintf("%s passed %s downloads", name, humanizeFloat(float64(count))),
+			})
+		}
+	case MilestoneRelease:
+		before := make(map[string]int, len(prev.Releases))
+		for _, rel := range prev.Releases {
+			before[rel.Tag] = rel.TotalDownloads
+		}
+		for _, rel := range cur.Releases {
+			if r.Within > 0 && cur.FetchedAt.Sub(rel.ReleaseDate()) > r.Within {
+				continue
+			}
+			count, ok := r.crossed(before[rel.Tag], rel.TotalDownloads)
+			if !ok {
+				continue
+			}
+			message := fmt.Sprintf("%s %s passed %s downloads", name, rel.Tag, humanizeFloat(float64(count)))
+			if r.Within > 0 {
+				message += " within " + formatWindow(r.Within) + " of its release"
+			}
+			out = append(out, milestoneCrossing{subject: rel.Tag, count: count, value: rel.TotalDownloads, message: message})
+		}
+	case MilestonePeriod:
+		for start := r.Period.start(prev.FetchedAt); !start.After(cur.FetchedAt); start = r.Period.next(start) {
+			downloads, _ := downloadsBetween(intervals, start, minTime(r.Period.next(start), cur.FetchedAt))
+			var before float64
+			if prev.FetchedAt.After(start) {
+				before, _ = downloadsBetween(intervals, start, prev.FetchedAt)
+			}
+			value := int(math.Round(downloads))
+			if count, ok := r.crossed(int(math.Round(before)), value); ok {
+				out = append(out, milestoneCrossing{
+					subject: start.Format("2006-01-02"),
+					count:   count,
+					value:   value,
+					message: fmt.Sprintf("%s got %s downloads %s", name, humanizeFloat(float64(count)), periodName(r.Period, start)),
+				})
+			}
+		}
+	}
+	return out
+}
+
+// periodName describes the bucket of period starting at start.
+func periodName(period TrendPeriod, start time.Time) string {
+	switch period {
+	case PeriodWeek:
+		return "in the week of " + start.Format("2006-01-02")
+	case PeriodMonth:
+		return "in " + start.Format("January 2006")
+	}
+	return "on " + start.Format("2006-01-02")
+}
+
+// Milestone is a milestone passed in a stored snapshot.
+type Milestone struct {
+	Rule  string `json:"rule" yaml:"rule"`
+	Owner string `json:"owner" yaml:"owner"`
+	Repo  string `json:"repo" yaml:"repo"`
+	// Subject is the release tag of release milestones and the period
+	// start of period milestones.
+	Subject string `json:"subject" yaml:"subject"`
+	Count   int    `json:"count" yaml:"count"`
+	// Value is the download count in the snapshot.
+	Value   int    `json:"value" yaml:"value"`
+	Message string `json:"message" yaml:"message"`
+	// SnapshotID and FetchedAt identify the first snapshot in which the
+	// milestone was passed.
+	SnapshotID int64     `json:"snapshot_id" yaml:"snapshot_id"`
+	FetchedAt  time.Time `json:"fetched_at" yaml:"fetched_at"`
+}
+
+// RecordMilestone stores a milestone unless it was recorded before, and
+// reports whether it is new.
+func (d *Database) RecordMilestone(m *Milestone) (bool, error) {
+	res, err := d.db.Exec(
+		`INSERT INTO milestones (rule, owner, repo, subject, count, value, message, snapshot_id, fetched_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (rule, owner, repo, subject, count) DO NOTHING`,
+		m.Rule, m.Owner, m.Repo, m.Subject, m.Count, m.Value, m.Message, m.SnapshotID, m.FetchedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record milestone: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListMilestones returns the milestones passed since the given time, most
+// recent first. Empty owner and repo list every repository.
+func (d *Database) ListMilestones(owner, repo string, since time.Time) ([]Milestone, error) {
+	return d.listMilestones(`(? = '' OR (owner = ? AND repo = ?)) AND fetched_at >= ?`, owner, owner, repo, since)
+}
+
+// MarkMilestoneNotified records that the milestone was notified.
+func (d *Database) MarkMilestoneNotified(m *Milestone) error {
+	_, err := d.db.Exec(
+		`UPDATE milestones SET notified_at = ?
+		 WHERE rule = ? AND owner = ? AND repo = ? AND subject = ? AND count = ? AND notified_at IS NULL`,
+		time.Now().UTC(), m.Rule, m.Owner, m.Repo, m.Subject, m.Count,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark milestone as notified: %w", err)
+	}
+	return nil
+}
+
+// listMilestones returns the milestones matching the where clause, most
+// recent first.
+func (d *Database) listMilestones(where string, args ...any) ([]Milestone, error) {
+	rows, err := d.db.Query(
+		`SELECT rule, owner, repo, subject, count, value, message, snapshot_id, fetched_at
+		 FROM milestones
+		 WHERE `+where+`
+		 ORDER BY fetched_at DESC, owner, repo, rule, subject, count DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query milestones: %w", err)
+	}
+	defer rows.Close()
+
+	milestones := make([]Milestone, 0)
+	for rows.Next() {
+		var m Milestone
+		if err := rows.Scan(&m.Rule, &m.Owner, &m.Repo, &m.Subject, &m.Count, &m.Value, &m.Message, &m.SnapshotID, &m.FetchedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan milestone: %w", err)
+		}
+		milestones = append(milestones, m)
+	}
+	return milestones, rows.Err()
+}
+
+// MilestoneTracker evaluates the configured milestone rules against stored
+// snapshots and announces the milestones passed.
+type MilestoneTracker struct {
+	db        *Database
+	cfg       *Config
+	rules     []MilestoneRule
+	notifiers map[string]*Notifier
+}
+
+// NewMilestoneTracker returns a tracker for the rules in cfg. A nil client
+// uses http.DefaultClient for notifications.
+func NewMilestoneTracker(db *Database, cfg *Config, client *http.Client) (*MilestoneTracker, error) {
+	notifiers, err := NewNotifiers(cfg.Notifiers, client)
+	if err != nil {
+		return nil, err
+	}
+	t := &MilestoneTracker{db: db, cfg: cfg, notifiers: notifiers}
+	for _, r := range cfg.Milestones {
+		if err := r.validate(cfg.Notifiers); err != nil {
+			return nil, err
+		}
+		t.rules = append(t.rules, r.withDefaults())
+	}
+	return t, nil
+}
+
+// Enabled reports whether any rule is configured.
+func (t *MilestoneTracker) Enabled() bool {
+	return len(t.rules) > 0
+}
+
+// Evaluate compares every snapshot of owner/repo fetched at or after since
+// with the snapshot before it, records the milestones passed and returns
+// those of owner/repo not notified yet, oldest first: the new ones and
+// earlier ones whose notification failed. A zero since evaluates the whole
+// history. Milestones passed before the first stored snapshot are not
+// reported, since no snapshot shows them being passed.
+func (t *MilestoneTracker) Evaluate(owner, repo string, since time.Time) ([]Milestone, error) {
+	var rules []MilestoneRule
+	for _, r := range t.rules {
+		if coversRepo(t.cfg, r.Repos, r.Group, owner, repo) {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	latest, err := t.db.GetLatestStats(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if latest.FetchedAt.IsZero() {
+		return nil, nil
+	}
+	anchor := since
+	if !since.IsZero() {
+		// Period rules spread downloads over the buckets from the one the
+		// snapshot before since was taken in
+		prev, err := t.db.GetSnapshotAt(owner, repo, since.Add(-time.Nanosecond))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			if r.Type == MilestonePeriod {
+				anchor = minTime(anchor, r.Period.start(prev.FetchedAt))
+			}
+		}
+	}
+	var first time.Time
+	if !anchor.IsZero() {
+		// The last snapshot before the anchor is the first one compared with
+		start, err := t.db.GetSnapshotAt(owner, repo, anchor.Add(-time.Nanosecond))
+		if err != nil {
+			return nil, err
+		}
+		first = start.FetchedAt
+	}
+	snapshots, err := t.db.GetStatsBetween(owner, repo, first, latest.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(snapshots)
+
+	for _, r := range rules {
+		filtered := snapshots
+		if r.Tag != "" {
+			filtered = make([]ReleaseStats, len(snapshots))
+			for i := range snapshots {
+				s, err := ReleaseFilter{TagGlob: r.Tag}.Apply(&snapshots[i])
+				if err != nil {
+					return nil, err
+				}
+				filtered[i] = *s
+			}
+		}
+		var intervals []Interval
+		if r.Type == MilestonePeriod {
+			intervals = Intervals(ExtractSeries(filtered, SeriesRepo)[0].Points)
+		}
+
+		for i := 1; i < len(filtered); i++ {
+			cur := &filtered[i]
+			if cur.FetchedAt.Before(since) {
+				continue
+			}
+			for _, c := range r.evaluate(&filtered[i-1], cur, intervals) {
+				m := Milestone{
+					Rule:       r.Name,
+					Owner:      owner,
+					Repo:       repo,
+					Subject:    c.subject,
+					Count:      c.count,
+					Value:      c.value,
+					Message:    c.message,
+					SnapshotID: cur.SnapshotID,
+					FetchedAt:  cur.FetchedAt,
+				}
+				if _, err := t.db.RecordMilestone(&m); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	pending, err := t.db.listMilestones(`owner = ? AND repo = ? AND notified_at IS NULL`, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(pending)
+	return pending, nil
+}
+
+// Notify posts each milestone to the notifiers of its rule and returns the
+// milestones that every notifier accepted. Record those with MarkNotified;
+// the others are returned by Evaluate again and retried, which may repeat
+// them on notifiers that accepted them.
+func (t *MilestoneTracker) Notify(ctx context.Context, milestones []Milestone) ([]Milestone, error) {
+	var delivered []Milestone
+	var errs []error
+	for _, m := range milestones {
+		ok := true
+		for _, r := range t.rules {
+			if r.Name != m.Rule {
+				continue
+			}
+			for _, n := range selectNotifiers(t.cfg.Notifiers, t.notifiers, r.Notify) {
+				if err := n.Notify(ctx, m.Notification()); err != nil {
+					errs = append(errs, err)
+					ok = false
+				}
+			}
+		}
+		if ok {
+			delivered = append(delivered, m)
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// MarkNotified records that milestones were notified, so that Evaluate no
+// longer returns them.
+func (t *MilestoneTracker) MarkNotified(milestones []Milestone) error {
+	for i := range milestones {
+		if err := t.db.MarkMilestoneNotified(&milestones[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notification announces the milestone.
+func (m Milestone) Notification() Notification {
+	labels := map[string]string{"rule": m.Rule, "count": strconv.Itoa(m.Count)}
+	if m.Subject != "" {
+		labels["subject"] = m.Subject
+	}
+	return Notification{
+		Kind:   "milestone",
+		Status: NotificationMilestone,
+		Title:  "🎉 " + m.Message,
+		Text: fmt.Sprintf("Passed in the snapshot of %s (ID %d), at %d downloads.",
+			m.FetchedAt.UTC().Format("2006-01-02 15:04 UTC"), m.SnapshotID, m.Value),
+		Owner:  m.Owner,
+		Repo:   m.Repo,
+		Time:   m.FetchedAt,
+		Labels: labels,
+	}
+}
+
+// MilestonesReport lists milestones.
+type MilestonesReport struct {
+	Milestones []Milestone `json:"milestones" yaml:"milestones"`
+}
+
+// WriteText writes the milestones as an aligned table.
+func (r *MilestonesReport) WriteText(out io.Writer) error {
+	if len(r.Milestones) == 0 {
+		_, err := fmt.Fprintln(out, "No milestones")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tID\tREPOSITORY\tRULE\tMILESTONE\tDOWNLOADS\tMESSAGE")
+	fmt.Fprintln(w, "---\t---\t---\t---\t---\t---\t---")
+	for _, m := range r.Milestones {
+		fmt.Fprintf(w, "%s\t%d\t%s/%s\t%s\t%s\t%d\t%s\n",
+			m.FetchedAt.Format("2006-01-02 15:04"), m.SnapshotID, m.Owner, m.Repo, m.Rule,
+			humanizeFloat(float64(m.Count)), m.Value, m.Message)
+	}
+	return w.Flush()
+}
+
+// Table returns one row per milestone.
+func (r *MilestonesReport) Table() ([]string, [][]string) {
+	header := []string{"fetched_at", "snapshot_id", "owner", "repo", "rule", "subject", "count", "value", "message"}
+	rows := make([][]string, 0, len(r.Milestones))
+	for _, m := range r.Milestones {
+		rows = append(rows, []string{
+			m.FetchedAt.Format(time.RFC3339), strconv.FormatInt(m.SnapshotID, 10),
+			m.Owner, m.Repo, m.Rule, m.Subject,
+			strconv.Itoa(m.Count), strconv.Itoa(m.Value), m.Message,
+		})
+	}
+	return header, rows
+}
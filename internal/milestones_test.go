@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMilestoneRules(t *testing.T) {
+	// v1.1.0 was created 2024-06-01; alertSnapshot(day) is fetched day days
+	// after 2024-07-01 with v1.0.0 at 5 downloads
+	prev, cur := alertSnapshot(0, 900), alertSnapshot(1, 1100)
+
+	for _, tt := range []struct {
+		rule MilestoneRule
+		want []milestoneCrossing
+	}{
+		{MilestoneRule{Type: MilestoneTotal, Count: 1000}, []milestoneCrossing{{count: 1000, value: 1105, message: "owner/repo passed 1k downloads"}}},
+		{MilestoneRule{Type: MilestoneTotal, Count: 500}, nil},
+		{MilestoneRule{Type: MilestoneTotal, Every: 250}, []milestoneCrossing{{count: 1000, value: 1105, message: "owner/repo passed 1k downloads"}}},
+		{MilestoneRule{Type: MilestoneRelease, Every: 1000}, []milestoneCrossing{{subject: "v1.1.0", count: 1000, value: 1100, message: "owner/repo v1.1.0 passed 1k downloads"}}},
+		{MilestoneRule{Type: MilestoneRelease, Count: 1000, Within: 7 * 24 * time.Hour}, nil},
+		{MilestoneRule{Type: MilestoneRelease, Count: 1000, Within: 32 * 24 * time.Hour}, []milestoneCrossing{
+			{subject: "v1.1.0", count: 1000, value: 1100, message: "owner/repo v1.1.0 passed 1k downloads within 32d of its release"},
+		}},
+	} {
+		got := tt.rule.evaluate(prev, cur, nil)
+		if len(got) != len(tt.want) || (len(got) == 1 && got[0] != tt.want[0]) {
+			t.Errorf("%+v: got %+v, want %+v", tt.rule, got, tt.want)
+		}
+	}
+
+	// within counts from the publish date when there is one
+	published := *cur
+	published.Releases = slices.Clone(cur.Releases)
+	published.Releases[1].PublishedAt = time.Date(2024, 6, 28, 0, 0, 0, 0, time.UTC)
+	firstWeek := MilestoneRule{Type: MilestoneRelease, Count: 1000, Within: 7 * 24 * time.Hour}
+	if got := firstWeek.evaluate(prev, &published, nil); len(got) != 1 || got[0].subject != "v1.1.0" {
+		t.Errorf("expected v1.1.0 to pass 1k within a week of publishing, got %+v", got)
+	}
+
+	// 2024-07-01 is a Monday; 100 downloads a day pass 250 in the week with
+	// the snapshot of 2024-07-04
+	var snapshots []ReleaseStats
+	for day := 0; day < 5; day++ {
+		snapshots = append(snapshots, *alertSnapshot(day, 1000+100*day))
+	}
+	intervals := Intervals(ExtractSeries(snapshots, SeriesRepo)[0].Points)
+	period := MilestoneRule{Type: MilestonePeriod, Period: PeriodWeek, Count: 250}
+	for day := 1; day < 5; day++ {
+		got := period.evaluate(&snapshots[day-1], &snapshots[day], intervals)
+		if day != 3 && len(got) != 0 {
+			t.Errorf("day %d: unexpected %+v", day, got)
+		}
+		if day == 3 && (len(got) != 1 || got[0].subject != "2024-07-01" || got[0].value != 300 ||
+			got[0].message != "owner/repo got 250 downloads in the week of 2024-07-01") {
+			t.Errorf("day %d: unexpected %+v", day, got)
+		}
+	}
+
+	// After a gap, 90 of the 120 downloads between 2024-07-03 and 2024-07-09
+	// fall into the week of 2024-07-01, which the later snapshot completes
+	gap := append(snapshots[:3:3], *alertSnapshot(8, 1320))
+	intervals = Intervals(ExtractSeries(gap, SeriesRepo)[0].Points)
+	if got := period.evaluate(&gap[2], &gap[3], intervals); len(got) != 1 || got[0].subject != "2024-07-01" || got[0].value != 290 {
+		t.Errorf("expected the week of 2024-07-01 to pass 250 after the gap, got %+v", got)
+	}
+}
+
+func TestMilestoneCount(t *testing.T) {
+	var rule MilestoneRule
+	if err := yaml.Unmarshal([]byte("{name: m, type: release, count: 100k, within: 168h}"), &rule); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if rule.Count != 100000 || rule.Within != 7*24*time.Hour || rule.validate(nil) != nil {
+		t.Errorf("unexpected rule %+v", rule)
+	}
+}
+
+func TestMilestoneTracker(t *testing.T) {
+	var received []Notification
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		received = append(received, n)
+	}))
+	defer srv.Close()
+
+	db := newTestDatabase(t)
+	tracker, err := NewMilestoneTracker(db, &Config{
+		Notifiers:  []NotifierConfig{{Name: "hook", Type: NotifierWebhook, URL: srv.URL}},
+		Milestones: []MilestoneRule{{Name: "1k", Type: MilestoneTotal, Every: 1000}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewMilestoneTracker failed: %v", err)
+	}
+
+	for day, n := range []int{1200, 1800, 2100, 2300, 3100} {
+		if err := db.StoreStats(alertSnapshot(day, n)); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+	// The first snapshot is already past 1k, but does not show it passing
+	passed, err := tracker.Evaluate("owner", "repo", time.Time{})
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if len(passed) != 2 || passed[0].Count != 2000 || passed[1].Count != 3000 || !passed[1].FetchedAt.Equal(alertStart.AddDate(0, 0, 4)) {
+		t.Fatalf("expected 2k and 3k, got %+v", passed)
+	}
+	latest, _ := db.GetLatestStats("owner", "repo")
+	if passed[1].SnapshotID != latest.SnapshotID || passed[1].Value != 3105 {
+		t.Errorf("expected 3k to be passed in snapshot %d, got %+v", latest.SnapshotID, passed[1])
+	}
+
+	// Milestones are returned until they are notified, and recorded once
+	if again, _ := tracker.Evaluate("owner", "repo", time.Time{}); len(again) != 2 {
+		t.Errorf("expected the milestones not notified yet, got %+v", again)
+	}
+	if err := tracker.MarkNotified(passed); err != nil {
+		t.Fatalf("MarkNotified failed: %v", err)
+	}
+	if passed, _ := tracker.Evaluate("owner", "repo", time.Time{}); len(passed) != 0 {
+		t.Errorf("expected milestones to be recorded once, got %+v", passed)
+	}
+	// Evaluating the newest snapshot only, as after a store
+	if err := db.StoreStats(alertSnapshot(5, 4000)); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+	passed, err = tracker.Evaluate("owner", "repo", alertStart.AddDate(0, 0, 5))
+	if err != nil || len(passed) != 1 || passed[0].Count != 4000 {
+		t.Fatalf("expected 4k, got %+v, %v", passed, err)
+	}
+	failing = true
+	if notified, err := tracker.Notify(context.Background(), passed); len(notified) != 0 || err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the notification to fail, got %+v, %v", notified, err)
+	}
+	failing = false
+	passed, err = tracker.Evaluate("owner", "repo", alertStart.AddDate(0, 0, 5))
+	if err != nil || len(passed) != 1 || passed[0].Count != 4000 {
+		t.Fatalf("expected 4k to be retried, got %+v, %v", passed, err)
+	}
+	notified, err := tracker.Notify(context.Background(), passed)
+	if err != nil || len(notified) != 1 {
+		t.Fatalf("Notify = %+v, %v", notified, err)
+	}
+	if err := tracker.MarkNotified(notified); err != nil {
+		t.Fatalf("MarkNotified failed: %v", err)
+	}
+	if passed, _ := tracker.Evaluate("owner", "repo", alertStart.AddDate(0, 0, 5)); len(passed) != 0 {
+		t.Errorf("expected 4k to be notified once, got %+v", passed)
+	}
+	if len(received) != 1 || received[0].Kind != "milestone" || received[0].Title != "🎉 owner/repo passed 4k downloads" || received[0].Labels["count"] != "4000" {
+		t.Errorf("unexpected notifications %+v", received)
+	}
+
+	listed, err := db.ListMilestones("owner", "repo", alertStart.AddDate(0, 0, 3))
+	if err != nil || len(listed) != 2 || listed[0].Count != 4000 {
+		t.Errorf("unexpected milestones %+v, %v", listed, err)
+	}
+	if listed, _ := db.ListMilestones("", "", time.Time{}); len(listed) != 3 {
+		t.Errorf("expected 3 milestones, got %+v", listed)
+	}
+}
+
+func TestMilestoneTrackerPeriodGap(t *testing.T) {
+	db := newTestDatabase(t)
+	tracker, err := NewMilestoneTracker(db, &Config{
+		Milestones: []MilestoneRule{{Name: "week", Type: MilestonePeriod, Count: 250}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewMilestoneTracker failed: %v", err)
+	}
+
+	for day, n := range []int{1000, 1100, 1200} {
+		if err := db.StoreStats(alertSnapshot(day, n)); err != nil {
+			t.Fatalf("StoreStats failed: %v", err)
+		}
+	}
+	if passed, err := tracker.Evaluate("owner", "repo", time.Time{}); err != nil || len(passed) != 0 {
+		t.Fatalf("expected no milestones yet, got %+v, %v", passed, err)
+	}
+
+	// Evaluating the snapshot after the gap, as after a store, completes
+	// the week before it
+	if err := db.StoreStats(alertSnapshot(8, 1320)); err != nil {
+		t.Fatalf("StoreStats failed: %v", err)
+	}
+	passed, err := tracker.Evaluate("owner", "repo", alertStart.AddDate(0, 0, 8))
+	if err != nil || len(passed) != 1 || passed[0].Subject != "2024-07-01" || passed[0].Value != 290 {
+		t.Fatalf("expected the week of 2024-07-01 to pass 250, got %+v, %v", passed, err)
+	}
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NotifierType selects the payload format a notifier posts.
+type NotifierType string
+
+const (
+	// NotifierWebhook posts the Notification itself as JSON.
+	NotifierWebhook NotifierType = "webhook"
+	// NotifierSlack posts to a Slack incoming webhook.
+	NotifierSlack NotifierType = "slack"
+	// NotifierDiscord posts to a Discord channel webhook.
+	NotifierDiscord NotifierType = "discord"
+	// NotifierTeams posts an Adaptive Card to a Microsoft Teams workflow
+	// webhook.
+	NotifierTeams NotifierType = "teams"
+)
+
+// NotifierConfig declares a webhook that notifications are posted to.
+// Webhook URLs embed their credentials, so URLEnv can name an environment
+// variable holding the URL instead.
+type NotifierConfig struct {
+	Name   string       `yaml:"name"`
+	Type   NotifierType `yaml:"type"`
+	URL    string       `yaml:"url"`
+	URLEnv string       `yaml:"url_env"`
+}
+
+// Notification statuses, which also pick the message colour.
+const (
+	NotificationFiring    = "firing"
+	NotificationResolved  = "resolved"
+	NotificationMilestone = "milestone"
+	NotificationInfo      = "info"
+)
+
+// Notification is a message about a repository, such as an alert that
+// started firing.
+type Notification struct {
+	// Kind names what sent the notification, e.g. "alert" or "milestone".
+	Kind   string    `json:"kind"`
+	Status string    `json:"status"`
+	Title  string    `json:"title"`
+	Text   string    `json:"text"`
+	Owner  string    `json:"owner"`
+	Repo   string    `json:"repo"`
+	Time   time.Time `json:"time"`
+	// Labels identify the event further, e.g. the rule and release tag.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// color returns the status colour as a hex RGB value.
+func (n Notification) color() int {
+	switch n.Status {
+	case NotificationFiring:
+		return 0xd73a49
+	case NotificationResolved:
+		return 0x28a745
+	case NotificationMilestone:
+		return 0x6f42c1
+	}
+	return 0x0366d6
+}
+
+// Notifier posts notifications to one webhook.
+type Notifier struct {
+	name   string
+	kind   NotifierType
+	url    string
+	client *http.Client
+}
+
+// NewNotifier returns the notifier for cfg. A nil client uses
+// http.DefaultClient.
+func NewNotifier(cfg NotifierConfig, client *http.Client) (*Notifier, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("notifier: missing name")
+	}
+	switch cfg.Type {
+	case NotifierWebhook, NotifierSlack, NotifierDiscord, NotifierTeams:
+	default:
+		return nil, fmt.Errorf("notifier %s: unknown type %q (want webhook, slack, discord or teams)", cfg.Name, cfg.Type)
+	}
+	// The URL may come from an environment variable that is only set where
+	// notifications are sent, so only a URL given inline is checked
+	if cfg.URL != "" {
+		if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("notifier %s: invalid URL (want an http(s) URL)", cfg.Name)
+		}
+	} else if cfg.URLEnv == "" {
+		return nil, fmt.Errorf("notifier %s: missing url or url_env", cfg.Name)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Notifier{name: cfg.Name, kind: cfg.Type, url: tokenValue(cfg.URL, cfg.URLEnv), client: client}, nil
+}
+
+// String describes the notifier without its URL.
+func (n *Notifier) String() string {
+	return n.name + " (" + string(n.kind) + ")"
+}
+
+// Notify posts msg in the notifier's payload format.
+func (n *Notifier) Notify(ctx context.Context, msg Notification) error {
+	if n.url == "" {
+		return fmt.Errorf("failed to notify %s: no URL set", n)
+	}
+	body, err := json.Marshal(n.payload(msg))
+	if err != nil {
+		return fmt.Errorf("failed to notify %s: %w", n, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to notify %s: %w", n, unwrapURLError(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The *url.Error quotes the URL, which holds the webhook's
+		// credentials
+		return fmt.Errorf("failed to notify %s: %w", n, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to notify %s: %s: %s", n, resp.Status, strings.TrimSpace(string(text)))
+	}
+	return nil
+}
+
+// payload builds the request body for the notifier's type.
+func (n *Notifier) payload(msg Notification) any {
+	source := "git-download-stats"
+	if msg.Owner != "" {
+		source = msg.Owner + "/" + msg.Repo
+	}
+	color := fmt.Sprintf("#%06x", msg.color())
+
+	switch n.kind {
+	case NotifierSlack:
+		return map[string]any{
+			"text": msg.Title,
+			"attachments": []map[string]any{{
+				"color":  color,
+				"title":  msg.Title,
+				"text":   msg.Text,
+				"footer": source,
+				"ts":     msg.Time.Unix(),
+			}},
+		}
+	case NotifierDiscord:
+		return map[string]any{
+			"embeds": []map[string]any{{
+				"title":       msg.Title,
+				"description": msg.Text,
+				"color":       msg.color(),
+				"timestamp":   msg.Time.UTC().Format(time.RFC3339),
+				"footer":      map[string]string{"text": source},
+			}},
+		}
+	case NotifierTeams:
+		return map[string]any{
+			"type": "message",
+			"attachments": []map[string]any{{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []map[string]any{
+						{"type": "TextBlock", "text": msg.Title, "weight": "Bolder", "size": "Medium", "wrap": true, "color": teamsColor(msg.Status)},
+						{"type": "TextBlock", "text": msg.Text, "wrap": true},
+						{"type": "TextBlock", "text": source + " · " + msg.Time.UTC().Format("2006-01-02 15:04 UTC"), "isSubtle": true, "spacing": "Small"},
+					},
+				},
+			}},
+		}
+	}
+	return msg
+}
+
+// teamsColor maps a status onto an Adaptive Card text colour.
+func teamsColor(status string) string {
+	switch status {
+	case NotificationFiring:
+		return "Attention"
+	case NotificationResolved:
+		return "Good"
+	}
+	return "Accent"
+}
+
+// NewNotifiers returns the configured notifiers by name.
+func NewNotifiers(configs []NotifierConfig, client *http.Client) (map[string]*Notifier, error) {
+	notifiers := make(map[string]*Notifier, len(configs))
+	for _, cfg := range configs {
+		n, err := NewNotifier(cfg, client)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := notifiers[cfg.Name]; ok {
+			return nil, fmt.Errorf("notifier %s: duplicate name", cfg.Name)
+		}
+		notifiers[cfg.Name] = n
+	}
+	return notifiers, nil
+}
@@ -0,0 +1,538 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Unknown is the OS, architecture or package of an asset that no rule
+// recognises.
+const Unknown = "unknown"
+
+// Platform is what an asset was built for, derived from its name.
+type Platform struct {
+	OS      string `json:"os" yaml:"os"`
+	Arch    string `json:"arch" yaml:"arch"`
+	Package string `json:"package" yaml:"package"`
+}
+
+// PlatformRule classifies assets whose name matches a regular expression.
+// OS, Arch and Package may reference capture groups ("$1", "${os}"); when
+// empty, a named group "os", "arch" or "package" is used instead. Fields a
+// rule leaves empty fall back to the built-in rules.
+type PlatformRule struct {
+	Match   string `yaml:"match"`
+	OS      string `yaml:"os"`
+	Arch    string `yaml:"arch"`
+	Package string `yaml:"package"`
+}
+
+type compiledPlatformRule struct {
+	PlatformRule
+	re *regexp.Regexp
+}
+
+// PlatformClassifier classifies asset names using user rules followed by
+// built-in rules for goreleaser-style names and common package formats.
+type PlatformClassifier struct {
+	rules []compiledPlatformRule
+}
+
+// NewPlatformClassifier compiles user rules, which take precedence over the
+// built-in rules in the order given.
+func NewPlatformClassifier(rules []PlatformRule) (*PlatformClassifier, error) {
+	c := &PlatformClassifier{}
+	for _, r := range rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform rule %q: %w", r.Match, err)
+		}
+		c.rules = append(c.rules, compiledPlatformRule{PlatformRule: r, re: re})
+	}
+	return c, nil
+}
+
+// alias maps spellings found in asset names to a canonical name.
+type alias struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// token matches alternatives delimited by the start or end of the name or
+// by a non-alphanumeric character, so "arm" does not match inside "charm".
+func token(alternatives string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|[^a-z0-9])(?:` + alternatives + `)(?:$|[^a-z0-9])`)
+}
+
+// Order matters: more specific spellings come first.
+var osAliases = []alias{
+	{"linux", token(`linux`)},
+	{"macos", token(`darwin|macos|macosx|osx|mac|apple`)},
+	{"windows", token(`windows|win|win32|win64|mingw\w*|msvc`)},
+	{"freebsd", token(`freebsd`)},
+	{"openbsd", token(`openbsd`)},
+	{"netbsd", token(`netbsd`)},
+	{"android", token(`android`)},
+	{"ios", token(`ios`)},
+	{"solaris", token(`solaris|sunos`)},
+	{"illumos", token(`illumos`)},
+	{"aix", token(`aix`)},
+}
+
+var archAliases = []alias{
+	{"amd64", token(`amd64|x86_64|x86-64|x64|win64|64bit|64-bit`)},
+	{"arm64", token(`arm64|aarch64|armv8[a-z0-9]*`)},
+	{"arm", token(`armv[5-7][a-z0-9]*|armhf|armel|arm`)},
+	{"386", token(`386|i386|i686|x86|win32|32bit|32-bit|ia32`)},
+	{"ppc64le", token(`ppc64le|ppc64el`)},
+	{"ppc64", token(`ppc64`)},
+	{"s390x", token(`s390x`)},
+	{"riscv64", token(`riscv64`)},
+	{"mips64le", token(`mips64le|mips64el`)},
+	{"mips64", token(`mips64`)},
+	{"mipsle", token(`mipsle|mipsel`)},
+	{"mips", token(`mips`)},
+	{"loong64", token(`loong64|loongarch64`)},
+	{"wasm", token(`wasm|wasm32`)},
+	{"universal", token(`universal|all|noarch`)},
+}
+
+// packageSuffixes maps file extensions to a package type and, for formats
+// tied to one operating system, that OS.
+var packageSuffixes = []struct {
+	suffix, pkg, os string
+}{
+	{".tar.gz", "tar.gz", ""},
+	{".tgz", "tar.gz", ""},
+	{".tar.xz", "tar.xz", ""},
+	{".tar.bz2", "tar.bz2", ""},
+	{".tar.zst", "tar.zst", ""},
+	{".zip", "zip", ""},
+	{".7z", "7z", ""},
+	{".deb", "deb", "linux"},
+	{".rpm", "rpm", "linux"},
+	{".apk", "apk", ""},
+	{".appimage", "appimage", "linux"},
+	{".snap", "snap", "linux"},
+	{".flatpak", "flatpak", "linux"},
+	{".msi", "msi", "windows"},
+	{".msix", "msix", "windows"},
+	{".exe", "exe", "windows"},
+	{".dmg", "dmg", "macos"},
+	{".pkg", "pkg", "macos"},
+	{".jar", "jar", ""},
+	{".whl", "wheel", ""},
+	{".nupkg", "nupkg", ""},
+	{".gem", "gem", ""},
+}
+
+// Classify returns the platform of an asset name.
+func (c *PlatformClassifier) Classify(name string) Platform {
+	var p Platform
+	if c != nil {
+		for _, r := range c.rules {
+			m := r.re.FindStringSubmatchIndex(name)
+			if m == nil {
+				continue
+			}
+			p.OS = r.expand(r.OS, "os", name, m)
+			p.Arch = r.expand(r.Arch, "arch", name, m)
+			p.Package = r.expand(r.Package, "package", name, m)
+			break
+		}
+	}
+
+	builtin := classifyPlatform(name)
+	if p.OS == "" {
+		p.OS = builtin.OS
+	}
+	if p.Arch == "" {
+		p.Arch = builtin.Arch
+	}
+	if p.Package == "" {
+		p.Package = builtin.Package
+	}
+	return p
+}
+
+func (r compiledPlatformRule) expand(template, group, name string, match []int) string {
+	if template == "" {
+		if r.re.SubexpIndex(group) < 0 {
+			return ""
+		}
+		template = "${" + group + "}"
+	}
+	return strings.ToLower(string(r.re.ExpandString(nil, template, name, match)))
+}
+
+// classifyPlatform applies the built-in rules.
+func classifyPlatform(name string) Platform {
+	lower := strings.ToLower(name)
+	p := Platform{OS: Unknown, Arch: Unknown, Package: Unknown}
+
+	stem := lower
+	for _, s := range packageSuffixes {
+		if strings.HasSuffix(lower, s.suffix) {
+			p.Package = s.pkg
+			if s.os != "" {
+				p.OS = s.os
+			}
+			stem = strings.TrimSuffix(lower, s.suffix)
+			break
+		}
+	}
+
+	for _, a := range osAliases {
+		if a.re.MatchString(stem) {
+			p.OS = a.name
+			break
+		}
+	}
+	for _, a := range archAliases {
+		if a.re.MatchString(stem) {
+			p.Arch = a.name
+			break
+		}
+	}
+
+	// A bare executable such as tool-linux-amd64 has no extension after its
+	// last name component
+	last := stem[strings.LastIndexAny(stem, "_-")+1:]
+	if p.Package == Unknown && p.OS != Unknown && !strings.Contains(last, ".") {
+		p.Package = "binary"
+	}
+	return p
+}
+
+// PlatformDimension selects how assets are grouped in a platform breakdown.
+type PlatformDimension string
+
+const (
+	DimensionOS       PlatformDimension = "os"
+	DimensionArch     PlatformDimension = "arch"
+	DimensionPackage  PlatformDimension = "package"
+	DimensionPlatform PlatformDimension = "platform"
+)
+
+// ParsePlatformDimension validates a dimension name.
+func ParsePlatformDimension(s string) (PlatformDimension, error) {
+	switch d := PlatformDimension(s); d {
+	case DimensionOS, DimensionArch, DimensionPackage, DimensionPlatform:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown dimension %q (want os, arch, package or platform)", s)
+}
+
+// Key returns the bucket of p for the dimension; platform is "os/arch".
+func (d PlatformDimension) Key(p Platform) string {
+	switch d {
+	case DimensionArch:
+		return p.Arch
+	case DimensionPackage:
+		return p.Package
+	case DimensionPlatform:
+		return p.OS + "/" + p.Arch
+	}
+	return p.OS
+}
+
+// PlatformBucket is the downloads of every asset in one bucket.
+type PlatformBucket struct {
+	Name      string  `json:"name" yaml:"name"`
+	Assets    int     `json:"assets" yaml:"assets"`
+	Downloads int     `json:"downloads" yaml:"downloads"`
+	Share     float64 `json:"share_percent" yaml:"share_percent"`
+	// Growth is the increase between the oldest and newest snapshot.
+	Growth        int     `json:"growth" yaml:"growth"`
+	GrowthShare   float64 `json:"growth_share_percent" yaml:"growth_share_percent"`
+	GrowthPercent float64 `json:"growth_percent" yaml:"growth_percent"`
+}
+
+// PlatformPeriod is the downloads per bucket in one period.
+type PlatformPeriod struct {
+	Start     time.Time          `json:"start" yaml:"start"`
+	Downloads map[string]float64 `json:"downloads" yaml:"downloads"`
+}
+
+// PlatformReport renders the platforms command.
+type PlatformReport struct {
+	Owner    string            `json:"owner" yaml:"owner"`
+	Repo     string            `json:"repo" yaml:"repo"`
+	By       PlatformDimension `json:"by" yaml:"by"`
+	Oldest   SnapshotTotal     `json:"oldest" yaml:"oldest"`
+	Newest   SnapshotTotal     `json:"newest" yaml:"newest"`
+	Period   TrendPeriod       `json:"period" yaml:"period"`
+	Buckets  []PlatformBucket  `json:"buckets" yaml:"buckets"`
+	Timeline []PlatformPeriod  `json:"timeline" yaml:"timeline"`
+	Charts   ChartStyle        `json:"-" yaml:"-"`
+}
+
+// SetChartStyle enables stacked bars of the share of each bucket.
+func (r *PlatformReport) SetChartStyle(s ChartStyle) {
+	r.Charts = s
+}
+
+// platformKeys returns a function mapping asset names to their bucket.
+// Names repeat across releases and snapshots, so each is classified once.
+func platformKeys(classifier *PlatformClassifier, by PlatformDimension) func(string) string {
+	keys := make(map[string]string)
+	return func(name string) string {
+		k, ok := keys[name]
+		if !ok {
+			k = by.Key(classifier.Classify(name))
+			keys[name] = k
+		}
+		return k
+	}
+}
+
+// platformPoints sums artifact downloads per bucket in each snapshot.
+// Buckets whose assets appear after the oldest snapshot start from zero in
+// it, so their downloads count as growth. Snapshots must be ordered oldest
+// first.
+func platformPoints(ordered []ReleaseStats, keyOf func(string) string) map[string][]Point {
+	series := make(map[string][]Point)
+	for _, snap := range ordered {
+		totals := make(map[string]float64)
+		for _, rel := range snap.Releases {
+			for _, asset := range rel.Assets {
+				if asset.Kind.Auxiliary() {
+					continue
+				}
+				totals[keyOf(asset.Name)] += float64(asset.DownloadCount)
+			}
+		}
+		for k, v := range totals {
+			if _, ok := series[k]; !ok && !snap.FetchedAt.Equal(ordered[0].FetchedAt) {
+				series[k] = []Point{{Time: ordered[0].FetchedAt}}
+			}
+			series[k] = append(series[k], Point{Time: snap.FetchedAt, Value: v})
+		}
+	}
+	return series
+}
+
+// PlatformSeries returns the cumulative artifact downloads of each bucket
+// across snapshots, ordered by latest downloads, largest first.
+func PlatformSeries(snapshots []ReleaseStats, classifier *PlatformClassifier, by PlatformDimension) []Series {
+	ordered := make([]ReleaseStats, len(snapshots))
+	copy(ordered, snapshots)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].FetchedAt.Before(ordered[j].FetchedAt) })
+
+	out := make([]Series, 0)
+	for key, points := range platformPoints(ordered, platformKeys(classifier, by)) {
+		out = append(out, Series{Key: key, Points: points})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Latest() != out[j].Latest() {
+			return out[i].Latest() > out[j].Latest()
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// NewPlatformReport aggregates artifact downloads across releases into
+// platform buckets, with growth between the oldest and newest snapshot and
+// downloads per period in between.
+func NewPlatformReport(owner, repo string, snapshots []ReleaseStats, classifier *PlatformClassifier, by PlatformDimension, period TrendPeriod) *PlatformReport {
+	report := &PlatformReport{
+		Owner:    owner,
+		Repo:     repo,
+		By:       by,
+		Period:   period,
+		Buckets:  make([]PlatformBucket, 0),
+		Timeline: make([]PlatformPeriod, 0),
+	}
+	if len(snapshots) == 0 {
+		return report
+	}
+
+	ordered := make([]ReleaseStats, len(snapshots))
+	copy(ordered, snapshots)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].FetchedAt.Before(ordered[j].FetchedAt) })
+	oldest, newest := ordered[0], ordered[len(ordered)-1]
+	report.Oldest = snapshotTotal(&oldest)
+	report.Newest = snapshotTotal(&newest)
+
+	keyOf := platformKeys(classifier, by)
+	series := platformPoints(ordered, keyOf)
+
+	buckets := make(map[string]*PlatformBucket)
+	bucket := func(name string) *PlatformBucket {
+		b, ok := buckets[name]
+		if !ok {
+			b = &PlatformBucket{Name: name}
+			buckets[name] = b
+		}
+		return b
+	}
+	var total, growth int
+	for _, rel := range newest.Releases {
+		for _, asset := range rel.Assets {
+			if asset.Kind.Auxiliary() {
+				continue
+			}
+			b := bucket(keyOf(asset.Name))
+			b.Assets++
+			b.Downloads += asset.DownloadCount
+			total += asset.DownloadCount
+		}
+	}
+	for name := range series {
+		b := bucket(name)
+		var base int
+		for _, p := range series[name] {
+			if p.Time.Equal(oldest.FetchedAt) {
+				base = int(p.Value)
+			}
+		}
+		b.Growth = b.Downloads - base
+		b.GrowthPercent = percentOf(b.Growth, base)
+		growth += b.Growth
+	}
+
+	for _, b := range buckets {
+		b.Share = percentOf(b.Downloads, total)
+		b.GrowthShare = percentOf(b.Growth, growth)
+		report.Buckets = append(report.Buckets, *b)
+	}
+	sort.Slice(report.Buckets, func(i, j int) bool {
+		if report.Buckets[i].Downloads != report.Buckets[j].Downloads {
+			return report.Buckets[i].Downloads > report.Buckets[j].Downloads
+		}
+		return report.Buckets[i].Name < report.Buckets[j].Name
+	})
+
+	periods := make(map[time.Time]*PlatformPeriod)
+	for name, points := range series {
+		for _, b := range Bucketize(points, period, 1) {
+			p, ok := periods[b.Start]
+			if !ok {
+				p = &PlatformPeriod{Start: b.Start, Downloads: make(map[string]float64)}
+				periods[b.Start] = p
+			}
+			p.Downloads[name] = b.Downloads
+		}
+	}
+	for _, p := range periods {
+		// Every period lists every bucket, including those without downloads
+		for name := range buckets {
+			if _, ok := p.Downloads[name]; !ok {
+				p.Downloads[name] = 0
+			}
+		}
+		report.Timeline = append(report.Timeline, *p)
+	}
+	sort.Slice(report.Timeline, func(i, j int) bool { return report.Timeline[i].Start.Before(report.Timeline[j].Start) })
+
+	return report
+}
+
+// WriteText writes the bucket table followed by downloads per period.
+func (r *PlatformReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nPlatform Breakdown for %s/%s (by %s)\n", r.Owner, r.Repo, r.By)
+	fmt.Fprintf(out, "Oldest: %s | Newest: %s\n\n", r.Oldest.FetchedAt.Format("2006-01-02"), r.Newest.FetchedAt.Format("2006-01-02"))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s\tASSETS\tDOWNLOADS\tSHARE\tGROWTH\tGROWTH SHARE\tGROWTH %%\t\n", strings.ToUpper(string(r.By)))
+	for _, b := range r.Buckets {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%+d\t%.1f%%\t%+.1f%%\t\n", b.Name, b.Assets, b.Downloads, b.Share, b.Growth, b.GrowthShare, b.GrowthPercent)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if r.Charts.Enabled() {
+		r.writeShareChart(out)
+	}
+
+	if len(r.Timeline) > 0 {
+		fmt.Fprintf(out, "\nDownloads per %s:\n", r.Period)
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprint(w, "PERIOD\t")
+		for _, b := range r.Buckets {
+			fmt.Fprintf(w, "%s\t", b.Name)
+		}
+		fmt.Fprintln(w)
+		for _, p := range r.Timeline {
+			fmt.Fprintf(w, "%s\t", p.Start.Format("2006-01-02"))
+			for _, b := range r.Buckets {
+				fmt.Fprintf(w, "%.0f\t", math.Round(p.Downloads[b.Name]))
+			}
+			fmt.Fprintln(w)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// maxStackedBuckets is the number of buckets drawn as their own segment;
+// smaller buckets are merged into "other".
+const maxStackedBuckets = 7
+
+// writeShareChart draws the share of each bucket in the newest snapshot and
+// in the downloads of each period as stacked bars, with a legend.
+func (r *PlatformReport) writeShareChart(out io.Writer) {
+	segments := min(len(r.Buckets), maxStackedBuckets)
+	parts := func(value func(name string) float64) []float64 {
+		p := make([]float64, segments)
+		for i, b := range r.Buckets {
+			p[min(i, segments-1)] += value(b.Name)
+		}
+		return p
+	}
+
+	downloads := make(map[string]float64, len(r.Buckets))
+	for _, b := range r.Buckets {
+		downloads[b.Name] = float64(b.Downloads)
+	}
+	width := r.Charts.span(14, 10)
+	ascii := r.Charts.ASCII
+
+	fmt.Fprintf(out, "\nShare:\n")
+	fmt.Fprintf(out, "  %-10s  %s\n", "total", StackedBar(parts(func(name string) float64 { return downloads[name] }), width, ascii))
+	for _, p := range r.Timeline {
+		bar := StackedBar(parts(func(name string) float64 { return p.Downloads[name] }), width, ascii)
+		fmt.Fprintf(out, "  %-10s  %s\n", p.Start.Format("2006-01-02"), bar)
+	}
+
+	legend := make([]string, 0, segments)
+	for i, b := range r.Buckets {
+		if i == segments-1 && len(r.Buckets) > segments {
+			legend = append(legend, StackFill(i, ascii)+" other")
+			break
+		}
+		legend = append(legend, fmt.Sprintf("%s %s %.1f%%", StackFill(i, ascii), b.Name, b.Share))
+	}
+	fmt.Fprintf(out, "  %s\n", strings.Join(legend, "  "))
+}
+
+// Table returns one row per bucket.
+func (r *PlatformReport) Table() ([]string, [][]string) {
+	header := []string{string(r.By), "assets", "downloads", "share_percent", "growth", "growth_share_percent", "growth_percent"}
+	rows := make([][]string, 0, len(r.Buckets))
+	for _, b := range r.Buckets {
+		rows = append(rows, []string{
+			b.Name,
+			strconv.Itoa(b.Assets),
+			strconv.Itoa(b.Downloads),
+			strconv.FormatFloat(b.Share, 'f', 2, 64),
+			strconv.Itoa(b.Growth),
+			strconv.FormatFloat(b.GrowthShare, 'f', 2, 64),
+			strconv.FormatFloat(b.GrowthPercent, 'f', 2, 64),
+		})
+	}
+	return header, rows
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClassifyPlatform(t *testing.T) {
+	tests := map[string]Platform{
+		"tool_2.1.0_linux_arm64.tar.gz":           {OS: "linux", Arch: "arm64", Package: "tar.gz"},
+		"tool_2.1.0_Darwin_x86_64.tar.gz":         {OS: "macos", Arch: "amd64", Package: "tar.gz"},
+		"tool_2.1.0_windows_386.zip":              {OS: "windows", Arch: "386", Package: "zip"},
+		"tool_2.1.0_linux_armv7.deb":              {OS: "linux", Arch: "arm", Package: "deb"},
+		"tool-2.1.0-1.aarch64.rpm":                {OS: "linux", Arch: "arm64", Package: "rpm"},
+		"tool-2.1.0-x64.msi":                      {OS: "windows", Arch: "amd64", Package: "msi"},
+		"Tool-2.1.0-universal.dmg":                {OS: "macos", Arch: "universal", Package: "dmg"},
+		"tool-linux-amd64":                        {OS: "linux", Arch: "amd64", Package: "binary"},
+		"tool-x86_64-unknown-linux-musl.tar.gz":   {OS: "linux", Arch: "amd64", Package: "tar.gz"},
+		"checksums.txt":                           {OS: Unknown, Arch: Unknown, Package: Unknown},
+		"charm_1.0.0_freebsd_riscv64.tar.gz":      {OS: "freebsd", Arch: "riscv64", Package: "tar.gz"},
+		"tool_2.1.0_linux_amd64.tar.gz.sbom.json": {OS: "linux", Arch: "amd64", Package: Unknown},
+	}
+
+	var classifier *PlatformClassifier
+	for name, want := range tests {
+		if got := classifier.Classify(name); got != want {
+			t.Errorf("Classify(%q) = %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestPlatformRules(t *testing.T) {
+	classifier, err := NewPlatformClassifier([]PlatformRule{
+		{Match: `^mytool-(?P<os>[A-Za-z]+)-(?P<arch>[a-z0-9]+)\.bin$`, Package: "bin"},
+		{Match: `-steamdeck\.`, OS: "linux", Arch: "amd64"},
+	})
+	if err != nil {
+		t.Fatalf("failed to compile rules: %v", err)
+	}
+
+	if got := classifier.Classify("mytool-Haiku-x86.bin"); got != (Platform{OS: "haiku", Arch: "x86", Package: "bin"}) {
+		t.Errorf("named groups not applied: %+v", got)
+	}
+	// Fields a rule leaves empty fall back to the built-in rules
+	if got := classifier.Classify("game-steamdeck.zip"); got != (Platform{OS: "linux", Arch: "amd64", Package: "zip"}) {
+		t.Errorf("fixed values not applied: %+v", got)
+	}
+
+	if _, err := NewPlatformClassifier([]PlatformRule{{Match: "("}}); err == nil {
+		t.Error("expected an error for an invalid rule")
+	}
+}
+
+func TestNewPlatformReport(t *testing.T) {
+	snapshot := func(day, linux, windows int) ReleaseStats {
+		return ReleaseStats{
+			Owner:     "owner",
+			Repo:      "repo",
+			FetchedAt: time.Date(2024, 3, 4+day, 0, 0, 0, 0, time.UTC),
+			Releases: []Release{{
+				Tag: "v1.0.0",
+				Assets: []Asset{
+					{Name: "tool_1.0.0_linux_amd64.tar.gz", DownloadCount: linux},
+					{Name: "tool_1.0.0_windows_amd64.zip", DownloadCount: windows},
+				},
+			}},
+		}
+	}
+	// Newest first, as returned by the database
+	snapshots := []ReleaseStats{snapshot(7, 300, 150), snapshot(0, 100, 100)}
+
+	report := NewPlatformReport("owner", "repo", snapshots, nil, DimensionOS, PeriodWeek)
+
+	if len(report.Buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %+v", report.Buckets)
+	}
+	linux, windows := report.Buckets[0], report.Buckets[1]
+	if linux.Name != "linux" || linux.Downloads != 300 || linux.Growth != 200 || linux.GrowthPercent != 200 {
+		t.Errorf("unexpected linux bucket: %+v", linux)
+	}
+	if windows.Name != "windows" || windows.Growth != 50 || math.Abs(windows.Share-100.0/3) > 1e-9 {
+		t.Errorf("unexpected windows bucket: %+v", windows)
+	}
+	if linux.GrowthShare != 80 {
+		t.Errorf("expected linux to account for 80%% of growth, got %v", linux.GrowthShare)
+	}
+	if len(report.Timeline) != 1 || report.Timeline[0].Downloads["linux"] != 200 {
+		t.Errorf("unexpected timeline: %+v", report.Timeline)
+	}
+
+	// macOS assets are first uploaded in the second week: their growth is in
+	// the timeline, and every week lists every bucket
+	third := snapshot(14, 400, 200)
+	third.Releases[0].Assets = append(third.Releases[0].Assets, Asset{Name: "tool_1.0.0_darwin_arm64.tar.gz", DownloadCount: 70})
+	report = NewPlatformReport("owner", "repo", append([]ReleaseStats{third}, snapshots...), nil, DimensionOS, PeriodWeek)
+	if len(report.Timeline) != 2 {
+		t.Fatalf("expected 2 weeks, got %+v", report.Timeline)
+	}
+	var timeline float64
+	for _, p := range report.Timeline {
+		if len(p.Downloads) != 3 {
+			t.Errorf("expected every bucket in %s, got %v", p.Start.Format("2006-01-02"), p.Downloads)
+		}
+		timeline += p.Downloads["macos"]
+	}
+	for _, b := range report.Buckets {
+		if b.Name == "macos" && (b.Growth != 70 || math.Abs(timeline-70) > 1e-9) {
+			t.Errorf("expected macos growth of 70 in the buckets and timeline, got %+v and %v", b, timeline)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Project is a repository on the watchlist stored in the database.
+type Project struct {
+	Owner        string    `json:"owner" yaml:"owner"`
+	Repo         string    `json:"repo" yaml:"repo"`
+	Group        string    `json:"group,omitempty" yaml:"group,omitempty"`
+	Interval     string    `json:"interval,omitempty" yaml:"interval,omitempty"`
+	AddedAt      time.Time `json:"added_at" yaml:"added_at"`
+	FirstFetchAt time.Time `json:"first_fetch_at,omitzero" yaml:"first_fetch_at,omitempty"`
+	LastFetchAt  time.Time `json:"last_fetch_at,omitzero" yaml:"last_fetch_at,omitempty"`
+	LastError    string    `json:"last_error,omitempty" yaml:"last_error,omitempty"`
+	LastErrorAt  time.Time `json:"last_error_at,omitzero" yaml:"last_error_at,omitempty"`
+}
+
+// TrackProject adds a repository to the watchlist. Tracking a repository
+// again updates its group and interval but keeps its fetch history.
+func (d *Database) TrackProject(owner, repo, group, interval string) error {
+	_, err := d.db.Exec(
+		`INSERT INTO projects (owner, repo, group_name, interval, added_at)
+		 VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (owner, repo) DO UPDATE SET
+			group_name = excluded.group_name,
+			interval = excluded.interval`,
+		owner, repo, group, interval, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to track project: %w", err)
+	}
+	return nil
+}
+
+// UntrackProject removes a repository from the watchlist. Stored statistics
+// are kept. It reports whether the repository was tracked.
+func (d *Database) UntrackProject(owner, repo string) (bool, error) {
+	res, err := d.db.Exec(`DELETE FROM projects WHERE owner = ? AND repo = ?`, owner, repo)
+	if err != nil {
+		return false, fmt.Errorf("failed to untrack project: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to untrack project: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListProjects returns the watchlist ordered by owner and repo, restricted to
+// group when it is not empty.
+func (d *Database) ListProjects(group string) ([]Project, error) {
+	rows, err := d.db.Query(
+		`SELECT owner, repo, group_name, interval, added_at, first_fetch_at, last_fetch_at, last_error, last_error_at
+		 FROM projects
+		 WHERE ? = '' OR group_name = ?
+		 ORDER BY owner, repo`,
+		group, group,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := make([]Project, 0)
+	for rows.Next() {
+		var p Project
+		var first, last, errAt sql.NullTime
+		if err := rows.Scan(&p.Owner, &p.Repo, &p.Group, &p.Interval, &p.AddedAt, &first, &last, &p.LastError, &errAt); err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		p.FirstFetchAt = first.Time
+		p.LastFetchAt = last.Time
+		p.LastErrorAt = errAt.Time
+		projects = append(projects, p)
+	}
+
+	return projects, rows.Err()
+}
+
+// RecordFetch updates the watchlist entry for owner/repo after a fetch. A
+// nil fetchErr records a successful fetch and clears the last error.
+// Repositories that are not tracked are ignored.
+func (d *Database) RecordFetch(owner, repo string, at time.Time, fetchErr error) error {
+	var err error
+	if fetchErr == nil {
+		_, err = d.db.Exec(
+			`UPDATE projects SET
+				first_fetch_at = COALESCE(first_fetch_at, ?),
+				last_fetch_at = ?,
+				last_error = '',
+				last_error_at = NULL
+			 WHERE owner = ? AND repo = ?`,
+			at, at, owner, repo,
+		)
+	} else {
+		_, err = d.db.Exec(
+			`UPDATE projects SET last_error = ?, last_error_at = ?
+			 WHERE owner = ? AND repo = ?`,
+			fetchErr.Error(), at, owner, repo,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record fetch: %w", err)
+	}
+	return nil
+}
+
+// ProjectsReport renders the watchlist.
+type ProjectsReport struct {
+	Projects []Project `json:"projects" yaml:"projects"`
+}
+
+// WriteText writes the watchlist as an aligned table.
+func (r *ProjectsReport) WriteText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tGROUP\tINTERVAL\tFIRST FETCH\tLAST FETCH\tLAST ERROR")
+	fmt.Fprintln(w, "---\t---\t---\t---\t---\t---")
+	for _, p := range r.Projects {
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Owner, p.Repo,
+			orDash(p.Group),
+			orDash(p.Interval),
+			formatOptionalTime(p.FirstFetchAt),
+			formatOptionalTime(p.LastFetchAt),
+			orDash(p.LastError),
+		)
+	}
+	return w.Flush()
+}
+
+// Table returns one row per tracked repository.
+func (r *ProjectsReport) Table() ([]string, [][]string) {
+	header := []string{"owner", "repo", "group", "interval", "added_at", "first_fetch_at", "last_fetch_at", "last_error", "last_error_at"}
+	rows := make([][]string, 0, len(r.Projects))
+	for _, p := range r.Projects {
+		rows = append(rows, []string{
+			p.Owner, p.Repo, p.Group, p.Interval,
+			p.AddedAt.Format(time.RFC3339),
+			formatRFC3339(p.FirstFetchAt),
+			formatRFC3339(p.LastFetchAt),
+			p.LastError,
+			formatRFC3339(p.LastErrorAt),
+		})
+	}
+	return header, rows
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func formatRFC3339(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,363 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pushBatchLines is the number of lines sent per InfluxDB write request.
+const pushBatchLines = 5000
+
+// pushTimeout bounds a Graphite or OpenTSDB push when the HTTP client given
+// to NewPushSink has no timeout.
+const pushTimeout = time.Minute
+
+// pushCredentials are the query parameters of InfluxDB write URLs that carry
+// credentials, such as the user and password of InfluxDB 1.x.
+var pushCredentials = []string{"u", "p", "password", "token"}
+
+// PushTarget is a time-series database that snapshots are pushed to. The
+// URL scheme selects the protocol:
+//
+//	http(s)://host:8086/api/v2/write?org=o&bucket=b   InfluxDB 2.x line protocol
+//	http(s)://host:8086/write?db=d                    InfluxDB 1.x line protocol
+//	graphite://host:2003                              Graphite plaintext over TCP
+//	opentsdb://host:4242                              OpenTSDB telnet put over TCP
+//
+// Releases, Tag, Assets and MaxSeries select series as the --metrics-*
+// flags do for /metrics.
+type PushTarget struct {
+	URL string `yaml:"url"`
+	// Token is sent as "Authorization: Token ..." to InfluxDB.
+	Token    string `yaml:"token"`
+	TokenEnv string `yaml:"token_env"`
+	// Prefix starts every Graphite path and OpenTSDB metric name
+	// (default: github).
+	Prefix    string `yaml:"prefix"`
+	Releases  int    `yaml:"releases"`
+	Tag       string `yaml:"tag"`
+	Assets    string `yaml:"assets"`
+	MaxSeries int    `yaml:"max_series"`
+}
+
+// Options returns the series selection of the target.
+func (t PushTarget) Options() (MetricsOptions, error) {
+	if t.Tag != "" {
+		if _, err := path.Match(t.Tag, ""); err != nil {
+			return MetricsOptions{}, fmt.Errorf("invalid tag pattern %q: %w", t.Tag, err)
+		}
+	}
+	assets, err := ParseAssetLabels(t.Assets)
+	if err != nil {
+		return MetricsOptions{}, err
+	}
+	return MetricsOptions{TagGlob: t.Tag, Releases: t.Releases, Assets: assets, MaxAssetSeries: t.MaxSeries}, nil
+}
+
+// PushPoint is one download count at a snapshot's fetch time. Repository
+// totals have no Tag; release totals have no Asset, OS or Arch; assets
+// summed per platform have OS and Arch but no Asset.
+type PushPoint struct {
+	Time      time.Time
+	Owner     string
+	Repo      string
+	Tag       string
+	Asset     string
+	OS        string
+	Arch      string
+	Downloads int
+}
+
+// level names what the point counts: repo, release or asset.
+func (p PushPoint) level() string {
+	switch {
+	case p.Tag == "":
+		return "repo"
+	case p.Asset == "" && p.OS == "":
+		return "release"
+	}
+	return "asset"
+}
+
+// SnapshotPoints converts a snapshot into points timestamped with its
+// FetchedAt: the repository total, then every selected release followed by
+// its selected assets.
+func SnapshotPoints(stats *ReleaseStats, classifier *PlatformClassifier, opts MetricsOptions) ([]PushPoint, error) {
+	sel, err := opts.selectDownloads(stats, classifier)
+	if err != nil {
+		return nil, err
+	}
+
+	base := PushPoint{Time: stats.FetchedAt, Owner: stats.Owner, Repo: stats.Repo}
+	points := make([]PushPoint, 0, 1+len(sel.releases)+len(sel.assets))
+	repo := base
+	repo.Downloads = stats.TotalDownloads
+	points = append(points, repo)
+
+	assets := sel.assets
+	for i, rel := range sel.releases {
+		p := base
+		p.Tag, p.Downloads = rel.Tag, rel.TotalDownloads
+		points = append(points, p)
+		for len(assets) > 0 && assets[0].release == i {
+			a := assets[0]
+			p.Asset, p.OS, p.Arch, p.Downloads = a.asset, a.os, a.arch, a.downloads
+			points = append(points, p)
+			assets = assets[1:]
+		}
+	}
+	return points, nil
+}
+
+// PushSink sends points to a time-series database.
+type PushSink interface {
+	Push(ctx context.Context, points []PushPoint) error
+	// String describes the sink without credentials.
+	String() string
+}
+
+// NewPushSink returns the sink for target. A nil client uses
+// http.DefaultClient. Graphite and OpenTSDB pushes time out after the
+// client's timeout, or pushTimeout without one.
+func NewPushSink(target PushTarget, client *http.Client) (PushSink, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid push URL %q: %w", target.URL, err)
+	}
+	prefix := target.Prefix
+	if prefix == "" {
+		prefix = "github"
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return newInfluxSink(u, tokenValue(target.Token, target.TokenEnv), client)
+	case "graphite", "opentsdb":
+		if u.Host == "" || u.Port() == "" {
+			return nil, fmt.Errorf("invalid push URL %q: want %s://host:port", target.URL, u.Scheme)
+		}
+		encode := graphiteLine
+		if u.Scheme == "opentsdb" {
+			encode = openTSDBLine
+		}
+		timeout := pushTimeout
+		if client != nil && client.Timeout > 0 {
+			timeout = client.Timeout
+		}
+		return &lineSink{scheme: u.Scheme, addr: u.Host, prefix: prefix, encode: encode, timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("invalid push URL %q: want an http(s) InfluxDB write URL, graphite://host:port or opentsdb://host:port", target.URL)
+}
+
+// influxPrecisions maps the precision query parameter of a write URL to the
+// timestamp unit.
+var influxPrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"n":  time.Nanosecond,
+	"us": time.Microsecond,
+	"u":  time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// influxSink writes line protocol to an InfluxDB write endpoint.
+type influxSink struct {
+	url       *url.URL
+	token     string
+	client    *http.Client
+	precision time.Duration
+}
+
+func newInfluxSink(u *url.URL, token string, client *http.Client) (*influxSink, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	q := u.Query()
+	if q.Get("precision") == "" {
+		q.Set("precision", "s")
+		u.RawQuery = q.Encode()
+	}
+	precision, ok := influxPrecisions[q.Get("precision")]
+	if !ok {
+		return nil, fmt.Errorf("invalid push URL: unknown precision %q", q.Get("precision"))
+	}
+	return &influxSink{url: u, token: token, client: client, precision: precision}, nil
+}
+
+// String describes the sink with its userinfo and credential query
+// parameters masked.
+func (s *influxSink) String() string {
+	u := *s.url
+	q := u.Query()
+	for _, key := range pushCredentials {
+		if q.Has(key) {
+			q.Set(key, "xxxxx")
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.Redacted()
+}
+
+func (s *influxSink) Push(ctx context.Context, points []PushPoint) error {
+	var body bytes.Buffer
+	for start := 0; start < len(points); start += pushBatchLines {
+		body.Reset()
+		for _, p := range points[start:min(start+pushBatchLines, len(points))] {
+			writeInfluxLine(&body, p, s.precision)
+		}
+		if err := s.write(ctx, &body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *influxSink) write(ctx context.Context, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url.String(), body)
+	if err != nil {
+		return fmt.Errorf("failed to push to %s: %w", s, unwrapURLError(err))
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push to %s: %w", s, unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to push to %s: %s: %s", s, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// unwrapURLError drops the *url.Error around err, whose message repeats the
+// request URL with its credentials.
+func unwrapURLError(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return ue.Err
+	}
+	return err
+}
+
+var influxTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+// writeInfluxLine writes a point as github_<level>_downloads with a
+// downloads integer field. Empty tags are left out, as line protocol
+// requires.
+func writeInfluxLine(w *bytes.Buffer, p PushPoint, precision time.Duration) {
+	w.WriteString("github_" + p.level() + "_downloads")
+	for _, tag := range [][2]string{{"arch", p.Arch}, {"asset", p.Asset}, {"os", p.OS}, {"owner", p.Owner}, {"repo", p.Repo}, {"tag", p.Tag}} {
+		if tag[1] == "" {
+			continue
+		}
+		fmt.Fprintf(w, ",%s=%s", tag[0], influxTagEscaper.Replace(tag[1]))
+	}
+	fmt.Fprintf(w, " downloads=%di %d\n", p.Downloads, p.Time.UnixNano()/int64(precision))
+}
+
+// lineSink writes one line per point over a TCP connection opened for each
+// push, as Graphite and OpenTSDB accept.
+type lineSink struct {
+	scheme string
+	addr   string
+	prefix string
+	encode func(prefix string, p PushPoint) string
+	// timeout bounds the whole push, so a hung server cannot block the
+	// caller when ctx has no deadline.
+	timeout time.Duration
+}
+
+func (s *lineSink) String() string {
+	return s.scheme + "://" + s.addr
+}
+
+func (s *lineSink) Push(ctx context.Context, points []PushPoint) error {
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	d := net.Dialer{Deadline: deadline}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to push to %s: %w", s, err)
+	}
+	defer conn.Close()
+	_ = conn.SetWriteDeadline(deadline)
+
+	w := bufio.NewWriter(conn)
+	for _, p := range points {
+		if _, err := w.WriteString(s.encode(s.prefix, p)); err != nil {
+			return fmt.Errorf("failed to push to %s: %w", s, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to push to %s: %w", s, err)
+	}
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("failed to push to %s: %w", s, err)
+	}
+	return nil
+}
+
+// metricComponent makes s safe as one component of a Graphite path or an
+// OpenTSDB tag value by replacing every other character with "_". Dots are
+// kept only when keepDots is set.
+func metricComponent(s string, keepDots bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == '.' && keepDots:
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// graphiteLine encodes a point as a Graphite plaintext line under
+// <prefix>.<owner>.<repo>, e.g. github.cli.cli.releases.v2_0_0.downloads.
+func graphiteLine(prefix string, p PushPoint) string {
+	parts := []string{prefix, metricComponent(p.Owner, false), metricComponent(p.Repo, false)}
+	if p.Tag != "" {
+		parts = append(parts, "releases", metricComponent(p.Tag, false))
+	}
+	switch {
+	case p.Asset != "":
+		parts = append(parts, "assets", metricComponent(p.Asset, false))
+	case p.OS != "":
+		parts = append(parts, "platforms", metricComponent(p.OS+"_"+p.Arch, false))
+	}
+	parts = append(parts, "downloads")
+	return strings.Join(parts, ".") + " " + strconv.Itoa(p.Downloads) + " " + strconv.FormatInt(p.Time.Unix(), 10) + "\n"
+}
+
+// openTSDBLine encodes a point as an OpenTSDB put command for the metric
+// <prefix>.<level>.downloads, tagged with its owner, repository, release
+// and asset.
+func openTSDBLine(prefix string, p PushPoint) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "put %s.%s.downloads %d %d", prefix, p.level(), p.Time.Unix(), p.Downloads)
+	for _, tag := range [][2]string{{"owner", p.Owner}, {"repo", p.Repo}, {"tag", p.Tag}, {"asset", p.Asset}, {"os", p.OS}, {"arch", p.Arch}} {
+		if tag[1] != "" {
+			fmt.Fprintf(&b, " %s=%s", tag[0], metricComponent(tag[1], true))
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pushSnapshot() *ReleaseStats {
+	s := sampleStats()
+	s.FetchedAt = time.Date(2024, 7, 5, 12, 0, 0, 0, time.UTC)
+	s.Releases[1].Assets = []Asset{
+		{Name: "tool_linux_amd64.tar.gz", DownloadCount: 7},
+		{Name: "tool_linux_arm64.tar.gz", DownloadCount: 3},
+		{Name: "checksums.txt", DownloadCount: 1, Kind: AssetChecksum},
+	}
+	return s
+}
+
+func TestSnapshotPoints(t *testing.T) {
+	points, err := SnapshotPoints(pushSnapshot(), nil, MetricsOptions{})
+	if err != nil {
+		t.Fatalf("SnapshotPoints failed: %v", err)
+	}
+	var got []string
+	for _, p := range points {
+		if !p.Time.Equal(time.Date(2024, 7, 5, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("point %+v is not timestamped with FetchedAt", p)
+		}
+		got = append(got, p.level()+":"+p.Tag+":"+p.Asset)
+	}
+	want := "repo::,release:v1.1.0:,asset:v1.1.0:tool_linux_amd64.tar.gz,asset:v1.1.0:tool_linux_arm64.tar.gz,release:v1.0.0:,asset:v1.0.0:asset1.tar.gz"
+	if strings.Join(got, ",") != want {
+		t.Errorf("unexpected points:\n got %s\nwant %s", strings.Join(got, ","), want)
+	}
+
+	points, err = SnapshotPoints(pushSnapshot(), nil, MetricsOptions{Releases: 1, Assets: AssetLabelsPlatform})
+	if err != nil {
+		t.Fatalf("SnapshotPoints failed: %v", err)
+	}
+	if len(points) != 4 || points[2].Asset != "" || points[2].OS != "linux" || points[2].Arch != "amd64" || points[2].Downloads != 7 {
+		t.Errorf("unexpected platform points %+v", points)
+	}
+}
+
+func TestPushEncodings(t *testing.T) {
+	p := PushPoint{Time: time.Unix(1720180800, 0), Owner: "acme", Repo: "cli", Tag: "v1.2.0", Asset: "tool linux,x=1.tar.gz", OS: "linux", Arch: "amd64", Downloads: 42}
+
+	var b bytes.Buffer
+	writeInfluxLine(&b, p, time.Millisecond)
+	if want := `github_asset_downloads,arch=amd64,asset=tool\ linux\,x\=1.tar.gz,os=linux,owner=acme,repo=cli,tag=v1.2.0 downloads=42i 1720180800000` + "\n"; b.String() != want {
+		t.Errorf("influx line:\n got %q\nwant %q", b.String(), want)
+	}
+	if got, want := graphiteLine("github", p), "github.acme.cli.releases.v1_2_0.assets.tool_linux_x_1_tar_gz.downloads 42 1720180800\n"; got != want {
+		t.Errorf("graphite line:\n got %q\nwant %q", got, want)
+	}
+	release := PushPoint{Time: p.Time, Owner: "acme", Repo: "cli", Tag: "v1.2.0", Downloads: 40}
+	if got, want := openTSDBLine("dl", release), "put dl.release.downloads 1720180800 40 owner=acme repo=cli tag=v1.2.0\n"; got != want {
+		t.Errorf("opentsdb line:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestInfluxSink(t *testing.T) {
+	var body, auth, precision string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body, auth, precision = string(data), r.Header.Get("Authorization"), r.URL.Query().Get("precision")
+		if r.URL.Query().Get("bucket") != "downloads" {
+			http.Error(w, `{"message":"bucket not found"}`, http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	points, err := SnapshotPoints(pushSnapshot(), nil, MetricsOptions{})
+	if err != nil {
+		t.Fatalf("SnapshotPoints failed: %v", err)
+	}
+	sink, err := NewPushSink(PushTarget{URL: srv.URL + "/api/v2/write?org=acme&bucket=downloads", Token: "secret"}, nil)
+	if err != nil {
+		t.Fatalf("NewPushSink failed: %v", err)
+	}
+	if err := sink.Push(context.Background(), points); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if auth != "Token secret" || precision != "s" || strings.Count(body, "\n") != len(points) {
+		t.Errorf("unexpected write: auth %q, precision %q, body:\n%s", auth, precision, body)
+	}
+	if !strings.HasPrefix(body, "github_repo_downloads,owner=owner,repo=repo downloads=15i 1720180800\n") {
+		t.Errorf("unexpected first line:\n%s", body)
+	}
+
+	sink, err = NewPushSink(PushTarget{URL: srv.URL + "/api/v2/write?org=acme&bucket=missing"}, nil)
+	if err != nil {
+		t.Fatalf("NewPushSink failed: %v", err)
+	}
+	if err := sink.Push(context.Background(), points); err == nil || !strings.Contains(err.Error(), "bucket not found") {
+		t.Errorf("expected the server's error, got %v", err)
+	}
+
+	// InfluxDB 1.x credentials in the query are masked, also in errors
+	sink, err = NewPushSink(PushTarget{URL: "http://127.0.0.1:1/write?db=stats&u=admin&p=hunter2"}, nil)
+	if err != nil {
+		t.Fatalf("NewPushSink failed: %v", err)
+	}
+	err = sink.Push(context.Background(), points)
+	for _, s := range []string{sink.String(), fmt.Sprint(err)} {
+		if strings.Contains(s, "hunter2") || strings.Contains(s, "admin") || !strings.Contains(s, "db=stats") {
+			t.Errorf("expected credentials to be masked, got %q", s)
+		}
+	}
+}
+
+func TestLineSinks(t *testing.T) {
+	for _, scheme := range []string{"graphite", "opentsdb"} {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		received := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				received <- ""
+				return
+			}
+			defer conn.Close()
+			data, _ := io.ReadAll(conn)
+			received <- string(data)
+		}()
+
+		sink, err := NewPushSink(PushTarget{URL: scheme + "://" + ln.Addr().String()}, nil)
+		if err != nil {
+			t.Fatalf("NewPushSink failed: %v", err)
+		}
+		points, _ := SnapshotPoints(pushSnapshot(), nil, MetricsOptions{Assets: AssetLabelsNone})
+		if err := sink.Push(context.Background(), points); err != nil {
+			t.Fatalf("%s: Push failed: %v", scheme, err)
+		}
+		got := <-received
+		ln.Close()
+
+		want := "github.owner.repo.downloads 15 1720180800\n"
+		if scheme == "opentsdb" {
+			want = "put github.repo.downloads 1720180800 15 owner=owner repo=repo\n"
+		}
+		if strings.Count(got, "\n") != 3 || !strings.HasPrefix(got, want) {
+			t.Errorf("%s: unexpected lines:\n%s", scheme, got)
+		}
+	}
+
+	for _, u := range []string{"graphite://localhost", "udp://localhost:2003", "http://localhost:8086/write?db=d&precision=h"} {
+		if _, err := NewPushSink(PushTarget{URL: u}, nil); err == nil {
+			t.Errorf("expected an error for %s", u)
+		}
+	}
+}
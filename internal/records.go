@@ -2,19 +2,59 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"text/tabwriter"
 	"time"
+	"unicode/utf8"
 )
 
+// SnapshotReport renders a single snapshot of release statistics.
+type SnapshotReport struct {
+	*ReleaseStats `yaml:",inline"`
+	TotalReleases int        `json:"total_releases" yaml:"total_releases"`
+	Detailed      bool       `json:"-" yaml:"-"`
+	Charts        ChartStyle `json:"-" yaml:"-"`
+}
+
+// SetChartStyle enables a bar chart of downloads per release.
+func (r *SnapshotReport) SetChartStyle(s ChartStyle) {
+	r.Charts = s
+}
+
+// NewSnapshotReport wraps stats for rendering.
+func NewSnapshotReport(stats *ReleaseStats, detailed bool) *SnapshotReport {
+	return &SnapshotReport{
+		ReleaseStats:  stats,
+		TotalReleases: len(stats.Releases),
+		Detailed:      detailed,
+	}
+}
+
 func DisplayStats(stats *ReleaseStats, detailed bool) {
-	fmt.Printf("\nDownload Statistics for %s/%s\n", stats.Owner, stats.Repo)
-	fmt.Printf("Total Releases: %d | Total Downloads: %d\n", len(stats.Releases), stats.TotalDownloads)
-	fmt.Printf("Last Updated: %s\n\n", time.Now().Format("2006-01-02 15:04:05 MST"))
+	_ = NewSnapshotReport(stats, detailed).WriteText(os.Stdout)
+}
+
+// WriteText writes the snapshot as an aligned table.
+func (r *SnapshotReport) WriteText(out io.Writer) error {
+	stats := r.ReleaseStats
+	updated := stats.FetchedAt
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	fmt.Fprintf(out, "\nDownload Statistics for %s/%s\n", stats.Owner, stats.Repo)
+	fmt.Fprintf(out, "Total Releases: %d | Total Downloads: %d", len(stats.Releases), stats.TotalDownloads)
+	if stats.AuxiliaryDownloads > 0 {
+		fmt.Fprintf(out, " | Auxiliary Downloads: %d", stats.AuxiliaryDownloads)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Last Updated: %s\n\n", updated.Format("2006-01-02 15:04:05 MST"))
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
 
-	if detailed {
+	if r.Detailed {
 		fmt.Fprintln(w, "RELEASE\tTAG\tASSETS\tTOTAL DOWNLOADS\tCREATED AT")
 		fmt.Fprintln(w, "---\t---\t---\t---\t---")
 		for _, rel := range stats.Releases {
@@ -26,10 +66,15 @@ func DisplayStats(stats *ReleaseStats, detailed bool) {
 				rel.CreatedAt.Format("2006-01-02"),
 			)
 			for _, asset := range rel.Assets {
-				fmt.Fprintf(w, "\t→ %s\t\t%s\t%d downloads\n",
+				note := ""
+				if asset.Kind.Auxiliary() {
+					note = fmt.Sprintf(" (%s, not counted)", asset.Kind)
+				}
+				fmt.Fprintf(w, "\t→ %s\t\t%s\t%d downloads%s\n",
 					"",
 					asset.Name,
 					asset.DownloadCount,
+					note,
 				)
 			}
 		}
@@ -47,7 +92,84 @@ func DisplayStats(stats *ReleaseStats, detailed bool) {
 		}
 	}
 
-	w.Flush()
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if r.Charts.Enabled() {
+		if err := writeReleaseBars(out, stats.Releases, r.Charts); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(out, "\n✅ Statistics compiled successfully\n\n")
+	return err
+}
 
-	fmt.Printf("\n✅ Statistics compiled successfully\n\n")
+// maxChartReleases caps the bars drawn for repositories with many releases.
+const maxChartReleases = 20
+
+// writeReleaseBars draws a horizontal bar per release, scaled to the release
+// with the most downloads.
+func writeReleaseBars(out io.Writer, releases []Release, style ChartStyle) error {
+	shown := releases
+	if len(shown) > maxChartReleases {
+		shown = shown[:maxChartReleases]
+	}
+	if len(shown) == 0 {
+		return nil
+	}
+
+	label, count, most := 0, 0, 0
+	for _, rel := range shown {
+		label = max(label, utf8.RuneCountInString(rel.Tag))
+		count = max(count, len(strconv.Itoa(rel.TotalDownloads)))
+		most = max(most, rel.TotalDownloads)
+	}
+	width := style.span(label+count+4, 10)
+
+	fmt.Fprintf(out, "\nDownloads by release:\n")
+	for _, rel := range shown {
+		bar := HBar(float64(rel.TotalDownloads), float64(most), width, style.ASCII)
+		fmt.Fprintf(out, "  %-*s %s %d\n", label, rel.Tag, bar, rel.TotalDownloads)
+	}
+	if len(releases) > len(shown) {
+		fmt.Fprintf(out, "  … %d more releases\n", len(releases)-len(shown))
+	}
+	return nil
+}
+
+// Table returns one row per release, or one row per asset when detailed.
+func (r *SnapshotReport) Table() ([]string, [][]string) {
+	rows := make([][]string, 0, len(r.Releases))
+	if r.Detailed {
+		header := []string{"release", "tag", "asset", "kind", "downloads", "size", "created_at"}
+		for _, rel := range r.Releases {
+			for _, asset := range rel.Assets {
+				rows = append(rows, []string{
+					rel.Name,
+					rel.Tag,
+					asset.Name,
+					string(asset.Kind),
+					strconv.Itoa(asset.DownloadCount),
+					strconv.FormatInt(asset.Size, 10),
+					rel.CreatedAt.Format("2006-01-02"),
+				})
+			}
+		}
+		return header, rows
+	}
+
+	header := []string{"release", "tag", "assets", "downloads", "auxiliary_downloads", "created_at"}
+	for _, rel := range r.Releases {
+		rows = append(rows, []string{
+			rel.Name,
+			rel.Tag,
+			strconv.Itoa(len(rel.Assets)),
+			strconv.Itoa(rel.TotalDownloads),
+			strconv.Itoa(rel.AuxiliaryDownloads),
+			rel.CreatedAt.Format("2006-01-02"),
+		})
+	}
+	return header, rows
 }
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OutputFormat selects how a command renders its result.
+type OutputFormat string
+
+const (
+	OutputTable    OutputFormat = "table"
+	OutputJSON     OutputFormat = "json"
+	OutputYAML     OutputFormat = "yaml"
+	OutputCSV      OutputFormat = "csv"
+	OutputMarkdown OutputFormat = "markdown"
+)
+
+// ParseOutputFormat validates an output format name.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch f := OutputFormat(s); f {
+	case OutputTable, OutputJSON, OutputYAML, OutputCSV, OutputMarkdown:
+		return f, nil
+	case "":
+		return OutputTable, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want table, json, yaml, csv or markdown)", s)
+}
+
+// Report is a command result that can be rendered in every output format.
+// JSON and YAML output marshal the report value itself, so its struct tags
+// define the documented schema.
+type Report interface {
+	// WriteText writes the human-readable form used by the table format.
+	WriteText(w io.Writer) error
+	// Table returns a flat header and rows for the csv and markdown formats.
+	Table() ([]string, [][]string)
+}
+
+// Render writes r to w in the given format.
+func Render(w io.Writer, format OutputFormat, r Report) error {
+	switch format {
+	case OutputTable, "":
+		return r.WriteText(w)
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case OutputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to encode yaml: %w", err)
+		}
+		return enc.Close()
+	case OutputCSV:
+		header, rows := r.Table()
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return fmt.Errorf("failed to write csv header: %w", err)
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write csv rows: %w", err)
+		}
+		return nil
+	case OutputMarkdown:
+		header, rows := r.Table()
+		return writeMarkdownTable(w, header, rows)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+func writeMarkdownTable(w io.Writer, header []string, rows [][]string) error {
+	escape := func(cells []string) string {
+		out := make([]string, len(cells))
+		for i, c := range cells {
+			out[i] = strings.ReplaceAll(c, "|", `\|`)
+		}
+		return "| " + strings.Join(out, " | ") + " |"
+	}
+
+	sep := make([]string, len(header))
+	for i := range sep {
+		sep[i] = "---"
+	}
+
+	lines := []string{escape(header), "|" + strings.Join(sep, "|") + "|"}
+	for _, row := range rows {
+		lines = append(lines, escape(row))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// percentOf returns delta as a percentage of base, or 0 when base is 0.
+func percentOf(delta, base int) float64 {
+	if base == 0 {
+		return 0
+	}
+	return float64(delta) / float64(base) * 100
+}
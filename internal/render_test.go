@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRenderSnapshotJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, OutputJSON, NewSnapshotReport(sampleStats(), false)); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	var decoded struct {
+		Owner          string `json:"owner"`
+		TotalReleases  int    `json:"total_releases"`
+		TotalDownloads int    `json:"total_downloads"`
+		Releases       []struct {
+			Tag    string `json:"tag"`
+			Assets []struct {
+				Name          string `json:"name"`
+				DownloadCount int    `json:"download_count"`
+			} `json:"assets"`
+		} `json:"releases"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid json: %v\n%s", err, buf.String())
+	}
+	if decoded.Owner != "owner" || decoded.TotalReleases != 2 || decoded.TotalDownloads != 15 {
+		t.Fatalf("unexpected snapshot: %+v", decoded)
+	}
+	if decoded.Releases[1].Assets[0].DownloadCount != 10 {
+		t.Fatalf("unexpected asset downloads: %+v", decoded.Releases[1])
+	}
+}
+
+func TestRenderSnapshotMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, OutputMarkdown, NewSnapshotReport(sampleStats(), false)); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	want := "| release | tag | assets | downloads | auxiliary_downloads | created_at |\n" +
+		"|---|---|---|---|---|---|\n" +
+		"| Release One | v1.0.0 | 1 | 5 | 0 | 2024-05-01 |\n" +
+		"| Release Two | v1.1.0 | 1 | 10 | 0 | 2024-06-01 |\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected markdown:\n%s", buf.String())
+	}
+}
+
+func TestRenderCompareCSV(t *testing.T) {
+	oldest := sampleStats()
+	newest := sampleStats()
+	newest.Releases[1].TotalDownloads = 20
+	newest.Releases[1].Assets[0].DownloadCount = 20
+	newest.TotalDownloads = 25
+	report := NewCompareReport(oldest, newest)
+
+	var buf bytes.Buffer
+	if err := Render(&buf, OutputCSV, report); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Release Two,v1.1.0,10,20,10,100.00") {
+		t.Fatalf("unexpected csv:\n%s", buf.String())
+	}
+	if report.Growth != 10 || report.GrowthPercent < 66.66 || report.GrowthPercent > 66.67 {
+		t.Fatalf("unexpected growth: %d (%.2f%%)", report.Growth, report.GrowthPercent)
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	if f, err := ParseOutputFormat(""); err != nil || f != OutputTable {
+		t.Fatalf("expected empty format to default to table, got %q (%v)", f, err)
+	}
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Fatal("expected unknown format to fail")
+	}
+}
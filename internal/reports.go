@@ -0,0 +1,422 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ReleaseSummary is a release reduced to its identity and download total.
+type ReleaseSummary struct {
+	Name           string `json:"name" yaml:"name"`
+	Tag            string `json:"tag" yaml:"tag"`
+	TotalDownloads int    `json:"total_downloads" yaml:"total_downloads"`
+}
+
+// HistoryEntry summarises one stored snapshot.
+type HistoryEntry struct {
+	SnapshotID     int64            `json:"snapshot_id,omitempty" yaml:"snapshot_id,omitempty"`
+	FetchedAt      time.Time        `json:"fetched_at" yaml:"fetched_at"`
+	TotalReleases  int              `json:"total_releases" yaml:"total_releases"`
+	TotalDownloads int              `json:"total_downloads" yaml:"total_downloads"`
+	TopReleases    []ReleaseSummary `json:"top_releases" yaml:"top_releases"`
+}
+
+// HistoryReport renders the history command.
+type HistoryReport struct {
+	Owner     string         `json:"owner" yaml:"owner"`
+	Repo      string         `json:"repo" yaml:"repo"`
+	Snapshots []HistoryEntry `json:"snapshots" yaml:"snapshots"`
+	Charts    ChartStyle     `json:"-" yaml:"-"`
+}
+
+// SetChartStyle enables sparklines of total downloads and growth.
+func (r *HistoryReport) SetChartStyle(s ChartStyle) {
+	r.Charts = s
+}
+
+// NewHistoryReport summarises snapshots, keeping the first top releases of each.
+func NewHistoryReport(owner, repo string, snapshots []ReleaseStats, top int) *HistoryReport {
+	report := &HistoryReport{
+		Owner:     owner,
+		Repo:      repo,
+		Snapshots: make([]HistoryEntry, 0, len(snapshots)),
+	}
+
+	for _, stats := range snapshots {
+		entry := HistoryEntry{
+			SnapshotID:     stats.SnapshotID,
+			FetchedAt:      stats.FetchedAt,
+			TotalReleases:  len(stats.Releases),
+			TotalDownloads: stats.TotalDownloads,
+			TopReleases:    make([]ReleaseSummary, 0, top),
+		}
+		for j := 0; j < top && j < len(stats.Releases); j++ {
+			rel := stats.Releases[j]
+			entry.TopReleases = append(entry.TopReleases, ReleaseSummary{
+				Name:           rel.Name,
+				Tag:            rel.Tag,
+				TotalDownloads: rel.TotalDownloads,
+			})
+		}
+		report.Snapshots = append(report.Snapshots, entry)
+	}
+
+	return report
+}
+
+// WriteText writes one block per snapshot with its top releases.
+func (r *HistoryReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "\nStatistics History for %s/%s (last %d fetches)\n\n", r.Owner, r.Repo, len(r.Snapshots))
+
+	if r.Charts.Enabled() && len(r.Snapshots) > 1 {
+		r.writeSparklines(w)
+	}
+
+	for i, entry := range r.Snapshots {
+		fmt.Fprintf(w, "[%d] Fetched at: %s | Total Releases: %d | Total Downloads: %d\n",
+			i+1,
+			entry.FetchedAt.Format("2006-01-02 15:04:05 MST"),
+			entry.TotalReleases,
+			entry.TotalDownloads,
+		)
+
+		if len(entry.TopReleases) > 0 {
+			fmt.Fprintf(w, "    Top %d releases:\n", len(entry.TopReleases))
+			for _, rel := range entry.TopReleases {
+				fmt.Fprintf(w, "      - %s (%s): %d downloads\n", rel.Name, rel.Tag, rel.TotalDownloads)
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSparklines draws total downloads and the growth between consecutive
+// snapshots, oldest first.
+func (r *HistoryReport) writeSparklines(w io.Writer) {
+	n := len(r.Snapshots)
+	totals := make([]float64, n)
+	for i, entry := range r.Snapshots {
+		totals[n-1-i] = float64(entry.TotalDownloads)
+	}
+	growth := make([]float64, n-1)
+	for i := 1; i < n; i++ {
+		growth[i-1] = math.Max(totals[i]-totals[i-1], 0)
+	}
+
+	oldest, newest := r.Snapshots[n-1], r.Snapshots[0]
+	width := r.Charts.span(40, 8)
+	fmt.Fprintf(w, "Total downloads  %s  %d -> %d\n", Sparkline(totals, width, r.Charts.ASCII), oldest.TotalDownloads, newest.TotalDownloads)
+	fmt.Fprintf(w, "Growth           %s  %+d\n", Sparkline(growth, width, r.Charts.ASCII), newest.TotalDownloads-oldest.TotalDownloads)
+	fmt.Fprintf(w, "                 %s to %s\n\n", oldest.FetchedAt.Format("2006-01-02"), newest.FetchedAt.Format("2006-01-02"))
+}
+
+// Table returns one row per snapshot.
+func (r *HistoryReport) Table() ([]string, [][]string) {
+	header := []string{"fetched_at", "total_releases", "total_downloads"}
+	rows := make([][]string, 0, len(r.Snapshots))
+	for _, entry := range r.Snapshots {
+		rows = append(rows, []string{
+			entry.FetchedAt.Format(time.RFC3339),
+			strconv.Itoa(entry.TotalReleases),
+			strconv.Itoa(entry.TotalDownloads),
+		})
+	}
+	return header, rows
+}
+
+// SnapshotTotal identifies a snapshot by fetch time and its download total.
+type SnapshotTotal struct {
+	SnapshotID         int64     `json:"snapshot_id,omitempty" yaml:"snapshot_id,omitempty"`
+	FetchedAt          time.Time `json:"fetched_at" yaml:"fetched_at"`
+	TotalDownloads     int       `json:"total_downloads" yaml:"total_downloads"`
+	AuxiliaryDownloads int       `json:"auxiliary_downloads" yaml:"auxiliary_downloads"`
+}
+
+func snapshotTotal(stats *ReleaseStats) SnapshotTotal {
+	return SnapshotTotal{
+		SnapshotID:         stats.SnapshotID,
+		FetchedAt:          stats.FetchedAt,
+		TotalDownloads:     stats.TotalDownloads,
+		AuxiliaryDownloads: stats.AuxiliaryDownloads,
+	}
+}
+
+// ReleaseComparison is the download growth of one release between two snapshots.
+type ReleaseComparison struct {
+	Name          string  `json:"name" yaml:"name"`
+	Tag           string  `json:"tag" yaml:"tag"`
+	OldDownloads  int     `json:"old_downloads" yaml:"old_downloads"`
+	NewDownloads  int     `json:"new_downloads" yaml:"new_downloads"`
+	Growth        int     `json:"growth" yaml:"growth"`
+	GrowthPercent float64 `json:"growth_percent" yaml:"growth_percent"`
+	// Assets holds per-asset deltas, ordered by growth.
+	Assets []AssetComparison `json:"assets,omitempty" yaml:"assets,omitempty"`
+}
+
+// Asset statuses reported by AssetComparison.
+const (
+	StatusNew       = "new"
+	StatusRemoved   = "removed"
+	StatusChanged   = "changed"
+	StatusUnchanged = "unchanged"
+)
+
+// AssetComparison is the download growth of one asset between two snapshots.
+// Auxiliary assets are included with their kind but do not count towards
+// the release growth.
+type AssetComparison struct {
+	Name         string    `json:"name" yaml:"name"`
+	Kind         AssetKind `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Status       string    `json:"status" yaml:"status"`
+	OldDownloads int       `json:"old_downloads" yaml:"old_downloads"`
+	NewDownloads int       `json:"new_downloads" yaml:"new_downloads"`
+	Growth       int       `json:"growth" yaml:"growth"`
+}
+
+// compareAssets matches assets by name. Assets only in current are new and
+// assets only in previous are removed.
+func compareAssets(previous, current []Asset) []AssetComparison {
+	before := make(map[string]Asset, len(previous))
+	for _, a := range previous {
+		before[a.Name] = a
+	}
+
+	result := make([]AssetComparison, 0, len(current))
+	seen := make(map[string]bool, len(current))
+	for _, a := range current {
+		seen[a.Name] = true
+		c := AssetComparison{Name: a.Name, Kind: a.Kind, Status: StatusNew, NewDownloads: a.DownloadCount}
+		if old, ok := before[a.Name]; ok {
+			c.OldDownloads = old.DownloadCount
+			c.Status = StatusChanged
+			if old.DownloadCount == a.DownloadCount {
+				c.Status = StatusUnchanged
+			}
+		}
+		c.Growth = c.NewDownloads - c.OldDownloads
+		result = append(result, c)
+	}
+	for _, a := range previous {
+		if !seen[a.Name] {
+			result = append(result, AssetComparison{
+				Name:         a.Name,
+				Kind:         a.Kind,
+				Status:       StatusRemoved,
+				OldDownloads: a.DownloadCount,
+				Growth:       -a.DownloadCount,
+			})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Growth != result[j].Growth {
+			return result[i].Growth > result[j].Growth
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// CompareReport renders the compare command. Releases are ordered by growth,
+// largest first; releases present in only one of the two snapshots are
+// listed separately.
+type CompareReport struct {
+	Owner string `json:"owner" yaml:"owner"`
+	Repo  string `json:"repo" yaml:"repo"`
+	// Days is the number of whole days between the two snapshots.
+	Days          int           `json:"days" yaml:"days"`
+	Oldest        SnapshotTotal `json:"oldest" yaml:"oldest"`
+	Newest        SnapshotTotal `json:"newest" yaml:"newest"`
+	Growth        int           `json:"growth" yaml:"growth"`
+	GrowthPercent float64       `json:"growth_percent" yaml:"growth_percent"`
+	// AuxiliaryGrowth is the growth of auxiliary downloads, which Growth
+	// leaves out.
+	AuxiliaryGrowth int                 `json:"auxiliary_growth" yaml:"auxiliary_growth"`
+	Releases        []ReleaseComparison `json:"releases" yaml:"releases"`
+	NewReleases     []ReleaseSummary    `json:"new_releases" yaml:"new_releases"`
+	RemovedReleases []ReleaseSummary    `json:"removed_releases" yaml:"removed_releases"`
+
+	// Top limits the releases listed in text output; zero lists all.
+	Top int `json:"-" yaml:"-"`
+	// Detailed adds per-asset deltas to text and table output.
+	Detailed bool `json:"-" yaml:"-"`
+}
+
+// NewCompareReport compares the oldest snapshot with the newest one.
+func NewCompareReport(oldest, newest *ReleaseStats) *CompareReport {
+	diff := DiffSnapshots(oldest, newest)
+	return &CompareReport{
+		Owner:           newest.Owner,
+		Repo:            newest.Repo,
+		Days:            int(math.Round(newest.FetchedAt.Sub(oldest.FetchedAt).Hours() / 24)),
+		Oldest:          diff.Previous,
+		Newest:          diff.Current,
+		Growth:          diff.Growth,
+		GrowthPercent:   diff.GrowthPercent,
+		AuxiliaryGrowth: newest.AuxiliaryDownloads - oldest.AuxiliaryDownloads,
+		Releases:        diff.Releases,
+		NewReleases:     diff.NewReleases,
+		RemovedReleases: diff.RemovedReleases,
+	}
+}
+
+// NewReleaseComparison fills in the growth fields for a release.
+func NewReleaseComparison(name, tag string, oldDL, newDL int) ReleaseComparison {
+	growth := newDL - oldDL
+	return ReleaseComparison{
+		Name:          name,
+		Tag:           tag,
+		OldDownloads:  oldDL,
+		NewDownloads:  newDL,
+		Growth:        growth,
+		GrowthPercent: percentOf(growth, oldDL),
+	}
+}
+
+// WriteText writes the total growth, new and removed releases, and the
+// releases with the largest growth.
+func (r *CompareReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "\nDownload Statistics Comparison for %s/%s\n", r.Owner, r.Repo)
+	fmt.Fprintf(w, "From: %s | To: %s | Period: %d days\n\n", describeSnapshot(r.Oldest), describeSnapshot(r.Newest), r.Days)
+
+	fmt.Fprintf(w, "Total Downloads:\n")
+	fmt.Fprintf(w, "  From:   %d\n", r.Oldest.TotalDownloads)
+	fmt.Fprintf(w, "  To:     %d\n", r.Newest.TotalDownloads)
+	fmt.Fprintf(w, "  Growth: %+d (%+.2f%%)\n\n", r.Growth, r.GrowthPercent)
+
+	if r.Oldest.AuxiliaryDownloads > 0 || r.Newest.AuxiliaryDownloads > 0 {
+		fmt.Fprintf(w, "Auxiliary Downloads (checksums, signatures, SBOMs; not counted above):\n")
+		fmt.Fprintf(w, "  From:   %d\n", r.Oldest.AuxiliaryDownloads)
+		fmt.Fprintf(w, "  To:     %d\n", r.Newest.AuxiliaryDownloads)
+		fmt.Fprintf(w, "  Growth: %+d\n\n", r.AuxiliaryGrowth)
+	}
+
+	if len(r.NewReleases) > 0 {
+		fmt.Fprintf(w, "New releases:\n")
+		for _, rel := range r.NewReleases {
+			fmt.Fprintf(w, "  + %s (%s): %d downloads\n", rel.Name, rel.Tag, rel.TotalDownloads)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(r.RemovedReleases) > 0 {
+		fmt.Fprintf(w, "Removed releases:\n")
+		for _, rel := range r.RemovedReleases {
+			fmt.Fprintf(w, "  - %s (%s): %d downloads\n", rel.Name, rel.Tag, rel.TotalDownloads)
+		}
+		fmt.Fprintln(w)
+	}
+
+	releases := r.Releases
+	if r.Top > 0 && len(releases) > r.Top {
+		releases = releases[:r.Top]
+		fmt.Fprintf(w, "Top %d releases by growth:\n", r.Top)
+	} else {
+		fmt.Fprintf(w, "Releases by growth:\n")
+	}
+	for i, c := range releases {
+		fmt.Fprintf(w, "  %d. %s (%s): %+d (%+.2f%%)\n", i+1, c.Name, c.Tag, c.Growth, c.GrowthPercent)
+		if !r.Detailed {
+			continue
+		}
+		for _, a := range c.Assets {
+			if a.Status == StatusUnchanged {
+				continue
+			}
+			fmt.Fprintf(w, "       %s: %d -> %d (%+d)%s\n", a.Name, a.OldDownloads, a.NewDownloads, a.Growth, assetNote(a))
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// describeSnapshot formats a snapshot's date, with its ID when it has one.
+func describeSnapshot(s SnapshotTotal) string {
+	if s.SnapshotID == 0 {
+		return s.FetchedAt.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s (#%d)", s.FetchedAt.Format("2006-01-02"), s.SnapshotID)
+}
+
+func assetNote(a AssetComparison) string {
+	switch {
+	case a.Status == StatusNew || a.Status == StatusRemoved:
+		if a.Kind.Auxiliary() {
+			return fmt.Sprintf(" [%s, %s]", a.Status, a.Kind)
+		}
+		return fmt.Sprintf(" [%s]", a.Status)
+	case a.Kind.Auxiliary():
+		return fmt.Sprintf(" [%s]", a.Kind)
+	}
+	return ""
+}
+
+// Table returns one row per release with its status: changed, unchanged, new
+// or removed. The detailed view has one row per asset instead.
+func (r *CompareReport) Table() ([]string, [][]string) {
+	if r.Detailed {
+		return r.assetTable()
+	}
+
+	header := []string{"release", "tag", "old_downloads", "new_downloads", "growth", "growth_percent", "status"}
+	rows := make([][]string, 0, len(r.Releases)+len(r.NewReleases)+len(r.RemovedReleases))
+	for _, c := range r.Releases {
+		rows = append(rows, []string{
+			c.Name,
+			c.Tag,
+			strconv.Itoa(c.OldDownloads),
+			strconv.Itoa(c.NewDownloads),
+			strconv.Itoa(c.Growth),
+			strconv.FormatFloat(c.GrowthPercent, 'f', 2, 64),
+			releaseStatus(c),
+		})
+	}
+	for _, rel := range r.NewReleases {
+		rows = append(rows, []string{rel.Name, rel.Tag, "0", strconv.Itoa(rel.TotalDownloads), strconv.Itoa(rel.TotalDownloads), "", StatusNew})
+	}
+	for _, rel := range r.RemovedReleases {
+		rows = append(rows, []string{rel.Name, rel.Tag, strconv.Itoa(rel.TotalDownloads), "0", strconv.Itoa(-rel.TotalDownloads), "", StatusRemoved})
+	}
+	return header, rows
+}
+
+func (r *CompareReport) assetTable() ([]string, [][]string) {
+	header := []string{"release", "tag", "asset", "kind", "old_downloads", "new_downloads", "growth", "status"}
+	rows := make([][]string, 0)
+	for _, c := range r.Releases {
+		for _, a := range c.Assets {
+			rows = append(rows, []string{
+				c.Name,
+				c.Tag,
+				a.Name,
+				string(a.Kind),
+				strconv.Itoa(a.OldDownloads),
+				strconv.Itoa(a.NewDownloads),
+				strconv.Itoa(a.Growth),
+				a.Status,
+			})
+		}
+	}
+	for _, rel := range r.NewReleases {
+		rows = append(rows, []string{rel.Name, rel.Tag, "", "", "0", strconv.Itoa(rel.TotalDownloads), strconv.Itoa(rel.TotalDownloads), StatusNew})
+	}
+	for _, rel := range r.RemovedReleases {
+		rows = append(rows, []string{rel.Name, rel.Tag, "", "", strconv.Itoa(rel.TotalDownloads), "0", strconv.Itoa(-rel.TotalDownloads), StatusRemoved})
+	}
+	return header, rows
+}
+
+func releaseStatus(c ReleaseComparison) string {
+	if c.Growth == 0 {
+		return StatusUnchanged
+	}
+	return StatusChanged
+}
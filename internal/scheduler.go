@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule returns the next activation time after the given time.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// intervalSchedule fires at a fixed interval after the previous activation.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// ParseSchedule accepts a Go duration such as "6h", a standard five-field
+// cron expression, or a descriptor such as "@daily" or "@every 90m".
+// Intervals must be at least a minute long.
+func ParseSchedule(spec string) (Schedule, error) {
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval %s is shorter than one minute", d)
+		}
+		return intervalSchedule(d), nil
+	}
+
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: expected a duration or cron expression: %w", spec, err)
+	}
+	if every, ok := sched.(cron.ConstantDelaySchedule); ok && every.Delay < time.Minute {
+		return nil, fmt.Errorf("interval %s is shorter than one minute", every.Delay)
+	}
+	return sched, nil
+}
+
+// JobStatus reports the state of one scheduled job.
+type JobStatus struct {
+	Name        string    `json:"name"`
+	Schedule    string    `json:"schedule"`
+	Running     bool      `json:"running"`
+	Runs        int       `json:"runs"`
+	Failures    int       `json:"failures"`
+	LastRun     time.Time `json:"last_run,omitzero"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextRun     time.Time `json:"next_run,omitzero"`
+}
+
+type job struct {
+	schedule Schedule
+	run      func(context.Context) error
+	status   JobStatus
+}
+
+// Scheduler runs jobs on their own schedules until its context is cancelled.
+// Every activation is delayed by a random amount up to the configured jitter
+// so that jobs sharing a schedule do not hit the API at the same instant.
+type Scheduler struct {
+	jitter    time.Duration
+	immediate bool
+
+	mu      sync.Mutex
+	jobs    []*job
+	started time.Time
+}
+
+// NewScheduler creates a scheduler. When immediate is set every job runs
+// once at startup before following its schedule.
+func NewScheduler(jitter time.Duration, immediate bool) *Scheduler {
+	return &Scheduler{jitter: jitter, immediate: immediate}
+}
+
+// Add registers a job. specLabel is reported in the job status.
+func (s *Scheduler) Add(name, specLabel string, schedule Schedule, run func(context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{
+		schedule: schedule,
+		run:      run,
+		status:   JobStatus{Name: name, Schedule: specLabel},
+	})
+}
+
+// Run starts every job and blocks until ctx is cancelled and all running
+// jobs have returned.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.started = time.Now()
+	jobs := append([]*job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	next := time.Now()
+	if !s.immediate {
+		next = j.schedule.Next(next)
+	}
+
+	for {
+		next = next.Add(s.jitterDelay())
+		s.update(j, func(st *JobStatus) { st.NextRun = next })
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.update(j, func(st *JobStatus) { st.Running = true })
+		started := time.Now()
+		err := j.run(ctx)
+		s.update(j, func(st *JobStatus) {
+			st.Running = false
+			st.Runs++
+			st.LastRun = started
+			if err != nil {
+				st.Failures++
+				st.LastError = err.Error()
+			} else {
+				st.LastSuccess = started
+				st.LastError = ""
+			}
+		})
+
+		next = j.schedule.Next(time.Now())
+	}
+}
+
+func (s *Scheduler) jitterDelay() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return rand.N(s.jitter)
+}
+
+func (s *Scheduler) update(j *job, f func(*JobStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&j.status)
+}
+
+// Status returns a snapshot of every job's status, ordered by name.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		out = append(out, j.status)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
+
+// HealthReport is the JSON document served by HealthHandler.
+type HealthReport struct {
+	Status    string      `json:"status"`
+	StartedAt time.Time   `json:"started_at"`
+	Jobs      []JobStatus `json:"jobs"`
+}
+
+// Health summarises the scheduler: "ok" when no job's latest run failed,
+// otherwise "degraded".
+func (s *Scheduler) Health() HealthReport {
+	jobs := s.Status()
+	status := "ok"
+	for _, j := range jobs {
+		if j.LastError != "" {
+			status = "degraded"
+			break
+		}
+	}
+
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	return HealthReport{Status: status, StartedAt: started, Jobs: jobs}
+}
+
+// HealthHandler serves the scheduler health as JSON, with status 503 unless
+// it is "ok" so that probes can act on it.
+func HealthHandler(s *Scheduler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := s.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(health)
+	})
+}
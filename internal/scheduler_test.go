@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	start := time.Date(2024, 7, 1, 10, 30, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"6h":          start.Add(6 * time.Hour),
+		"0 */6 * * *": time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+		"@daily":      time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC),
+		"@every 90m":  start.Add(90 * time.Minute),
+	}
+	for spec, want := range cases {
+		sched, err := ParseSchedule(spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) failed: %v", spec, err)
+		}
+		if got := sched.Next(start); !got.Equal(want) {
+			t.Fatalf("ParseSchedule(%q).Next = %s, want %s", spec, got, want)
+		}
+	}
+
+	for _, spec := range []string{"10s", "@every 10s", "every day", "61 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("expected ParseSchedule(%q) to fail", spec)
+		}
+	}
+}
+
+func TestSchedulerRunsJobsUntilCancelled(t *testing.T) {
+	s := NewScheduler(0, true)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runs := make(chan struct{}, 10)
+	s.Add("ok", "10ms", intervalSchedule(10*time.Millisecond), func(context.Context) error {
+		runs <- struct{}{}
+		return nil
+	})
+	s.Add("failing", "1h", intervalSchedule(time.Hour), func(context.Context) error {
+		return errors.New("boom")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(2 * time.Second):
+			t.Fatal("job did not run")
+		}
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("scheduler did not stop after cancellation")
+	}
+
+	health := s.Health()
+	if health.Status != "degraded" {
+		t.Fatalf("expected degraded status, got %q", health.Status)
+	}
+	rec := httptest.NewRecorder()
+	HealthHandler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503 for a degraded scheduler, got %d", rec.Code)
+	}
+	for _, j := range health.Jobs {
+		switch j.Name {
+		case "failing":
+			if j.Failures != 1 || j.LastError != "boom" {
+				t.Fatalf("unexpected failing job status: %+v", j)
+			}
+		case "ok":
+			if j.Runs < 2 || j.LastError != "" || j.LastSuccess.IsZero() {
+				t.Fatalf("unexpected ok job status: %+v", j)
+			}
+		}
+	}
+}
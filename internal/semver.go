@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version is a release tag parsed as a semantic version. Tags that do not
+// look like a version have Valid set to false and sort before all versions.
+type Version struct {
+	Major      int    `json:"major" yaml:"major"`
+	Minor      int    `json:"minor" yaml:"minor"`
+	Patch      int    `json:"patch" yaml:"patch"`
+	Prerelease string `json:"prerelease,omitempty" yaml:"prerelease,omitempty"`
+	Valid      bool   `json:"valid" yaml:"valid"`
+}
+
+// ParseVersion parses tags such as "v1.2.3", "1.2", "v2.0.0-rc.1" or
+// "tool/v1.4.0". Missing minor or patch components default to zero and build
+// metadata is ignored.
+func ParseVersion(tag string) Version {
+	s := tag
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[i+1:]
+	}
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+
+	var v Version
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Version{}
+	}
+	nums := [3]int{}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return Version{}
+		}
+		nums[i] = n
+	}
+
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	v.Valid = true
+	return v
+}
+
+// String formats v as MAJOR.MINOR.PATCH[-PRERELEASE], or "" when invalid.
+func (v Version) String() string {
+	if !v.Valid {
+		return ""
+	}
+	s := strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 following semantic version precedence.
+func (v Version) Compare(o Version) int {
+	if v.Valid != o.Valid {
+		if v.Valid {
+			return 1
+		}
+		return -1
+	}
+	for _, d := range [3]int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// comparePrerelease orders prerelease identifiers; a release without one
+// takes precedence over any prerelease of the same version.
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	ap, bp := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aErr := strconv.Atoi(ap[i])
+		bn, bErr := strconv.Atoi(bp[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(ap[i], bp[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(ap) < len(bp):
+		return -1
+	case len(ap) > len(bp):
+		return 1
+	}
+	return 0
+}
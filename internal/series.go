@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SeriesLevel selects what a download time series is measured for.
+type SeriesLevel string
+
+const (
+	SeriesRepo    SeriesLevel = "repo"
+	SeriesRelease SeriesLevel = "release"
+	SeriesAsset   SeriesLevel = "asset"
+)
+
+// ParseSeriesLevel validates a series level name.
+func ParseSeriesLevel(s string) (SeriesLevel, error) {
+	switch l := SeriesLevel(s); l {
+	case SeriesRepo, SeriesRelease, SeriesAsset:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown level %q (want repo, release or asset)", s)
+}
+
+// Point is a cumulative download count observed at a snapshot.
+type Point struct {
+	Time  time.Time `json:"time" yaml:"time"`
+	Value float64   `json:"value" yaml:"value"`
+}
+
+// Series is the cumulative download count of one repo, release or asset
+// across snapshots, oldest first.
+type Series struct {
+	Key    string  `json:"key" yaml:"key"`
+	Tag    string  `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Asset  string  `json:"asset,omitempty" yaml:"asset,omitempty"`
+	Points []Point `json:"-" yaml:"-"`
+}
+
+// Latest returns the last observed value, or 0 for an empty series.
+func (s Series) Latest() float64 {
+	if len(s.Points) == 0 {
+		return 0
+	}
+	return s.Points[len(s.Points)-1].Value
+}
+
+// Growth returns the increase between the first and last observation.
+func (s Series) Growth() float64 {
+	if len(s.Points) < 2 {
+		return 0
+	}
+	return s.Points[len(s.Points)-1].Value - s.Points[0].Value
+}
+
+// ExtractSeries turns snapshots into one cumulative series per repo, release
+// or asset. Snapshots may be in any order; series are ordered by key.
+func ExtractSeries(snapshots []ReleaseStats, level SeriesLevel) []Series {
+	byKey := make(map[string]*Series)
+	add := func(key, tag, asset string, t time.Time, v int) {
+		s, ok := byKey[key]
+		if !ok {
+			s = &Series{Key: key, Tag: tag, Asset: asset}
+			byKey[key] = s
+		}
+		s.Points = append(s.Points, Point{Time: t, Value: float64(v)})
+	}
+
+	for _, snap := range snapshots {
+		switch level {
+		case SeriesRepo:
+			add(snap.Owner+"/"+snap.Repo, "", "", snap.FetchedAt, snap.TotalDownloads)
+		case SeriesRelease:
+			for _, rel := range snap.Releases {
+				add(rel.Tag, rel.Tag, "", snap.FetchedAt, rel.TotalDownloads)
+			}
+		case SeriesAsset:
+			for _, rel := range snap.Releases {
+				for _, asset := range rel.Assets {
+					add(rel.Tag+"/"+asset.Name, rel.Tag, asset.Name, snap.FetchedAt, asset.DownloadCount)
+				}
+			}
+		}
+	}
+
+	out := make([]Series, 0, len(byKey))
+	for _, s := range byKey {
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].Time.Before(s.Points[j].Time) })
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Interval is the download increase between two successive observations.
+type Interval struct {
+	Start     time.Time `json:"start" yaml:"start"`
+	End       time.Time `json:"end" yaml:"end"`
+	Downloads float64   `json:"downloads" yaml:"downloads"`
+	PerDay    float64   `json:"per_day" yaml:"per_day"`
+}
+
+// Intervals converts cumulative points into per-interval increases,
+// normalised to downloads per day so that irregular snapshot spacing does
+// not distort comparisons. Decreases, which happen when assets are deleted,
+// count as zero.
+func Intervals(points []Point) []Interval {
+	out := make([]Interval, 0, len(points))
+	for i := 1; i < len(points); i++ {
+		elapsed := points[i].Time.Sub(points[i-1].Time)
+		if elapsed <= 0 {
+			continue
+		}
+		delta := points[i].Value - points[i-1].Value
+		if delta < 0 {
+			delta = 0
+		}
+		out = append(out, Interval{
+			Start:     points[i-1].Time,
+			End:       points[i].Time,
+			Downloads: delta,
+			PerDay:    delta / elapsed.Hours() * 24,
+		})
+	}
+	return out
+}
@@ -0,0 +1,362 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SiteRelease is a release as listed on the report site, with the downloads
+// it gained over the period and the path of its page. PublishedAt is the
+// release's ReleaseDate.
+type SiteRelease struct {
+	Name           string    `json:"name"`
+	Tag            string    `json:"tag"`
+	Page           string    `json:"page"`
+	TotalDownloads int       `json:"total_downloads"`
+	Growth         int       `json:"growth"`
+	PublishedAt    time.Time `json:"published_at"`
+	Prerelease     bool      `json:"prerelease"`
+	Assets         []Asset   `json:"assets"`
+}
+
+// SiteRepo is everything the report site shows for one repository over a
+// period ending at its newest snapshot.
+type SiteRepo struct {
+	Owner          string          `json:"owner"`
+	Repo           string          `json:"repo"`
+	Page           string          `json:"page"`
+	FetchedAt      time.Time       `json:"fetched_at"`
+	TotalDownloads int             `json:"total_downloads"`
+	History        []SnapshotTotal `json:"history"`
+	Releases       []SiteRelease   `json:"releases"`
+	Compare        *CompareReport  `json:"compare"`
+	Platforms      *PlatformReport `json:"platforms"`
+
+	snapshots []ReleaseStats
+	platforms []Series
+	pages     map[string]string
+}
+
+// NewSiteRepo builds the site data for one repository from its snapshots of
+// the period, newest first.
+func NewSiteRepo(snapshots []ReleaseStats, classifier *PlatformClassifier, by PlatformDimension, period TrendPeriod) (*SiteRepo, error) {
+	if len(snapshots) == 0 {
+		return nil, fmt.Errorf("no snapshots to build the site from")
+	}
+	newest, oldest := &snapshots[0], &snapshots[len(snapshots)-1]
+	r := &SiteRepo{
+		Owner:          newest.Owner,
+		Repo:           newest.Repo,
+		Page:           siteSlug(newest.Owner) + "/" + siteSlug(newest.Repo) + "/index.html",
+		FetchedAt:      newest.FetchedAt,
+		TotalDownloads: newest.TotalDownloads,
+		History:        make([]SnapshotTotal, 0, len(snapshots)),
+		Releases:       make([]SiteRelease, 0, len(newest.Releases)),
+		Compare:        NewCompareReport(oldest, newest),
+		Platforms:      NewPlatformReport(newest.Owner, newest.Repo, snapshots, classifier, by, period),
+		snapshots:      snapshots,
+		platforms:      PlatformSeries(snapshots, classifier, by),
+		pages:          make(map[string]string, len(newest.Releases)),
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		r.History = append(r.History, snapshotTotal(&snapshots[i]))
+	}
+
+	before := make(map[string]int, len(oldest.Releases))
+	for _, rel := range oldest.Releases {
+		before[rel.Tag] = rel.TotalDownloads
+	}
+	used := make(map[string]bool, len(newest.Releases))
+	for _, rel := range newest.Releases {
+		// Tags that only differ in punctuation get numbered pages
+		slug := siteSlug(rel.Tag)
+		for n := 2; used[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", siteSlug(rel.Tag), n)
+		}
+		used[slug] = true
+
+		page := strings.TrimSuffix(r.Page, "index.html") + "releases/" + slug + ".html"
+		r.pages[rel.Tag] = page
+		r.Releases = append(r.Releases, SiteRelease{
+			Name:           rel.Name,
+			Tag:            rel.Tag,
+			Page:           page,
+			TotalDownloads: rel.TotalDownloads,
+			Growth:         rel.TotalDownloads - before[rel.Tag],
+			PublishedAt:    rel.ReleaseDate(),
+			Prerelease:     rel.IsPrerelease,
+			Assets:         rel.Assets,
+		})
+	}
+
+	return r, nil
+}
+
+// Growth returns the downloads gained over the period.
+func (r *SiteRepo) Growth() int {
+	return r.Compare.Growth
+}
+
+// LatestRelease returns the most recently published release, or nil when
+// the repository has none.
+func (r *SiteRepo) LatestRelease() *SiteRelease {
+	var latest *SiteRelease
+	for i := range r.Releases {
+		if latest == nil || r.Releases[i].PublishedAt.After(latest.PublishedAt) {
+			latest = &r.Releases[i]
+		}
+	}
+	return latest
+}
+
+// ReleasePage returns the path of a release page relative to the site root,
+// or "" for releases that are no longer published.
+func (r *SiteRepo) ReleasePage(tag string) string {
+	return r.pages[tag]
+}
+
+// Site is a static report site covering several repositories. Its pages
+// and data file depend only on the stored snapshots, so rebuilding it from
+// the same database produces the same files.
+type Site struct {
+	Title string `json:"title"`
+	Days  int    `json:"days"`
+	// Updated is the time of the newest snapshot of any repository.
+	Updated time.Time   `json:"updated"`
+	Repos   []*SiteRepo `json:"repos"`
+
+	// Theme colours the charts and pages.
+	Theme ChartTheme `json:"-"`
+}
+
+// NewSite collects repositories into a site, ordered by name.
+func NewSite(title string, days int, theme ChartTheme, repos []*SiteRepo) *Site {
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].Owner+"/"+repos[i].Repo < repos[j].Owner+"/"+repos[j].Repo
+	})
+	s := &Site{Title: title, Days: days, Repos: repos, Theme: theme}
+	for _, r := range repos {
+		if r.FetchedAt.After(s.Updated) {
+			s.Updated = r.FetchedAt
+		}
+	}
+	return s
+}
+
+// SiteDataFile is the path of the JSON data file relative to the site root.
+const SiteDataFile = "data.json"
+
+// Build renders every page and the data file, calling write with each path
+// relative to the site root, using forward slashes, in a fixed order.
+func (s *Site) Build(write func(path string, content []byte) error) error {
+	var buf bytes.Buffer
+	render := func(path string, p *sitePage) error {
+		buf.Reset()
+		p.Site = s
+		p.Root = strings.Repeat("../", strings.Count(path, "/"))
+		if err := siteTemplates.ExecuteTemplate(&buf, "page", p); err != nil {
+			return fmt.Errorf("failed to render %s: %w", path, err)
+		}
+		return write(path, buf.Bytes())
+	}
+
+	if err := render("index.html", &sitePage{Title: s.Title}); err != nil {
+		return err
+	}
+	for _, r := range s.Repos {
+		charts := []template.HTML{
+			s.chart("Total downloads", ChartLine, PeriodWeek, ExtractSeries(r.snapshots, SeriesRepo)),
+			s.chart("Downloads by release", ChartArea, PeriodWeek, TopSeries(ExtractSeries(r.snapshots, SeriesRelease), 6, true)),
+			s.chart(fmt.Sprintf("Downloads by %s per %s", r.Platforms.By, r.Platforms.Period), ChartBar, r.Platforms.Period, TopSeries(r.platforms, 6, true)),
+		}
+		if err := render(r.Page, &sitePage{Title: r.Owner + "/" + r.Repo, Repo: r, Charts: charts}); err != nil {
+			return err
+		}
+
+		assets := ExtractSeries(r.snapshots, SeriesAsset)
+		for i := range r.Releases {
+			rel := &r.Releases[i]
+			var series []Series
+			for _, a := range assets {
+				if a.Tag == rel.Tag {
+					a.Key = a.Asset
+					series = append(series, a)
+				}
+			}
+			page := &sitePage{
+				Title:   r.Owner + "/" + r.Repo + " " + rel.Tag,
+				Repo:    r,
+				Release: rel,
+				Charts:  []template.HTML{s.chart("Downloads by asset", ChartArea, PeriodWeek, TopSeries(series, 6, true))},
+			}
+			if err := render(rel.Page, page); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode site data: %w", err)
+	}
+	return write(SiteDataFile, append(data, '\n'))
+}
+
+// chart renders an inline SVG chart, or nothing when the period holds too
+// few snapshots to draw one.
+func (s *Site) chart(title string, kind ChartKind, period TrendPeriod, series []Series) template.HTML {
+	points := 0
+	for _, ser := range series {
+		points = max(points, len(ser.Points))
+	}
+	if points < 2 {
+		return ""
+	}
+
+	c := &SVGChart{Title: title, Kind: kind, Theme: s.Theme, Width: 800, Height: 400, Series: series, Period: period}
+	var buf bytes.Buffer
+	if err := c.WriteSVG(&buf); err != nil {
+		return ""
+	}
+	// The SVG is generated here and escapes all text itself
+	return template.HTML(buf.String())
+}
+
+// sitePage is the data of one page. Root is the relative path back to the
+// site root, so the site works from any directory or URL prefix.
+type sitePage struct {
+	Site    *Site
+	Root    string
+	Title   string
+	Repo    *SiteRepo
+	Release *SiteRelease
+	Charts  []template.HTML
+}
+
+// Style returns the page stylesheet in the colours of the chart theme.
+func (p *sitePage) Style() template.CSS {
+	t := p.Site.Theme
+	return template.CSS(fmt.Sprintf(siteStyle, t.Background, t.Text, t.Muted, t.Grid, t.Palette[0]))
+}
+
+var siteSlugPattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// siteSlug turns a tag or name into a safe file name.
+func siteSlug(s string) string {
+	slug := strings.Trim(siteSlugPattern.ReplaceAllString(s, "-"), "-.")
+	if slug == "" {
+		return "_"
+	}
+	return slug
+}
+
+const siteStyle = `
+body { margin: 0 auto; max-width: 960px; padding: 1.5rem; background: %s; color: %s;
+  font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; line-height: 1.5; }
+.muted, nav, footer { color: %s; font-size: 0.9rem; }
+table { border-collapse: collapse; width: 100%%; margin: 0.5rem 0 1.5rem; }
+th, td { padding: 0.3rem 0.6rem; border-bottom: 1px solid %[4]s; text-align: left; }
+td.n, th.n { text-align: right; font-variant-numeric: tabular-nums; }
+a { color: %s; }
+svg { display: block; max-width: 100%%; height: auto; margin: 1rem 0; }
+`
+
+var siteTemplates = template.Must(template.New("site").Funcs(template.FuncMap(TemplateFuncs())).Funcs(template.FuncMap{
+	"releaseStatus": releaseStatus,
+	"date":          func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"time":          func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+}).Parse(`
+{{- define "page" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>{{.Style}}</style>
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">{{.Site.Title}}</a>
+{{- with .Repo}} / <a href="{{$.Root}}{{.Page}}">{{.Owner}}/{{.Repo}}</a>{{end}}
+{{- with .Release}} / {{.Tag}}{{end}}</nav>
+{{if .Release}}{{template "release" .}}{{else if .Repo}}{{template "repo" .}}{{else}}{{template "index" .}}{{end}}
+<footer>Snapshots up to {{time .Site.Updated}} · <a href="{{.Root}}data.json">data.json</a></footer>
+</body>
+</html>
+{{end -}}
+
+{{- define "index" -}}
+<h1>{{.Site.Title}}</h1>
+<p class="muted">Growth over the {{.Site.Days}} days before each repository's latest snapshot.</p>
+<table>
+<tr><th>Repository</th><th class="n">Downloads</th><th class="n">Growth</th><th class="n">Releases</th><th>Latest release</th><th>Updated</th></tr>
+{{range .Site.Repos -}}
+<tr><td><a href="{{.Page}}">{{.Owner}}/{{.Repo}}</a></td><td class="n">{{humanize .TotalDownloads}}</td><td class="n">{{signed .Growth}} ({{printf "%+.1f" .Compare.GrowthPercent}}%)</td><td class="n">{{len .Releases}}</td><td>{{with .LatestRelease}}<a href="{{.Page}}">{{.Tag}}</a>{{end}}</td><td>{{date .FetchedAt}}</td></tr>
+{{end -}}
+</table>
+{{end -}}
+
+{{- define "repo" -}}
+{{with .Repo -}}
+<h1>{{.Owner}}/{{.Repo}}</h1>
+<p class="muted">{{humanize .TotalDownloads}} downloads across {{len .Releases}} releases, {{signed .Growth}} ({{printf "%+.1f" .Compare.GrowthPercent}}%) from {{date .Compare.Oldest.FetchedAt}} to {{date .Compare.Newest.FetchedAt}}.</p>
+{{end -}}
+{{range .Charts}}{{.}}{{end}}
+{{with .Repo -}}
+<h2>Releases</h2>
+<table>
+<tr><th>Release</th><th>Tag</th><th>Published</th><th class="n">Assets</th><th class="n">Downloads</th><th class="n">Growth</th></tr>
+{{range .Releases -}}
+<tr><td>{{.Name}}{{if .Prerelease}} <span class="muted">(pre-release)</span>{{end}}</td><td><a href="{{$.Root}}{{.Page}}">{{.Tag}}</a></td><td>{{date .PublishedAt}}</td><td class="n">{{len .Assets}}</td><td class="n">{{.TotalDownloads}}</td><td class="n">{{printf "%+d" .Growth}}</td></tr>
+{{end -}}
+</table>
+{{with .Compare -}}
+<h2>Changes over {{.Days}} days</h2>
+<table>
+<tr><th>Tag</th><th>Status</th><th class="n">From</th><th class="n">To</th><th class="n">Growth</th></tr>
+{{range .Releases -}}
+<tr><td>{{with $.Repo.ReleasePage .Tag}}<a href="{{$.Root}}{{.}}">{{end}}{{.Tag}}{{if $.Repo.ReleasePage .Tag}}</a>{{end}}</td><td>{{releaseStatus .}}</td><td class="n">{{.OldDownloads}}</td><td class="n">{{.NewDownloads}}</td><td class="n">{{printf "%+d (%+.1f%%)" .Growth .GrowthPercent}}</td></tr>
+{{end -}}
+{{range .NewReleases -}}
+<tr><td><a href="{{$.Root}}{{$.Repo.ReleasePage .Tag}}">{{.Tag}}</a></td><td>new</td><td class="n">-</td><td class="n">{{.TotalDownloads}}</td><td class="n">{{printf "%+d" .TotalDownloads}}</td></tr>
+{{end -}}
+{{range .RemovedReleases -}}
+<tr><td>{{.Tag}}</td><td>removed</td><td class="n">{{.TotalDownloads}}</td><td class="n">-</td><td class="n">-</td></tr>
+{{end -}}
+</table>
+{{end -}}
+{{with .Platforms -}}
+<h2>Downloads by {{.By}}</h2>
+<table>
+<tr><th>{{.By}}</th><th class="n">Assets</th><th class="n">Downloads</th><th class="n">Share</th><th class="n">Growth</th><th class="n">Share of growth</th></tr>
+{{range .Buckets -}}
+<tr><td>{{.Name}}</td><td class="n">{{.Assets}}</td><td class="n">{{.Downloads}}</td><td class="n">{{printf "%.1f%%" .Share}}</td><td class="n">{{printf "%+d" .Growth}}</td><td class="n">{{printf "%.1f%%" .GrowthShare}}</td></tr>
+{{end -}}
+</table>
+{{end -}}
+{{end -}}
+{{end -}}
+
+{{- define "release" -}}
+{{with .Release -}}
+<h1>{{.Tag}}{{if ne .Name .Tag}} <span class="muted">{{.Name}}</span>{{end}}</h1>
+<p class="muted">Published {{date .PublishedAt}}{{if .Prerelease}}, pre-release{{end}}. {{humanize .TotalDownloads}} downloads, {{signed .Growth}} over the period.</p>
+{{end -}}
+{{range .Charts}}{{.}}{{end}}
+{{with .Release -}}
+<h2>Assets</h2>
+<table>
+<tr><th>Asset</th><th>Kind</th><th class="n">Size</th><th class="n">Downloads</th></tr>
+{{range .Assets -}}
+<tr><td>{{.Name}}</td><td>{{.Kind}}</td><td class="n">{{humanize .Size}}B</td><td class="n">{{.DownloadCount}}</td></tr>
+{{end -}}
+</table>
+{{end -}}
+{{end -}}
+`))
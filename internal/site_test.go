@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildSite(t *testing.T) map[string]string {
+	t.Helper()
+	snapshots := sampleSnapshots()
+	snapshots[0].Releases[0].Tag = "release/1.0 <beta>"
+	snapshots[0].Releases[1].PublishedAt = time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	snapshots[0].Releases[1].IsPrerelease = true
+
+	repo, err := NewSiteRepo(snapshots, nil, DimensionOS, PeriodWeek)
+	if err != nil {
+		t.Fatalf("NewSiteRepo failed: %v", err)
+	}
+	if _, err := NewSiteRepo(nil, nil, DimensionOS, PeriodWeek); err == nil {
+		t.Errorf("expected an error without snapshots")
+	}
+
+	theme, _ := ParseChartTheme("light")
+	site := NewSite("Stats & more", 30, theme, []*SiteRepo{repo})
+
+	files := make(map[string]string)
+	var order []string
+	err = site.Build(func(path string, content []byte) error {
+		files[path] = string(content)
+		order = append(order, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if order[0] != "index.html" || order[len(order)-1] != SiteDataFile {
+		t.Errorf("unexpected file order %v", order)
+	}
+	return files
+}
+
+func TestSiteBuildPages(t *testing.T) {
+	files := buildSite(t)
+
+	for _, path := range []string{
+		"index.html",
+		"owner/repo/index.html",
+		"owner/repo/releases/release-1.0-beta.html",
+		"owner/repo/releases/v1.1.0.html",
+		SiteDataFile,
+	} {
+		if _, ok := files[path]; !ok {
+			t.Errorf("missing %s (have %d files)", path, len(files))
+		}
+	}
+
+	index := files["index.html"]
+	if !strings.Contains(index, "Stats &amp; more") || !strings.Contains(index, `href="owner/repo/index.html"`) {
+		t.Errorf("index is missing the title or repository link:\n%s", index)
+	}
+
+	repo := files["owner/repo/index.html"]
+	if !strings.Contains(repo, `href="../../owner/repo/releases/v1.1.0.html"`) {
+		t.Errorf("repository page is missing relative release links:\n%s", repo)
+	}
+	if !strings.Contains(repo, "<svg") || !strings.Contains(repo, "release/1.0 &lt;beta&gt;") {
+		t.Errorf("repository page is missing charts or escaping:\n%s", repo)
+	}
+
+	release := files["owner/repo/releases/v1.1.0.html"]
+	if !strings.Contains(release, `href="../../../index.html"`) || !strings.Contains(release, "asset2.tar.gz") {
+		t.Errorf("release page is missing navigation or assets:\n%s", release)
+	}
+	if !strings.Contains(release, "Published 2024-06-03, pre-release.") {
+		t.Errorf("release page is missing the publish date or pre-release marker:\n%s", release)
+	}
+}
+
+func TestSiteBuildIsDeterministic(t *testing.T) {
+	first, second := buildSite(t), buildSite(t)
+	for path, content := range first {
+		if second[path] != content {
+			t.Errorf("%s differs between builds", path)
+		}
+	}
+
+	var data struct {
+		Repos []struct {
+			Releases []struct {
+				Tag    string `json:"tag"`
+				Page   string `json:"page"`
+				Growth int    `json:"growth"`
+			} `json:"releases"`
+			Compare struct {
+				Growth int `json:"growth"`
+			} `json:"compare"`
+		} `json:"repos"`
+	}
+	if err := json.Unmarshal([]byte(first[SiteDataFile]), &data); err != nil {
+		t.Fatalf("invalid data file: %v", err)
+	}
+	if len(data.Repos) != 1 || data.Repos[0].Compare.Growth != 5 {
+		t.Fatalf("unexpected data %+v", data)
+	}
+	if rel := data.Repos[0].Releases[1]; rel.Tag != "v1.1.0" || rel.Growth != 5 || rel.Page != "owner/repo/releases/v1.1.0.html" {
+		t.Errorf("unexpected release %+v", rel)
+	}
+}
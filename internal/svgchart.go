@@ -0,0 +1,487 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChartKind is the shape of an SVG chart.
+type ChartKind string
+
+const (
+	// ChartLine draws each series as a line of cumulative downloads.
+	ChartLine ChartKind = "line"
+	// ChartArea stacks the cumulative downloads of the series.
+	ChartArea ChartKind = "area"
+	// ChartBar stacks the downloads of each period as bars.
+	ChartBar ChartKind = "bar"
+)
+
+// ParseChartKind validates a chart kind name.
+func ParseChartKind(s string) (ChartKind, error) {
+	switch k := ChartKind(s); k {
+	case ChartLine, ChartArea, ChartBar:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown chart kind %q (want line, area or bar)", s)
+}
+
+// ChartTheme holds the colours of an SVG chart.
+type ChartTheme struct {
+	Background string
+	Text       string
+	Muted      string
+	Grid       string
+	Palette    []string
+}
+
+// chartThemes are the built-in themes. The palettes are colour-blind safe.
+var chartThemes = map[string]ChartTheme{
+	"light": {
+		Background: "#ffffff", Text: "#1f2328", Muted: "#656d76", Grid: "#d0d7de",
+		Palette: []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"},
+	},
+	"dark": {
+		Background: "#0d1117", Text: "#e6edf3", Muted: "#8d96a0", Grid: "#30363d",
+		Palette: []string{"#58a6ff", "#f0883e", "#ff7b72", "#56d4dd", "#7ee787", "#e3b341", "#d2a8ff", "#ffa198", "#c69026", "#8b949e"},
+	},
+	"mono": {
+		Background: "#ffffff", Text: "#000000", Muted: "#555555", Grid: "#dddddd",
+		Palette: []string{"#111111", "#555555", "#888888", "#aaaaaa", "#cccccc", "#333333", "#777777", "#999999"},
+	},
+	// transparent suits README files viewed in both light and dark mode
+	"transparent": {
+		Background: "none", Text: "#808080", Muted: "#808080", Grid: "#80808040",
+		Palette: []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"},
+	},
+}
+
+// ParseChartTheme returns a built-in theme by name.
+func ParseChartTheme(name string) (ChartTheme, error) {
+	if t, ok := chartThemes[name]; ok {
+		return t, nil
+	}
+	names := make([]string, 0, len(chartThemes))
+	for n := range chartThemes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return ChartTheme{}, fmt.Errorf("unknown theme %q (want %s)", name, strings.Join(names, ", "))
+}
+
+// chartSizes are named sizes in pixels: readme for embedding in a README,
+// slide for 16:9 presentations and square for social posts.
+var chartSizes = map[string][2]int{
+	"readme": {800, 400},
+	"slide":  {1600, 900},
+	"square": {800, 800},
+}
+
+// ParseChartSize parses a named size or WIDTHxHEIGHT in pixels.
+func ParseChartSize(s string) (int, int, error) {
+	if size, ok := chartSizes[s]; ok {
+		return size[0], size[1], nil
+	}
+	w, h, ok := strings.Cut(strings.ToLower(s), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil {
+		return 0, 0, fmt.Errorf("invalid size %q (want readme, slide, square or WIDTHxHEIGHT)", s)
+	}
+	if width < 200 || height < 150 || width > 8000 || height > 8000 {
+		return 0, 0, fmt.Errorf("size %q out of range (200x150 to 8000x8000)", s)
+	}
+	return width, height, nil
+}
+
+// Annotation marks a point in time on a chart, such as a launch.
+type Annotation struct {
+	Time  time.Time
+	Label string
+}
+
+// ParseAnnotation parses DATE=LABEL, where DATE is YYYY-MM-DD or RFC3339.
+func ParseAnnotation(s string) (Annotation, error) {
+	date, label, _ := strings.Cut(s, "=")
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02", date, time.Local)
+	}
+	if err != nil {
+		return Annotation{}, fmt.Errorf("invalid annotation %q (want YYYY-MM-DD=label)", s)
+	}
+	return Annotation{Time: t, Label: label}, nil
+}
+
+// SVGChart draws download series as a standalone SVG document. The output
+// depends only on the fields, so regenerating a chart from the same data
+// produces the same file.
+type SVGChart struct {
+	Title    string
+	Subtitle string
+	Kind     ChartKind
+	Theme    ChartTheme
+	Width    int
+	Height   int
+	// Series hold cumulative downloads. Line and area charts plot them as
+	// is; bar charts plot the downloads of each Period.
+	Series      []Series
+	Period      TrendPeriod
+	Annotations []Annotation
+}
+
+// chartLayout holds the plot area and font size derived from the chart size.
+type chartLayout struct {
+	font                     float64
+	left, right, top, bottom float64
+}
+
+func (c *SVGChart) layout() chartLayout {
+	font := math.Max(11, math.Min(28, float64(c.Height)/36))
+	top := font * 2.4
+	if c.Subtitle != "" {
+		top += font * 1.3
+	}
+	bottom := font * 2.6
+	if len(c.Series) > 1 {
+		bottom += font * 1.8
+	}
+	return chartLayout{
+		font:   font,
+		left:   font * 4.5,
+		right:  float64(c.Width) - font*1.5,
+		top:    top,
+		bottom: float64(c.Height) - bottom,
+	}
+}
+
+// stackRow is one x position of a chart with the top of each series.
+type stackRow struct {
+	start, end time.Time
+	values     []float64
+}
+
+// rows samples the series at every observed time (line and area) or period
+// (bar), with values stacked for area and bar charts.
+func (c *SVGChart) rows() []stackRow {
+	if c.Kind == ChartBar {
+		byStart := make(map[time.Time]*stackRow)
+		for i, s := range c.Series {
+			for _, b := range Bucketize(s.Points, c.Period, 1) {
+				row, ok := byStart[b.Start]
+				if !ok {
+					row = &stackRow{start: b.Start, end: c.Period.next(b.Start), values: make([]float64, len(c.Series))}
+					byStart[b.Start] = row
+				}
+				row.values[i] = b.Downloads
+			}
+		}
+		rows := make([]stackRow, 0, len(byStart))
+		for _, row := range byStart {
+			rows = append(rows, *row)
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].start.Before(rows[j].start) })
+		for _, row := range rows {
+			accumulate(row.values)
+		}
+		return rows
+	}
+
+	times := seriesTimes(c.Series)
+	rows := make([]stackRow, len(times))
+	for i, t := range times {
+		rows[i] = stackRow{start: t, end: t, values: make([]float64, len(c.Series))}
+	}
+	for i, s := range c.Series {
+		for j, v := range heldValues(s, times) {
+			rows[j].values[i] = v
+		}
+	}
+	if c.Kind == ChartArea {
+		for _, row := range rows {
+			accumulate(row.values)
+		}
+	}
+	return rows
+}
+
+// seriesTimes returns every time observed in series, in order.
+func seriesTimes(series []Series) []time.Time {
+	seen := make(map[time.Time]bool)
+	var times []time.Time
+	for _, s := range series {
+		for _, p := range s.Points {
+			if !seen[p.Time] {
+				seen[p.Time] = true
+				times = append(times, p.Time)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// heldValues samples s at ordered times: zero before its first point, and
+// its last value since then.
+func heldValues(s Series, times []time.Time) []float64 {
+	values := make([]float64, len(times))
+	next, value := 0, 0.0
+	for i, t := range times {
+		for next < len(s.Points) && !s.Points[next].Time.After(t) {
+			value = s.Points[next].Value
+			next++
+		}
+		values[i] = value
+	}
+	return values
+}
+
+func accumulate(values []float64) {
+	for i := 1; i < len(values); i++ {
+		values[i] += values[i-1]
+	}
+}
+
+// niceStep rounds a raw tick step to 1, 2 or 5 times a power of ten.
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// num formats a coordinate with one decimal.
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// WriteSVG writes the chart as an SVG document.
+func (c *SVGChart) WriteSVG(out io.Writer) error {
+	rows := c.rows()
+	if len(rows) == 0 {
+		return fmt.Errorf("nothing to chart")
+	}
+
+	l := c.layout()
+	t := c.Theme
+	w := bufio.NewWriter(out)
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="-apple-system, BlinkMacSystemFont, 'Segoe UI', Helvetica, Arial, sans-serif" role="img" aria-label="%s">`+"\n",
+		c.Width, c.Height, c.Width, c.Height, escapeXML(c.Title))
+	fmt.Fprintf(w, "<title>%s</title>\n", escapeXML(c.Title))
+	fmt.Fprintf(w, `<rect width="%d" height="%d" fill="%s"/>`+"\n", c.Width, c.Height, t.Background)
+	fmt.Fprintf(w, `<text x="%s" y="%s" font-size="%s" font-weight="600" fill="%s">%s</text>`+"\n",
+		num(l.left), num(l.font*1.6), num(l.font*1.3), t.Text, escapeXML(c.Title))
+	if c.Subtitle != "" {
+		fmt.Fprintf(w, `<text x="%s" y="%s" font-size="%s" fill="%s">%s</text>`+"\n",
+			num(l.left), num(l.font*3), num(l.font), t.Muted, escapeXML(c.Subtitle))
+	}
+
+	// Y axis from zero to a rounded maximum
+	top := 0.0
+	for _, row := range rows {
+		for _, v := range row.values {
+			top = math.Max(top, v)
+		}
+	}
+	step := niceStep(top / 5)
+	yMax := math.Max(step, math.Ceil(top/step)*step)
+	y := func(v float64) float64 { return l.bottom - v/yMax*(l.bottom-l.top) }
+
+	fmt.Fprintf(w, `<g font-size="%s" fill="%s">`+"\n", num(l.font*0.85), t.Muted)
+	for v := 0.0; v <= yMax+step/2; v += step {
+		fmt.Fprintf(w, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="1"/>`+"\n",
+			num(l.left), num(y(v)), num(l.right), num(y(v)), t.Grid)
+		fmt.Fprintf(w, `<text x="%s" y="%s" text-anchor="end">%s</text>`+"\n",
+			num(l.left-l.font*0.5), num(y(v)+l.font*0.3), humanizeFloat(v))
+	}
+
+	// X axis over time; bars span their whole period
+	first, last := rows[0].start, rows[len(rows)-1].end
+	if !last.After(first) {
+		last = first.Add(24 * time.Hour)
+	}
+	x := func(at time.Time) float64 {
+		return l.left + float64(at.Sub(first))/float64(last.Sub(first))*(l.right-l.left)
+	}
+	layoutFmt := "Jan 2"
+	if last.Sub(first) > 300*24*time.Hour {
+		layoutFmt = "Jan 2006"
+	}
+	ticks := max(2, min(8, int((l.right-l.left)/(l.font*7))))
+	for i := 0; i < ticks; i++ {
+		at := first.Add(time.Duration(float64(last.Sub(first)) * float64(i) / float64(ticks-1)))
+		anchor := "middle"
+		if i == 0 {
+			anchor = "start"
+		} else if i == ticks-1 {
+			anchor = "end"
+		}
+		fmt.Fprintf(w, `<text x="%s" y="%s" text-anchor="%s">%s</text>`+"\n",
+			num(x(at)), num(l.bottom+l.font*1.5), anchor, at.Format(layoutFmt))
+	}
+	fmt.Fprintln(w, "</g>")
+
+	fmt.Fprintln(w, `<g stroke-linejoin="round">`)
+	switch c.Kind {
+	case ChartBar:
+		for _, row := range rows {
+			x0, x1 := x(row.start), x(row.end)
+			pad := (x1 - x0) * 0.1
+			base := 0.0
+			for i, v := range row.values {
+				if v > base {
+					fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+						num(x0+pad), num(y(v)), num(x1-x0-2*pad), num(y(base)-y(v)), c.color(i))
+				}
+				base = v
+			}
+		}
+	case ChartArea:
+		// Draw from the top of the stack down so every band is visible
+		for i := len(c.Series) - 1; i >= 0; i-- {
+			var path strings.Builder
+			for j, row := range rows {
+				cmd := "L"
+				if j == 0 {
+					cmd = "M"
+				}
+				fmt.Fprintf(&path, "%s%s %s ", cmd, num(x(row.start)), num(y(row.values[i])))
+			}
+			for j := len(rows) - 1; j >= 0; j-- {
+				base := 0.0
+				if i > 0 {
+					base = rows[j].values[i-1]
+				}
+				fmt.Fprintf(&path, "L%s %s ", num(x(rows[j].start)), num(y(base)))
+			}
+			fmt.Fprintf(w, `<path d="%sZ" fill="%s" fill-opacity="0.85"/>`+"\n", path.String(), c.color(i))
+		}
+	default:
+		for i, s := range c.Series {
+			var path strings.Builder
+			for j, p := range s.Points {
+				cmd := "L"
+				if j == 0 {
+					cmd = "M"
+				}
+				fmt.Fprintf(&path, "%s%s %s ", cmd, num(x(p.Time)), num(y(p.Value)))
+			}
+			fmt.Fprintf(w, `<path d="%s" fill="none" stroke="%s" stroke-width="%s"/>`+"\n",
+				strings.TrimSpace(path.String()), c.color(i), num(math.Max(2, l.font/6)))
+		}
+	}
+	fmt.Fprintln(w, "</g>")
+
+	c.writeAnnotations(w, l, x, first, last)
+	c.writeLegend(w, l)
+
+	fmt.Fprintln(w, "</svg>")
+	return w.Flush()
+}
+
+// color returns the palette colour of series i.
+func (c *SVGChart) color(i int) string {
+	return c.Theme.Palette[i%len(c.Theme.Palette)]
+}
+
+// writeAnnotations draws a dashed marker with a label for each annotation
+// within the time range. Labels are staggered so neighbours do not overlap.
+func (c *SVGChart) writeAnnotations(w io.Writer, l chartLayout, x func(time.Time) float64, first, last time.Time) {
+	shown := 0
+	for _, a := range c.Annotations {
+		if a.Time.Before(first) || a.Time.After(last) {
+			continue
+		}
+		if shown == 0 {
+			fmt.Fprintf(w, `<g font-size="%s" fill="%s">`+"\n", num(l.font*0.8), c.Theme.Text)
+		}
+		ax := x(a.Time)
+		fmt.Fprintf(w, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s" stroke-width="1" stroke-dasharray="4 3"/>`+"\n",
+			num(ax), num(l.top), num(ax), num(l.bottom), c.Theme.Muted)
+		if a.Label != "" {
+			anchor, dx := "start", l.font*0.3
+			if ax > (l.left+l.right)/2 {
+				anchor, dx = "end", -l.font*0.3
+			}
+			fmt.Fprintf(w, `<text x="%s" y="%s" text-anchor="%s">%s</text>`+"\n",
+				num(ax+dx), num(l.top+l.font*(1+float64(shown%3)*1.1)), anchor, escapeXML(a.Label))
+		}
+		shown++
+	}
+	if shown > 0 {
+		fmt.Fprintln(w, "</g>")
+	}
+}
+
+// writeLegend lays out series names in a row below the x axis.
+func (c *SVGChart) writeLegend(w io.Writer, l chartLayout) {
+	if len(c.Series) < 2 {
+		return
+	}
+	size := l.font * 0.8
+	y := float64(c.Height) - l.font*1.2
+	x := l.left
+	fmt.Fprintf(w, `<g font-size="%s" fill="%s">`+"\n", num(l.font*0.85), c.Theme.Text)
+	for i, s := range c.Series {
+		// Approximate text width; legends that overflow are cut short
+		width := size*1.6 + float64(len(s.Key))*l.font*0.55 + l.font
+		if x+width > float64(c.Width) {
+			fmt.Fprintf(w, `<text x="%s" y="%s">…</text>`+"\n", num(x), num(y))
+			break
+		}
+		fmt.Fprintf(w, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+			num(x), num(y-size), num(size), num(size), c.color(i))
+		fmt.Fprintf(w, `<text x="%s" y="%s">%s</text>`+"\n", num(x+size*1.4), num(y), escapeXML(s.Key))
+		x += width
+	}
+	fmt.Fprintln(w, "</g>")
+}
+
+// TopSeries keeps the n series with the most downloads at their latest
+// point, largest first. With other set, the rest are summed into a series
+// named "other" so stacked charts still add up to the total.
+func TopSeries(series []Series, n int, other bool) []Series {
+	sorted := make([]Series, len(series))
+	copy(sorted, series)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Latest() > sorted[j].Latest() })
+	if n <= 0 || len(sorted) <= n {
+		return sorted
+	}
+
+	top, rest := sorted[:n], sorted[n:]
+	if !other {
+		return top
+	}
+
+	times := seriesTimes(rest)
+	merged := Series{Key: "other", Points: make([]Point, len(times))}
+	for i, t := range times {
+		merged.Points[i].Time = t
+	}
+	for _, s := range rest {
+		for i, v := range heldValues(s, times) {
+			merged.Points[i].Value += v
+		}
+	}
+	return append(top, merged)
+}
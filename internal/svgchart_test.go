@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func chartSeries() []Series {
+	first := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(day int) time.Time { return first.AddDate(0, 0, day) }
+	return []Series{
+		{Key: "v1.0.0", Points: []Point{{at(0), 100}, {at(7), 200}, {at(14), 260}}},
+		{Key: "v1.1.0", Points: []Point{{at(7), 10}, {at(14), 90}}},
+		{Key: "v0.9.0", Points: []Point{{at(0), 5}, {at(14), 6}}},
+	}
+}
+
+func TestSVGChartIsWellFormedAndDeterministic(t *testing.T) {
+	theme, err := ParseChartTheme("dark")
+	if err != nil {
+		t.Fatalf("ParseChartTheme failed: %v", err)
+	}
+
+	for _, kind := range []ChartKind{ChartLine, ChartArea, ChartBar} {
+		chart := &SVGChart{
+			Title:       "acme & co",
+			Kind:        kind,
+			Theme:       theme,
+			Width:       800,
+			Height:      400,
+			Series:      chartSeries(),
+			Period:      PeriodWeek,
+			Annotations: []Annotation{{Time: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC), Label: "<launch>"}},
+		}
+
+		var first, second bytes.Buffer
+		if err := chart.WriteSVG(&first); err != nil {
+			t.Fatalf("%s: WriteSVG failed: %v", kind, err)
+		}
+		if err := chart.WriteSVG(&second); err != nil {
+			t.Fatalf("%s: WriteSVG failed: %v", kind, err)
+		}
+		if first.String() != second.String() {
+			t.Fatalf("%s: output is not deterministic", kind)
+		}
+
+		dec := xml.NewDecoder(strings.NewReader(first.String()))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: invalid SVG: %v\n%s", kind, err, first.String())
+			}
+		}
+		if !strings.Contains(first.String(), "&lt;launch&gt;") || !strings.Contains(first.String(), "#58a6ff") {
+			t.Errorf("%s: expected the escaped annotation and theme palette", kind)
+		}
+	}
+}
+
+func TestSVGChartStacksAreas(t *testing.T) {
+	chart := &SVGChart{Kind: ChartArea, Series: chartSeries()}
+	rows := chart.rows()
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+	// v1.1.0 is zero before its first point and stacks on v1.0.0
+	if got := rows[0].values; got[0] != 100 || got[1] != 100 || got[2] != 105 {
+		t.Errorf("unexpected first row %v", got)
+	}
+	// v0.9.0 holds its value between observations
+	if got := rows[1].values; got[0] != 200 || got[1] != 210 || got[2] != 215 {
+		t.Errorf("unexpected second row %v", got)
+	}
+}
+
+func TestTopSeriesMergesOther(t *testing.T) {
+	top := TopSeries(chartSeries(), 1, true)
+	if len(top) != 2 || top[0].Key != "v1.0.0" || top[1].Key != "other" {
+		t.Fatalf("unexpected series %+v", top)
+	}
+	if top[1].Latest() != 96 {
+		t.Errorf("expected other to sum to 96, got %v", top[1].Latest())
+	}
+	if got := TopSeries(chartSeries(), 1, false); len(got) != 1 {
+		t.Errorf("expected the rest to be dropped, got %+v", got)
+	}
+}
+
+func TestParseChartOptions(t *testing.T) {
+	if w, h, err := ParseChartSize("slide"); err != nil || w != 1600 || h != 900 {
+		t.Errorf("ParseChartSize(slide) = %d, %d, %v", w, h, err)
+	}
+	if w, h, err := ParseChartSize("1200x630"); err != nil || w != 1200 || h != 630 {
+		t.Errorf("ParseChartSize(1200x630) = %d, %d, %v", w, h, err)
+	}
+	for _, bad := range []string{"big", "10x10", "800"} {
+		if _, _, err := ParseChartSize(bad); err == nil {
+			t.Errorf("expected an error for size %q", bad)
+		}
+	}
+
+	a, err := ParseAnnotation("2024-05-01=v2.0 launch")
+	if err != nil || a.Label != "v2.0 launch" || a.Time.Day() != 1 {
+		t.Errorf("ParseAnnotation = %+v, %v", a, err)
+	}
+	if _, err := ParseAnnotation("May 1st"); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+	if _, err := ParseChartTheme("neon"); err == nil {
+		t.Error("expected an error for an unknown theme")
+	}
+}
@@ -0,0 +1,358 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// builtinTemplates holds the named templates shipped with the tool, keyed by
+// report kind and then by name.
+var builtinTemplates = map[string]map[string]string{
+	"snapshot": {
+		"slack": `*{{.Owner}}/{{.Repo}}*: {{humanize .TotalDownloads}} downloads across {{.TotalReleases}} releases
+{{range limit 5 (sortBy "-TotalDownloads" .Releases)}}• ` + "`{{.Tag}}`" + ` {{humanize .TotalDownloads}} ({{percent .TotalDownloads $.TotalDownloads}})
+{{end}}`,
+		"readme-table": `| Release | Published | Downloads |
+|---|---|---:|
+{{range sortBy "-semver:Tag" .Releases}}| {{.Tag}} | {{.ReleaseDate.Format "2006-01-02"}} | {{humanize .TotalDownloads}} |
+{{end}}`,
+		"changelog": `## Download statistics ({{.FetchedAt.Format "2006-01-02"}})
+
+{{range sortBy "-semver:Tag" .Releases}}- **{{.Tag}}**: {{humanize .TotalDownloads}} downloads
+{{end}}`,
+	},
+	"history": {
+		"slack": `*{{.Owner}}/{{.Repo}}* download history
+{{range .Snapshots}}• {{.FetchedAt.Format "2006-01-02 15:04"}}: {{humanize .TotalDownloads}} downloads, {{.TotalReleases}} releases
+{{end}}`,
+		"readme-table": `| Date | Releases | Downloads |
+|---|---:|---:|
+{{range .Snapshots}}| {{.FetchedAt.Format "2006-01-02"}} | {{.TotalReleases}} | {{humanize .TotalDownloads}} |
+{{end}}`,
+	},
+	"compare": {
+		"slack": `*{{.Owner}}/{{.Repo}}*: {{signed .Growth}} downloads ({{printf "%+.1f" .GrowthPercent}}%) over {{.Days}} days
+{{range limit 5 .Releases}}• ` + "`{{.Tag}}`" + ` {{signed .Growth}}
+{{end}}{{range .NewReleases}}• ` + "`{{.Tag}}`" + ` new, {{humanize .TotalDownloads}} downloads
+{{end}}`,
+		"changelog": `## Download growth, {{.Oldest.FetchedAt.Format "2006-01-02"}} to {{.Newest.FetchedAt.Format "2006-01-02"}}
+
+Total downloads {{if lt .Growth 0}}fell by {{slice (humanize .Growth) 1}}{{else}}grew by {{humanize .Growth}}{{end}} to {{humanize .Newest.TotalDownloads}}.
+
+{{range sortBy "-semver:Tag" .Releases}}- **{{.Tag}}**: {{signed .Growth}}
+{{end}}`,
+	},
+	"diff": {
+		"slack": `*{{.Owner}}/{{.Repo}}*: {{signed .Growth}} downloads since {{.Previous.FetchedAt.Format "2006-01-02 15:04"}}
+{{range .NewReleases}}• new ` + "`{{.Tag}}`" + ` {{humanize .TotalDownloads}}
+{{end}}{{range limit 5 .Releases}}{{if .Growth}}• ` + "`{{.Tag}}`" + ` {{signed .Growth}}
+{{end}}{{end}}`,
+	},
+	"forecast": {
+		"slack": `*{{.Owner}}/{{.Repo}}*: {{humanize .Current.TotalDownloads}} downloads, {{.Days}}-day forecast
+{{range .Models}}• {{.Model}}: {{humanize .Final.Value}} ({{humanize .Final.Lower}} to {{humanize .Final.Upper}}){{with .Target}}{{if .Reached}}, {{humanize .Target}} reached{{else if .Date}}, {{humanize .Target}} by {{.Date.Format "2006-01-02"}}{{end}}{{end}}
+{{end}}`,
+	},
+	"leaderboard": {
+		"slack": `*Leaderboard by {{.Metric}}*, {{.Start.Format "2006-01-02"}} to {{.End.Format "2006-01-02"}}
+{{range .Repos}}{{.Rank}}. *{{.Owner}}/{{.Repo}}* {{humanize .TotalDownloads}} downloads, {{signed .Growth}}{{if .PreviousRank}}{{if .RankChange}} (was #{{.PreviousRank}}){{end}}{{else}} (new){{end}}
+{{end}}`,
+	},
+	"platforms": {
+		"slack": `*{{.Owner}}/{{.Repo}}* downloads by {{.By}}
+{{range .Buckets}}• {{.Name}}: {{humanize .Downloads}} ({{printf "%.1f" .Share}}%), {{signed .Growth}} since {{$.Oldest.FetchedAt.Format "2006-01-02"}}
+{{end}}`,
+	},
+	"trend": {
+		"slack": `*{{.Owner}}/{{.Repo}}* download trend
+{{range limit 5 .Series}}• ` + "`{{.Key}}`" + ` {{humanize .Summary.PerDay}}/day{{with .Summary.WeekOverWeek}} ({{signed .}}% week over week){{end}}
+{{end}}`,
+	},
+}
+
+func templateKind(r Report) string {
+	switch r.(type) {
+	case *SnapshotReport:
+		return "snapshot"
+	case *HistoryReport:
+		return "history"
+	case *CompareReport:
+		return "compare"
+	case *DiffReport:
+		return "diff"
+	case *TrendReport:
+		return "trend"
+	case *ForecastReport:
+		return "forecast"
+	case *PlatformReport:
+		return "platforms"
+	case *LeaderboardReport:
+		return "leaderboard"
+	}
+	return ""
+}
+
+// BuiltinTemplateNames lists the named templates available for r.
+func BuiltinTemplateNames(r Report) []string {
+	names := make([]string, 0)
+	for name := range builtinTemplates[templateKind(r)] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderTemplate executes a text/template against r. The spec is the name
+// of a built-in template, a path to a template file, or an inline template.
+func RenderTemplate(w io.Writer, spec string, r Report) error {
+	text, err := resolveTemplate(spec, r)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("output").Funcs(TemplateFuncs()).Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	if err := tmpl.Execute(w, r); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+	return nil
+}
+
+func resolveTemplate(spec string, r Report) (string, error) {
+	if text, ok := builtinTemplates[templateKind(r)][spec]; ok {
+		return text, nil
+	}
+
+	data, err := os.ReadFile(spec)
+	if err == nil {
+		return string(data), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read template: %w", err)
+	}
+
+	if strings.Contains(spec, "{{") {
+		return spec, nil
+	}
+	return "", fmt.Errorf("unknown template %q (built-in: %s)", spec, strings.Join(BuiltinTemplateNames(r), ", "))
+}
+
+// TemplateFuncs returns the helper functions available to templates.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"humanize": humanize,
+		"signed":   signed,
+		"percent":  percent,
+		"sum":      sumField,
+		"sortBy":   sortBy,
+		"limit":    limit,
+		"semver":   ParseVersion,
+	}
+}
+
+// humanize abbreviates a number: 950, 12.3k, 4.5M, 1.2B.
+func humanize(v any) (string, error) {
+	n, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return humanizeFloat(n), nil
+}
+
+func humanizeFloat(n float64) string {
+	abs := math.Abs(n)
+	for _, u := range []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "k"}} {
+		// Rounding to one decimal may carry into the larger unit: 999950
+		// is 1M rather than 1000.0k
+		if abs >= u.size || math.Round(abs/u.size*1e4) >= 1e4 {
+			s := fmt.Sprintf("%.1f", n/u.size)
+			return strings.TrimSuffix(s, ".0") + u.suffix
+		}
+	}
+	if n == math.Trunc(n) {
+		return fmt.Sprintf("%.0f", n)
+	}
+	return fmt.Sprintf("%.1f", n)
+}
+
+// signed humanizes a number with an explicit sign.
+func signed(v any) (string, error) {
+	n, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	if n >= 0 {
+		return "+" + humanizeFloat(n), nil
+	}
+	return humanizeFloat(n), nil
+}
+
+// percent formats part as a percentage of whole.
+func percent(part, whole any) (string, error) {
+	p, err := toFloat(part)
+	if err != nil {
+		return "", err
+	}
+	t, err := toFloat(whole)
+	if err != nil {
+		return "", err
+	}
+	if t == 0 {
+		return "0.0%", nil
+	}
+	return fmt.Sprintf("%.1f%%", p/t*100), nil
+}
+
+// sumField adds up a numeric field across a slice of structs. An empty field
+// sums the elements themselves.
+func sumField(field string, list any) (float64, error) {
+	items, err := sliceOf(list)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, item := range items {
+		v, err := fieldOf(item, field)
+		if err != nil {
+			return 0, err
+		}
+		n, err := toFloat(v.Interface())
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// sortBy returns a sorted copy of a slice of structs. A leading "-" sorts in
+// descending order and a "semver:" prefix compares the field as a version.
+func sortBy(key string, list any) (any, error) {
+	items, err := sliceOf(list)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+	asVersion := strings.HasPrefix(key, "semver:")
+	key = strings.TrimPrefix(key, "semver:")
+
+	keys := make([]reflect.Value, len(items))
+	for i, item := range items {
+		if keys[i], err = fieldOf(item, key); err != nil {
+			return nil, err
+		}
+	}
+
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		c := compareValues(keys[idx[a]], keys[idx[b]], asVersion)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	rv := reflect.ValueOf(list)
+	out := reflect.MakeSlice(rv.Type(), 0, len(items))
+	for _, i := range idx {
+		out = reflect.Append(out, items[i])
+	}
+	return out.Interface(), nil
+}
+
+// limit returns at most the first n elements of a slice.
+func limit(n int, list any) (any, error) {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("limit: expected a slice, got %T", list)
+	}
+	if n < rv.Len() {
+		return rv.Slice(0, n).Interface(), nil
+	}
+	return list, nil
+}
+
+func sliceOf(list any) ([]reflect.Value, error) {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("expected a slice, got %T", list)
+	}
+	items := make([]reflect.Value, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i)
+	}
+	return items, nil
+}
+
+func fieldOf(item reflect.Value, field string) (reflect.Value, error) {
+	for item.Kind() == reflect.Pointer || item.Kind() == reflect.Interface {
+		item = item.Elem()
+	}
+	if field == "" {
+		return item, nil
+	}
+	if item.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("cannot read field %q of %s", field, item.Type())
+	}
+	v := item.FieldByName(field)
+	if !v.IsValid() {
+		return reflect.Value{}, fmt.Errorf("%s has no field %q", item.Type(), field)
+	}
+	return v, nil
+}
+
+func compareValues(a, b reflect.Value, asVersion bool) int {
+	if asVersion {
+		return ParseVersion(a.String()).Compare(ParseVersion(b.String()))
+	}
+	if t, ok := a.Interface().(time.Time); ok {
+		return t.Compare(b.Interface().(time.Time))
+	}
+	if a.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String())
+	}
+	x, _ := toFloat(a.Interface())
+	y, _ := toFloat(b.Interface())
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v any) (float64, error) {
+	rv := reflect.ValueOf(v)
+	// Optional values such as TrendSummary.WeekOverWeek are pointers
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", v)
+}
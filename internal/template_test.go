@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplateInline(t *testing.T) {
+	var buf bytes.Buffer
+	spec := `{{range sortBy "-TotalDownloads" .Releases}}{{.Tag}}={{humanize .TotalDownloads}} {{end}}total={{sum "TotalDownloads" .Releases}}`
+	if err := RenderTemplate(&buf, spec, NewSnapshotReport(sampleStats(), false)); err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	if got, want := buf.String(), "v1.1.0=10 v1.0.0=5 total=15"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRenderTemplateBuiltin(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderTemplate(&buf, "slack", NewSnapshotReport(sampleStats(), false)); err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	out := buf.String()
+	for _, c := range []string{"*owner/repo*: 15 downloads across 2 releases", "`v1.1.0` 10 (66.7%)"} {
+		if !strings.Contains(out, c) {
+			t.Fatalf("expected output to contain %q, got:\n%s", c, out)
+		}
+	}
+}
+
+func TestRenderTemplateReleaseDates(t *testing.T) {
+	stats := sampleStats()
+	stats.Releases[1].PublishedAt = time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := RenderTemplate(&buf, "readme-table", NewSnapshotReport(stats, false)); err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	// Releases without a publish date fall back to their creation date
+	for _, c := range []string{"| v1.1.0 | 2024-06-03 | 10 |", "| v1.0.0 | 2024-05-01 | 5 |"} {
+		if !strings.Contains(buf.String(), c) {
+			t.Fatalf("expected output to contain %q, got:\n%s", c, buf.String())
+		}
+	}
+
+	newest := sampleStats()
+	newest.Releases[1].TotalDownloads = 2
+	newest.TotalDownloads = 7
+	buf.Reset()
+	if err := RenderTemplate(&buf, "changelog", NewCompareReport(sampleStats(), newest)); err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	if c := "Total downloads fell by 8 to 7."; !strings.Contains(buf.String(), c) {
+		t.Fatalf("expected output to contain %q, got:\n%s", c, buf.String())
+	}
+}
+
+func TestRenderTemplateUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	err := RenderTemplate(&buf, "no-such-template", NewSnapshotReport(sampleStats(), false))
+	if err == nil || !strings.Contains(err.Error(), "changelog, readme-table, slack") {
+		t.Fatalf("expected unknown template error listing built-ins, got %v", err)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	cases := map[int]string{
+		0:          "0",
+		950:        "950",
+		1000:       "1k",
+		12345:      "12.3k",
+		4500000:    "4.5M",
+		1200000000: "1.2B",
+		-2500:      "-2.5k",
+		999949:     "999.9k",
+		999950:     "1M",
+	}
+	for in, want := range cases {
+		got, err := humanize(in)
+		if err != nil || got != want {
+			t.Fatalf("humanize(%d) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+}
+
+func TestSortBySemver(t *testing.T) {
+	releases := []Release{{Tag: "v1.10.0"}, {Tag: "v1.2.0"}, {Tag: "v1.10.0-rc.1"}, {Tag: "nightly"}}
+	sorted, err := sortBy("-semver:Tag", releases)
+	if err != nil {
+		t.Fatalf("sortBy failed: %v", err)
+	}
+	var tags []string
+	for _, rel := range sorted.([]Release) {
+		tags = append(tags, rel.Tag)
+	}
+	if got, want := strings.Join(tags, " "), "v1.10.0 v1.10.0-rc.1 v1.2.0 nightly"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
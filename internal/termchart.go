@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// ChartStyle controls the charts drawn in text output. The zero value draws
+// no charts.
+type ChartStyle struct {
+	// Width is the number of terminal columns charts may use.
+	Width int
+	// ASCII draws with plain ASCII characters, for output that is not a
+	// terminal.
+	ASCII bool
+}
+
+// Enabled reports whether charts should be drawn.
+func (s ChartStyle) Enabled() bool {
+	return s.Width > 0
+}
+
+// maxChartWidth keeps charts readable on very wide terminals.
+const maxChartWidth = 120
+
+// span returns the columns left for a chart after reserved columns, between
+// min and maxChartWidth.
+func (s ChartStyle) span(reserved, min int) int {
+	w := s.Width
+	if w > maxChartWidth {
+		w = maxChartWidth
+	}
+	w -= reserved
+	if w < min {
+		return min
+	}
+	return w
+}
+
+// ChartedReport is a report that can draw terminal charts in its text output.
+type ChartedReport interface {
+	Report
+	SetChartStyle(ChartStyle)
+}
+
+var (
+	sparkUnicode = []rune("▁▂▃▄▅▆▇█")
+	sparkASCII   = []rune("_.-:=+*#")
+	// barEighths are the partial blocks for one to seven eighths of a cell.
+	barEighths = []rune("▏▎▍▌▋▊▉")
+	// stackUnicode and stackASCII fill the segments of stacked bars.
+	stackUnicode = []rune("█▓▒░▚▞▖▘")
+	stackASCII   = []rune("#=+-:o*.")
+)
+
+// Sparkline draws values, oldest first, as one character per value. When
+// there are more values than width, neighbouring values are averaged.
+func Sparkline(values []float64, width int, ascii bool) string {
+	levels := sparkUnicode
+	if ascii {
+		levels = sparkASCII
+	}
+	values = resample(values, width)
+	if len(values) == 0 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if hi > lo {
+			level = int(math.Round((v - lo) / (hi - lo) * float64(len(levels)-1)))
+		}
+		b.WriteRune(levels[level])
+	}
+	return b.String()
+}
+
+// resample averages values into at most width buckets.
+func resample(values []float64, width int) []float64 {
+	if width <= 0 || len(values) <= width {
+		return values
+	}
+	out := make([]float64, width)
+	for i := range out {
+		from := i * len(values) / width
+		to := (i + 1) * len(values) / width
+		sum := 0.0
+		for _, v := range values[from:to] {
+			sum += v
+		}
+		out[i] = sum / float64(to-from)
+	}
+	return out
+}
+
+// HBar draws value as a horizontal bar, where max fills width columns.
+func HBar(value, max float64, width int, ascii bool) string {
+	if max <= 0 || value <= 0 || width <= 0 {
+		return ""
+	}
+	cells := math.Min(value/max, 1) * float64(width)
+	if ascii {
+		return strings.Repeat("#", int(math.Round(cells)))
+	}
+
+	full := int(cells)
+	bar := strings.Repeat("█", full)
+	if eighths := int(math.Round((cells - float64(full)) * 8)); eighths == 8 {
+		bar += "█"
+	} else if eighths > 0 {
+		bar += string(barEighths[eighths-1])
+	} else if full == 0 {
+		// Keep small positive values visible
+		bar = string(barEighths[0])
+	}
+	return bar
+}
+
+// StackFill returns the character filling segment i of a stacked bar, for
+// use in legends.
+func StackFill(i int, ascii bool) string {
+	fills := stackUnicode
+	if ascii {
+		fills = stackASCII
+	}
+	return string(fills[i%len(fills)])
+}
+
+// StackedBar draws parts as adjacent segments of a bar width columns wide,
+// each proportional to its share of the sum. Segment i is filled with
+// StackFill(i).
+func StackedBar(parts []float64, width int, ascii bool) string {
+	total := 0.0
+	for _, p := range parts {
+		total += math.Max(p, 0)
+	}
+	if total == 0 || width <= 0 {
+		return ""
+	}
+
+	// Largest remainder rounding so the segments add up to width
+	cells := make([]int, len(parts))
+	type remainder struct {
+		i    int
+		frac float64
+	}
+	rems := make([]remainder, 0, len(parts))
+	used := 0
+	for i, p := range parts {
+		exact := math.Max(p, 0) / total * float64(width)
+		cells[i] = int(exact)
+		used += cells[i]
+		rems = append(rems, remainder{i, exact - float64(cells[i])})
+	}
+	sort.SliceStable(rems, func(a, b int) bool { return rems[a].frac > rems[b].frac })
+	for k := 0; used < width; k++ {
+		cells[rems[k].i]++
+		used++
+	}
+
+	var b strings.Builder
+	for i, n := range cells {
+		b.WriteString(strings.Repeat(StackFill(i, ascii), n))
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSparkline(t *testing.T) {
+	if got := Sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}, 20, false); got != "▁▂▃▄▅▆▇█" {
+		t.Errorf("unexpected sparkline %q", got)
+	}
+	if got := Sparkline([]float64{0, 7}, 20, true); got != "_#" {
+		t.Errorf("unexpected ASCII sparkline %q", got)
+	}
+	// Values beyond the width are averaged in pairs
+	if got := Sparkline([]float64{0, 0, 5, 5, 10, 10}, 3, false); got != "▁▅█" {
+		t.Errorf("unexpected resampled sparkline %q", got)
+	}
+	if got := Sparkline([]float64{3, 3, 3}, 10, false); got != "▁▁▁" {
+		t.Errorf("expected a flat sparkline, got %q", got)
+	}
+}
+
+func TestHBar(t *testing.T) {
+	if got := HBar(50, 100, 10, false); got != "█████" {
+		t.Errorf("unexpected bar %q", got)
+	}
+	if got := HBar(55, 100, 10, false); got != "█████▌" {
+		t.Errorf("expected a half block, got %q", got)
+	}
+	if got := HBar(1, 1000, 10, false); got != "▏" {
+		t.Errorf("expected small values to stay visible, got %q", got)
+	}
+	if got := HBar(100, 100, 10, true); got != "##########" {
+		t.Errorf("unexpected ASCII bar %q", got)
+	}
+	if got := HBar(0, 100, 10, false); got != "" {
+		t.Errorf("expected no bar for zero, got %q", got)
+	}
+}
+
+func TestStackedBarFillsWidth(t *testing.T) {
+	bar := StackedBar([]float64{1, 1, 1}, 10, true)
+	if bar != "####===+++" {
+		t.Errorf("unexpected stacked bar %q", bar)
+	}
+	if n := utf8.RuneCountInString(StackedBar([]float64{5, 3, 2, 1}, 33, false)); n != 33 {
+		t.Errorf("expected 33 columns, got %d", n)
+	}
+}
+
+func TestReportsDrawChartsOnlyWhenEnabled(t *testing.T) {
+	report := NewSnapshotReport(sampleStats(), false)
+
+	var plain bytes.Buffer
+	if err := report.WriteText(&plain); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if strings.Contains(plain.String(), "Downloads by release") {
+		t.Fatal("expected no chart without a chart style")
+	}
+
+	report.SetChartStyle(ChartStyle{Width: 40, ASCII: true})
+	var charted bytes.Buffer
+	if err := report.WriteText(&charted); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if !strings.Contains(charted.String(), "Downloads by release") || strings.ContainsRune(charted.String(), '█') {
+		t.Fatalf("expected an ASCII bar chart:\n%s", charted.String())
+	}
+	for _, line := range strings.Split(charted.String(), "\n") {
+		if strings.Contains(line, "#") && utf8.RuneCountInString(line) > 40 {
+			t.Errorf("chart line wider than the terminal: %q", line)
+		}
+	}
+}
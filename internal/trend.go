@@ -0,0 +1,330 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// TrendPeriod is the bucket size of a trend.
+type TrendPeriod string
+
+const (
+	PeriodDay   TrendPeriod = "day"
+	PeriodWeek  TrendPeriod = "week"
+	PeriodMonth TrendPeriod = "month"
+)
+
+// ParseTrendPeriod validates a period name.
+func ParseTrendPeriod(s string) (TrendPeriod, error) {
+	switch p := TrendPeriod(s); p {
+	case PeriodDay, PeriodWeek, PeriodMonth:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown period %q (want day, week or month)", s)
+}
+
+// start returns the beginning of the bucket containing t, in UTC. Weeks
+// start on Monday.
+func (p TrendPeriod) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case PeriodWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// next returns the beginning of the bucket after the one starting at start.
+func (p TrendPeriod) next(start time.Time) time.Time {
+	switch p {
+	case PeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// TrendBucket holds the downloads attributed to one period. Downloads between
+// two snapshots are spread evenly over the time between them, so a bucket
+// may receive a share of an interval that straddles its boundary.
+type TrendBucket struct {
+	Start     time.Time `json:"start" yaml:"start"`
+	Downloads float64   `json:"downloads" yaml:"downloads"`
+	// CoveredDays is how much of the bucket lies between observations.
+	CoveredDays float64 `json:"covered_days" yaml:"covered_days"`
+	// PerDay is Downloads divided by CoveredDays.
+	PerDay float64 `json:"per_day" yaml:"per_day"`
+	// MovingAverage is the mean PerDay over the trailing window of buckets.
+	MovingAverage float64 `json:"moving_average" yaml:"moving_average"`
+	// ChangePercent compares PerDay with the previous bucket; nil for the
+	// first bucket or when the previous rate was zero.
+	ChangePercent *float64 `json:"change_percent" yaml:"change_percent"`
+}
+
+// Bucketize spreads the increases of a cumulative series over periods.
+func Bucketize(points []Point, period TrendPeriod, window int) []TrendBucket {
+	intervals := Intervals(points)
+	if len(intervals) == 0 {
+		return []TrendBucket{}
+	}
+
+	buckets := make([]TrendBucket, 0)
+	index := make(map[time.Time]int)
+	for _, iv := range intervals {
+		total := iv.End.Sub(iv.Start)
+		for start := period.start(iv.Start); start.Before(iv.End); start = period.next(start) {
+			end := period.next(start)
+			segStart, segEnd := maxTime(start, iv.Start), minTime(end, iv.End)
+			seg := segEnd.Sub(segStart)
+			if seg <= 0 {
+				continue
+			}
+			i, ok := index[start]
+			if !ok {
+				i = len(buckets)
+				index[start] = i
+				buckets = append(buckets, TrendBucket{Start: start})
+			}
+			buckets[i].Downloads += iv.Downloads * float64(seg) / float64(total)
+			buckets[i].CoveredDays += seg.Hours() / 24
+		}
+	}
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+
+	if window < 1 {
+		window = 1
+	}
+	for i := range buckets {
+		b := &buckets[i]
+		if b.CoveredDays > 0 {
+			b.PerDay = b.Downloads / b.CoveredDays
+		}
+
+		var sum float64
+		n := 0
+		for j := i; j >= 0 && j > i-window; j-- {
+			sum += buckets[j].PerDay
+			n++
+		}
+		b.MovingAverage = sum / float64(n)
+
+		if i > 0 && buckets[i-1].PerDay > 0 {
+			change := (b.PerDay - buckets[i-1].PerDay) / buckets[i-1].PerDay * 100
+			b.ChangePercent = &change
+		}
+	}
+
+	return buckets
+}
+
+// downloadsBetween estimates the downloads between from and to by spreading
+// each interval evenly over its duration.
+func downloadsBetween(intervals []Interval, from, to time.Time) (downloads, coveredDays float64) {
+	for _, iv := range intervals {
+		segStart, segEnd := maxTime(from, iv.Start), minTime(to, iv.End)
+		seg := segEnd.Sub(segStart)
+		if seg <= 0 {
+			continue
+		}
+		downloads += iv.Downloads * float64(seg) / float64(iv.End.Sub(iv.Start))
+		coveredDays += seg.Hours() / 24
+	}
+	return downloads, coveredDays
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// TrendSummary condenses a series over the whole range.
+type TrendSummary struct {
+	Downloads float64 `json:"downloads" yaml:"downloads"`
+	PerDay    float64 `json:"per_day" yaml:"per_day"`
+	// Last7Days and Previous7Days are downloads per day in the seven days
+	// before the latest snapshot and the seven days before that.
+	Last7Days     float64 `json:"last_7_days_per_day" yaml:"last_7_days_per_day"`
+	Previous7Days float64 `json:"previous_7_days_per_day" yaml:"previous_7_days_per_day"`
+	// WeekOverWeek compares Last7Days with Previous7Days; nil when there is
+	// not enough history.
+	WeekOverWeek *float64 `json:"week_over_week_percent" yaml:"week_over_week_percent"`
+}
+
+func summarizeTrend(points []Point) TrendSummary {
+	intervals := Intervals(points)
+	var s TrendSummary
+	if len(intervals) == 0 {
+		return s
+	}
+
+	first, last := intervals[0].Start, intervals[len(intervals)-1].End
+	var covered float64
+	s.Downloads, covered = downloadsBetween(intervals, first, last)
+	if covered > 0 {
+		s.PerDay = s.Downloads / covered
+	}
+
+	week := 7 * 24 * time.Hour
+	recent, recentDays := downloadsBetween(intervals, last.Add(-week), last)
+	prior, priorDays := downloadsBetween(intervals, last.Add(-2*week), last.Add(-week))
+	if recentDays > 0 {
+		s.Last7Days = recent / recentDays
+	}
+	if priorDays > 0 {
+		s.Previous7Days = prior / priorDays
+	}
+	// Only claim a week-over-week change when both weeks are mostly observed
+	if recentDays >= 3.5 && priorDays >= 3.5 && s.Previous7Days > 0 {
+		change := (s.Last7Days - s.Previous7Days) / s.Previous7Days * 100
+		s.WeekOverWeek = &change
+	}
+	return s
+}
+
+// TrendSeries is the trend of one repo, release or asset.
+type TrendSeries struct {
+	Series  `yaml:",inline"`
+	Summary TrendSummary  `json:"summary" yaml:"summary"`
+	Buckets []TrendBucket `json:"buckets" yaml:"buckets"`
+}
+
+// TrendOptions controls NewTrendReport.
+type TrendOptions struct {
+	Level  SeriesLevel
+	Period TrendPeriod
+	// Window is the number of buckets in the moving average.
+	Window int
+	// Top keeps the series with the most downloads in range when positive.
+	Top int
+}
+
+// TrendReport renders the trend command.
+type TrendReport struct {
+	Owner  string        `json:"owner" yaml:"owner"`
+	Repo   string        `json:"repo" yaml:"repo"`
+	Level  SeriesLevel   `json:"level" yaml:"level"`
+	Period TrendPeriod   `json:"period" yaml:"period"`
+	Window int           `json:"window" yaml:"window"`
+	Series []TrendSeries `json:"series" yaml:"series"`
+	Charts ChartStyle    `json:"-" yaml:"-"`
+}
+
+// SetChartStyle enables a sparkline of the daily rate of each series.
+func (r *TrendReport) SetChartStyle(s ChartStyle) {
+	r.Charts = s
+}
+
+// NewTrendReport derives download rates from successive snapshots.
+func NewTrendReport(owner, repo string, snapshots []ReleaseStats, opts TrendOptions) *TrendReport {
+	report := &TrendReport{
+		Owner:  owner,
+		Repo:   repo,
+		Level:  opts.Level,
+		Period: opts.Period,
+		Window: opts.Window,
+		Series: make([]TrendSeries, 0),
+	}
+
+	for _, s := range ExtractSeries(snapshots, opts.Level) {
+		report.Series = append(report.Series, TrendSeries{
+			Series:  s,
+			Summary: summarizeTrend(s.Points),
+			Buckets: Bucketize(s.Points, opts.Period, opts.Window),
+		})
+	}
+
+	sort.SliceStable(report.Series, func(i, j int) bool {
+		return report.Series[i].Summary.Downloads > report.Series[j].Summary.Downloads
+	})
+	if opts.Top > 0 && len(report.Series) > opts.Top {
+		report.Series = report.Series[:opts.Top]
+	}
+
+	return report
+}
+
+// WriteText writes a summary and bucket table per series.
+func (r *TrendReport) WriteText(out io.Writer) error {
+	fmt.Fprintf(out, "\nDownload Trend for %s/%s (per %s, %d-%s moving average)\n", r.Owner, r.Repo, r.Period, r.Window, r.Period)
+
+	for _, s := range r.Series {
+		fmt.Fprintf(out, "\n%s\n", s.Key)
+		fmt.Fprintf(out, "  %s downloads, %s/day", humanizeFloat(math.Round(s.Summary.Downloads)), humanizeFloat(roundTo(s.Summary.PerDay, 1)))
+		if s.Summary.WeekOverWeek != nil {
+			fmt.Fprintf(out, " | last 7 days %s/day, week over week %+.1f%%", humanizeFloat(roundTo(s.Summary.Last7Days, 1)), *s.Summary.WeekOverWeek)
+		}
+		fmt.Fprintln(out)
+
+		if r.Charts.Enabled() && len(s.Buckets) > 1 {
+			rates := make([]float64, len(s.Buckets))
+			for i, b := range s.Buckets {
+				rates[i] = b.PerDay
+			}
+			fmt.Fprintf(out, "  %s per day\n", Sparkline(rates, r.Charts.span(12, 8), r.Charts.ASCII))
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "  PERIOD\tDOWNLOADS\tPER DAY\tMOVING AVG\tCHANGE\t")
+		for _, b := range s.Buckets {
+			change := "-"
+			if b.ChangePercent != nil {
+				change = fmt.Sprintf("%+.1f%%", *b.ChangePercent)
+			}
+			fmt.Fprintf(w, "  %s\t%.0f\t%.1f\t%.1f\t%s\t\n", b.Start.Format("2006-01-02"), b.Downloads, b.PerDay, b.MovingAverage, change)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(out)
+	return err
+}
+
+// Table returns one row per series and bucket.
+func (r *TrendReport) Table() ([]string, [][]string) {
+	header := []string{"key", "tag", "asset", "period_start", "downloads", "per_day", "moving_average", "change_percent"}
+	rows := make([][]string, 0)
+	for _, s := range r.Series {
+		for _, b := range s.Buckets {
+			change := ""
+			if b.ChangePercent != nil {
+				change = strconv.FormatFloat(*b.ChangePercent, 'f', 2, 64)
+			}
+			rows = append(rows, []string{
+				s.Key, s.Tag, s.Asset,
+				b.Start.Format("2006-01-02"),
+				strconv.FormatFloat(b.Downloads, 'f', 2, 64),
+				strconv.FormatFloat(b.PerDay, 'f', 2, 64),
+				strconv.FormatFloat(b.MovingAverage, 'f', 2, 64),
+				change,
+			})
+		}
+	}
+	return header, rows
+}
+
+func roundTo(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIntervalsNormalizeIrregularSpacing(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Time: start, Value: 100},
+		{Time: start.AddDate(0, 0, 1), Value: 110},
+		{Time: start.AddDate(0, 0, 3), Value: 130},
+		{Time: start.AddDate(0, 0, 4), Value: 120}, // asset deleted
+	}
+
+	intervals := Intervals(points)
+
+	if len(intervals) != 3 {
+		t.Fatalf("expected 3 intervals, got %d", len(intervals))
+	}
+	if intervals[0].PerDay != 10 || intervals[1].PerDay != 10 {
+		t.Fatalf("expected 10/day for both intervals, got %v and %v", intervals[0].PerDay, intervals[1].PerDay)
+	}
+	if intervals[2].Downloads != 0 {
+		t.Fatalf("expected a decrease to count as 0, got %v", intervals[2].Downloads)
+	}
+}
+
+func TestBucketizeSplitsIntervalsAcrossPeriods(t *testing.T) {
+	// Sunday noon to Tuesday noon: half a day in one week, 1.5 days in the next
+	start := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	points := []Point{
+		{Time: start, Value: 0},
+		{Time: start.Add(48 * time.Hour), Value: 200},
+	}
+
+	buckets := Bucketize(points, PeriodWeek, 2)
+
+	if len(buckets) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(buckets))
+	}
+	if buckets[1].Start.Weekday() != time.Monday {
+		t.Fatalf("expected weeks to start on Monday, got %v", buckets[1].Start.Weekday())
+	}
+	if buckets[0].Downloads != 50 || buckets[1].Downloads != 150 {
+		t.Fatalf("expected 50/150 split, got %v/%v", buckets[0].Downloads, buckets[1].Downloads)
+	}
+	if buckets[0].PerDay != 100 || buckets[1].PerDay != 100 {
+		t.Fatalf("expected 100/day in both buckets, got %v/%v", buckets[0].PerDay, buckets[1].PerDay)
+	}
+	if buckets[1].ChangePercent == nil || *buckets[1].ChangePercent != 0 {
+		t.Fatalf("expected 0%% change, got %v", buckets[1].ChangePercent)
+	}
+}
+
+func TestNewTrendReportWeekOverWeek(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := make([]ReleaseStats, 0)
+	total := 0
+	for day := 0; day <= 14; day++ {
+		if day > 0 {
+			// 10/day in the first week, 20/day in the second
+			if day <= 7 {
+				total += 10
+			} else {
+				total += 20
+			}
+		}
+		snapshots = append(snapshots, ReleaseStats{
+			Owner:          "owner",
+			Repo:           "repo",
+			TotalDownloads: total,
+			FetchedAt:      start.AddDate(0, 0, day),
+		})
+	}
+
+	report := NewTrendReport("owner", "repo", snapshots, TrendOptions{Level: SeriesRepo, Period: PeriodDay, Window: 7})
+
+	if len(report.Series) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(report.Series))
+	}
+	summary := report.Series[0].Summary
+	if summary.Downloads != 210 {
+		t.Fatalf("expected 210 downloads, got %v", summary.Downloads)
+	}
+	if summary.WeekOverWeek == nil || math.Abs(*summary.WeekOverWeek-100) > 1e-9 {
+		t.Fatalf("expected +100%% week over week, got %v", summary.WeekOverWeek)
+	}
+	last := report.Series[0].Buckets[len(report.Series[0].Buckets)-1]
+	if last.MovingAverage != 20 {
+		t.Fatalf("expected a 7-day moving average of 20, got %v", last.MovingAverage)
+	}
+}